@@ -0,0 +1,534 @@
+package mongorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Pipeline builds an aggregation pipeline stage by stage. Pipelines are
+// created with MongoORM.Aggregate, or with NewPipeline for sub-pipelines
+// used in Facet.
+type Pipeline struct {
+	orm        *MongoORM
+	collection *mongo.Collection
+	model      interface{}
+	err        error
+	stages     mongo.Pipeline
+	// joins holds the models of the collections the pipeline may join
+	// while its operation is scoped or routed, by collection name: that of
+	// its model, those of its Joins and those given to Lookup.
+	joins map[string]reflect.Type
+}
+
+// Aggregate starts an aggregation pipeline on the collection selected with
+// Model. Conditions, joins, ordering, offset and limit accumulated on the
+// chain are applied as the leading $match, $lookup, $sort, $skip and $limit
+// stages, and soft deleted documents and those outside the model's default
+// scope are excluded unless the chain is Unscoped:
+//
+//	var totals []bson.M
+//	orm.Model(&Order{}).Where("status = ?", "paid").Aggregate().
+//		Group("$customer_id", bson.M{"total": bson.M{"$sum": "$amount"}}).
+//		Sort(bson.D{{Key: "total", Value: -1}}).
+//		All(&totals)
+func (orm *MongoORM) Aggregate() *Pipeline {
+	tx := orm.getInstance()
+	p := &Pipeline{orm: tx, collection: tx.Statement.Collection, model: tx.Statement.Model}
+	if tx.Statement.failed {
+		p.err = tx.Error
+	}
+	stages, err := tx.readPipeline(modelType(tx.Statement.Model), tx.Statement.Limit)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	p.stages = stages
+	p.joinable(tx, modelType(tx.Statement.Model))
+	tx.resetStatement()
+	return p
+}
+
+// joinable records the collections of t and of the associations given to
+// Joins as those the pipeline may join.
+func (p *Pipeline) joinable(tx *MongoORM, t reflect.Type) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return
+	}
+	p.joins = map[string]reflect.Type{tx.collectionName(t): t}
+	for _, name := range tx.Statement.Joins {
+		assoc, ok := tx.association(t, name)
+		if !ok {
+			continue
+		}
+		p.joins[tx.collectionName(assoc.target)] = assoc.target
+		if assoc.joinCollection != "" {
+			p.joins[assoc.joinCollection] = nil
+		}
+	}
+}
+
+// Sum stores the sum of field over the documents matching the accumulated
+// filter in dest, such as a *float64 or *int64. The collection is taken
+// from a preceding call to Model, and dest is left untouched when no
+// document matches:
+//
+//	var total float64
+//	orm.Model(&Order{}).Where("status = ?", "paid").Sum("Amount", &total)
+func (orm *MongoORM) Sum(field string, dest interface{}) *MongoORM {
+	return orm.accumulate("$sum", field, dest)
+}
+
+// Avg stores the average of field over the matching documents in dest, as
+// Sum does.
+func (orm *MongoORM) Avg(field string, dest interface{}) *MongoORM {
+	return orm.accumulate("$avg", field, dest)
+}
+
+// Min stores the smallest value of field among the matching documents in
+// dest, as Sum does.
+func (orm *MongoORM) Min(field string, dest interface{}) *MongoORM {
+	return orm.accumulate("$min", field, dest)
+}
+
+// Max stores the largest value of field among the matching documents in
+// dest, as Sum does.
+func (orm *MongoORM) Max(field string, dest interface{}) *MongoORM {
+	return orm.accumulate("$max", field, dest)
+}
+
+// accumulate groups the documents read by the chain into one with the
+// accumulator operator applied to field, and decodes the result into dest.
+func (orm *MongoORM) accumulate(operator, field string, dest interface{}) *MongoORM {
+	return orm.execute(opQuery, dest, func(tx *MongoORM) {
+		collection := tx.Statement.Collection
+		if collection == nil {
+			tx.Error = ErrMissingModel
+			return
+		}
+
+		ctx, cancel := tx.operationContext()
+		defer cancel()
+
+		t := modelType(tx.Statement.Model)
+		pipeline, err := tx.readPipeline(t, tx.Statement.Limit)
+		if err != nil {
+			tx.Error = err
+			return
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "value", Value: bson.D{{Key: operator, Value: "$" + tx.documentKey(t, field)}}},
+		}}})
+		tx.Statement.record(collection, "aggregate", pipeline)
+		if tx.Statement.DryRun {
+			return
+		}
+		cursor, err := collection.Aggregate(ctx, pipeline, tx.aggregateOptions())
+		if err != nil {
+			tx.Error = translateError(err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		if !cursor.Next(ctx) {
+			tx.Error = translateError(cursor.Err())
+			return
+		}
+		value := cursor.Current.Lookup("value")
+		if value.Type == bson.TypeNull {
+			return
+		}
+		tx.Error = value.Unmarshal(dest)
+	})
+}
+
+// NewPipeline returns an empty pipeline that is not bound to a collection,
+// for use as a Facet sub-pipeline.
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Stage appends a raw stage to the pipeline.
+func (p *Pipeline) Stage(stage bson.D) *Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// Match appends a $match stage.
+func (p *Pipeline) Match(filter interface{}) *Pipeline {
+	return p.Stage(bson.D{{Key: "$match", Value: filter}})
+}
+
+// Group appends a $group stage grouping by id, with accumulators given in
+// fields, e.g. bson.M{"count": bson.M{"$sum": 1}}.
+func (p *Pipeline) Group(id interface{}, fields bson.M) *Pipeline {
+	group := bson.D{{Key: "_id", Value: id}}
+	for name, accumulator := range fields {
+		group = append(group, bson.E{Key: name, Value: accumulator})
+	}
+	return p.Stage(bson.D{{Key: "$group", Value: group}})
+}
+
+// Project appends a $project stage.
+func (p *Pipeline) Project(projection interface{}) *Pipeline {
+	return p.Stage(bson.D{{Key: "$project", Value: projection}})
+}
+
+// Lookup appends a $lookup stage joining documents of the from collection
+// whose foreignField equals localField into the array field as. from is
+// the name of a collection or a model, whose collection is joined:
+//
+//	orm.Model(&Order{}).Aggregate().Lookup(&Customer{}, "customer_id", "_id", "customer")
+//
+// Operations scoped or routed by callbacks, such as those of tenants,
+// join models as they read them, and fail with ErrUnscopedJoin on
+// collections given by name that are not those of the pipeline's model
+// or of its Joins. Models can only be joined by pipelines started with
+// Aggregate.
+func (p *Pipeline) Lookup(from interface{}, localField, foreignField, as string) *Pipeline {
+	name, ok := from.(string)
+	if !ok {
+		t := modelType(from)
+		if p.orm == nil || t == nil || t.Kind() != reflect.Struct {
+			if p.err == nil {
+				p.err = fmt.Errorf("lookup of %T: not a model of a pipeline started with Aggregate", from)
+			}
+			return p
+		}
+		name = p.orm.collectionName(t)
+		if p.joins == nil {
+			p.joins = map[string]reflect.Type{}
+		}
+		p.joins[name] = t
+	}
+	return p.Stage(bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: name},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	}}})
+}
+
+// Unwind appends an $unwind stage for the array at path. When
+// preserveNullAndEmpty is true, documents without elements are kept.
+func (p *Pipeline) Unwind(path string, preserveNullAndEmpty ...bool) *Pipeline {
+	if path != "" && path[0] != '$' {
+		path = "$" + path
+	}
+	unwind := bson.D{{Key: "path", Value: path}}
+	if len(preserveNullAndEmpty) > 0 && preserveNullAndEmpty[0] {
+		unwind = append(unwind, bson.E{Key: "preserveNullAndEmptyArrays", Value: true})
+	}
+	return p.Stage(bson.D{{Key: "$unwind", Value: unwind}})
+}
+
+// Sort appends a $sort stage.
+func (p *Pipeline) Sort(sort bson.D) *Pipeline {
+	return p.Stage(bson.D{{Key: "$sort", Value: sort}})
+}
+
+// Skip appends a $skip stage.
+func (p *Pipeline) Skip(n int64) *Pipeline {
+	return p.Stage(bson.D{{Key: "$skip", Value: n}})
+}
+
+// Limit appends a $limit stage.
+func (p *Pipeline) Limit(n int64) *Pipeline {
+	return p.Stage(bson.D{{Key: "$limit", Value: n}})
+}
+
+// Facet appends a $facet stage running each named sub-pipeline over the
+// same input documents.
+func (p *Pipeline) Facet(facets map[string]*Pipeline) *Pipeline {
+	facet := bson.D{}
+	for name, sub := range facets {
+		facet = append(facet, bson.E{Key: name, Value: sub.Stages()})
+		if sub.err != nil && p.err == nil {
+			p.err = sub.err
+		}
+	}
+	return p.Stage(bson.D{{Key: "$facet", Value: facet}})
+}
+
+// Stages returns the stages built so far.
+func (p *Pipeline) Stages() mongo.Pipeline {
+	if p.stages == nil {
+		return mongo.Pipeline{}
+	}
+	return p.stages
+}
+
+// All runs the pipeline and decodes every result into results, which must be
+// a pointer to a slice of structs or maps.
+func (p *Pipeline) All(results interface{}) *MongoORM {
+	if !p.bound() {
+		return p.orm
+	}
+	return p.orm.execute(opQuery, results, func(tx *MongoORM) {
+		ctx, cancel := tx.operationContext()
+		defer cancel()
+
+		cursor, ok := p.run(ctx)
+		if !ok {
+			return
+		}
+		tx.Error = translateError(cursor.All(ctx, results))
+	})
+}
+
+// One runs the pipeline and decodes the first result into result. If the
+// pipeline yields no documents, Error is set to ErrRecordNotFound.
+func (p *Pipeline) One(result interface{}) *MongoORM {
+	if !p.bound() {
+		return p.orm
+	}
+	return p.orm.execute(opQuery, result, func(tx *MongoORM) {
+		ctx, cancel := tx.operationContext()
+		defer cancel()
+
+		cursor, ok := p.run(ctx)
+		if !ok {
+			return
+		}
+		defer cursor.Close(ctx)
+
+		if !cursor.Next(ctx) {
+			tx.Error = cursor.Err()
+			if tx.Error == nil {
+				tx.Error = ErrRecordNotFound
+			}
+			return
+		}
+		tx.Error = translateError(cursor.Decode(result))
+	})
+}
+
+// bound reports whether the pipeline can be run and, if so, restores the
+// collection, model and chain error captured by Aggregate. Pipelines
+// created with NewPipeline are not bound to a collection and cannot be run
+// on their own.
+func (p *Pipeline) bound() bool {
+	if p.orm == nil {
+		p.orm = &MongoORM{Error: errors.New("pipeline is not bound to a collection")}
+		return false
+	}
+	p.orm.Statement.Collection = p.collection
+	p.orm.Statement.Model = p.model
+	p.orm.AddError(p.err)
+	return true
+}
+
+// run executes the pipeline, behind a $match stage for the statement's
+// Scope when callbacks set one. The $match follows a leading $search or
+// $vectorSearch stage, which has to come first.
+func (p *Pipeline) run(ctx context.Context) (*mongo.Cursor, bool) {
+	if p.orm.Statement.Collection == nil {
+		p.orm.Error = ErrMissingModel
+		return nil, false
+	}
+
+	stages, err := p.scopeJoins(p.Stages())
+	if err != nil {
+		p.orm.Error = err
+		return nil, false
+	}
+	if scope := p.orm.statementScope(modelType(p.model)); len(scope) > 0 {
+		first := 0
+		if len(stages) > 0 && len(stages[0]) > 0 {
+			switch stages[0][0].Key {
+			case "$search", "$vectorSearch":
+				first = 1
+			}
+		}
+		match := bson.D{{Key: "$match", Value: scope}}
+		stages = append(append(append(mongo.Pipeline{}, stages[:first]...), match), stages[first:]...)
+	}
+	p.orm.Statement.record(p.orm.Statement.Collection, "aggregate", stages)
+	if p.orm.Statement.DryRun {
+		return nil, false
+	}
+	cursor, err := p.orm.Statement.Collection.Aggregate(ctx, stages, p.orm.aggregateOptions())
+	if err != nil {
+		p.orm.Error = translateError(err)
+		return nil, false
+	}
+	return cursor, true
+}
+
+// scopeJoins returns stages with the collections they join with $lookup,
+// $graphLookup and $unionWith routed and narrowed by the statement's Scope,
+// as the collection of the pipeline is, when callbacks set them. Joins of
+// collections the pipeline does not know the model of fail with
+// ErrUnscopedJoin then.
+func (p *Pipeline) scopeJoins(stages mongo.Pipeline) (mongo.Pipeline, error) {
+	stmt := p.orm.Statement
+	if stmt.Scope == nil && stmt.CollectionPrefix == "" {
+		return stages, nil
+	}
+
+	scoped := make(mongo.Pipeline, 0, len(stages))
+	for _, stage := range stages {
+		if len(stage) != 1 {
+			scoped = append(scoped, stage)
+			continue
+		}
+		key, value := stage[0].Key, stage[0].Value
+		switch key {
+		case "$lookup", "$graphLookup", "$unionWith":
+			spec, err := p.scopeJoin(key, value)
+			if err != nil {
+				return nil, err
+			}
+			stage = bson.D{{Key: key, Value: spec}}
+		case "$facet":
+			facets, err := toStageDocument(value)
+			if err != nil {
+				return nil, err
+			}
+			for i, facet := range facets {
+				sub, err := toStages(facet.Value)
+				if err != nil {
+					return nil, err
+				}
+				if facets[i].Value, err = p.scopeJoins(sub); err != nil {
+					return nil, err
+				}
+			}
+			stage = bson.D{{Key: key, Value: facets}}
+		}
+		scoped = append(scoped, stage)
+	}
+	return scoped, nil
+}
+
+// scopeJoin returns the specification of a $lookup, $graphLookup or
+// $unionWith stage, with the collection it joins routed and narrowed by the
+// statement's Scope.
+func (p *Pipeline) scopeJoin(stage string, value interface{}) (bson.D, error) {
+	field := "from"
+	if stage == "$unionWith" {
+		field = "coll"
+		if name, ok := value.(string); ok {
+			value = bson.D{{Key: field, Value: name}}
+		}
+	}
+	spec, err := toStageDocument(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var t reflect.Type
+	for i, e := range spec {
+		if e.Key != field {
+			continue
+		}
+		name, _ := e.Value.(string)
+		model, ok := p.joins[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s of %q", ErrUnscopedJoin, stage, e.Value)
+		}
+		t = model
+		spec[i].Value = p.orm.Statement.CollectionPrefix + name
+	}
+	scope := p.orm.statementScope(t)
+
+	if stage == "$graphLookup" {
+		if len(scope) == 0 {
+			return spec, nil
+		}
+		for i, e := range spec {
+			if e.Key == "restrictSearchWithMatch" {
+				restrict, err := toDocument(e.Value)
+				if err != nil {
+					return nil, err
+				}
+				spec[i].Value = mergeConditions(restrict, scope)
+				return spec, nil
+			}
+		}
+		return append(spec, bson.E{Key: "restrictSearchWithMatch", Value: scope}), nil
+	}
+
+	var pipeline mongo.Pipeline
+	if len(scope) > 0 {
+		pipeline = mongo.Pipeline{{{Key: "$match", Value: scope}}}
+	}
+	for i, e := range spec {
+		if e.Key != "pipeline" {
+			continue
+		}
+		sub, err := toStages(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		if sub, err = p.scopeJoins(sub); err != nil {
+			return nil, err
+		}
+		spec[i].Value = append(pipeline, sub...)
+		return spec, nil
+	}
+	if len(pipeline) > 0 {
+		spec = append(spec, bson.E{Key: "pipeline", Value: pipeline})
+	}
+	return spec, nil
+}
+
+// toStageDocument returns v, a document of a stage, as a bson.D.
+func toStageDocument(v interface{}) (bson.D, error) {
+	if d, ok := v.(bson.D); ok {
+		return append(bson.D(nil), d...), nil
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	err = bson.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// toStages returns v, the stages of a sub-pipeline, as a mongo.Pipeline.
+func toStages(v interface{}) (mongo.Pipeline, error) {
+	if stages, ok := v.(mongo.Pipeline); ok {
+		return stages, nil
+	}
+	_, data, err := bson.MarshalValue(v)
+	if err != nil {
+		return nil, err
+	}
+	values, err := bson.Raw(data).Values()
+	if err != nil {
+		return nil, err
+	}
+	stages := make(mongo.Pipeline, 0, len(values))
+	for _, value := range values {
+		doc, ok := value.DocumentOK()
+		if !ok {
+			return nil, fmt.Errorf("stage of type %s is not a document", value.Type)
+		}
+		stage, err := toStageDocument(doc)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// aggregateOptions translates the chained state into options for
+// aggregations.
+func (orm *MongoORM) aggregateOptions() *options.AggregateOptions {
+	opts := options.Aggregate()
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	if orm.Statement.Hint != nil {
+		opts.SetHint(orm.Statement.Hint)
+	}
+	return opts
+}
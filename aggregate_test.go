@@ -0,0 +1,194 @@
+package mongorm_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type sale struct {
+	mongorm.OrmModel `bson:",inline"`
+	Region           string `bson:"region"`
+	Amount           int    `bson:"amount"`
+}
+
+func newSales(t *testing.T) *mongorm.MongoORM {
+	t.Helper()
+	orm := mongormtest.New()
+	for _, s := range []sale{{Region: "east", Amount: 10}, {Region: "east", Amount: 30}, {Region: "west", Amount: 5}, {Region: "north", Amount: 7}} {
+		s := s
+		if err := orm.Create(&s).Error; err != nil {
+			t.Fatal(err)
+		}
+		if s.Region == "north" {
+			if err := orm.Delete(&s).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return orm
+}
+
+func TestPipelineStages(t *testing.T) {
+	sub := mongorm.NewPipeline().Match(bson.M{"a": 1})
+	tests := []struct {
+		name string
+		p    *mongorm.Pipeline
+		want mongo.Pipeline
+	}{
+		{
+			"group",
+			mongorm.NewPipeline().Group("$region", bson.M{"total": bson.M{"$sum": "$amount"}}),
+			mongo.Pipeline{{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$region"}, {Key: "total", Value: bson.M{"$sum": "$amount"}}}}}},
+		},
+		{
+			"unwind",
+			mongorm.NewPipeline().Unwind("items").Unwind("$tags", true),
+			mongo.Pipeline{
+				{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$items"}}}},
+				{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$tags"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+			},
+		},
+		{
+			"window",
+			mongorm.NewPipeline().Sort(bson.D{{Key: "a", Value: -1}}).Skip(2).Limit(3).Project(bson.M{"a": 1}),
+			mongo.Pipeline{
+				{{Key: "$sort", Value: bson.D{{Key: "a", Value: -1}}}},
+				{{Key: "$skip", Value: int64(2)}},
+				{{Key: "$limit", Value: int64(3)}},
+				{{Key: "$project", Value: bson.M{"a": 1}}},
+			},
+		},
+		{
+			"lookup",
+			mongorm.NewPipeline().Lookup("customers", "customer_id", "_id", "customer"),
+			mongo.Pipeline{{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "customers"},
+				{Key: "localField", Value: "customer_id"},
+				{Key: "foreignField", Value: "_id"},
+				{Key: "as", Value: "customer"},
+			}}}},
+		},
+		{
+			"facet",
+			mongorm.NewPipeline().Facet(map[string]*mongorm.Pipeline{"matched": sub}),
+			mongo.Pipeline{{{Key: "$facet", Value: bson.D{{Key: "matched", Value: mongo.Pipeline{{{Key: "$match", Value: bson.M{"a": 1}}}}}}}}},
+		},
+		{"empty", mongorm.NewPipeline(), mongo.Pipeline{}},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Stages(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: stages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAggregateStartsWithChain(t *testing.T) {
+	orm := newSales(t)
+	p := orm.Model(&sale{}).Where("region = ?", "east").Order("amount desc").Offset(1).Limit(5).Aggregate()
+	want := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"region": "east", "date_deleted": nil}}},
+		{{Key: "$sort", Value: bson.D{{Key: "amount", Value: -1}}}},
+		{{Key: "$skip", Value: int64(1)}},
+		{{Key: "$limit", Value: int64(5)}},
+	}
+	if got := p.Stages(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stages = %v, want %v", got, want)
+	}
+
+	var results []sale
+	if err := p.All(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Amount != 10 {
+		t.Fatalf("results = %+v, want the east sale of 10", results)
+	}
+}
+
+func TestAggregateRunsPipeline(t *testing.T) {
+	orm := newSales(t)
+	var totals []struct {
+		Region string `bson:"_id"`
+		Total  int    `bson:"total"`
+	}
+	err := orm.Model(&sale{}).Aggregate().
+		Group("$region", bson.M{"total": bson.M{"$sum": "$amount"}}).
+		Sort(bson.D{{Key: "total", Value: -1}}).
+		All(&totals).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 2 || totals[0].Region != "east" || totals[0].Total != 40 || totals[1].Region != "west" {
+		t.Fatalf("totals = %+v, want east with 40 then west, without deleted sales", totals)
+	}
+
+	var unscoped []bson.M
+	if err := orm.Model(&sale{}).Unscoped().Aggregate().All(&unscoped).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(unscoped) != 4 {
+		t.Fatalf("unscoped results = %d, want 4", len(unscoped))
+	}
+
+	var top sale
+	if err := orm.Model(&sale{}).Aggregate().Sort(bson.D{{Key: "amount", Value: -1}}).One(&top).Error; err != nil {
+		t.Fatal(err)
+	}
+	if top.Amount != 30 {
+		t.Fatalf("top sale = %+v, want 30", top)
+	}
+	err = orm.Model(&sale{}).Aggregate().Match(bson.M{"region": "south"}).One(&top).Error
+	if !errors.Is(err, mongorm.ErrRecordNotFound) {
+		t.Fatalf("One without results error = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestAggregateFailures(t *testing.T) {
+	orm := newSales(t)
+	var results []bson.M
+	if err := mongorm.NewPipeline().All(&results).Error; err == nil {
+		t.Fatal("running an unbound pipeline succeeded")
+	}
+	if err := orm.Model(&sale{}).Where("region").Aggregate().All(&results).Error; !errors.Is(err, mongorm.ErrInvalidCondition) {
+		t.Fatalf("error of a failed chain = %v, want ErrInvalidCondition", err)
+	}
+	if err := orm.Aggregate().All(&results).Error; !errors.Is(err, mongorm.ErrMissingModel) {
+		t.Fatalf("error without model = %v, want ErrMissingModel", err)
+	}
+	err := orm.Model(&sale{}).Aggregate().Lookup(primitive.NewObjectID(), "a", "b", "c").All(&results).Error
+	if err == nil {
+		t.Fatal("lookup of a value that is not a model succeeded")
+	}
+}
+
+func TestAccumulators(t *testing.T) {
+	orm := newSales(t)
+	tests := []struct {
+		name string
+		run  func(dest *int) *mongorm.MongoORM
+		want int
+	}{
+		{"Sum", func(dest *int) *mongorm.MongoORM { return orm.Model(&sale{}).Sum("Amount", dest) }, 45},
+		{"Avg", func(dest *int) *mongorm.MongoORM { return orm.Model(&sale{}).Avg("amount", dest) }, 15},
+		{"Min", func(dest *int) *mongorm.MongoORM { return orm.Model(&sale{}).Min("amount", dest) }, 5},
+		{"Max", func(dest *int) *mongorm.MongoORM {
+			return orm.Model(&sale{}).Where("region = ?", "west").Max("amount", dest)
+		}, 5},
+	}
+	for _, tt := range tests {
+		var got int
+		if err := tt.run(&got).Error; err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,764 @@
+package mongorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// association describes an association field of a model.
+type association struct {
+	// field is the association field.
+	field reflect.StructField
+	// target is the struct type of the associated documents.
+	target reflect.Type
+	// many is set for slice fields. Unless manyToMany is set too, they hold
+	// the documents that refer to the model; other fields hold the document
+	// the model refers to.
+	many bool
+	// manyToMany is set for slice fields declared with a many2many tag,
+	// which hold documents the model is associated with in either
+	// direction.
+	manyToMany bool
+	// joinCollection holds, for many-to-many associations declared with a
+	// collection name, one document per associated pair, referring to the
+	// model under joinForeignKey and to the target under joinReferences.
+	joinCollection string
+	joinForeignKey string
+	joinReferences string
+	// foreignKey is the field holding the reference: a field of target for
+	// slice fields, of the model otherwise. Many-to-many associations
+	// without a join collection refer to their targets with an array of
+	// ObjectIDs in the model.
+	foreignKey reflect.StructField
+}
+
+// association resolves the association name of the model type t, declared
+// as described for Preload.
+func (orm *MongoORM) association(t reflect.Type, name string) (association, bool) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return association{}, false
+	}
+	s := orm.schema(t)
+	if lookup, ok := s.named.Load(name); ok {
+		return lookup.(associationLookup).assoc, lookup.(associationLookup).ok
+	}
+	assoc, ok, _ := orm.parseAssociation(t, name)
+	s.named.Store(name, associationLookup{assoc: assoc, ok: ok})
+	return assoc, ok
+}
+
+// missingAssociation returns the error for name, which is not a valid
+// association of the model type t.
+func (orm *MongoORM) missingAssociation(t reflect.Type, name string) error {
+	if _, _, err := orm.parseAssociation(t, name); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %v has no association %q", ErrInvalidAssociation, t, name)
+}
+
+// parseAssociation is the uncached association. It fails when the field
+// declares an association with its tag but the declaration is invalid.
+func (orm *MongoORM) parseAssociation(t reflect.Type, name string) (association, bool, error) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return association{}, false, nil
+	}
+	field, found := t.FieldByName(name)
+	if !found {
+		return association{}, false, nil
+	}
+	settings := fieldSettings(field)
+	_, hasMany := settings["hasmany"]
+	_, belongsTo := settings["belongsto"]
+	joinCollection, manyToMany := settings["many2many"]
+	invalid := func(format string, args ...interface{}) (association, bool, error) {
+		return association{}, false, fmt.Errorf("%w: %v.%s: %s", ErrInvalidAssociation, t, field.Name, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case hasMany && belongsTo, hasMany && manyToMany, belongsTo && manyToMany:
+		return invalid("hasMany, belongsTo and many2many exclude each other")
+	case (hasMany || manyToMany) && (field.Type.Kind() != reflect.Slice || indirectType(field.Type.Elem()).Kind() != reflect.Struct):
+		return invalid("hasMany and many2many require a slice of structs, got %v", field.Type)
+	case belongsTo && (field.Type.Kind() != reflect.Ptr || field.Type.Elem().Kind() != reflect.Struct):
+		return invalid("belongsTo requires a pointer to a struct, got %v", field.Type)
+	}
+
+	switch field.Type.Kind() {
+	case reflect.Slice:
+		target := indirectType(field.Type.Elem())
+		if target.Kind() != reflect.Struct {
+			return association{}, false, nil
+		}
+		if manyToMany {
+			assoc := association{field: field, target: target, many: true, manyToMany: true}
+			if joinCollection == "" {
+				foreignKey, found := t.FieldByName(settings["foreignkey"])
+				if !found {
+					return invalid("many2many without a join collection requires the foreignKey of an ObjectID array")
+				}
+				if elem := foreignKey.Type; elem.Kind() != reflect.Slice || indirectType(elem.Elem()) != objectIDType {
+					return invalid("foreign key %s must be an ObjectID array, got %v", foreignKey.Name, elem)
+				}
+				assoc.foreignKey = foreignKey
+				return assoc, true, nil
+			}
+			assoc.joinCollection = joinCollection
+			assoc.joinForeignKey = settings["joinforeignkey"]
+			if assoc.joinForeignKey == "" {
+				assoc.joinForeignKey = toSnakeCase(t.Name()) + "_id"
+			}
+			assoc.joinReferences = settings["joinreferences"]
+			if assoc.joinReferences == "" {
+				assoc.joinReferences = toSnakeCase(target.Name()) + "_id"
+			}
+			return assoc, true, nil
+		}
+
+		if hasMany {
+			refFieldName := settings["foreignkey"]
+			if refFieldName == "" {
+				return invalid("hasMany requires the foreignKey of %v referring to %v", target, t)
+			}
+			foreignKey, found := target.FieldByName(refFieldName)
+			if !found {
+				return invalid("foreign key %s is not a field of %v", refFieldName, target)
+			}
+			if indirectType(foreignKey.Type) != objectIDType {
+				return invalid("foreign key %v.%s must be an ObjectID, got %v", target, foreignKey.Name, foreignKey.Type)
+			}
+			return association{field: field, target: target, many: true, foreignKey: foreignKey}, true, nil
+		}
+
+		// Without hasMany, the association is that declared by the
+		// belongsTo field of target named after t, whose schema reports
+		// its errors.
+		refField, found := target.FieldByName(t.Name())
+		if !found {
+			return association{}, false, nil
+		}
+		refFieldName, found := fieldSettings(refField)["foreignkey"]
+		if !found {
+			return association{}, false, nil
+		}
+		foreignKey, found := target.FieldByName(refFieldName)
+		if !found || indirectType(foreignKey.Type) != objectIDType {
+			return association{}, false, nil
+		}
+		return association{field: field, target: target, many: true, foreignKey: foreignKey}, true, nil
+	case reflect.Ptr:
+		target := field.Type.Elem()
+		if target.Kind() != reflect.Struct {
+			return association{}, false, nil
+		}
+		fieldIdName, found := settings["foreignkey"]
+		if !found {
+			if belongsTo {
+				return invalid("belongsTo requires the foreignKey of %v referring to %v", t, target)
+			}
+			return association{}, false, nil
+		}
+		foreignKey, found := t.FieldByName(fieldIdName)
+		if !found {
+			return invalid("foreign key %s is not a field of %v", fieldIdName, t)
+		}
+		if indirectType(foreignKey.Type) != objectIDType {
+			return invalid("foreign key %s must be an ObjectID, got %v", foreignKey.Name, foreignKey.Type)
+		}
+		return association{field: field, target: target, foreignKey: foreignKey}, true, nil
+	}
+	return association{}, false, nil
+}
+
+// manyToManyAssociations returns the many-to-many associations of the model
+// type t.
+func (orm *MongoORM) manyToManyAssociations(t reflect.Type) []association {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var assocs []association
+	for _, assoc := range orm.schema(t).associations {
+		if assoc.manyToMany {
+			assocs = append(assocs, assoc)
+		}
+	}
+	return assocs
+}
+
+// targetIDs returns the IDs of the documents held by the association field
+// of doc, a struct value, skipping those without one.
+func targetIDs(doc reflect.Value, assoc association) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	targets := doc.FieldByIndex(assoc.field.Index)
+	for i := 0; i < targets.Len(); i++ {
+		if target, ok := structValue(targets.Index(i)); ok {
+			if id, err := documentID(target.Addr().Interface()); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// setReferenceArrays sets the ObjectID arrays of the many-to-many
+// associations of doc declared without a join collection to the IDs of the
+// documents held by the association fields, when those are not nil, so
+// that writing doc stores the associations.
+func (orm *MongoORM) setReferenceArrays(doc interface{}) {
+	docVal, ok := structValue(reflect.ValueOf(doc))
+	if !ok || !docVal.CanAddr() {
+		return
+	}
+	for _, assoc := range orm.manyToManyAssociations(docVal.Type()) {
+		if assoc.joinCollection != "" || docVal.FieldByIndex(assoc.field.Index).IsNil() {
+			continue
+		}
+		array := docVal.FieldByIndex(assoc.foreignKey.Index)
+		ids := targetIDs(docVal, assoc)
+		refs := reflect.MakeSlice(array.Type(), 0, len(ids))
+		for _, id := range ids {
+			ref := reflect.ValueOf(id)
+			if array.Type().Elem().Kind() == reflect.Ptr {
+				ref = reflect.New(ref.Type())
+				ref.Elem().Set(reflect.ValueOf(id))
+			}
+			refs = reflect.Append(refs, ref)
+		}
+		array.Set(refs)
+	}
+}
+
+// saveJoinDocuments inserts into the join collections of the many-to-many
+// associations of doc the documents associating doc with each document held
+// by the association fields, unless they already exist.
+func (orm *MongoORM) saveJoinDocuments(ctx context.Context, doc interface{}) error {
+	docVal, ok := structValue(reflect.ValueOf(doc))
+	if !ok || !docVal.CanAddr() {
+		return nil
+	}
+	id, err := documentID(doc)
+	if err != nil {
+		return nil
+	}
+	for _, assoc := range orm.manyToManyAssociations(docVal.Type()) {
+		if assoc.joinCollection == "" {
+			continue
+		}
+		if err := orm.insertJoinDocuments(ctx, assoc, id, targetIDs(docVal, assoc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertJoinDocuments upserts the join documents associating the document
+// id with each of targets.
+func (orm *MongoORM) insertJoinDocuments(ctx context.Context, assoc association, id primitive.ObjectID, targets []primitive.ObjectID) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(targets))
+	for _, target := range targets {
+		pair := bson.M{assoc.joinForeignKey: id, assoc.joinReferences: target}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(pair).
+			SetUpdate(bson.M{"$set": pair}).
+			SetUpsert(true))
+	}
+	_, err := orm.collection(assoc.joinCollection).BulkWrite(ctx, models)
+	return err
+}
+
+// Association manages the documents associated with a model through one of
+// its association fields, keeping the references in the database and the
+// field of the model in step. It is returned by MongoORM.Association.
+type Association struct {
+	orm   *MongoORM
+	model reflect.Value
+	id    primitive.ObjectID
+	assoc association
+	// Error holds the error of resolving the association or of the first
+	// failing method, which later methods return without doing anything.
+	Error error
+}
+
+// Association returns the association name, declared as described for
+// Preload, of the model given to Model, which must have an ID:
+//
+//	orm.Model(&user).Association("Orders").Append(&order)
+//	n := orm.Model(&user).Association("Roles").Count()
+//
+// Documents given to Append and Replace are created first if they have no
+// ID. Removing documents from a slice association unsets their foreign key
+// or deletes the join documents; the documents themselves are kept.
+func (orm *MongoORM) Association(name string) *Association {
+	tx := orm.getInstance()
+	a := &Association{orm: tx, Error: tx.Error}
+	if a.Error != nil {
+		return a
+	}
+
+	model, ok := structValue(reflect.ValueOf(tx.Statement.Model))
+	if !ok || !model.CanAddr() {
+		a.Error = ErrMissingModel
+		return a
+	}
+	assoc, ok := tx.association(model.Type(), name)
+	if !ok {
+		a.Error = tx.missingAssociation(model.Type(), name)
+		return a
+	}
+	id, err := documentID(model.Addr().Interface())
+	if err != nil {
+		a.Error = err
+		return a
+	}
+	a.model, a.assoc, a.id = model, assoc, id
+	return a
+}
+
+// Append associates values, documents or slices of documents of the
+// association's type, with the model. A pointer association is set to the
+// single value given.
+func (a *Association) Append(values ...interface{}) error {
+	if a.Error != nil {
+		return a.Error
+	}
+	a.Error = a.append(values, false)
+	return a.Error
+}
+
+// Replace associates values with the model in place of the documents
+// currently associated.
+func (a *Association) Replace(values ...interface{}) error {
+	if a.Error != nil {
+		return a.Error
+	}
+	a.Error = a.append(values, true)
+	return a.Error
+}
+
+// Delete removes the association between the model and values.
+func (a *Association) Delete(values ...interface{}) error {
+	if a.Error != nil {
+		return a.Error
+	}
+	docs, err := a.values(values)
+	if err != nil {
+		a.Error = err
+		return err
+	}
+	a.Error = a.remove(docIDs(docs))
+	return a.Error
+}
+
+// Clear removes every association between the model and documents of the
+// association.
+func (a *Association) Clear() error {
+	if a.Error != nil {
+		return a.Error
+	}
+	a.Error = a.remove(nil)
+	return a.Error
+}
+
+// Count returns the number of documents associated with the model,
+// excluding soft deleted ones and those outside the default scope of their
+// model unless the chain is Unscoped.
+func (a *Association) Count() int64 {
+	if a.Error != nil {
+		return 0
+	}
+	if a.orm.Statement.DryRun || a.orm.dryRun {
+		return 0
+	}
+
+	ctx, cancel := a.orm.operationContext()
+	defer cancel()
+
+	targets := a.orm.collection(a.orm.collectionName(a.assoc.target))
+	var filter bson.M
+	switch {
+	case a.assoc.manyToMany:
+		collection, key, cond := a.orm.Statement.Collection, a.fieldKey(), bson.M{"_id": a.id}
+		if a.assoc.joinCollection != "" {
+			collection, key, cond = a.orm.collection(a.assoc.joinCollection), a.assoc.joinReferences, bson.M{a.assoc.joinForeignKey: a.id}
+		}
+		refs, err := collection.Distinct(ctx, key, cond)
+		if err != nil {
+			a.Error = translateError(err)
+			return 0
+		}
+		filter = bson.M{"_id": bson.M{"$in": refs}}
+	case a.assoc.many:
+		filter = bson.M{a.orm.fieldName(a.assoc.foreignKey): a.id}
+	default:
+		ref, ok := objectIDValue(a.model.FieldByIndex(a.assoc.foreignKey.Index))
+		if !ok {
+			return 0
+		}
+		filter = bson.M{"_id": ref}
+	}
+
+	count, err := targets.CountDocuments(ctx, mergeConditions(filter, a.orm.modelScope(a.assoc.target)))
+	a.Error = translateError(err)
+	return count
+}
+
+// fieldKey returns the document key of the model's foreign key field.
+func (a *Association) fieldKey() string {
+	return a.orm.fieldName(a.assoc.foreignKey)
+}
+
+// values returns the documents given to an Association method as struct
+// values of the association's type that can be modified.
+func (a *Association) values(values []interface{}) ([]reflect.Value, error) {
+	var docs []reflect.Value
+	add := func(v reflect.Value) error {
+		doc, ok := structValue(v)
+		if !ok || doc.Type() != a.assoc.target {
+			return fmt.Errorf("%w: %s holds %v, got %v", ErrInvalidAssociation, a.assoc.field.Name, a.assoc.target, v.Type())
+		}
+		if !doc.CanAddr() {
+			copied := reflect.New(doc.Type()).Elem()
+			copied.Set(doc)
+			doc = copied
+		}
+		docs = append(docs, doc)
+		return nil
+	}
+
+	for _, value := range values {
+		v := reflect.ValueOf(value)
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Slice {
+			if err := add(v); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := add(v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return docs, nil
+}
+
+// append associates values with the model, in place of the documents
+// currently associated when replace is set.
+func (a *Association) append(values []interface{}, replace bool) error {
+	docs, err := a.values(values)
+	if err != nil {
+		return err
+	}
+	if !a.assoc.many && len(docs) != 1 {
+		return fmt.Errorf("%w: %s holds a single document, got %d", ErrInvalidAssociation, a.assoc.field.Name, len(docs))
+	}
+	if a.orm.Statement.DryRun || a.orm.dryRun {
+		return nil
+	}
+
+	// Documents referring to the model get their foreign key before they
+	// are created, so that it is stored with them.
+	hasMany := a.assoc.many && !a.assoc.manyToMany
+	if hasMany {
+		for _, doc := range docs {
+			setReference(doc.FieldByIndex(a.assoc.foreignKey.Index), a.id)
+		}
+	}
+	for _, doc := range docs {
+		if _, err := documentID(doc.Addr().Interface()); err == nil {
+			continue
+		}
+		create := a.orm.newInstance()
+		create.ctx = a.orm.context()
+		if err := create.Create(doc.Addr().Interface()).Error; err != nil {
+			return err
+		}
+	}
+	ids := docIDs(docs)
+
+	ctx, cancel := a.orm.operationContext()
+	defer cancel()
+
+	switch {
+	case a.assoc.joinCollection != "":
+		if err = a.orm.insertJoinDocuments(ctx, a.assoc, a.id, ids); err == nil && replace {
+			_, err = a.orm.collection(a.assoc.joinCollection).DeleteMany(ctx, bson.M{
+				a.assoc.joinForeignKey: a.id,
+				a.assoc.joinReferences: bson.M{"$nin": ids},
+			})
+		}
+	case a.assoc.manyToMany:
+		update := bson.M{"$addToSet": bson.M{a.fieldKey(): bson.M{"$each": ids}}}
+		if replace {
+			update = bson.M{"$set": bson.M{a.fieldKey(): ids}}
+		}
+		_, err = a.orm.Statement.Collection.UpdateOne(ctx, bson.M{"_id": a.id}, update)
+	case hasMany:
+		targets := a.orm.collection(a.orm.collectionName(a.assoc.target))
+		key := a.orm.fieldName(a.assoc.foreignKey)
+		_, err = targets.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$set": bson.M{key: a.id}})
+		if err == nil && replace {
+			_, err = targets.UpdateMany(ctx, bson.M{key: a.id, "_id": bson.M{"$nin": ids}}, bson.M{"$unset": bson.M{key: ""}})
+		}
+	default:
+		_, err = a.orm.Statement.Collection.UpdateOne(ctx, bson.M{"_id": a.id}, bson.M{"$set": bson.M{a.fieldKey(): ids[0]}})
+	}
+	if err != nil {
+		return translateError(err)
+	}
+
+	field := a.model.FieldByIndex(a.assoc.field.Index)
+	if !a.assoc.many {
+		setReference(a.model.FieldByIndex(a.assoc.foreignKey.Index), ids[0])
+		field.Set(docs[0].Addr())
+		return nil
+	}
+	if replace || field.IsNil() {
+		field.Set(reflect.MakeSlice(field.Type(), 0, len(docs)))
+	}
+	for _, doc := range docs {
+		if field.Type().Elem().Kind() == reflect.Ptr {
+			field.Set(reflect.Append(field, doc.Addr()))
+		} else {
+			field.Set(reflect.Append(field, doc))
+		}
+	}
+	if a.assoc.manyToMany && a.assoc.joinCollection == "" {
+		a.orm.setReferenceArrays(a.model.Addr().Interface())
+	}
+	return nil
+}
+
+// remove removes the association between the model and the documents ids,
+// or every document when ids is nil.
+func (a *Association) remove(ids []primitive.ObjectID) error {
+	if a.orm.Statement.DryRun || a.orm.dryRun {
+		return nil
+	}
+	ctx, cancel := a.orm.operationContext()
+	defer cancel()
+
+	var err error
+	switch {
+	case a.assoc.joinCollection != "":
+		filter := bson.M{a.assoc.joinForeignKey: a.id}
+		if ids != nil {
+			filter[a.assoc.joinReferences] = bson.M{"$in": ids}
+		}
+		_, err = a.orm.collection(a.assoc.joinCollection).DeleteMany(ctx, filter)
+	case a.assoc.manyToMany:
+		update := bson.M{"$set": bson.M{a.fieldKey(): bson.A{}}}
+		if ids != nil {
+			update = bson.M{"$pull": bson.M{a.fieldKey(): bson.M{"$in": ids}}}
+		}
+		_, err = a.orm.Statement.Collection.UpdateOne(ctx, bson.M{"_id": a.id}, update)
+	case a.assoc.many:
+		key := a.orm.fieldName(a.assoc.foreignKey)
+		filter := bson.M{key: a.id}
+		if ids != nil {
+			filter["_id"] = bson.M{"$in": ids}
+		}
+		_, err = a.orm.collection(a.orm.collectionName(a.assoc.target)).UpdateMany(ctx, filter, bson.M{"$unset": bson.M{key: ""}})
+	default:
+		ref, ok := objectIDValue(a.model.FieldByIndex(a.assoc.foreignKey.Index))
+		if !ok || (ids != nil && !containsID(ids, ref)) {
+			return nil
+		}
+		_, err = a.orm.Statement.Collection.UpdateOne(ctx, bson.M{"_id": a.id}, bson.M{"$unset": bson.M{a.fieldKey(): ""}})
+	}
+	if err != nil {
+		return translateError(err)
+	}
+
+	field := a.model.FieldByIndex(a.assoc.field.Index)
+	if !a.assoc.many {
+		setReference(a.model.FieldByIndex(a.assoc.foreignKey.Index), primitive.NilObjectID)
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	kept := reflect.MakeSlice(field.Type(), 0, field.Len())
+	for i := 0; ids != nil && i < field.Len(); i++ {
+		if doc, ok := structValue(field.Index(i)); ok {
+			if id, err := documentID(doc.Addr().Interface()); err == nil && containsID(ids, id) {
+				continue
+			}
+		}
+		kept = reflect.Append(kept, field.Index(i))
+	}
+	field.Set(kept)
+	if a.assoc.manyToMany && a.assoc.joinCollection == "" {
+		a.orm.setReferenceArrays(a.model.Addr().Interface())
+	}
+	return nil
+}
+
+// docIDs returns the IDs of docs, struct values, skipping those without
+// one.
+func docIDs(docs []reflect.Value) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(docs))
+	for _, doc := range docs {
+		if id, err := documentID(doc.Addr().Interface()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// setReference stores id in v, a primitive.ObjectID or a pointer to one.
+// primitive.NilObjectID clears it.
+func setReference(v reflect.Value, id primitive.ObjectID) {
+	switch {
+	case v.Type() == reflect.TypeOf(id):
+		v.Set(reflect.ValueOf(id))
+	case v.Type() == reflect.TypeOf(&id) && id.IsZero():
+		v.Set(reflect.Zero(v.Type()))
+	case v.Type() == reflect.TypeOf(&id):
+		v.Set(reflect.ValueOf(&id))
+	}
+}
+
+// associations returns the associations of the model type t that Create
+// saves along with it, leaving out those given to Omit.
+func (orm *MongoORM) associations(t reflect.Type) []association {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var assocs []association
+	for _, assoc := range orm.schema(t).associations {
+		if !orm.omitted(t, assoc.field.Name) {
+			assocs = append(assocs, assoc)
+		}
+	}
+	return assocs
+}
+
+// omitted reports whether the field name of t was given to Omit.
+func (orm *MongoORM) omitted(t reflect.Type, name string) bool {
+	key := orm.documentKey(t, name)
+	for _, omit := range orm.Statement.Omits {
+		if omit == name || orm.documentKey(t, omit) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// createReferenced creates the documents without an ID held by the pointer
+// and many-to-many associations of doc, and stores the ID of the document
+// held by each pointer association in its foreign key, before doc is
+// created.
+func (orm *MongoORM) createReferenced(doc interface{}) error {
+	docVal, ok := structValue(reflect.ValueOf(doc))
+	if !ok || !docVal.CanAddr() {
+		return nil
+	}
+	for _, assoc := range orm.associations(docVal.Type()) {
+		if assoc.many && !assoc.manyToMany {
+			continue
+		}
+		field := docVal.FieldByIndex(assoc.field.Index)
+		if field.IsNil() {
+			continue
+		}
+		if err := orm.createAssociated(field); err != nil {
+			return err
+		}
+		if !assoc.many {
+			if id, err := documentID(field.Interface()); err == nil {
+				setReference(docVal.FieldByIndex(assoc.foreignKey.Index), id)
+			}
+		}
+	}
+	return nil
+}
+
+// createReferrers stores the ID of doc, once created, in the foreign key of
+// the documents held by its slice associations, creating those without an
+// ID and updating the others, and inserts the join documents of its
+// many-to-many associations.
+func (orm *MongoORM) createReferrers(ctx context.Context, doc interface{}) error {
+	docVal, ok := structValue(reflect.ValueOf(doc))
+	if !ok || !docVal.CanAddr() {
+		return nil
+	}
+	id, err := documentID(doc)
+	if err != nil {
+		return nil
+	}
+	for _, assoc := range orm.associations(docVal.Type()) {
+		if !assoc.many || assoc.manyToMany {
+			continue
+		}
+		children := docVal.FieldByIndex(assoc.field.Index)
+		for i := 0; i < children.Len(); i++ {
+			if child, ok := structValue(children.Index(i)); ok {
+				setReference(child.FieldByIndex(assoc.foreignKey.Index), id)
+			}
+		}
+		existing := targetIDs(docVal, assoc)
+		if err := orm.createAssociated(children); err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			key := orm.fieldName(assoc.foreignKey)
+			_, err := orm.collection(orm.collectionName(assoc.target)).UpdateMany(ctx,
+				bson.M{"_id": bson.M{"$in": existing}}, bson.M{"$set": bson.M{key: id}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return orm.saveJoinDocuments(ctx, doc)
+}
+
+// createAssociated creates the documents without an ID held by field, a
+// pointer to a struct or a slice of structs or pointers to them.
+func (orm *MongoORM) createAssociated(field reflect.Value) error {
+	var docs []reflect.Value
+	if field.Kind() == reflect.Slice {
+		for i := 0; i < field.Len(); i++ {
+			if doc, ok := structValue(field.Index(i)); ok {
+				docs = append(docs, doc)
+			}
+		}
+	} else if doc, ok := structValue(field); ok {
+		docs = append(docs, doc)
+	}
+
+	var missing reflect.Value
+	for _, doc := range docs {
+		if _, err := documentID(doc.Addr().Interface()); err == nil {
+			continue
+		}
+		if !missing.IsValid() {
+			missing = reflect.MakeSlice(reflect.SliceOf(doc.Addr().Type()), 0, len(docs))
+		}
+		missing = reflect.Append(missing, doc.Addr())
+	}
+	if !missing.IsValid() {
+		return nil
+	}
+
+	create := orm.newInstance()
+	create.ctx = orm.context()
+	return create.Create(missing.Interface()).Error
+}
@@ -0,0 +1,235 @@
+package mongorm
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AtlasSearch builds the $search stage of Atlas Search, which ranks
+// documents by relevance using a search index defined in Atlas:
+//
+//	search := mongorm.NewAtlasSearch("places").
+//		Must(mongorm.SearchText("coffee", "name", "description").Fuzzy(1)).
+//		Should(mongorm.SearchPhrase("flat white", "menu")).
+//		Filter(mongorm.SearchEquals("open", true)).
+//		Highlight("highlights", "description").
+//		Score("score")
+//	orm.Model(&Place{}).Where("city = ?", "Oslo").Aggregate().
+//		AtlasSearch(search).Limit(20).All(&results)
+//
+// A single operator given to Operator is used as is; clauses added with
+// Must, Should, Filter and MustNot are combined in a compound operator.
+type AtlasSearch struct {
+	index    string
+	operator *SearchOperator
+	compound bson.D
+	// highlightPaths are the paths to highlight, stored in highlightField,
+	// and scoreField holds the relevance score.
+	highlightPaths []string
+	highlightField string
+	scoreField     string
+}
+
+// NewAtlasSearch returns a search using the named index, or the index named
+// "default" when index is empty.
+func NewAtlasSearch(index string) *AtlasSearch {
+	return &AtlasSearch{index: index}
+}
+
+// Operator sets the single operator of the search.
+func (s *AtlasSearch) Operator(op SearchOperator) *AtlasSearch {
+	s.operator = &op
+	return s
+}
+
+// Must adds clauses the documents have to match, contributing to their
+// score.
+func (s *AtlasSearch) Must(ops ...SearchOperator) *AtlasSearch {
+	return s.clause("must", ops)
+}
+
+// Should adds clauses raising the score of the documents matching them.
+func (s *AtlasSearch) Should(ops ...SearchOperator) *AtlasSearch {
+	return s.clause("should", ops)
+}
+
+// Filter adds clauses the documents have to match, without affecting their
+// score.
+func (s *AtlasSearch) Filter(ops ...SearchOperator) *AtlasSearch {
+	return s.clause("filter", ops)
+}
+
+// MustNot adds clauses the documents must not match.
+func (s *AtlasSearch) MustNot(ops ...SearchOperator) *AtlasSearch {
+	return s.clause("mustNot", ops)
+}
+
+// clause appends ops to the compound clause named name.
+func (s *AtlasSearch) clause(name string, ops []SearchOperator) *AtlasSearch {
+	for i, e := range s.compound {
+		if e.Key == name {
+			s.compound[i].Value = append(e.Value.(bson.A), searchOperators(ops)...)
+			return s
+		}
+	}
+	s.compound = append(s.compound, bson.E{Key: name, Value: searchOperators(ops)})
+	return s
+}
+
+// Highlight stores the passages of paths matching the search in the field
+// as, which decodes into a []SearchHighlight. Without paths, every indexed
+// field is highlighted.
+func (s *AtlasSearch) Highlight(as string, paths ...string) *AtlasSearch {
+	s.highlightField = as
+	s.highlightPaths = paths
+	return s
+}
+
+// Score stores the relevance score of each document in the field as.
+func (s *AtlasSearch) Score(as string) *AtlasSearch {
+	s.scoreField = as
+	return s
+}
+
+// Stages returns the $search stage, followed by the $addFields stage
+// storing the score and highlights when they were asked for.
+func (s *AtlasSearch) Stages() mongo.Pipeline {
+	search := bson.D{}
+	if s.index != "" {
+		search = append(search, bson.E{Key: "index", Value: s.index})
+	}
+	if len(s.compound) > 0 {
+		compound := s.compound
+		if s.operator != nil {
+			compound = append(bson.D{{Key: "must", Value: bson.A{s.operator.document()}}}, compound...)
+		}
+		search = append(search, bson.E{Key: "compound", Value: compound})
+	} else if s.operator != nil {
+		search = append(search, s.operator.document()...)
+	}
+	if s.highlightField != "" {
+		search = append(search, bson.E{Key: "highlight", Value: bson.D{{Key: "path", Value: searchPath(s.highlightPaths)}}})
+	}
+	stages := mongo.Pipeline{{{Key: "$search", Value: search}}}
+
+	fields := bson.D{}
+	if s.scoreField != "" {
+		fields = append(fields, bson.E{Key: s.scoreField, Value: bson.D{{Key: "$meta", Value: "searchScore"}}})
+	}
+	if s.highlightField != "" {
+		fields = append(fields, bson.E{Key: s.highlightField, Value: bson.D{{Key: "$meta", Value: "searchHighlights"}}})
+	}
+	if len(fields) > 0 {
+		stages = append(stages, bson.D{{Key: "$addFields", Value: fields}})
+	}
+	return stages
+}
+
+// AtlasSearch runs search ahead of the other stages, as Atlas requires of
+// $search; the conditions of the chain are matched after it.
+func (p *Pipeline) AtlasSearch(search *AtlasSearch) *Pipeline {
+	p.stages = append(search.Stages(), p.stages...)
+	return p
+}
+
+// SearchHighlight is a passage of a document matching an Atlas Search, as
+// stored by AtlasSearch.Highlight.
+type SearchHighlight struct {
+	Path  string                `bson:"path" json:"path"`
+	Score float64               `bson:"score" json:"score"`
+	Texts []SearchHighlightText `bson:"texts" json:"texts"`
+}
+
+// SearchHighlightText is a part of a highlighted passage, whose Type is
+// "hit" for the terms matching the search and "text" for their context.
+type SearchHighlightText struct {
+	Value string `bson:"value" json:"value"`
+	Type  string `bson:"type" json:"type"`
+}
+
+// SearchOperator is an Atlas Search operator, such as text or autocomplete.
+type SearchOperator struct {
+	name string
+	spec bson.D
+}
+
+// NewSearchOperator returns the operator name with the given specification,
+// for operators without a helper:
+//
+//	mongorm.NewSearchOperator("range", bson.D{{Key: "path", Value: "rating"}, {Key: "gte", Value: 4}})
+func NewSearchOperator(name string, spec bson.D) SearchOperator {
+	return SearchOperator{name: name, spec: spec}
+}
+
+// SearchText matches documents whose paths contain terms of query. Without
+// paths, every indexed field is searched.
+func SearchText(query string, paths ...string) SearchOperator {
+	return NewSearchOperator("text", bson.D{{Key: "query", Value: query}, {Key: "path", Value: searchPath(paths)}})
+}
+
+// SearchPhrase matches documents whose paths contain the terms of query in
+// order.
+func SearchPhrase(query string, paths ...string) SearchOperator {
+	return NewSearchOperator("phrase", bson.D{{Key: "query", Value: query}, {Key: "path", Value: searchPath(paths)}})
+}
+
+// SearchAutocomplete matches documents whose path, indexed with the
+// autocomplete type, contains words starting with query, as typed in a
+// search box.
+func SearchAutocomplete(query, path string) SearchOperator {
+	return NewSearchOperator("autocomplete", bson.D{{Key: "query", Value: query}, {Key: "path", Value: path}})
+}
+
+// SearchEquals matches documents whose path equals value, a boolean,
+// number, date or ObjectID.
+func SearchEquals(path string, value interface{}) SearchOperator {
+	return NewSearchOperator("equals", bson.D{{Key: "path", Value: path}, {Key: "value", Value: value}})
+}
+
+// Fuzzy lets the terms of a text or autocomplete operator match words up to
+// maxEdits (1 or 2) single-character edits away, tolerating typos.
+func (op SearchOperator) Fuzzy(maxEdits int) SearchOperator {
+	return op.with("fuzzy", bson.D{{Key: "maxEdits", Value: maxEdits}})
+}
+
+// Boost multiplies the score of the documents matching op by factor.
+func (op SearchOperator) Boost(factor float64) SearchOperator {
+	return op.with("score", bson.D{{Key: "boost", Value: bson.D{{Key: "value", Value: factor}}}})
+}
+
+// with returns op with the option key set to value.
+func (op SearchOperator) with(key string, value interface{}) SearchOperator {
+	spec := append(bson.D(nil), op.spec...)
+	for i, e := range spec {
+		if e.Key == key {
+			spec[i].Value = value
+			return SearchOperator{name: op.name, spec: spec}
+		}
+	}
+	return SearchOperator{name: op.name, spec: append(spec, bson.E{Key: key, Value: value})}
+}
+
+// document returns op as it appears in a $search stage.
+func (op SearchOperator) document() bson.D {
+	return bson.D{{Key: op.name, Value: op.spec}}
+}
+
+func searchOperators(ops []SearchOperator) bson.A {
+	operators := make(bson.A, len(ops))
+	for i, op := range ops {
+		operators[i] = op.document()
+	}
+	return operators
+}
+
+// searchPath returns the path of an operator searching paths: a single
+// field, a list of them, or every indexed field when there are none.
+func searchPath(paths []string) interface{} {
+	switch len(paths) {
+	case 0:
+		return bson.D{{Key: "wildcard", Value: "*"}}
+	case 1:
+		return paths[0]
+	}
+	return paths
+}
@@ -0,0 +1,109 @@
+package mongorm
+
+import (
+	"errors"
+	"reflect"
+)
+
+// FindInBatches reads the documents matching the chain batchSize at a time
+// into docs, a pointer to a slice, and calls fc after each batch with the
+// batch number, starting at 1, and an instance whose RowsAffected is the
+// size of the batch. Documents are read from a single cursor, so that only
+// one batch is held in memory; preloads and AfterFind hooks run per batch,
+// and the operation timeout applies to reading each batch. An error
+// returned by fc stops the iteration and is stored in Error:
+//
+//	var users []User
+//	orm.Where("active = ?", true).FindInBatches(&users, 500, func(tx *mongorm.MongoORM, batch int) error {
+//		return export(users)
+//	})
+//
+// RowsAffected counts the documents read.
+func (orm *MongoORM) FindInBatches(docs interface{}, batchSize int, fc func(tx *MongoORM, batch int) error) *MongoORM {
+	return orm.execute(opQuery, docs, func(tx *MongoORM) {
+		tx.findInBatches(docs, batchSize, fc)
+	})
+}
+
+// findInBatches is the built-in step of FindInBatches.
+func (orm *MongoORM) findInBatches(docs interface{}, batchSize int, fc func(tx *MongoORM, batch int) error) *MongoORM {
+	docsVal := reflect.ValueOf(docs)
+	if docsVal.Kind() != reflect.Ptr || docsVal.Elem().Kind() != reflect.Slice {
+		orm.Error = ErrNotSlice
+		return orm
+	}
+	if batchSize <= 0 {
+		orm.Error = errors.New("batch size must be positive")
+		return orm
+	}
+
+	collection, t, err := orm.readSource(docs)
+	if err != nil {
+		orm.Error = err
+		return orm
+	}
+	filter := orm.queryFilter(t)
+	opts := orm.findOptions(t).SetBatchSize(int32(batchSize))
+	orm.Statement.record(collection, "find", filter)
+	if orm.Statement.DryRun {
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	cursor, err := collection.Find(ctx, filter, opts)
+	cancel()
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	defer cursor.Close(orm.context())
+
+	sliceVal := docsVal.Elem()
+	elemType := sliceVal.Type().Elem()
+	for batch := 1; ; batch++ {
+		ctx, cancel := orm.operationContext()
+		result := reflect.MakeSlice(sliceVal.Type(), 0, batchSize)
+		for result.Len() < batchSize && cursor.Next(ctx) {
+			elem := reflect.New(indirectType(elemType))
+			if err := cursor.Decode(elem.Interface()); err != nil {
+				cancel()
+				orm.Error = err
+				return orm
+			}
+			if elemType.Kind() != reflect.Ptr {
+				elem = elem.Elem()
+			}
+			result = reflect.Append(result, elem)
+		}
+		err := cursor.Err()
+		cancel()
+		if err != nil {
+			orm.Error = translateError(err)
+			return orm
+		}
+		if result.Len() == 0 {
+			return orm
+		}
+
+		sliceVal.Set(result)
+		orm.RowsAffected += uint(result.Len())
+		orm.processPreloads(docs)
+		if orm.Error == nil {
+			orm.Error = orm.callHookEach(sliceVal, hookAfterFind)
+		}
+		if orm.Error != nil {
+			return orm
+		}
+
+		tx := orm.newInstance()
+		tx.ctx = orm.context()
+		tx.RowsAffected = uint(result.Len())
+		if err := fc(tx, batch); err != nil {
+			orm.Error = err
+			return orm
+		}
+		if result.Len() < batchSize {
+			return orm
+		}
+	}
+}
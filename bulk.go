@@ -0,0 +1,504 @@
+package mongorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BulkOperation accumulates inserts, updates, replacements and deletes that
+// are sent to the server as a single BulkWrite. It is created with
+// MongoORM.Bulk:
+//
+//	orm.Model(&Event{}).Bulk().
+//		Insert(&event).
+//		Update(bson.M{"_id": id}, bson.M{"$inc": bson.M{"seen": 1}}).
+//		Delete(bson.M{"expired": true}).
+//		Execute()
+type BulkOperation struct {
+	orm        *MongoORM
+	collection *mongo.Collection
+	model      interface{}
+	models     []mongo.WriteModel
+	ordered    *bool
+	err        error
+	after      []bulkHook
+	versions   []bulkVersion
+}
+
+// bulkVersion is a replacement of a versioned document, written with the
+// version following current.
+type bulkVersion struct {
+	index   int
+	version reflect.Value
+	current int64
+}
+
+// bulkHook is an After hook to run once the bulk write succeeded.
+type bulkHook struct {
+	doc  interface{}
+	name string
+}
+
+// BulkItemError is the failure of a single operation of a bulk write.
+type BulkItemError struct {
+	// Index is the position of the operation in the order it was added.
+	Index int
+	Err   error
+}
+
+func (e BulkItemError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e BulkItemError) Unwrap() error {
+	return e.Err
+}
+
+// BulkWriteError reports the operations of a bulk write that failed. The
+// item errors are translated like those of single operations, so
+// errors.Is(err, ErrDuplicateKey) works on it.
+type BulkWriteError struct {
+	Items []BulkItemError
+	err   error
+}
+
+func (e *BulkWriteError) Error() string {
+	messages := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		messages = append(messages, item.Error())
+	}
+	if len(messages) == 0 {
+		return e.err.Error()
+	}
+	return "bulk write failed: " + strings.Join(messages, "; ")
+}
+
+func (e *BulkWriteError) Unwrap() []error {
+	errs := []error{e.err}
+	for _, item := range e.Items {
+		errs = append(errs, item)
+	}
+	return errs
+}
+
+// Bulk starts a bulk write on the collection selected with Model. Without
+// a model, the collection of the first inserted or replaced document is
+// used.
+func (orm *MongoORM) Bulk() *BulkOperation {
+	tx := orm.getInstance()
+	return &BulkOperation{orm: tx, collection: tx.Statement.Collection}
+}
+
+// Insert adds an insert of doc, running its BeforeCreate hook, and its
+// AfterCreate hook once the bulk write succeeded. Documents without an ID
+// are assigned one so that it is known after Execute.
+func (b *BulkOperation) Insert(doc interface{}) *BulkOperation {
+	b.useCollectionOf(doc)
+	if err := b.orm.callHook(doc, hookBeforeCreate); err != nil {
+		b.fail(err)
+		return b
+	}
+	if err := b.orm.validate(doc, false); err != nil {
+		b.fail(err)
+		return b
+	}
+	if err := b.orm.assignID(doc); err != nil {
+		b.fail(err)
+		return b
+	}
+	b.orm.stampCreate(doc)
+	b.orm.initVersion(doc)
+	if _, err := recordID(doc); err != nil {
+		setDocumentID(reflect.ValueOf(doc), primitive.NewObjectID())
+	}
+	b.models = append(b.models, mongo.NewInsertOneModel().SetDocument(doc))
+	b.after = append(b.after, bulkHook{doc, hookAfterCreate})
+	return b
+}
+
+// Replace adds a replacement of the stored document with doc, matched by
+// doc's ID, running its BeforeSave and AfterSave hooks. Versioned
+// documents are only replaced while they have the version of doc, as with
+// Save, and written with the next one; a replacement of a document changed
+// in between fails with ErrStaleObject in the BulkWriteError of Execute.
+// Such replacements are sent on their own, between bulk writes of the
+// operations around them, as a bulk write does not tell which of its
+// replacements matched.
+func (b *BulkOperation) Replace(doc interface{}) *BulkOperation {
+	b.useCollectionOf(doc)
+	oid, err := recordID(doc)
+	if err != nil {
+		b.fail(err)
+		return b
+	}
+	if err := b.orm.callHook(doc, hookBeforeSave); err != nil {
+		b.fail(err)
+		return b
+	}
+	b.orm.stampSave(doc)
+	if err := b.orm.validate(doc, false); err != nil {
+		b.fail(err)
+		return b
+	}
+	filter := bson.M{"_id": oid}
+	if version, key, ok := b.orm.lockVersion(doc); ok {
+		current := version.Int()
+		filter = mergeConditions(filter, versionCondition(key, current))
+		version.SetInt(current + 1)
+		b.versions = append(b.versions, bulkVersion{index: len(b.models), version: version, current: current})
+	}
+	b.models = append(b.models, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(doc))
+	b.after = append(b.after, bulkHook{doc, hookAfterSave})
+	return b
+}
+
+// Update adds an update of the first document matching filter. Updates
+// of the model given to Model stamp its update timestamps and increment
+// the version of versioned documents, without checking it.
+func (b *BulkOperation) Update(filter, update interface{}) *BulkOperation {
+	b.models = append(b.models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(b.stampUpdate(update)))
+	return b
+}
+
+// UpdateMany adds an update of every document matching filter, stamping
+// timestamps as Update does.
+func (b *BulkOperation) UpdateMany(filter, update interface{}) *BulkOperation {
+	b.models = append(b.models, mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(b.stampUpdate(update)))
+	return b
+}
+
+// stampUpdate returns update with the update timestamps of the model given
+// to Model set, and its version incremented. Pipelines and other updates
+// that are not documents of operators are returned as they are.
+func (b *BulkOperation) stampUpdate(update interface{}) interface{} {
+	doc, err := toDocument(update)
+	if err != nil || !hasOperator(doc) {
+		return update
+	}
+	t := modelType(b.orm.Statement.Model)
+	doc = b.orm.stampUpdate(doc, t, nil)
+	if field, ok := b.orm.versionField(t); ok {
+		doc = incrementVersion(doc, b.orm.fieldName(field))
+	}
+	return doc
+}
+
+// Delete adds a delete of the first document matching filter.
+func (b *BulkOperation) Delete(filter interface{}) *BulkOperation {
+	b.models = append(b.models, mongo.NewDeleteOneModel().SetFilter(filter))
+	return b
+}
+
+// DeleteMany adds a delete of every document matching filter.
+func (b *BulkOperation) DeleteMany(filter interface{}) *BulkOperation {
+	b.models = append(b.models, mongo.NewDeleteManyModel().SetFilter(filter))
+	return b
+}
+
+// Ordered controls whether the bulk write stops at the first failing
+// operation (the default) or attempts every operation.
+func (b *BulkOperation) Ordered(ordered bool) *BulkOperation {
+	b.ordered = &ordered
+	return b
+}
+
+// Execute sends the accumulated operations, through the callbacks of
+// Callbacks.Bulk. BulkWriteResult holds the driver's counts and
+// RowsAffected their sum. Failed operations are reported as a
+// *BulkWriteError in Error.
+func (b *BulkOperation) Execute() *MongoORM {
+	orm := b.orm
+	if b.err != nil {
+		orm.Error = b.err
+		b.restoreVersions(nil)
+		return orm
+	}
+	if orm.Error != nil {
+		b.restoreVersions(nil)
+		return orm
+	}
+	if b.collection == nil {
+		orm.Error = ErrMissingModel
+		return orm
+	}
+	if len(b.models) == 0 {
+		orm.RowsAffected = 0
+		return orm
+	}
+
+	orm.Statement.Collection = b.collection
+	if orm.Statement.Model == nil {
+		orm.Statement.Model = b.model
+	}
+	written := false
+	tx := orm.execute(opBulk, b.models, func(tx *MongoORM) {
+		written = b.write(tx)
+	})
+	if !written {
+		b.restoreVersions(nil)
+	}
+	return tx
+}
+
+// write is the built-in step of Execute. It reports whether the write
+// models were sent.
+func (b *BulkOperation) write(tx *MongoORM) bool {
+	models, _ := tx.Statement.Dest.([]mongo.WriteModel)
+	models, err := scopeWriteModels(models, tx.statementScope(modelType(tx.Statement.Model)))
+	if err != nil {
+		tx.Error = err
+		return false
+	}
+
+	opts := options.BulkWrite()
+	if b.ordered != nil {
+		opts.SetOrdered(*b.ordered)
+	}
+
+	ctx, cancel := tx.operationContext()
+	defer cancel()
+
+	collection := tx.Statement.Collection
+	tx.Statement.record(collection, "bulkWrite", models)
+	if tx.Statement.DryRun {
+		return false
+	}
+	result, err := b.bulkWrite(ctx, collection, models, opts)
+	tx.BulkWriteResult = result
+	if result != nil {
+		tx.RowsAffected = uint(result.InsertedCount + result.ModifiedCount + result.DeletedCount + result.UpsertedCount)
+	}
+	if err != nil {
+		tx.Error = err
+		b.restoreVersions(tx.Error)
+		return true
+	}
+	for _, hook := range b.after {
+		if tx.Error = tx.callHook(hook.doc, hook.name); tx.Error != nil {
+			break
+		}
+	}
+	return true
+}
+
+// scopeWriteModels returns models with scope added to the filters of the
+// updates, replacements and deletes. The write models are copied rather
+// than changed.
+func scopeWriteModels(models []mongo.WriteModel, scope bson.M) ([]mongo.WriteModel, error) {
+	if len(scope) == 0 {
+		return models, nil
+	}
+	scoped := make([]mongo.WriteModel, len(models))
+	for i, model := range models {
+		var err error
+		switch m := model.(type) {
+		case *mongo.UpdateOneModel:
+			copied := *m
+			copied.Filter, err = scopeFilter(m.Filter, scope)
+			model = &copied
+		case *mongo.UpdateManyModel:
+			copied := *m
+			copied.Filter, err = scopeFilter(m.Filter, scope)
+			model = &copied
+		case *mongo.ReplaceOneModel:
+			copied := *m
+			copied.Filter, err = scopeFilter(m.Filter, scope)
+			model = &copied
+		case *mongo.DeleteOneModel:
+			copied := *m
+			copied.Filter, err = scopeFilter(m.Filter, scope)
+			model = &copied
+		case *mongo.DeleteManyModel:
+			copied := *m
+			copied.Filter, err = scopeFilter(m.Filter, scope)
+			model = &copied
+		}
+		if err != nil {
+			return nil, err
+		}
+		scoped[i] = model
+	}
+	return scoped, nil
+}
+
+// scopeFilter returns filter narrowed by scope.
+func scopeFilter(filter interface{}, scope bson.M) (interface{}, error) {
+	if filter == nil {
+		return scope, nil
+	}
+	doc, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+	return mergeConditions(doc, scope), nil
+}
+
+// bulkWrite sends models to collection. Versioned replacements are sent
+// as single replacements filtered by version, which fail with
+// ErrStaleObject when they match nothing, and the models between them as
+// bulk writes. The counts of every write are added up, and the failures
+// reported as a *BulkWriteError indexed by position in models.
+func (b *BulkOperation) bulkWrite(ctx context.Context, collection *mongo.Collection, models []mongo.WriteModel, opts *options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	if len(b.versions) == 0 {
+		result, err := collection.BulkWrite(ctx, models, opts)
+		if err != nil {
+			return result, translateBulkError(err)
+		}
+		return result, nil
+	}
+
+	versioned := map[int]bool{}
+	for _, v := range b.versions {
+		versioned[v.index] = true
+	}
+	ordered := b.ordered == nil || *b.ordered
+	total := &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+	bulkErr := &BulkWriteError{}
+	fail := func(item BulkItemError, err error) {
+		bulkErr.Items = append(bulkErr.Items, item)
+		if bulkErr.err == nil {
+			bulkErr.err = err
+		}
+	}
+
+	start := 0
+	for i := 0; i <= len(models); i++ {
+		if i < len(models) && !versioned[i] {
+			continue
+		}
+		if i > start {
+			result, err := collection.BulkWrite(ctx, models[start:i], opts)
+			addBulkResult(total, result, start)
+			var exception mongo.BulkWriteException
+			if err != nil && !errors.As(err, &exception) {
+				return total, translateError(err)
+			}
+			if err != nil {
+				for _, item := range translateBulkError(err).(*BulkWriteError).Items {
+					if item.Index >= 0 {
+						item.Index += start
+					}
+					fail(item, err)
+				}
+				if ordered {
+					break
+				}
+			}
+		}
+		if i == len(models) {
+			break
+		}
+
+		replace := models[i].(*mongo.ReplaceOneModel)
+		replaceOpts := options.Replace()
+		if replace.Collation != nil {
+			replaceOpts.SetCollation(replace.Collation)
+		}
+		if replace.Hint != nil {
+			replaceOpts.SetHint(replace.Hint)
+		}
+		result, err := collection.ReplaceOne(ctx, replace.Filter, replace.Replacement, replaceOpts)
+		var exception mongo.WriteException
+		switch {
+		case err != nil && !errors.As(err, &exception):
+			return total, translateError(err)
+		case err != nil:
+			fail(BulkItemError{Index: i, Err: translateError(err)}, err)
+		case result.MatchedCount == 0:
+			fail(BulkItemError{Index: i, Err: ErrStaleObject}, ErrStaleObject)
+		default:
+			total.MatchedCount += result.MatchedCount
+			total.ModifiedCount += result.ModifiedCount
+		}
+		if ordered && len(bulkErr.Items) > 0 {
+			break
+		}
+		start = i + 1
+	}
+	if len(bulkErr.Items) > 0 {
+		return total, bulkErr
+	}
+	return total, nil
+}
+
+// addBulkResult adds the counts of result, the bulk write of the models
+// from offset on, to total.
+func addBulkResult(total, result *mongo.BulkWriteResult, offset int) {
+	if result == nil {
+		return
+	}
+	total.InsertedCount += result.InsertedCount
+	total.MatchedCount += result.MatchedCount
+	total.ModifiedCount += result.ModifiedCount
+	total.DeletedCount += result.DeletedCount
+	total.UpsertedCount += result.UpsertedCount
+	for index, id := range result.UpsertedIDs {
+		total.UpsertedIDs[index+int64(offset)] = id
+	}
+}
+
+// restoreVersions gives back their version to the documents of versioned
+// replacements that were not written: every one without err, or else
+// those that failed, and those that followed a failure of an ordered bulk
+// write.
+func (b *BulkOperation) restoreVersions(err error) {
+	failed := map[int]bool{}
+	first := -1
+	var bulkErr *BulkWriteError
+	if errors.As(err, &bulkErr) {
+		for _, item := range bulkErr.Items {
+			failed[item.Index] = true
+			if item.Index >= 0 && (first < 0 || item.Index < first) {
+				first = item.Index
+			}
+		}
+	}
+	ordered := b.ordered == nil || *b.ordered
+	for _, v := range b.versions {
+		if err == nil || bulkErr == nil || failed[v.index] || (ordered && first >= 0 && v.index > first) {
+			v.version.SetInt(v.current)
+		}
+	}
+}
+
+func (b *BulkOperation) useCollectionOf(doc interface{}) {
+	if b.collection == nil {
+		b.collection = b.orm.collection(b.orm.determineCollectionName(doc))
+		b.model = doc
+	}
+}
+
+func (b *BulkOperation) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// translateBulkError converts a driver bulk write exception into a
+// *BulkWriteError with one translated error per failed operation.
+func translateBulkError(err error) error {
+	var exception mongo.BulkWriteException
+	if !errors.As(err, &exception) {
+		return translateError(err)
+	}
+
+	bulkErr := &BulkWriteError{err: err}
+	for _, writeError := range exception.WriteErrors {
+		bulkErr.Items = append(bulkErr.Items, BulkItemError{
+			Index: writeError.Index,
+			Err:   translateError(writeError.WriteError),
+		})
+	}
+	if exception.WriteConcernError != nil {
+		bulkErr.Items = append(bulkErr.Items, BulkItemError{Index: -1, Err: exception.WriteConcernError})
+	}
+	return bulkErr
+}
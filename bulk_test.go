@@ -0,0 +1,82 @@
+package mongorm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBulkRunsBulkCallbacks(t *testing.T) {
+	orm := mongormtest.New()
+	var seen []mongo.WriteModel
+	err := orm.Callback().Bulk().Before("mongorm:bulk").Register("test:scope", func(tx *mongorm.MongoORM) {
+		seen, _ = tx.Statement.Dest.([]mongo.WriteModel)
+		tx.Statement.Scope = func(reflect.Type) bson.M {
+			return bson.M{"owner": "ann"}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, owner := range []string{"ann", "bob"} {
+		if err := orm.Create(&account{Owner: owner, Balance: 10}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx := orm.Model(&account{}).Bulk().
+		UpdateMany(bson.M{}, bson.M{"$inc": bson.M{"balance": 5}}).
+		Execute()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if len(seen) != 1 {
+		t.Fatalf("callback saw %d write models, want 1", len(seen))
+	}
+	if tx.RowsAffected != 1 {
+		t.Fatalf("RowsAffected = %d, want 1", tx.RowsAffected)
+	}
+
+	var bob account
+	if err := orm.Where("owner = ?", "bob").First(&bob).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bob.Balance != 10 {
+		t.Fatalf("balance outside the scope = %d, want 10", bob.Balance)
+	}
+}
+
+func TestBulkExecutesMixedWrites(t *testing.T) {
+	orm := mongormtest.New()
+	ann, bob := account{Owner: "ann", Balance: 10}, account{Owner: "bob", Balance: 20}
+	for _, a := range []*account{&ann, &bob} {
+		if err := orm.Create(a).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx := orm.Model(&account{}).Bulk().
+		Insert(&account{Owner: "cy", Balance: 30}).
+		Update(bson.M{"owner": "ann"}, bson.M{"$inc": bson.M{"balance": 5}}).
+		Delete(bson.M{"owner": "bob"}).
+		Execute()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	result := tx.BulkWriteResult
+	if result.InsertedCount != 1 || result.ModifiedCount != 1 || result.DeletedCount != 1 {
+		t.Fatalf("result = %+v, want one insert, update and delete", result)
+	}
+
+	var accounts []account
+	if err := orm.Order("owner").Find(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Owner != "ann" || accounts[0].Balance != 15 || accounts[1].Owner != "cy" {
+		t.Fatalf("accounts = %+v, want ann with 15 and cy", accounts)
+	}
+}
@@ -0,0 +1,341 @@
+package mongorm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Operation names, used as Statement.Operation and to select a processor.
+const (
+	opCreate = "create"
+	opQuery  = "query"
+	opUpdate = "update"
+	opDelete = "delete"
+	opBulk   = "bulk"
+	opRaw    = "raw"
+)
+
+// Callbacks is the registry of functions run around every operation. Each
+// kind of operation has a processor whose callbacks run in order around the
+// built-in step, named "mongorm:create", "mongorm:query", "mongorm:update",
+// "mongorm:delete", "mongorm:bulk" or "mongorm:raw", which executes the
+// operation itself:
+//
+//	orm.Callback().Delete().Before("mongorm:delete").Register("audit", func(tx *mongorm.MongoORM) {
+//		log.Printf("deleting from %v", tx.Statement.Dest)
+//	})
+//
+// Callbacks run even when an earlier one failed, so that instrumentation
+// sees every operation; the built-in step is skipped once Error is set.
+// Callbacks report failures with AddError.
+type Callbacks struct {
+	processors map[string]*Processor
+}
+
+// Processor holds the callbacks for one kind of operation.
+type Processor struct {
+	mu        sync.RWMutex
+	callbacks []*callback
+	compiled  []*callback
+}
+
+type callback struct {
+	name      string
+	before    string
+	after     string
+	fn        func(*MongoORM)
+	builtin   bool
+	processor *Processor
+}
+
+func newCallbacks() *Callbacks {
+	cs := &Callbacks{processors: map[string]*Processor{}}
+	for _, op := range []string{opCreate, opQuery, opUpdate, opDelete, opBulk, opRaw} {
+		p := &Processor{}
+		p.callbacks = []*callback{{name: "mongorm:" + op, builtin: true, processor: p}}
+		p.compiled = p.callbacks
+		cs.processors[op] = p
+	}
+	return cs
+}
+
+// Create returns the processor for Create, CreateInBatches and
+// FirstOrCreate.
+func (cs *Callbacks) Create() *Processor {
+	return cs.processors[opCreate]
+}
+
+// Query returns the processor for First, Find, FindInBatches, Count, Exists,
+// Distinct, FirstOrInit and aggregations.
+func (cs *Callbacks) Query() *Processor {
+	return cs.processors[opQuery]
+}
+
+// Update returns the processor for Save, Updates, UpdateMany, UpdateAndGet
+// and Restore.
+func (cs *Callbacks) Update() *Processor {
+	return cs.processors[opUpdate]
+}
+
+// Delete returns the processor for Delete and DeleteAndGet. The document
+// selected by an ID given to Delete is in Statement.Filter.
+func (cs *Callbacks) Delete() *Processor {
+	return cs.processors[opDelete]
+}
+
+// Bulk returns the processor for BulkOperation.Execute. Statement.Dest holds
+// the []mongo.WriteModel about to be sent, and Statement.Model the model
+// given to Model, or else the first document inserted or replaced. The
+// filters of the write models are scoped with Statement.Scope by the
+// built-in step.
+func (cs *Callbacks) Bulk() *Processor {
+	return cs.processors[opBulk]
+}
+
+// Raw returns the processor for Collection, whose built-in step returns the
+// collection named by Statement.Table, routed as callbacks set. Failing
+// callbacks make Collection fail.
+func (cs *Callbacks) Raw() *Processor {
+	return cs.processors[opRaw]
+}
+
+// Before starts the registration of a callback running before name.
+func (p *Processor) Before(name string) *callback {
+	return &callback{before: name, processor: p}
+}
+
+// After starts the registration of a callback running after name.
+func (p *Processor) After(name string) *callback {
+	return &callback{after: name, processor: p}
+}
+
+// Register adds fn under name, running after every callback registered so
+// far.
+func (p *Processor) Register(name string, fn func(*MongoORM)) error {
+	return (&callback{processor: p}).Register(name, fn)
+}
+
+// Remove unregisters the callback name.
+func (p *Processor) Remove(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, c := range p.callbacks {
+		if c.name == name {
+			callbacks := append(append([]*callback(nil), p.callbacks[:i]...), p.callbacks[i+1:]...)
+			p.compile(callbacks)
+			return nil
+		}
+	}
+	return fmt.Errorf("callback %q not registered", name)
+}
+
+// Replace swaps the function of the callback name for fn. Replacing a
+// built-in step replaces how the operation is executed.
+func (p *Processor) Replace(name string, fn func(*MongoORM)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, c := range p.callbacks {
+		if c.name == name {
+			replaced := *c
+			replaced.fn = fn
+			callbacks := append([]*callback(nil), p.callbacks...)
+			callbacks[i] = &replaced
+			p.compile(callbacks)
+			return nil
+		}
+	}
+	return fmt.Errorf("callback %q not registered", name)
+}
+
+// Get returns the function registered under name, or nil.
+func (p *Processor) Get(name string) func(*MongoORM) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, c := range p.callbacks {
+		if c.name == name {
+			return c.fn
+		}
+	}
+	return nil
+}
+
+// Register adds fn under name at the position chosen with Before or After.
+func (c *callback) Register(name string, fn func(*MongoORM)) error {
+	if name == "" || fn == nil {
+		return errors.New("callback requires a name and a function")
+	}
+
+	p := c.processor
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ref := c.before + c.after; ref != "" && !p.registered(ref) {
+		return fmt.Errorf("callback %q refers to unknown callback %q", name, ref)
+	}
+	if p.registered(name) {
+		return fmt.Errorf("callback %q already registered", name)
+	}
+
+	registered := *c
+	registered.name = name
+	registered.fn = fn
+	p.compile(append(append([]*callback(nil), p.callbacks...), &registered))
+	return nil
+}
+
+// registered reports whether a callback named name is registered.
+func (p *Processor) registered(name string) bool {
+	for _, c := range p.callbacks {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// compile orders callbacks by their Before and After constraints and
+// installs them. Callbacks without constraints keep registration order.
+func (p *Processor) compile(callbacks []*callback) {
+	var order []*callback
+	indexOf := func(name string) int {
+		for i, c := range order {
+			if c.name == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	pending := callbacks
+	for len(pending) > 0 {
+		var next []*callback
+		for _, c := range pending {
+			switch {
+			case c.before != "":
+				if i := indexOf(c.before); i >= 0 {
+					order = append(order[:i], append([]*callback{c}, order[i:]...)...)
+					continue
+				}
+			case c.after != "":
+				if i := indexOf(c.after); i >= 0 {
+					order = append(order[:i+1], append([]*callback{c}, order[i+1:]...)...)
+					continue
+				}
+			default:
+				order = append(order, c)
+				continue
+			}
+			next = append(next, c)
+		}
+		if len(next) == len(pending) {
+			// The callbacks they were ordered against were removed.
+			order = append(order, next...)
+			break
+		}
+		pending = next
+	}
+
+	p.callbacks = callbacks
+	p.compiled = order
+}
+
+// execute runs the callbacks, with core as the built-in step.
+func (p *Processor) execute(tx *MongoORM, core func(*MongoORM)) {
+	p.mu.RLock()
+	callbacks := p.compiled
+	p.mu.RUnlock()
+
+	for _, c := range callbacks {
+		switch {
+		case c.fn != nil:
+			c.fn(tx)
+		case c.builtin && tx.Error == nil:
+			core(tx)
+		}
+	}
+}
+
+// Callback returns the callback registry shared by orm and every instance
+// derived from it.
+func (orm *MongoORM) Callback() *Callbacks {
+	return orm.callbacks
+}
+
+// AddError records err in Error, joining it with errors already recorded
+// for the current operation, and returns the result.
+func (orm *MongoORM) AddError(err error) error {
+	if err == nil {
+		return orm.Error
+	}
+	if orm.Error == nil || !orm.Statement.failed {
+		orm.Error = err
+	} else {
+		orm.Error = errors.Join(orm.Error, err)
+	}
+	orm.Statement.failed = true
+	return orm.Error
+}
+
+// execute runs an operation through the callbacks of processor op. Errors
+// left over from earlier operations are cleared first, while errors raised
+// while building the chain, such as an invalid Where condition, skip the
+// operation. The operation is traced to the Logger and the statement is
+// cleared afterwards.
+func (orm *MongoORM) execute(op string, dest interface{}, core func(*MongoORM)) *MongoORM {
+	tx := orm.getInstance()
+	if !tx.Statement.failed {
+		tx.Error = nil
+	}
+	begin := time.Now()
+	tx.RowsAffected = 0
+	tx.Statement.Operation = op
+	tx.Statement.Context = tx.context()
+	tx.Statement.Dest = dest
+	tx.Statement.DryRun = tx.Statement.DryRun || tx.dryRun
+	tx.callbacks.processors[op].execute(tx, func(tx *MongoORM) {
+		if tx.Statement.routed() {
+			// The collection selected with Model follows the routing set
+			// by callbacks.
+			tx.refreshCollection()
+		}
+		core(tx)
+	})
+	tx.trace(begin)
+	tx.resetStatement()
+	return tx
+}
+
+// Plugin packages callbacks for a cross-cutting concern such as tracing or
+// metrics.
+type Plugin interface {
+	// Name identifies the plugin; it must be unique per MongoORM.
+	Name() string
+	// Initialize registers the plugin's callbacks on orm. It must not
+	// register plugins itself.
+	Initialize(orm *MongoORM) error
+}
+
+// RegisterPlugin initializes plugin and records it in Config.Plugins. It
+// is safe to call concurrently on instances sharing a Config; each plugin
+// name is initialized once.
+func (orm *MongoORM) RegisterPlugin(plugin Plugin) error {
+	name := plugin.Name()
+	orm.config.pluginsMu.Lock()
+	defer orm.config.pluginsMu.Unlock()
+	if _, ok := orm.config.Plugins[name]; ok {
+		return fmt.Errorf("plugin %q already registered", name)
+	}
+	if err := plugin.Initialize(orm); err != nil {
+		return fmt.Errorf("initialize plugin %q: %w", name, err)
+	}
+	if orm.config.Plugins == nil {
+		orm.config.Plugins = map[string]Plugin{}
+	}
+	orm.config.Plugins[name] = plugin
+	return nil
+}
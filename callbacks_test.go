@@ -0,0 +1,48 @@
+package mongorm_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+)
+
+type countingPlugin struct {
+	name        string
+	initialized *int
+}
+
+func (p countingPlugin) Name() string { return p.name }
+
+func (p countingPlugin) Initialize(orm *mongorm.MongoORM) error {
+	*p.initialized++
+	return orm.Callback().Query().Register(p.name, func(*mongorm.MongoORM) {})
+}
+
+func TestRegisterPluginConcurrently(t *testing.T) {
+	config := &mongorm.Config{}
+	orm := mongormtest.New(config)
+	counts := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range counts {
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				orm.RegisterPlugin(countingPlugin{name: fmt.Sprintf("plugin%d", i), initialized: &counts[i]})
+			}(i)
+		}
+	}
+	wg.Wait()
+
+	if len(config.Plugins) != len(counts) {
+		t.Fatalf("plugins = %d, want %d", len(config.Plugins), len(counts))
+	}
+	for i, n := range counts {
+		if n != 1 {
+			t.Errorf("plugin%d initialized %d times, want once", i, n)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package mongorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Capped is implemented by models stored in a capped collection, which
+// keeps documents in insertion order and drops the oldest ones once it
+// holds size bytes, or max documents when max is positive:
+//
+//	func (LogEntry) CappedSize() (size, max int64) { return 16 << 20, 10000 }
+//
+// AutoMigrate creates the collection when it does not exist yet; an
+// existing collection is left as it is.
+type Capped interface {
+	CappedSize() (size, max int64)
+}
+
+// parseCapped returns the options creating the capped collection of t, or
+// nil options when t is not Capped.
+func parseCapped(t reflect.Type) (*options.CreateCollectionOptions, error) {
+	capped, ok := reflect.New(t).Interface().(Capped)
+	if !ok {
+		return nil, nil
+	}
+	size, max := capped.CappedSize()
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid capped collection size %d", size)
+	}
+	opts := options.CreateCollection().SetCapped(true).SetSizeInBytes(size)
+	if max > 0 {
+		opts.SetMaxDocuments(max)
+	}
+	return opts, nil
+}
+
+// tailRetryDelay is the wait before Tail reopens a cursor that died, such
+// as one opened on an empty collection.
+const tailRetryDelay = time.Second
+
+// Tail follows the capped collection of the chain like tail -f: it sends
+// the documents matching the chain on the returned channel in insertion
+// order, then those inserted later as they arrive, until the context set
+// with WithContext is done:
+//
+//	ctx, cancel := context.WithCancel(ctx)
+//	defer cancel()
+//	docs, errs := orm.WithContext(ctx).Model(&LogEntry{}).Where("level = ?", "error").Tail()
+//	for doc := range docs {
+//		var entry LogEntry
+//		if err := bson.Unmarshal(doc, &entry); err != nil {
+//			return err
+//		}
+//		alert(entry)
+//	}
+//	return <-errs
+//
+// Both channels are closed once tailing stops; errs then yields the error
+// that stopped it, or nil when the context was done. A cursor that dies,
+// as it does when the collection is empty, is reopened after the last
+// document sent. Select and Omit apply; sorting is not allowed on a
+// tailable cursor. Tail sends nothing on a dry run.
+func (orm *MongoORM) Tail() (<-chan bson.Raw, <-chan error) {
+	docs := make(chan bson.Raw)
+	errs := make(chan error, 1)
+
+	var ctx context.Context
+	var collection *mongo.Collection
+	var filter bson.M
+	var opts *options.FindOptions
+	tx := orm.execute(opQuery, nil, func(tx *MongoORM) {
+		collection = tx.Statement.Collection
+		if collection == nil {
+			tx.Error = ErrMissingModel
+			return
+		}
+		t := modelType(tx.Statement.Model)
+		filter = tx.queryFilter(t)
+		opts = tx.findOptions(t).SetCursorType(options.TailableAwait)
+		// A limited cursor would end, and be reopened, over and over.
+		opts.Limit = nil
+		ctx = tx.context()
+		tx.Statement.record(collection, "find", filter)
+	})
+	if tx.Error != nil || tx.Statement.DryRun {
+		errs <- tx.Error
+		close(docs)
+		close(errs)
+		return docs, errs
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(docs)
+		errs <- orm.tail(ctx, collection, filter, opts, docs)
+	}()
+	return docs, errs
+}
+
+// tail sends the documents of tailable cursors on collection to docs,
+// reopening them after the last document sent until ctx is done.
+func (orm *MongoORM) tail(ctx context.Context, collection *mongo.Collection, filter bson.M, opts *options.FindOptions, docs chan<- bson.Raw) error {
+	var last interface{}
+	for {
+		query := filter
+		if last != nil {
+			query = mergeConditions(filter, bson.M{"_id": bson.M{"$gt": last}})
+		}
+		cursor, err := collection.Find(ctx, query, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return translateError(err)
+		}
+		for cursor.Next(ctx) {
+			doc := append(bson.Raw(nil), cursor.Current...)
+			select {
+			case docs <- doc:
+			case <-ctx.Done():
+				cursor.Close(context.Background())
+				return nil
+			}
+			if id, err := doc.LookupErr("_id"); err == nil {
+				var value interface{}
+				if err := id.Unmarshal(&value); err == nil {
+					last = value
+				}
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(context.Background())
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return translateError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(tailRetryDelay):
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package mongorm
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// changeTracker holds the snapshots of the documents loaded in a session
+// with Session.TrackChanges, as they were last read or written.
+type changeTracker struct {
+	mu        sync.Mutex
+	snapshots map[snapshotKey]bson.Raw
+}
+
+// snapshotKey identifies a document by its collection and encoded ID.
+type snapshotKey struct {
+	collection string
+	id         string
+}
+
+func newChangeTracker() *changeTracker {
+	return &changeTracker{snapshots: map[snapshotKey]bson.Raw{}}
+}
+
+// snapshotKey returns the key of the snapshot of doc, which needs an ID.
+func (orm *MongoORM) snapshotKey(doc interface{}) (snapshotKey, bool) {
+	id, err := recordID(doc)
+	if err != nil {
+		return snapshotKey{}, false
+	}
+	_, data, err := bson.MarshalValue(id)
+	if err != nil {
+		return snapshotKey{}, false
+	}
+	return snapshotKey{collection: orm.determineCollectionName(doc), id: string(data)}, true
+}
+
+// snapshot records doc as it is stored, when changes are tracked. Documents
+// read with a projection are forgotten instead, since the fields they lack
+// would look changed.
+func (orm *MongoORM) snapshot(doc interface{}) {
+	if orm.changes == nil {
+		return
+	}
+	key, ok := orm.snapshotKey(doc)
+	if !ok {
+		return
+	}
+	var data []byte
+	if len(orm.Statement.Selects) == 0 {
+		data, _ = marshalDocument(doc)
+	}
+	orm.changes.mu.Lock()
+	defer orm.changes.mu.Unlock()
+	if data == nil {
+		delete(orm.changes.snapshots, key)
+		return
+	}
+	orm.changes.snapshots[key] = data
+}
+
+// snapshotEach records every element of the slice docs, as snapshot does.
+func (orm *MongoORM) snapshotEach(docs reflect.Value) {
+	if orm.changes == nil {
+		return
+	}
+	for i := 0; i < docs.Len(); i++ {
+		orm.snapshot(elemPointer(docs.Index(i)))
+	}
+}
+
+// forget drops the snapshot of doc.
+func (orm *MongoORM) forget(doc interface{}) {
+	if orm.changes == nil {
+		return
+	}
+	if key, ok := orm.snapshotKey(doc); ok {
+		orm.changes.mu.Lock()
+		delete(orm.changes.snapshots, key)
+		orm.changes.mu.Unlock()
+	}
+}
+
+// snapshotOf returns the snapshot of doc, and false when it has none.
+func (orm *MongoORM) snapshotOf(doc interface{}) (bson.Raw, bool) {
+	if orm.changes == nil {
+		return nil, false
+	}
+	key, ok := orm.snapshotKey(doc)
+	if !ok {
+		return nil, false
+	}
+	orm.changes.mu.Lock()
+	defer orm.changes.mu.Unlock()
+	snapshot, ok := orm.changes.snapshots[key]
+	return snapshot, ok
+}
+
+// changedFields returns the update turning snapshot into doc: a $set of
+// the top-level fields whose value changed or that were added, and an
+// $unset of those that were removed. It is empty when nothing changed.
+func changedFields(doc interface{}, snapshot bson.Raw) (bson.M, error) {
+	data, err := marshalDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	current := bson.Raw(data)
+	elements, err := current.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	set, unset := bson.M{}, bson.M{}
+	for _, element := range elements {
+		key, value := element.Key(), element.Value()
+		if key == "_id" {
+			continue
+		}
+		old, err := snapshot.LookupErr(key)
+		if err != nil || old.Type != value.Type || !bytes.Equal(old.Value, value.Value) {
+			set[key] = value
+		}
+	}
+	previous, err := snapshot.Elements()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range previous {
+		if _, err := current.LookupErr(element.Key()); err != nil {
+			unset[element.Key()] = ""
+		}
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
+}
@@ -0,0 +1,114 @@
+package mongorm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type profile struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty"`
+	Name  string             `bson:"name"`
+	Email string             `bson:"email"`
+	Bio   string             `bson:"bio,omitempty"`
+}
+
+// recordUpdates returns the updates sent by Save and friends on orm.
+func recordUpdates(t *testing.T, orm *mongorm.MongoORM) *[]interface{} {
+	t.Helper()
+	var updates []interface{}
+	err := orm.Callback().Update().After("mongorm:update").Register("test:updates", func(tx *mongorm.MongoORM) {
+		if len(tx.Statement.Args) > 1 {
+			updates = append(updates, tx.Statement.Args[1])
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &updates
+}
+
+func TestTrackChangesWritesChangedFields(t *testing.T) {
+	orm := mongormtest.New()
+	updates := recordUpdates(t, orm)
+	p := profile{Name: "ann", Email: "ann@example.com", Bio: "hi"}
+	if err := orm.Create(&p).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	db := orm.Session(&mongorm.Session{TrackChanges: true})
+	var loaded profile
+	if err := db.First(&loaded, p.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	loaded.Name = "anne"
+	loaded.Bio = ""
+	if err := db.Save(&loaded).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(*updates) != 1 {
+		t.Fatalf("updates = %v, want 1", *updates)
+	}
+	want := bson.M{"$set": bson.M{"name": "anne"}, "$unset": bson.M{"bio": ""}}
+	if got := (*updates)[0]; !equalDocuments(t, got, want) {
+		t.Fatalf("update = %v, want %v", got, want)
+	}
+
+	var stored profile
+	if err := orm.First(&stored, p.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "anne" || stored.Email != "ann@example.com" || stored.Bio != "" {
+		t.Fatalf("stored = %+v", stored)
+	}
+}
+
+func TestTrackChangesSkipsUnchangedDocuments(t *testing.T) {
+	orm := mongormtest.New()
+	updates := recordUpdates(t, orm)
+	p := profile{Name: "ann"}
+	if err := orm.Create(&p).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	db := orm.Session(&mongorm.Session{TrackChanges: true})
+	var loaded profile
+	if err := db.First(&loaded, p.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(&loaded).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(*updates) != 0 {
+		t.Fatalf("updates = %v, want none", *updates)
+	}
+
+	// Documents loaded outside the session are replaced whole.
+	if err := orm.Save(&loaded).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(*updates) != 1 {
+		t.Fatalf("updates = %v, want the replacement", *updates)
+	}
+}
+
+// equalDocuments reports whether a and b encode to the same document,
+// whatever the order of their keys.
+func equalDocuments(t *testing.T, a, b interface{}) bool {
+	t.Helper()
+	var docs [2]bson.M
+	for i, v := range []interface{}{a, b} {
+		data, err := bson.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bson.Unmarshal(data, &docs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reflect.DeepEqual(docs[0], docs[1])
+}
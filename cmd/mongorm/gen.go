@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const mongormPath = "github.com/imkrishnaagrawal/mongorm"
+
+// model is a struct type fields are generated for.
+type model struct {
+	name   string
+	fields []modelField
+}
+
+// modelField is a field of a model, with inlined structs flattened.
+type modelField struct {
+	name string
+	key  string
+	typ  string
+}
+
+func runGen(args []string) error {
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	typeNames := flags.String("type", "", "comma separated `names` of the models; defaults to the exported structs with an ID field")
+	output := flags.String("output", "mongorm_fields.go", "`file` to write, relative to the package directory")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: mongorm gen [flags] [dir]\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	dir := "."
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		dir = flags.Arg(0)
+	default:
+		flags.Usage()
+		return errors.New("too many arguments")
+	}
+
+	outPath := *output
+	if !filepath.IsAbs(outPath) {
+		outPath = filepath.Join(dir, outPath)
+	}
+	pkg, err := loadPackage(dir, outPath)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	if *typeNames != "" {
+		for _, name := range strings.Split(*typeNames, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	} else {
+		names = modelNames(pkg)
+		if len(names) == 0 {
+			return fmt.Errorf("no models in package %s; name them with -type", pkg.Name())
+		}
+	}
+
+	imports := map[string]string{mongormPath: "mongorm"}
+	qualifier := func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		imports[other.Path()] = other.Name()
+		return other.Name()
+	}
+	var models []model
+	for _, name := range names {
+		m, err := loadModel(pkg, name, qualifier)
+		if err != nil {
+			return err
+		}
+		models = append(models, m)
+	}
+
+	src, err := render(pkg.Name(), imports, models)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, src, 0o644)
+}
+
+// loadPackage type-checks the package in dir, leaving out the file at
+// outPath, which is about to be regenerated.
+func loadPackage(dir, outPath string) (*types.Package, error) {
+	buildPkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range buildPkg.GoFiles {
+		path := filepath.Join(dir, name)
+		if same, _ := sameFile(path, outPath); same {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	var typeErr error
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			if typeErr == nil {
+				typeErr = err
+			}
+		},
+	}
+	pkg, _ := conf.Check(buildPkg.ImportPath, fset, files, nil)
+	if pkg == nil {
+		return nil, typeErr
+	}
+	return pkg, nil
+}
+
+// sameFile reports whether the paths a and b name the same file.
+func sameFile(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return absA == absB, nil
+}
+
+// modelNames returns the exported struct types of pkg that have an ID field,
+// which mongorm identifies documents by.
+func modelNames(pkg *types.Package) []string {
+	var names []string
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || !obj.Exported() || obj.IsAlias() {
+			continue
+		}
+		if _, ok := obj.Type().Underlying().(*types.Struct); !ok {
+			continue
+		}
+		if field, _, _ := types.LookupFieldOrMethod(obj.Type(), false, pkg, "ID"); field != nil {
+			if _, ok := field.(*types.Var); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// loadModel returns the model for the struct type name of pkg, writing field
+// types with qualifier.
+func loadModel(pkg *types.Package, name string, qualifier types.Qualifier) (model, error) {
+	obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return model{}, fmt.Errorf("type %s not found in package %s", name, pkg.Name())
+	}
+	st, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return model{}, fmt.Errorf("type %s is not a struct", name)
+	}
+	m := model{name: name}
+	seen := map[string]bool{}
+	collectFields(st, qualifier, seen, &m.fields)
+	return m, nil
+}
+
+// collectFields appends the fields stored by st to fields, following
+// inlined structs as the bson codec does. Fields shadowed by one seen
+// earlier are skipped.
+func collectFields(st *types.Struct, qualifier types.Qualifier, seen map[string]bool, fields *[]modelField) {
+	var inlined []*types.Struct
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() {
+			continue
+		}
+		tag := strings.Split(reflect.StructTag(st.Tag(i)).Get("bson"), ",")
+		key, options := tag[0], tag[1:]
+		if key == "-" {
+			continue
+		}
+
+		typ := field.Type()
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		if inner, ok := typ.Underlying().(*types.Struct); ok && hasOption(options, "inline") {
+			inlined = append(inlined, inner)
+			continue
+		}
+
+		if key == "" {
+			key = strings.ToLower(field.Name())
+		}
+		if seen[field.Name()] {
+			continue
+		}
+		seen[field.Name()] = true
+		*fields = append(*fields, modelField{
+			name: field.Name(),
+			key:  key,
+			typ:  types.TypeString(typ, qualifier),
+		})
+	}
+	for _, inner := range inlined {
+		collectFields(inner, qualifier, seen, fields)
+	}
+}
+
+// hasOption reports whether options, the options of a bson tag, include
+// option.
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the formatted source of the generated file.
+func render(pkgName string, imports map[string]string, models []model) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by mongorm gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkgName)
+
+	// Standard library imports come first, in a group of their own.
+	paths := make([]string, 0, len(imports))
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	isStd := func(path string) bool { return !strings.Contains(strings.Split(path, "/")[0], ".") }
+	sort.Slice(paths, func(i, j int) bool {
+		if isStd(paths[i]) != isStd(paths[j]) {
+			return isStd(paths[i])
+		}
+		return paths[i] < paths[j]
+	})
+	buf.WriteString("import (\n")
+	for i, path := range paths {
+		if i > 0 && isStd(paths[i-1]) && !isStd(path) {
+			buf.WriteString("\n")
+		}
+		name := imports[path]
+		if name == filepath.Base(path) {
+			fmt.Fprintf(&buf, "\t%s\n", strconv.Quote(path))
+		} else {
+			fmt.Fprintf(&buf, "\t%s %s\n", name, strconv.Quote(path))
+		}
+	}
+	buf.WriteString(")\n")
+
+	for _, m := range models {
+		fmt.Fprintf(&buf, "\n// Document keys of %s.\nconst (\n", m.name)
+		for _, f := range m.fields {
+			fmt.Fprintf(&buf, "\t%sField%s = %s\n", m.name, f.name, strconv.Quote(f.key))
+		}
+		buf.WriteString(")\n")
+
+		fmt.Fprintf(&buf, "\n// %[1]sFields holds the typed fields of %[1]s for building filters.\n", m.name)
+		fmt.Fprintf(&buf, "var %sFields = struct {\n", m.name)
+		for _, f := range m.fields {
+			fmt.Fprintf(&buf, "\t%s mongorm.Field[%s]\n", f.name, f.typ)
+		}
+		buf.WriteString("}{\n")
+		for _, f := range m.fields {
+			fmt.Fprintf(&buf, "\t%s: mongorm.NewField[%s](%sField%s),\n", f.name, f.typ, m.name, f.name)
+		}
+		buf.WriteString("}\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
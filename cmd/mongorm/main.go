@@ -0,0 +1,46 @@
+// Command mongorm provides development tools for mongorm models.
+//
+// The gen command writes typed field constants and predicate builders for
+// the models of a package, usually from a go:generate directive next to
+// them:
+//
+//	//go:generate go run github.com/imkrishnaagrawal/mongorm/cmd/mongorm gen
+//
+// For a model User it declares the document key constants UserFieldName,
+// UserFieldAge and so on, and the variable UserFields holding a
+// mongorm.Field per field, so that filters such as UserFields.Age.Gt(30)
+// are checked by the compiler. Run "mongorm gen -h" for its flags.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: mongorm <command> [arguments]
+
+commands:
+  gen    generate typed fields for the models of a package
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "gen":
+		err = runGen(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "mongorm: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mongorm %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
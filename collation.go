@@ -0,0 +1,18 @@
+package mongorm
+
+import "go.mongodb.org/mongo-driver/mongo/options"
+
+// Collation compares strings by the rules of locale, such as "en" or "fr",
+// for the conditions, sorting and updates of the next operation. strength
+// sets how fine the comparison is: 1 ignores case and accents, 2 ignores
+// case only and 3, the default when strength is 0, tells both apart:
+//
+//	orm.Collation("en", 2).Where("email = ?", "Ann@Example.com").First(&user)
+//
+// A query only uses an index declared with the same collation, as with
+// the "collation" and "strength" index options.
+func (orm *MongoORM) Collation(locale string, strength int) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Collation = &options.Collation{Locale: locale, Strength: strength}
+	return tx
+}
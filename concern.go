@@ -0,0 +1,99 @@
+package mongorm
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// ReadPreference routes the next operation's reads according to rp, for
+// example to secondaries for analytics:
+//
+//	orm.ReadPreference(readpref.SecondaryPreferred()).Find(&events)
+func (orm *MongoORM) ReadPreference(rp *readpref.ReadPref) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.ReadPreference = rp
+	tx.refreshCollection()
+	return tx
+}
+
+// ReadConcern sets the read concern level, such as "majority" or "local",
+// of the next operation.
+func (orm *MongoORM) ReadConcern(level string) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.ReadConcern = &readconcern.ReadConcern{Level: level}
+	tx.refreshCollection()
+	return tx
+}
+
+// WriteConcern sets the write concern of the next operation. w is the
+// number of members that must acknowledge the write or "majority"; journal
+// requires the write to be journaled and timeout, if positive, bounds the
+// wait for acknowledgment:
+//
+//	orm.WriteConcern("majority", true, 5*time.Second).Create(&payment)
+func (orm *MongoORM) WriteConcern(w interface{}, journal bool, timeout time.Duration) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.WriteConcern = &writeconcern.WriteConcern{W: w, Journal: &journal, WTimeout: timeout}
+	tx.refreshCollection()
+	return tx
+}
+
+// collection returns the named collection of orm's database, applying the
+// routing, read preference and concerns of the statement.
+func (orm *MongoORM) collection(name string) *mongo.Collection {
+	stmt := orm.Statement
+	database := orm.databaseName(name)
+	embedded := false
+	if orm.schemas != nil {
+		_, embedded = orm.schemas.embedded.Load(name)
+	}
+	if stmt != nil {
+		name = stmt.CollectionPrefix + name
+	}
+	if !embedded && (stmt == nil || (stmt.ReadPreference == nil && stmt.ReadConcern == nil && stmt.WriteConcern == nil)) {
+		return orm.client.Database(database).Collection(name)
+	}
+
+	opts := options.Collection()
+	if embedded {
+		// Documents with embedded fields are flattened by the codecs.
+		opts.SetRegistry(embeddedRegistry)
+	}
+	if stmt == nil {
+		return orm.client.Database(database).Collection(name, opts)
+	}
+	if stmt.ReadPreference != nil {
+		opts.SetReadPreference(stmt.ReadPreference)
+	}
+	if stmt.ReadConcern != nil {
+		opts.SetReadConcern(stmt.ReadConcern)
+	}
+	if stmt.WriteConcern != nil {
+		opts.SetWriteConcern(stmt.WriteConcern)
+	}
+	return orm.client.Database(database).Collection(name, opts)
+}
+
+// refreshCollection reapplies the statement's settings to a collection
+// already selected with Model.
+func (orm *MongoORM) refreshCollection() {
+	if orm.Statement.Collection == nil || orm.client == nil {
+		return
+	}
+	if orm.Statement.Model != nil || orm.Statement.Table != "" {
+		orm.Statement.Collection = orm.collection(orm.determineCollectionName(orm.Statement.Model))
+		return
+	}
+	orm.Statement.Collection = orm.collection(orm.Statement.Collection.Name())
+}
+
+// routed reports whether callbacks routed the operation to another
+// database or prefixed its collections.
+func (stmt *Statement) routed() bool {
+	return stmt.Database != "" || stmt.CollectionPrefix != ""
+}
@@ -0,0 +1,320 @@
+package mongorm
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	conditionSeparator = regexp.MustCompile(`(?i)\s+and\s+`)
+	conditionPattern   = regexp.MustCompile(`(?i)^\s*([\w.$]+)\s*(=|==|!=|<>|>=|<=|>|<|not\s+in|in)\s*\?\s*$`)
+)
+
+// comparisonOperators maps the operators accepted in Where() conditions to
+// their MongoDB query operator. An empty value means plain equality.
+var comparisonOperators = map[string]string{
+	"=":      "",
+	"==":     "",
+	"!=":     "$ne",
+	"<>":     "$ne",
+	">":      "$gt",
+	">=":     "$gte",
+	"<":      "$lt",
+	"<=":     "$lte",
+	"in":     "$in",
+	"not in": "$nin",
+}
+
+// Where adds a condition to the query. Conditions are written as
+// "field op ?" where op is one of =, !=, <>, >, >=, <, <=, IN or NOT IN, and
+// several conditions may be joined with AND:
+//
+//	orm.Where("age > ? AND status IN ?", 30, []string{"active", "pending"})
+//
+// The field "id" refers to the document's _id; string arguments for it that
+// are hex encoded ObjectIDs are converted to primitive.ObjectID, others are
+// kept for models with string IDs. Calling Where several times ANDs the
+// conditions together.
+//
+// The query may also be a map of document keys to the values they must
+// equal, or a struct whose non-zero fields they must equal, stored under
+// the keys of its bson tags:
+//
+//	orm.Where(map[string]interface{}{"status": "active"}).Find(&users)
+//	orm.Where(&User{Status: "active", Role: "admin"}).Find(&users)
+//
+// Fields given as args after a struct are compared even when zero, and the
+// others left out:
+//
+//	orm.Where(&User{Status: "active"}, "Status", "Age").Find(&users)
+//
+// Or and Not accept the same queries.
+func (orm *MongoORM) Where(query interface{}, args ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	cond, err := tx.condition(query, args...)
+	if err != nil {
+		tx.AddError(err)
+		return tx
+	}
+	tx.addCondition(cond)
+	return tx
+}
+
+// Or adds a condition that is ORed with everything accumulated so far:
+//
+//	orm.Where("status = ?", "active").Or("role = ?", "admin")
+//
+// matches documents that are active or belong to an admin. Without a prior
+// condition Or behaves like Where.
+func (orm *MongoORM) Or(query interface{}, args ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	cond, err := tx.condition(query, args...)
+	if err != nil {
+		tx.AddError(err)
+		return tx
+	}
+	if len(tx.Statement.Filter) == 0 {
+		tx.Statement.Filter = cond
+		return tx
+	}
+
+	if or, ok := tx.Statement.Filter["$or"].(bson.A); ok && len(tx.Statement.Filter) == 1 {
+		tx.Statement.Filter = bson.M{"$or": append(append(bson.A{}, or...), cond)}
+	} else {
+		tx.Statement.Filter = bson.M{"$or": bson.A{tx.Statement.Filter, cond}}
+	}
+	return tx
+}
+
+// Not adds a negated condition, matching documents for which the condition
+// does not hold. It uses $nor so that documents missing the field match too,
+// mirroring MongoDB's $not semantics.
+func (orm *MongoORM) Not(query interface{}, args ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	cond, err := tx.condition(query, args...)
+	if err != nil {
+		tx.AddError(err)
+		return tx
+	}
+	tx.addCondition(bson.M{"$nor": bson.A{cond}})
+	return tx
+}
+
+// addFilters ANDs raw bson.M filters, as passed to Find, into the
+// accumulated filter.
+func (orm *MongoORM) addFilters(filters []interface{}) error {
+	for _, filter := range filters {
+		switch f := filter.(type) {
+		case bson.M:
+			orm.addCondition(f)
+		case map[string]interface{}:
+			orm.addCondition(bson.M(f))
+		default:
+			return fmt.Errorf("%w: unsupported filter type %T", ErrInvalidCondition, filter)
+		}
+	}
+	return nil
+}
+
+// addCondition ANDs cond into the accumulated filter.
+func (orm *MongoORM) addCondition(cond bson.M) {
+	orm.Statement.Filter = mergeConditions(orm.Statement.Filter, cond)
+}
+
+// mergeConditions ANDs two filters together. Disjoint fields are merged into
+// a single document; overlapping fields or operators fall back to $and.
+func mergeConditions(filter, cond bson.M) bson.M {
+	if len(cond) == 0 {
+		return filter
+	}
+	if len(filter) == 0 {
+		return cond
+	}
+
+	merged := bson.M{}
+	for key, value := range filter {
+		merged[key] = value
+	}
+	for key, value := range cond {
+		if _, exists := merged[key]; exists || strings.HasPrefix(key, "$") {
+			return bson.M{"$and": bson.A{filter, cond}}
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// condition translates the query and args given to Where, Or or Not into a
+// bson filter.
+func (orm *MongoORM) condition(query interface{}, args ...interface{}) (bson.M, error) {
+	switch q := query.(type) {
+	case string:
+		return parseCondition(q, args...)
+	case bson.M:
+		return mapCondition(q, args)
+	case map[string]interface{}:
+		return mapCondition(q, args)
+	case bson.D:
+		return mapCondition(q.Map(), args)
+	}
+	v := reflect.ValueOf(query)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: unsupported condition type %T", ErrInvalidCondition, query)
+	}
+	return orm.structCondition(v, args)
+}
+
+// mapCondition returns the equality conditions of m, whose "id" key refers
+// to _id as in Where strings.
+func mapCondition(m map[string]interface{}, args []interface{}) (bson.M, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("%w: a map condition takes no arguments, got %d", ErrInvalidCondition, len(args))
+	}
+	cond := bson.M{}
+	for key, value := range m {
+		if key == "id" || key == "_id" {
+			key, value = "_id", normalizeObjectID(value)
+		}
+		cond[key] = value
+	}
+	return cond, nil
+}
+
+// structCondition returns the equality conditions on the fields of v, a
+// struct, named by fields, or else on those not holding zero values. A
+// field is zero when it encodes as it does in a zero struct, so that the
+// fields of embedded and inlined structs are compared one by one.
+func (orm *MongoORM) structCondition(v reflect.Value, fields []interface{}) (bson.M, error) {
+	doc, err := toDocument(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	cond := bson.M{}
+	if len(fields) > 0 {
+		for _, field := range fields {
+			name, ok := field.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: fields of a struct condition must be strings, got %T", ErrInvalidCondition, field)
+			}
+			key := orm.documentKey(v.Type(), name)
+			value, ok := doc[key]
+			if !ok {
+				// omitempty leaves zero values out of doc.
+				f, found := orm.lookupField(v.Type(), name)
+				if !found {
+					return nil, fmt.Errorf("%w: %v has no field %q", ErrInvalidCondition, v.Type(), name)
+				}
+				value = reflect.Zero(f.Type).Interface()
+			}
+			cond[key] = value
+		}
+		return cond, nil
+	}
+
+	zero, err := toDocument(reflect.Zero(v.Type()).Interface())
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range doc {
+		if zeroValue, ok := zero[key]; ok && reflect.DeepEqual(value, zeroValue) {
+			continue
+		}
+		cond[key] = value
+	}
+	return cond, nil
+}
+
+// parseCondition translates a Where() style query string and its
+// placeholder arguments into a bson filter.
+func parseCondition(query string, args ...interface{}) (bson.M, error) {
+	clauses := conditionSeparator.Split(strings.TrimSpace(query), -1)
+	if len(clauses) != len(args) {
+		return nil, fmt.Errorf("%w: %q expects %d arguments, got %d", ErrInvalidCondition, query, len(clauses), len(args))
+	}
+
+	var filter bson.M
+	for i, clause := range clauses {
+		matches := conditionPattern.FindStringSubmatch(clause)
+		if matches == nil {
+			return nil, fmt.Errorf("%w: unsupported clause %q", ErrInvalidCondition, clause)
+		}
+
+		field := matches[1]
+		operator := comparisonOperators[strings.Join(strings.Fields(strings.ToLower(matches[2])), " ")]
+		value := args[i]
+
+		if field == "id" || field == "_id" {
+			field = "_id"
+			value = normalizeObjectID(value)
+		}
+
+		if operator == "$in" || operator == "$nin" {
+			values, err := toBSONArray(value)
+			if err != nil {
+				return nil, err
+			}
+			value = values
+		}
+
+		if operator == "" {
+			filter = mergeConditions(filter, bson.M{field: value})
+		} else {
+			filter = mergeConditions(filter, bson.M{field: bson.M{operator: value}})
+		}
+	}
+	return filter, nil
+}
+
+// normalizeObjectID converts hex strings, or slices of them, into
+// primitive.ObjectID values. Other values, including strings that are not
+// ObjectIDs and slices holding any, are returned unchanged.
+func normalizeObjectID(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if id, err := parseObjectID(v); err == nil {
+			return id
+		}
+	case []string:
+		ids := make([]primitive.ObjectID, len(v))
+		for i, s := range v {
+			id, err := parseObjectID(s)
+			if err != nil {
+				return value
+			}
+			ids[i] = id
+		}
+		return ids
+	}
+	return value
+}
+
+// normalizeID converts id, an _id value for documents of t, as parseID
+// does when it is a string, and as normalizeObjectID does otherwise.
+func normalizeID(t reflect.Type, id interface{}) (interface{}, error) {
+	if s, ok := id.(string); ok {
+		return parseID(t, s)
+	}
+	return normalizeObjectID(id), nil
+}
+
+// toBSONArray converts any slice or array value into a bson.A.
+func toBSONArray(value interface{}) (bson.A, error) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%w: IN expects a slice argument, got %T", ErrInvalidCondition, value)
+	}
+	values := make(bson.A, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, nil
+}
@@ -0,0 +1,136 @@
+package mongorm_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWhereParsesConditions(t *testing.T) {
+	id := primitive.NewObjectID()
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  bson.M
+	}{
+		{"age = ?", []interface{}{30}, bson.M{"age": 30}},
+		{"age == ?", []interface{}{30}, bson.M{"age": 30}},
+		{"age != ?", []interface{}{30}, bson.M{"age": bson.M{"$ne": 30}}},
+		{"age <> ?", []interface{}{30}, bson.M{"age": bson.M{"$ne": 30}}},
+		{"age > ?", []interface{}{30}, bson.M{"age": bson.M{"$gt": 30}}},
+		{"age >= ?", []interface{}{30}, bson.M{"age": bson.M{"$gte": 30}}},
+		{"age < ?", []interface{}{30}, bson.M{"age": bson.M{"$lt": 30}}},
+		{"age <= ?", []interface{}{30}, bson.M{"age": bson.M{"$lte": 30}}},
+		{"age>?", []interface{}{30}, bson.M{"age": bson.M{"$gt": 30}}},
+		{"status IN ?", []interface{}{[]string{"a", "b"}}, bson.M{"status": bson.M{"$in": bson.A{"a", "b"}}}},
+		{"status in ?", []interface{}{[2]int{1, 2}}, bson.M{"status": bson.M{"$in": bson.A{1, 2}}}},
+		{"status NOT  IN ?", []interface{}{[]string{"a"}}, bson.M{"status": bson.M{"$nin": bson.A{"a"}}}},
+		{"address.city = ?", []interface{}{"Pune"}, bson.M{"address.city": "Pune"}},
+		{"id = ?", []interface{}{id.Hex()}, bson.M{"_id": id}},
+		{"_id = ?", []interface{}{"slug"}, bson.M{"_id": "slug"}},
+		{"id IN ?", []interface{}{[]string{id.Hex()}}, bson.M{"_id": bson.M{"$in": bson.A{id}}}},
+		{
+			"age > ? AND status = ? and role != ?",
+			[]interface{}{30, "active", "admin"},
+			bson.M{"age": bson.M{"$gt": 30}, "status": "active", "role": bson.M{"$ne": "admin"}},
+		},
+		{
+			"age > ? AND age < ?",
+			[]interface{}{30, 40},
+			bson.M{"$and": bson.A{bson.M{"age": bson.M{"$gt": 30}}, bson.M{"age": bson.M{"$lt": 40}}}},
+		},
+	}
+	orm := mongormtest.New()
+	for _, tt := range tests {
+		tx := orm.Where(tt.query, tt.args...)
+		if tx.Error != nil {
+			t.Errorf("Where(%q) error = %v", tt.query, tx.Error)
+			continue
+		}
+		if got := tx.Statement.Filter; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Where(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestWhereRejectsInvalidConditions(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"age = ?", nil},
+		{"age = ?", []interface{}{1, 2}},
+		{"age > ? AND status = ?", []interface{}{1}},
+		{"age", []interface{}{1}},
+		{"age = 30", []interface{}{1}},
+		{"age LIKE ?", []interface{}{"a"}},
+		{"age = ? OR status = ?", []interface{}{1, "a"}},
+		{"status IN ?", []interface{}{"active"}},
+		{"status NOT IN ?", []interface{}{1}},
+	}
+	orm := mongormtest.New()
+	for _, tt := range tests {
+		if err := orm.Where(tt.query, tt.args...).Error; !errors.Is(err, mongorm.ErrInvalidCondition) {
+			t.Errorf("Where(%q, %v) error = %v, want ErrInvalidCondition", tt.query, tt.args, err)
+		}
+	}
+}
+
+func TestConditionsAreMerged(t *testing.T) {
+	orm := mongormtest.New()
+	tests := []struct {
+		name string
+		tx   *mongorm.MongoORM
+		want bson.M
+	}{
+		{
+			"disjoint fields",
+			orm.Where("a = ?", 1).Where("b = ?", 2),
+			bson.M{"a": 1, "b": 2},
+		},
+		{
+			"same field",
+			orm.Where("a > ?", 1).Where("a < ?", 5),
+			bson.M{"$and": bson.A{bson.M{"a": bson.M{"$gt": 1}}, bson.M{"a": bson.M{"$lt": 5}}}},
+		},
+		{
+			"operator key",
+			orm.Where("a = ?", 1).Not("b = ?", 2),
+			bson.M{"$and": bson.A{bson.M{"a": 1}, bson.M{"$nor": bson.A{bson.M{"b": 2}}}}},
+		},
+		{
+			"Or",
+			orm.Where("a = ?", 1).Or("b = ?", 2).Or("c = ?", 3),
+			bson.M{"$or": bson.A{bson.M{"a": 1}, bson.M{"b": 2}, bson.M{"c": 3}}},
+		},
+		{
+			"Or first",
+			orm.Or("a = ?", 1),
+			bson.M{"a": 1},
+		},
+		{
+			"Where after Or",
+			orm.Where("a = ?", 1).Or("b = ?", 2).Where("c = ?", 3),
+			bson.M{"$or": bson.A{bson.M{"a": 1}, bson.M{"b": 2}}, "c": 3},
+		},
+		{
+			"map",
+			orm.Where(map[string]interface{}{"id": "slug", "b": 2}).Where("c = ?", 3),
+			bson.M{"_id": "slug", "b": 2, "c": 3},
+		},
+	}
+	for _, tt := range tests {
+		if tt.tx.Error != nil {
+			t.Errorf("%s: error = %v", tt.name, tt.tx.Error)
+			continue
+		}
+		if got := tt.tx.Statement.Filter; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: filter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package mongorm
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultTimeout bounds operations whose context has no deadline unless
+// Config.DefaultTimeout says otherwise.
+const defaultTimeout = 10 * time.Second
+
+// timeout returns the configured timeout for operations of kind op.
+func (c *Config) timeout(op string) time.Duration {
+	if c == nil {
+		return defaultTimeout
+	}
+
+	var timeout time.Duration
+	switch op {
+	case opCreate:
+		timeout = c.CreateTimeout
+	case opQuery:
+		timeout = c.QueryTimeout
+	case opUpdate:
+		timeout = c.UpdateTimeout
+	case opDelete:
+		timeout = c.DeleteTimeout
+	}
+	if timeout == 0 {
+		timeout = c.DefaultTimeout
+	}
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return timeout
+}
+
+// Config holds settings shared by a MongoORM and every instance derived from
+// it. It is passed to NewMongoORM.
+type Config struct {
+	// NamingStrategy derives collection names for models that do not
+	// implement CollectionNamer, and document keys for untagged fields.
+	// Defaults to DefaultNamingStrategy.
+	NamingStrategy NamingStrategy
+
+	// AllowGlobalUpdate permits multi-document updates and deletes without
+	// conditions, which otherwise fail with ErrMissingWhereClause.
+	AllowGlobalUpdate bool
+
+	// DefaultTimeout bounds operations whose context, set with WithContext,
+	// has no deadline. Zero means 10 seconds; a negative value disables the
+	// timeout.
+	DefaultTimeout time.Duration
+	// CreateTimeout, QueryTimeout, UpdateTimeout and DeleteTimeout override
+	// DefaultTimeout for the operations run by the corresponding callback
+	// processor. Zero falls back to DefaultTimeout.
+	CreateTimeout time.Duration
+	QueryTimeout  time.Duration
+	UpdateTimeout time.Duration
+	DeleteTimeout time.Duration
+
+	// NowFunc returns the time stamped into timestamp fields. Defaults to
+	// time.Now.
+	NowFunc func() time.Time
+
+	// Logger receives a trace of every operation. Defaults to DefaultLogger.
+	Logger Logger
+
+	// SchemaValidation makes AutoMigrate install on the collection of each
+	// model the $jsonSchema validator returned by JSONSchema, so that the
+	// server rejects malformed documents written by any client.
+	SchemaValidation bool
+
+	// Databases maps collection names to the database holding them, for
+	// models kept outside the database given to NewMongoORM. Models may
+	// also choose their database by implementing DatabaseNamer.
+	Databases map[string]string
+
+	// FileBucket is the name of the GridFS bucket holding the content of
+	// File fields. Defaults to "fs".
+	FileBucket string
+
+	// DisableForeignKeyIndexes stops AutoMigrate from indexing the foreign
+	// keys of associations, which it otherwise does so that loading them
+	// does not scan whole collections.
+	DisableForeignKeyIndexes bool
+
+	// IDGenerators holds ID generators by name, for ID fields tagged
+	// mongorm:"idGenerator:<name>". They are added to the built-in "uuid"
+	// and "objectid" generators, which they may replace.
+	IDGenerators map[string]IDGenerator
+
+	// Plugins holds the plugins added with RegisterPlugin, by name.
+	Plugins map[string]Plugin
+	// pluginsMu guards Plugins while plugins are registered.
+	pluginsMu sync.Mutex
+}
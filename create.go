@@ -0,0 +1,158 @@
+package mongorm
+
+import (
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateInBatches inserts the elements of docs, a slice or pointer to one,
+// with one InsertMany per batchSize elements. It stops at the first failing
+// batch; RowsAffected counts the documents inserted until then.
+func (orm *MongoORM) CreateInBatches(docs interface{}, batchSize int) *MongoORM {
+	return orm.execute(opCreate, docs, func(tx *MongoORM) {
+		tx.createInBatches(tx.Statement.Dest, batchSize)
+	})
+}
+
+// createInBatches is the built-in step of CreateInBatches.
+func (orm *MongoORM) createInBatches(docs interface{}, batchSize int) *MongoORM {
+	sliceValue, ok := sliceOf(docs)
+	if !ok {
+		orm.Error = ErrNotSlice
+		return orm
+	}
+	return orm.createMany(sliceValue, batchSize)
+}
+
+// Ordered controls whether slice inserts stop at the first failing
+// document (the default) or attempt every document and report all failures.
+func (orm *MongoORM) Ordered(ordered bool) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Ordered = &ordered
+	return tx
+}
+
+func (orm *MongoORM) createMany(sliceValue reflect.Value, batchSize int) *MongoORM {
+	if orm.Error != nil {
+		return orm
+	}
+	if batchSize <= 0 {
+		batchSize = sliceValue.Len()
+	}
+
+	collectionName := orm.determineCollectionName(sliceValue.Interface())
+	collection := orm.collection(collectionName)
+
+	opts := options.InsertMany()
+	if orm.Statement.Ordered != nil {
+		opts.SetOrdered(*orm.Statement.Ordered)
+	}
+	orm.Statement.Ordered = nil
+	orm.RowsAffected = 0
+
+	for start := 0; start < sliceValue.Len(); start += batchSize {
+		end := start + batchSize
+		if end > sliceValue.Len() {
+			end = sliceValue.Len()
+		}
+
+		docs := make([]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			elem := sliceValue.Index(i)
+			if elem.Kind() != reflect.Ptr {
+				elem = elem.Addr()
+			}
+			if err := orm.callHook(elem.Interface(), hookBeforeCreate); err != nil {
+				orm.Error = err
+				return orm
+			}
+			if err := orm.assignID(elem.Interface()); err != nil {
+				orm.Error = err
+				return orm
+			}
+			orm.stampCreate(elem.Interface())
+			if err := orm.validate(elem.Interface(), false); err != nil {
+				orm.Error = err
+				return orm
+			}
+			if !orm.Statement.DryRun {
+				if err := orm.createReferenced(elem.Interface()); err != nil {
+					orm.Error = translateError(err)
+					return orm
+				}
+			}
+			orm.setReferenceArrays(elem.Interface())
+			orm.initVersion(elem.Interface())
+			insert, err := orm.writeDocument(elem.Interface())
+			if err != nil {
+				orm.Error = err
+				return orm
+			}
+			docs = append(docs, insert)
+		}
+
+		orm.Statement.record(collection, "insertMany", docs)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		ctx, cancel := orm.operationContext()
+		result, err := collection.InsertMany(ctx, docs, opts)
+		cancel()
+		if result != nil {
+			for i, id := range result.InsertedIDs {
+				setDocumentID(sliceValue.Index(start+i), id)
+			}
+			orm.RowsAffected += uint(len(result.InsertedIDs))
+		}
+		if err != nil {
+			orm.Error = translateError(err)
+			return orm
+		}
+		for i := start; i < end; i++ {
+			ctx, cancel := orm.operationContext()
+			err := orm.createReferrers(ctx, elemPointer(sliceValue.Index(i)))
+			cancel()
+			if err != nil {
+				orm.Error = translateError(err)
+				return orm
+			}
+		}
+		if err := orm.callHookEach(sliceValue.Slice(start, end), hookAfterCreate); err != nil {
+			orm.Error = err
+			return orm
+		}
+	}
+	return orm
+}
+
+// sliceOf returns the slice held by docs, which may be a slice or a pointer
+// to one.
+func sliceOf(docs interface{}) (reflect.Value, bool) {
+	value := reflect.ValueOf(docs)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice {
+		return reflect.Value{}, false
+	}
+	return value, true
+}
+
+// setDocumentID stores id in the ID field of doc if it is not yet set.
+func setDocumentID(doc reflect.Value, id interface{}) {
+	for doc.Kind() == reflect.Ptr {
+		if doc.IsNil() {
+			return
+		}
+		doc = doc.Elem()
+	}
+	if doc.Kind() != reflect.Struct {
+		return
+	}
+
+	idField := idValue(doc)
+	if idField.IsValid() && idField.CanSet() && idIsZero(idField) {
+		setID(idField, id)
+	}
+}
@@ -0,0 +1,76 @@
+package mongorm
+
+import "reflect"
+
+// DatabaseNamer is implemented by models kept outside the database given to
+// NewMongoORM, such as analytics events split from the hot data:
+//
+//	func (Event) DatabaseName() string { return "analytics" }
+//
+// Config.Databases does the same by collection name.
+type DatabaseNamer interface {
+	DatabaseName() string
+}
+
+// Use runs the next operation against database, overriding the database of
+// the model:
+//
+//	orm.Use("analytics").Where("type = ?", "click").Find(&events)
+//
+// Joins and preloads look up associated documents in the same database,
+// since $lookup cannot reach another one.
+func (orm *MongoORM) Use(database string) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Database = database
+	tx.refreshCollection()
+	return tx
+}
+
+// Table runs the next operation against the collection name instead of
+// that of the model, for models split across collections such as monthly
+// partitions of events:
+//
+//	orm.Table("events_2024_05").Where("kind = ?", "click").Find(&events)
+//	orm.Table("events_2024_06").Create(&event)
+//
+// The collection takes the place of the model's one in Config.Databases;
+// use Use to pick its database otherwise.
+func (orm *MongoORM) Table(name string) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Table = name
+	if tx.client != nil {
+		tx.Statement.Collection = tx.collection(name)
+	}
+	return tx
+}
+
+// databaseName returns the database holding the named collection: the one
+// given to Use, the one the collection's model chose, or orm's own.
+func (orm *MongoORM) databaseName(collection string) string {
+	if orm.Statement != nil && orm.Statement.Database != "" {
+		return orm.Statement.Database
+	}
+	if orm.config != nil {
+		if database, ok := orm.config.Databases[collection]; ok {
+			return database
+		}
+	}
+	if orm.schemas != nil {
+		if database, ok := orm.schemas.databases.Load(collection); ok {
+			return database.(string)
+		}
+	}
+	return orm.database
+}
+
+// parseDatabaseName returns the database chosen by the model type t with
+// DatabaseNamer, if any.
+func parseDatabaseName(t reflect.Type) string {
+	if t.Kind() == reflect.Interface {
+		return ""
+	}
+	if namer, ok := reflect.New(t).Interface().(DatabaseNamer); ok {
+		return namer.DatabaseName()
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package mongorm_test
+
+import (
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type player struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty"`
+	Name string             `bson:"name"`
+	Rank int                `bson:"rank"`
+}
+
+func newPlayers(t *testing.T) (*mongorm.MongoORM, []player) {
+	t.Helper()
+	orm := mongormtest.New()
+	players := []player{{Name: "ann", Rank: 1}, {Name: "bob", Rank: 1}, {Name: "cy", Rank: 2}}
+	for i := range players {
+		if err := orm.Create(&players[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return orm, players
+}
+
+func remaining(t *testing.T, orm *mongorm.MongoORM) []string {
+	t.Helper()
+	var players []player
+	if err := orm.Order("name").Find(&players).Error; err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, p := range players {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestDeleteWithConditionsDeletesTheDocumentOnly(t *testing.T) {
+	orm, players := newPlayers(t)
+	tx := orm.Where("rank = ?", 1).Delete(&players[0])
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx.RowsAffected != 1 {
+		t.Fatalf("RowsAffected = %d, want 1", tx.RowsAffected)
+	}
+	if got := remaining(t, orm); len(got) != 2 || got[0] != "bob" || got[1] != "cy" {
+		t.Fatalf("remaining players = %v, want bob and cy", got)
+	}
+
+	tx = orm.Where("rank = ?", 1).Delete(&players[2])
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx.RowsAffected != 0 {
+		t.Fatalf("RowsAffected of a document not matching the conditions = %d, want 0", tx.RowsAffected)
+	}
+}
+
+func TestDeleteWithConditionsDeletesEveryMatch(t *testing.T) {
+	orm, _ := newPlayers(t)
+	tx := orm.Where("rank = ?", 1).Delete(&player{})
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx.RowsAffected != 2 {
+		t.Fatalf("RowsAffected = %d, want 2", tx.RowsAffected)
+	}
+	if got := remaining(t, orm); len(got) != 1 || got[0] != "cy" {
+		t.Fatalf("remaining players = %v, want cy", got)
+	}
+}
+
+func TestDeleteByID(t *testing.T) {
+	orm, players := newPlayers(t)
+	if err := orm.Delete(&player{}, players[1].ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := remaining(t, orm); len(got) != 2 || got[0] != "ann" || got[1] != "cy" {
+		t.Fatalf("remaining players = %v, want ann and cy", got)
+	}
+	if err := orm.Delete(&player{}).Error; err != mongorm.ErrMissingID {
+		t.Fatalf("Delete without ID or conditions error = %v, want ErrMissingID", err)
+	}
+}
@@ -0,0 +1,301 @@
+package mongorm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// A struct field tagged "embedded" is stored flattened into its parent
+// document rather than as a sub-document, its keys starting with the
+// prefix given by "embeddedPrefix", so that value objects can be composed
+// into a model without nesting:
+//
+//	type Money struct {
+//		Amount   int64  `bson:"amount"`
+//		Currency string `bson:"currency"`
+//	}
+//
+//	type Invoice struct {
+//		ID    primitive.ObjectID `bson:"_id,omitempty"`
+//		Total Money              `bson:"total" mongorm:"embedded;embeddedPrefix:total_"`
+//		Tax   Money              `bson:"tax" mongorm:"embedded;embeddedPrefix:tax_"`
+//	}
+//
+// stores {"_id": ..., "total_amount": 1200, "total_currency": "EUR",
+// "tax_amount": 240, "tax_currency": "EUR"}. The flattened keys are
+// addressed through the embedding field, as in Path(&Invoice{}, "Tax",
+// "Amount") or Pluck("Tax.Amount"); indexes and schema validators declared
+// on the embedded struct apply to them.
+//
+// The collections of models with embedded fields encode and decode
+// documents with embeddedRegistry, the driver's default codecs with the
+// flattening added, so codecs registered on the client do not apply to
+// them.
+var embeddedRegistry = newEmbeddedRegistry()
+
+func newEmbeddedRegistry() *bsoncodec.Registry {
+	registry := bson.NewRegistry()
+	codec, err := bsoncodec.NewStructCodec(bsoncodec.DefaultStructTagParser)
+	if err != nil {
+		panic(err)
+	}
+	registry.RegisterKindEncoder(reflect.Struct, embeddedCodec{codec})
+	registry.RegisterKindDecoder(reflect.Struct, embeddedCodec{codec})
+	return registry
+}
+
+// embeddedPrefix returns the prefix of the keys of field when it is tagged
+// "embedded" or "embeddedPrefix", and whether it is.
+func embeddedPrefix(field reflect.StructField) (string, bool) {
+	if indirectType(field.Type).Kind() != reflect.Struct {
+		return "", false
+	}
+	settings := fieldSettings(field)
+	prefix, prefixed := settings["embeddedprefix"]
+	if _, embedded := settings["embedded"]; !embedded && !prefixed {
+		return "", false
+	}
+	return prefix, true
+}
+
+// embeddedField is a field of a struct flattened into its document.
+type embeddedField struct {
+	// key is the key the bson codec stores the field under, prefix that of
+	// its flattened keys, and keys those keys without the prefix.
+	key    string
+	prefix string
+	keys   map[string]bool
+}
+
+// embeddedFields caches the embedded fields of struct types.
+var embeddedFields sync.Map // reflect.Type -> []embeddedField
+
+// structEmbeddedFields returns the embedded fields of the struct type t,
+// including those of inlined structs.
+func structEmbeddedFields(t reflect.Type) []embeddedField {
+	if fields, ok := embeddedFields.Load(t); ok {
+		return fields.([]embeddedField)
+	}
+	var fields []embeddedField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if isInline(field) {
+			fields = append(fields, structEmbeddedFields(indirectType(field.Type))...)
+			continue
+		}
+		prefix, ok := embeddedPrefix(field)
+		if !ok {
+			continue
+		}
+		tags, err := bsoncodec.DefaultStructTagParser.ParseStructTags(field)
+		if err != nil || tags.Skip {
+			continue
+		}
+		fields = append(fields, embeddedField{key: tags.Name, prefix: prefix, keys: codecKeys(indirectType(field.Type))})
+	}
+	embeddedFields.Store(t, fields)
+	return fields
+}
+
+// codecKeys returns the keys the bson codec stores the fields of the
+// struct type t under, flattening embedded fields.
+func codecKeys(t reflect.Type) map[string]bool {
+	keys := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tags, err := bsoncodec.DefaultStructTagParser.ParseStructTags(field)
+		if err != nil || tags.Skip {
+			continue
+		}
+		switch prefix, embedded := embeddedPrefix(field); {
+		case tags.Inline && indirectType(field.Type).Kind() == reflect.Struct:
+			for key := range codecKeys(indirectType(field.Type)) {
+				keys[key] = true
+			}
+		case embedded:
+			for key := range codecKeys(indirectType(field.Type)) {
+				keys[prefix+key] = true
+			}
+		default:
+			keys[tags.Name] = true
+		}
+	}
+	return keys
+}
+
+// hasEmbeddedFields reports whether documents of type t, or documents
+// nested in them, have embedded fields.
+func hasEmbeddedFields(t reflect.Type, visited map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || visited[t] {
+		return false
+	}
+	visited[t] = true
+	if len(structEmbeddedFields(t)) > 0 {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.IsExported() && hasEmbeddedFields(field.Type, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedCodec is the bson codec of structs, flattening their embedded
+// fields.
+type embeddedCodec struct {
+	*bsoncodec.StructCodec
+}
+
+// EncodeValue encodes val as the struct codec does, then moves the keys of
+// its embedded fields up into the document.
+func (c embeddedCodec) EncodeValue(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	fields := structEmbeddedFields(val.Type())
+	if len(fields) == 0 {
+		return c.StructCodec.EncodeValue(ec, vw, val)
+	}
+
+	var buf bytes.Buffer
+	encoded, err := bsonrw.NewBSONValueWriter(&buf)
+	if err != nil {
+		return err
+	}
+	if err := c.StructCodec.EncodeValue(ec, encoded, val); err != nil {
+		return err
+	}
+	elements, err := bson.Raw(buf.Bytes()).Elements()
+	if err != nil {
+		return err
+	}
+
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	for _, element := range elements {
+		field, ok := findEmbeddedField(fields, element.Key())
+		if !ok {
+			doc = append(doc, element...)
+			continue
+		}
+		nested, ok := element.Value().DocumentOK()
+		if !ok {
+			continue
+		}
+		values, err := nested.Elements()
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			doc = bsoncore.AppendHeader(doc, bsontype.Type(value[0]), field.prefix+value.Key())
+			doc = append(doc, value.Value().Value...)
+		}
+	}
+	doc, err = bsoncore.AppendDocumentEnd(doc, idx)
+	if err != nil {
+		return err
+	}
+	return bsonrw.Copier{}.CopyDocumentFromBytes(vw, doc)
+}
+
+// DecodeValue gathers the keys of the embedded fields of val back into
+// sub-documents, then decodes the document as the struct codec does.
+func (c embeddedCodec) DecodeValue(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	fields := structEmbeddedFields(val.Type())
+	// A reader positioned on a whole document has no type.
+	if len(fields) == 0 || (vr.Type() != bsontype.EmbeddedDocument && vr.Type() != 0) {
+		return c.StructCodec.DecodeValue(dc, vr, val)
+	}
+
+	data, err := bsonrw.Copier{}.CopyDocumentToBytes(vr)
+	if err != nil {
+		return err
+	}
+	elements, err := bson.Raw(data).Elements()
+	if err != nil {
+		return err
+	}
+	nested := make([][]byte, len(fields))
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	for _, element := range elements {
+		key := element.Key()
+		moved := false
+		for i, field := range fields {
+			if rest, ok := strings.CutPrefix(key, field.prefix); ok && field.keys[rest] {
+				nested[i] = bsoncore.AppendHeader(nested[i], bsontype.Type(element[0]), rest)
+				nested[i] = append(nested[i], element.Value().Value...)
+				moved = true
+				break
+			}
+		}
+		if !moved {
+			doc = append(doc, element...)
+		}
+	}
+	for i, field := range fields {
+		if nested[i] == nil {
+			continue
+		}
+		doc = bsoncore.AppendDocumentElement(doc, field.key, bsoncore.BuildDocument(nil, nested[i]))
+	}
+	doc, err = bsoncore.AppendDocumentEnd(doc, idx)
+	if err != nil {
+		return err
+	}
+	return c.StructCodec.DecodeValue(dc, bsonrw.NewBSONDocumentReader(doc), val)
+}
+
+func findEmbeddedField(fields []embeddedField, key string) (embeddedField, bool) {
+	for _, field := range fields {
+		if field.key == key {
+			return field, true
+		}
+	}
+	return embeddedField{}, false
+}
+
+// marshalDocument encodes v, a document, flattening embedded fields.
+func marshalDocument(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	vw, err := bsonrw.NewBSONValueWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := bson.NewEncoder(vw)
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.SetRegistry(embeddedRegistry); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalDocument decodes data into v, gathering embedded fields.
+func unmarshalDocument(data []byte, v interface{}) error {
+	dec, err := bson.NewDecoder(bsonrw.NewBSONDocumentReader(data))
+	if err != nil {
+		return err
+	}
+	if err := dec.SetRegistry(embeddedRegistry); err != nil {
+		return err
+	}
+	return dec.Decode(v)
+}
@@ -0,0 +1,195 @@
+package mongorm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrRecordNotFound is returned when a single-document query such as
+	// First matches nothing. It wraps mongo.ErrNoDocuments.
+	ErrRecordNotFound = fmt.Errorf("record not found: %w", mongo.ErrNoDocuments)
+	// ErrDuplicateKey is returned when a write violates a unique index. The
+	// returned error is a *DuplicateKeyError describing the collision.
+	ErrDuplicateKey = errors.New("duplicate key")
+	// ErrInvalidObjectID is returned when a string is not a valid hex
+	// encoded ObjectID.
+	ErrInvalidObjectID = errors.New("invalid ObjectID")
+	// ErrInvalidUUID is returned when a string is not a valid UUID.
+	ErrInvalidUUID = errors.New("invalid UUID")
+	// ErrMissingID is returned when an operation needs the document's ID but
+	// the document has none.
+	ErrMissingID = errors.New("document must have a valid ID field")
+	// ErrMissingModel is returned by operations that need a collection but
+	// were not given a model with Model.
+	ErrMissingModel = errors.New("model not specified, call Model() first")
+	// ErrMissingClient is returned when the MongoORM was created without a
+	// mongo.Client.
+	ErrMissingClient = errors.New("mongo client not initialized")
+	// ErrInvalidCondition is returned when a Where, Or or Not condition
+	// cannot be parsed.
+	ErrInvalidCondition = errors.New("invalid condition")
+	// ErrMissingWhereClause is returned by multi-document writes issued
+	// without conditions, which would affect the whole collection.
+	ErrMissingWhereClause = errors.New("where conditions required")
+	// ErrInvalidUpdate is returned when an update document given to
+	// RawUpdate is malformed.
+	ErrInvalidUpdate = errors.New("invalid update")
+	// ErrEmptyUpdate is returned when an update has no fields to change.
+	ErrEmptyUpdate = errors.New("update has no fields")
+	// ErrNotSlice is returned when an operation expecting a slice of
+	// documents is given something else.
+	ErrNotSlice = errors.New("documents must be a slice or a pointer to a slice")
+	// ErrInvalidAssociation is returned when a name given to Joins or
+	// Association is not an association of the model, or documents given to
+	// an Association method do not fit it.
+	ErrInvalidAssociation = errors.New("invalid association")
+	// ErrInvalidCursor is returned by FindPage when a Paginator token is
+	// malformed or was issued for another sort order.
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+	// ErrStaleObject is returned by Save and Updates when a document using
+	// optimistic locking was changed by another writer since it was read.
+	ErrStaleObject = errors.New("stale object: document was modified concurrently")
+	// ErrValidation is returned by Create, Save and Updates when a document
+	// fails the rules of its validate tags. The returned error is a
+	// *ValidationError listing the failing fields.
+	ErrValidation = errors.New("validation failed")
+	// ErrNotSoftDeletable is returned by Restore for models without a
+	// DateDeleted field.
+	ErrNotSoftDeletable = errors.New("model does not support soft delete")
+	// ErrNotTouchable is returned by Touch for models without update
+	// timestamp fields.
+	ErrNotTouchable = errors.New("model has no update timestamp")
+	// ErrUnscopedJoin is returned by aggregations of operations scoped or
+	// routed by callbacks, such as those of tenants, joining a collection
+	// whose model is unknown, so that the documents joined could not be
+	// scoped as well. Join models with Pipeline.Lookup instead.
+	ErrUnscopedJoin = errors.New("cannot scope join of collection")
+)
+
+// translateError maps driver errors onto the package's sentinel errors. The
+// original error stays in the chain, so errors.Is works for both.
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrRecordNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return newDuplicateKeyError(err)
+	}
+	return err
+}
+
+// DuplicateKeyError reports a write rejected by a unique index. It matches
+// ErrDuplicateKey with errors.Is and unwraps to the driver error.
+type DuplicateKeyError struct {
+	// Index is the name of the violated unique index, when known.
+	Index string
+	// Fields lists the keys of the violated index.
+	Fields []string
+	// Values holds the duplicated key values, when the server reports them.
+	Values bson.M
+
+	err error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	msg := ErrDuplicateKey.Error()
+	if len(e.Fields) > 0 {
+		msg += " on " + strings.Join(e.Fields, ", ")
+	}
+	if e.Index != "" {
+		msg += fmt.Sprintf(" (index %s)", e.Index)
+	}
+	return msg
+}
+
+// Is reports whether target is ErrDuplicateKey.
+func (e *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+// Unwrap returns the underlying driver error.
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.err
+}
+
+var duplicateKeyMessage = regexp.MustCompile(`index: (\S+) dup key: \{ ?(.*?) ?\}`)
+var duplicateKeyField = regexp.MustCompile(`(?:^|, )"?([^:"]+)"?: `)
+
+// newDuplicateKeyError extracts the index and fields involved in a E11000
+// error, from the server's keyPattern and keyValue when present and from
+// the error message otherwise.
+func newDuplicateKeyError(err error) *DuplicateKeyError {
+	dup := &DuplicateKeyError{err: err}
+
+	message := err.Error()
+	var raw bson.Raw
+	var writeException mongo.WriteException
+	var bulkException mongo.BulkWriteException
+	var commandError mongo.CommandError
+	var writeError mongo.WriteError
+	switch {
+	case errors.As(err, &writeError):
+		message, raw = writeError.Message, writeError.Raw
+	case errors.As(err, &writeException):
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == 11000 || writeError.Code == 11001 || writeError.Code == 12582 {
+				message, raw = writeError.Message, writeError.Raw
+				break
+			}
+		}
+	case errors.As(err, &bulkException):
+		for _, writeError := range bulkException.WriteErrors {
+			if writeError.Code == 11000 || writeError.Code == 11001 || writeError.Code == 12582 {
+				message, raw = writeError.Message, writeError.Raw
+				break
+			}
+		}
+	case errors.As(err, &commandError):
+		message, raw = commandError.Message, commandError.Raw
+	}
+
+	if raw != nil {
+		if pattern, ok := raw.Lookup("keyPattern").DocumentOK(); ok {
+			if elements, err := pattern.Elements(); err == nil {
+				for _, element := range elements {
+					dup.Fields = append(dup.Fields, element.Key())
+				}
+			}
+		}
+		if value, ok := raw.Lookup("keyValue").DocumentOK(); ok {
+			var values bson.M
+			if bson.Unmarshal(value, &values) == nil {
+				dup.Values = values
+			}
+		}
+	}
+
+	if matches := duplicateKeyMessage.FindStringSubmatch(message); matches != nil {
+		dup.Index = matches[1]
+		if len(dup.Fields) == 0 {
+			for _, field := range duplicateKeyField.FindAllStringSubmatch(matches[2], -1) {
+				dup.Fields = append(dup.Fields, field[1])
+			}
+		}
+	}
+	return dup
+}
+
+// parseObjectID converts a hex string into an ObjectID, reporting failures
+// as ErrInvalidObjectID.
+func parseObjectID(s string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(s)
+	if err != nil {
+		return id, fmt.Errorf("%w: %q", ErrInvalidObjectID, s)
+	}
+	return id, nil
+}
@@ -0,0 +1,114 @@
+package mongorm
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Explain asks the server how it would run the query the chain builds, as
+// Find would send it, and decodes the winning plan into result, such as a
+// *bson.M. The query itself is not run:
+//
+//	var plan bson.M
+//	orm.Model(&User{}).Where("email = ?", email).Explain(&plan)
+//	// plan["stage"] is "FETCH", over an "IXSCAN" input stage
+//
+// Chains using Joins are explained as the aggregation they run.
+func (orm *MongoORM) Explain(result interface{}) *MongoORM {
+	return orm.execute(opQuery, result, func(tx *MongoORM) {
+		tx.explain(result)
+	})
+}
+
+// explain is the built-in step of Explain.
+func (orm *MongoORM) explain(result interface{}) *MongoORM {
+	collection := orm.Statement.Collection
+	if collection == nil {
+		orm.Error = ErrMissingModel
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	t := modelType(orm.Statement.Model)
+	var command bson.D
+	if len(orm.Statement.Joins) > 0 {
+		pipeline, err := orm.joinedPipeline(t, orm.Statement.Limit)
+		if err != nil {
+			orm.Error = err
+			return orm
+		}
+		command = bson.D{
+			{Key: "aggregate", Value: collection.Name()},
+			{Key: "pipeline", Value: pipeline},
+			{Key: "cursor", Value: bson.D{}},
+		}
+	} else {
+		command = bson.D{
+			{Key: "find", Value: collection.Name()},
+			{Key: "filter", Value: orm.queryFilter(t)},
+		}
+		if projection := orm.readProjection(t); len(projection) > 0 {
+			command = append(command, bson.E{Key: "projection", Value: projection})
+		}
+		if len(orm.Statement.Sort) > 0 {
+			command = append(command, bson.E{Key: "sort", Value: orm.Statement.Sort})
+		}
+		if orm.Statement.Offset > 0 {
+			command = append(command, bson.E{Key: "skip", Value: orm.Statement.Offset})
+		}
+		if orm.Statement.Limit > 0 {
+			command = append(command, bson.E{Key: "limit", Value: orm.Statement.Limit})
+		}
+	}
+
+	orm.Statement.record(collection, "explain", command)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	opts := options.RunCmd()
+	if orm.Statement.ReadPreference != nil {
+		opts.SetReadPreference(orm.Statement.ReadPreference)
+	}
+	raw, err := collection.Database().RunCommand(ctx, bson.D{
+		{Key: "explain", Value: command},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}, opts).DecodeBytes()
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	plan, ok := winningPlan(raw)
+	if !ok {
+		orm.Error = errors.New("explain output has no winning plan")
+		return orm
+	}
+	orm.Error = plan.Unmarshal(result)
+	return orm
+}
+
+// winningPlan returns the winning plan of an explain reply. Aggregations
+// that are not run by the query engine as a whole report it in their
+// leading $cursor stage.
+func winningPlan(reply bson.Raw) (bson.RawValue, bool) {
+	if plan, err := reply.LookupErr("queryPlanner", "winningPlan"); err == nil {
+		return plan, true
+	}
+	stages, ok := reply.Lookup("stages").ArrayOK()
+	if !ok {
+		return bson.RawValue{}, false
+	}
+	first, err := stages.IndexErr(0)
+	if err != nil {
+		return bson.RawValue{}, false
+	}
+	stage, ok := first.Value().DocumentOK()
+	if !ok {
+		return bson.RawValue{}, false
+	}
+	plan, err := stage.LookupErr("$cursor", "queryPlanner", "winningPlan")
+	return plan, err == nil
+}
@@ -0,0 +1,118 @@
+package mongorm
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Field is a document key holding values of type T. The mongorm command
+// generates a Field for each field of a model, so that filters are checked
+// by the compiler and break when a field is renamed:
+//
+//	//go:generate go run github.com/imkrishnaagrawal/mongorm/cmd/mongorm gen
+//
+//	orm.Find(&users, mongorm.And(
+//		UserFields.Age.Gt(30),
+//		UserFields.Status.In("active", "invited"),
+//	))
+//	orm.Order(UserFields.Name.Desc()).Find(&users)
+//
+// The predicates return filters accepted by Find, First and RawFilter.
+type Field[T any] struct {
+	key string
+}
+
+// NewField returns the Field stored under key, which may be a dotted path.
+func NewField[T any](key string) Field[T] {
+	return Field[T]{key: key}
+}
+
+// Key returns the document key of f, for Select, Pluck and the like.
+func (f Field[T]) Key() string {
+	return f.key
+}
+
+// String returns the document key of f.
+func (f Field[T]) String() string {
+	return f.key
+}
+
+// Eq matches the documents whose f equals value.
+func (f Field[T]) Eq(value T) bson.M {
+	return bson.M{f.key: value}
+}
+
+// Ne matches the documents whose f differs from value.
+func (f Field[T]) Ne(value T) bson.M {
+	return bson.M{f.key: bson.M{"$ne": value}}
+}
+
+// Gt matches the documents whose f is greater than value.
+func (f Field[T]) Gt(value T) bson.M {
+	return bson.M{f.key: bson.M{"$gt": value}}
+}
+
+// Gte matches the documents whose f is greater than or equal to value.
+func (f Field[T]) Gte(value T) bson.M {
+	return bson.M{f.key: bson.M{"$gte": value}}
+}
+
+// Lt matches the documents whose f is less than value.
+func (f Field[T]) Lt(value T) bson.M {
+	return bson.M{f.key: bson.M{"$lt": value}}
+}
+
+// Lte matches the documents whose f is less than or equal to value.
+func (f Field[T]) Lte(value T) bson.M {
+	return bson.M{f.key: bson.M{"$lte": value}}
+}
+
+// In matches the documents whose f is one of values.
+func (f Field[T]) In(values ...T) bson.M {
+	return bson.M{f.key: bson.M{"$in": valuesOf(values)}}
+}
+
+// Nin matches the documents whose f is none of values.
+func (f Field[T]) Nin(values ...T) bson.M {
+	return bson.M{f.key: bson.M{"$nin": valuesOf(values)}}
+}
+
+// Exists matches the documents that have f, or that lack it when exists is
+// false.
+func (f Field[T]) Exists(exists bool) bson.M {
+	return bson.M{f.key: bson.M{"$exists": exists}}
+}
+
+// Asc returns the ascending sort on f, for Order.
+func (f Field[T]) Asc() string {
+	return f.key + " asc"
+}
+
+// Desc returns the descending sort on f, for Order.
+func (f Field[T]) Desc() string {
+	return f.key + " desc"
+}
+
+// valuesOf returns values as a bson.A.
+func valuesOf[T any](values []T) bson.A {
+	a := make(bson.A, len(values))
+	for i, value := range values {
+		a[i] = value
+	}
+	return a
+}
+
+// And matches the documents matching every one of filters.
+func And(filters ...bson.M) bson.M {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return bson.M{"$and": valuesOf(filters)}
+}
+
+// Or matches the documents matching any of filters.
+func Or(filters ...bson.M) bson.M {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return bson.M{"$or": valuesOf(filters)}
+}
@@ -0,0 +1,252 @@
+package mongorm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// File references content stored in GridFS from a model field, such as an
+// avatar or a report. Only its ID is stored in the document; the other
+// fields are loaded from the bucket's files collection by Preload:
+//
+//	type User struct {
+//		ID     primitive.ObjectID `bson:"_id,omitempty"`
+//		Avatar *mongorm.File      `bson:"avatar"`
+//	}
+//
+//	avatar := &mongorm.File{Name: "avatar.png", ContentType: "image/png"}
+//	if err := orm.UploadFile(avatar, r.Body); err != nil {
+//		return err
+//	}
+//	user.Avatar = avatar
+//	orm.Save(&user)
+//
+//	orm.Preload("Avatar").First(&user)
+//	orm.DownloadFile(*user.Avatar, w)
+//
+// File fields may also be slices of File or *File.
+type File struct {
+	ID          primitive.ObjectID
+	Name        string
+	Length      int64
+	ContentType string
+	UploadDate  time.Time
+	// Metadata holds custom fields stored with the file.
+	Metadata bson.M
+}
+
+// MarshalBSONValue stores the file as its ID, or null for a file that was
+// not uploaded.
+func (f File) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if f.ID.IsZero() {
+		return bson.TypeNull, nil, nil
+	}
+	return bson.MarshalValue(f.ID)
+}
+
+// UnmarshalBSONValue reads the ID stored by MarshalBSONValue.
+func (f *File) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	*f = File{}
+	if t == bson.TypeNull || t == bson.TypeUndefined {
+		return nil
+	}
+	return bson.RawValue{Type: t, Value: data}.Unmarshal(&f.ID)
+}
+
+// gridFile mirrors a document of a GridFS files collection.
+type gridFile struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Length     int64              `bson:"length"`
+	UploadDate time.Time          `bson:"uploadDate"`
+	Filename   string             `bson:"filename"`
+	Metadata   bson.M             `bson:"metadata"`
+}
+
+// set copies the stored attributes of g into f.
+func (g gridFile) set(f *File) {
+	*f = File{ID: g.ID, Name: g.Filename, Length: g.Length, UploadDate: g.UploadDate, Metadata: g.Metadata}
+	if contentType, ok := g.Metadata["contentType"].(string); ok {
+		f.ContentType = contentType
+		delete(f.Metadata, "contentType")
+		if len(f.Metadata) == 0 {
+			f.Metadata = nil
+		}
+	}
+}
+
+// bucket returns the GridFS bucket holding File contents, with the
+// deadline of ctx, if any, applied.
+func (orm *MongoORM) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	if orm.client == nil {
+		return nil, ErrMissingClient
+	}
+	name := options.DefaultName
+	if orm.config.FileBucket != "" {
+		name = orm.config.FileBucket
+	}
+	bucket, err := gridfs.NewBucket(orm.client.Database(orm.databaseName(name+".files")), options.GridFSBucket().SetName(name))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetReadDeadline(deadline)
+		bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+// UploadFile stores the content read from r in GridFS as a new file named
+// file.Name, with its ContentType and Metadata, and sets the ID and Length
+// of file. The context set with WithContext bounds the upload.
+func (orm *MongoORM) UploadFile(file *File, r io.Reader) error {
+	ctx := orm.context()
+	bucket, err := orm.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	metadata := bson.M{}
+	for key, value := range file.Metadata {
+		metadata[key] = value
+	}
+	if file.ContentType != "" {
+		metadata["contentType"] = file.ContentType
+	}
+	opts := options.GridFSUpload()
+	if len(metadata) > 0 {
+		opts.SetMetadata(metadata)
+	}
+
+	stream, err := bucket.OpenUploadStream(file.Name, opts)
+	if err != nil {
+		return err
+	}
+	length, err := io.Copy(stream, r)
+	if err != nil {
+		stream.Abort()
+		stream.Close()
+		return err
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+	id, ok := stream.FileID.(primitive.ObjectID)
+	if !ok {
+		return fmt.Errorf("unexpected GridFS file ID %v", stream.FileID)
+	}
+	file.ID, file.Length = id, length
+	return nil
+}
+
+// OpenFile returns a reader streaming the content of file, which the
+// caller must close.
+func (orm *MongoORM) OpenFile(file File) (io.ReadCloser, error) {
+	if file.ID.IsZero() {
+		return nil, ErrMissingID
+	}
+	bucket, err := orm.bucket(orm.context())
+	if err != nil {
+		return nil, err
+	}
+	return bucket.OpenDownloadStream(file.ID)
+}
+
+// DownloadFile writes the content of file to w and returns the number of
+// bytes written.
+func (orm *MongoORM) DownloadFile(file File, w io.Writer) (int64, error) {
+	stream, err := orm.OpenFile(file)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	return io.Copy(w, stream)
+}
+
+// DeleteFile removes the content of file from GridFS. Documents referring
+// to it are left as they are.
+func (orm *MongoORM) DeleteFile(file File) error {
+	if file.ID.IsZero() {
+		return ErrMissingID
+	}
+	ctx := orm.context()
+	bucket, err := orm.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	return bucket.DeleteContext(ctx, file.ID)
+}
+
+var fileType = reflect.TypeOf(File{})
+
+// isFileField reports whether field holds a File, a *File, or a slice of
+// either.
+func isFileField(field reflect.StructField) bool {
+	t := field.Type
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return indirectType(t) == fileType
+}
+
+// preloadFiles loads the attributes of the files held by field of each of
+// parents from the files collection of the bucket. Files that are not
+// stored there are left as they are.
+func (orm *MongoORM) preloadFiles(ctx context.Context, parents []reflect.Value, field reflect.StructField) error {
+	var files []*File
+	for _, parent := range parents {
+		value := parent.FieldByIndex(field.Index)
+		if value.Kind() != reflect.Slice {
+			if file, ok := structValue(value); ok {
+				files = append(files, file.Addr().Interface().(*File))
+			}
+			continue
+		}
+		for i := 0; i < value.Len(); i++ {
+			if file, ok := structValue(value.Index(i)); ok {
+				files = append(files, file.Addr().Interface().(*File))
+			}
+		}
+	}
+
+	ids := bson.A{}
+	for _, file := range files {
+		if !file.ID.IsZero() {
+			ids = append(ids, file.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	bucket, err := orm.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	cursor, err := bucket.GetFilesCollection().Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	var stored []gridFile
+	if err := cursor.All(ctx, &stored); err != nil {
+		return err
+	}
+	byID := map[primitive.ObjectID]gridFile{}
+	for _, g := range stored {
+		byID[g.ID] = g
+	}
+	for _, file := range files {
+		if g, ok := byID[file.ID]; ok {
+			g.set(file)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package mongorm
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UpdateAndGet atomically applies update to the first document matching the
+// chained conditions, or doc's own ID when there are none, and decodes the
+// document into doc. By default the updated document is returned; pass
+// options.Before to get the document as it was before the update:
+//
+//	orm.Where("status = ?", "queued").Order("priority desc").
+//		UpdateAndGet(&job, bson.M{"status": "running"})
+//
+// update follows the same rules as UpdateMany, including the operators added
+// by Inc, Push and friends. It is merged into Statement.UpdateOperators
+// before callbacks run, so that they see it. Upsert is honoured. When
+// nothing matches, Error is ErrRecordNotFound.
+func (orm *MongoORM) UpdateAndGet(doc interface{}, update interface{}, returnDocument ...options.ReturnDocument) *MongoORM {
+	tx := orm.getInstance()
+	if update != nil {
+		if err := tx.mergeUpdate(update); err != nil {
+			tx.AddError(err)
+		}
+	}
+	return tx.execute(opUpdate, doc, func(tx *MongoORM) {
+		tx.updateAndGet(doc, returnDocument...)
+	})
+}
+
+// mergeUpdate merges update into the operators added by Set, Inc and
+// friends, which take precedence.
+func (orm *MongoORM) mergeUpdate(update interface{}) error {
+	doc, err := toUpdateDocument(update)
+	if err != nil {
+		return err
+	}
+	operators := bson.M{}
+	for operator, fields := range doc {
+		values, err := toDocument(fields)
+		if err != nil {
+			return fmt.Errorf("%w: %s expects a document, got %T", ErrInvalidUpdate, operator, fields)
+		}
+		operators[operator] = values
+	}
+	orm.Statement.UpdateOperators = mergeUpdateOperators(operators, orm.Statement.UpdateOperators)
+	return nil
+}
+
+// updateAndGet is the built-in step of UpdateAndGet.
+func (orm *MongoORM) updateAndGet(doc interface{}, returnDocument ...options.ReturnDocument) *MongoORM {
+	if orm.Error != nil {
+		return orm
+	}
+	if err := orm.identify(doc); err != nil {
+		orm.Error = err
+		return orm
+	}
+
+	updateDoc, err := orm.buildUpdate(nil)
+	if err != nil {
+		orm.Error = err
+		return orm
+	}
+	updateDoc = orm.stampUpdate(updateDoc, modelType(doc), nil)
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if len(returnDocument) > 0 {
+		opts.SetReturnDocument(returnDocument[0])
+	}
+	if len(orm.Statement.Sort) > 0 {
+		opts.SetSort(orm.Statement.Sort)
+	}
+	if orm.Statement.Upsert {
+		opts.SetUpsert(true)
+	}
+	if len(orm.Statement.ArrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: orm.Statement.ArrayFilters})
+	}
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	if orm.Statement.Hint != nil {
+		opts.SetHint(orm.Statement.Hint)
+	}
+
+	collection := orm.collection(orm.determineCollectionName(doc))
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	filter := orm.queryFilter(modelType(doc))
+
+	orm.Statement.record(collection, "findOneAndUpdate", filter, updateDoc)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	resetValue(doc)
+	if err := collection.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(doc); err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.RowsAffected = 1
+	orm.Error = orm.callHook(doc, hookAfterUpdate)
+	return orm
+}
+
+// DeleteAndGet atomically deletes the first document matching the chained
+// conditions, or doc's own ID when there are none, and decodes it into doc.
+// Soft deleted models are marked deleted instead, unless Unscoped. When
+// nothing matches, Error is ErrRecordNotFound.
+func (orm *MongoORM) DeleteAndGet(doc interface{}) *MongoORM {
+	return orm.execute(opDelete, doc, func(tx *MongoORM) {
+		tx.deleteAndGet(doc)
+	})
+}
+
+// deleteAndGet is the built-in step of DeleteAndGet.
+func (orm *MongoORM) deleteAndGet(doc interface{}) *MongoORM {
+	if orm.Error != nil {
+		return orm
+	}
+	if err := orm.identify(doc); err != nil {
+		orm.Error = err
+		return orm
+	}
+
+	collection := orm.collection(orm.determineCollectionName(doc))
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	if err := orm.callHook(doc, hookBeforeDelete); err != nil {
+		orm.Error = err
+		return orm
+	}
+
+	filter := orm.queryFilter(modelType(doc))
+	name, softDelete := orm.softDeleteField(modelType(doc))
+	softDelete = softDelete && !orm.Statement.Unscoped
+	deleted := deletedAt(doc)
+	sort := orm.Statement.Sort
+
+	var err error
+	if softDelete {
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if len(sort) > 0 {
+			opts.SetSort(sort)
+		}
+		if orm.Statement.Collation != nil {
+			opts.SetCollation(orm.Statement.Collation)
+		}
+		if orm.Statement.Hint != nil {
+			opts.SetHint(orm.Statement.Hint)
+		}
+		update := bson.M{"$set": bson.M{name: deleted}}
+		orm.Statement.record(collection, "findOneAndUpdate", filter, update)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		resetValue(doc)
+		err = collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(doc)
+	} else {
+		opts := options.FindOneAndDelete()
+		if len(sort) > 0 {
+			opts.SetSort(sort)
+		}
+		if orm.Statement.Collation != nil {
+			opts.SetCollation(orm.Statement.Collation)
+		}
+		if orm.Statement.Hint != nil {
+			opts.SetHint(orm.Statement.Hint)
+		}
+		orm.Statement.record(collection, "findOneAndDelete", filter)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		resetValue(doc)
+		err = collection.FindOneAndDelete(ctx, filter, opts).Decode(doc)
+	}
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.RowsAffected = 1
+	orm.Error = orm.callHook(doc, hookAfterDelete)
+	return orm
+}
+
+// identify restricts the chain to doc's own ID when no conditions were
+// given.
+func (orm *MongoORM) identify(doc interface{}) error {
+	if len(orm.Statement.Filter) > 0 {
+		return nil
+	}
+	oid, err := recordID(doc)
+	if err != nil {
+		return err
+	}
+	orm.Statement.Filter = bson.M{"_id": oid}
+	return nil
+}
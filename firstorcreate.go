@@ -0,0 +1,362 @@
+package mongorm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// Attrs sets fields used only when FirstOrInit or FirstOrCreate does not
+// find a matching document. attrs are maps or structs; struct fields are
+// used as the bson codec encodes them.
+func (orm *MongoORM) Attrs(attrs ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	for _, attr := range attrs {
+		doc, err := toDocument(attr)
+		if err != nil {
+			tx.AddError(err)
+			return tx
+		}
+		if tx.Statement.Attrs == nil {
+			tx.Statement.Attrs = bson.M{}
+		}
+		for key, value := range doc {
+			tx.Statement.Attrs[key] = value
+		}
+	}
+	return tx
+}
+
+// Assign sets fields applied whether or not FirstOrInit or FirstOrCreate
+// finds a matching document. FirstOrCreate also stores them on a found
+// document.
+func (orm *MongoORM) Assign(attrs ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	for _, attr := range attrs {
+		doc, err := toDocument(attr)
+		if err != nil {
+			tx.AddError(err)
+			return tx
+		}
+		if tx.Statement.Assigns == nil {
+			tx.Statement.Assigns = bson.M{}
+		}
+		for key, value := range doc {
+			tx.Statement.Assigns[key] = value
+		}
+	}
+	return tx
+}
+
+// FirstOrInit loads the first document matching the chained conditions and
+// conds into doc. When none matches, doc is initialized from the equality
+// conditions and Attrs instead. Assign values are applied in both cases.
+// Nothing is written to the database.
+func (orm *MongoORM) FirstOrInit(doc interface{}, conds ...interface{}) *MongoORM {
+	return orm.execute(opQuery, doc, func(tx *MongoORM) {
+		tx.firstOrInit(doc, conds...)
+	})
+}
+
+// firstOrInit is the built-in step of FirstOrInit.
+func (orm *MongoORM) firstOrInit(doc interface{}, conds ...interface{}) *MongoORM {
+	if orm.Error != nil {
+		return orm
+	}
+	if err := orm.addFilters(conds); err != nil {
+		orm.Error = err
+		return orm
+	}
+
+	attrs, assigns := orm.Statement.Attrs, orm.Statement.Assigns
+	filter := orm.Statement.Filter
+
+	collection := orm.collection(orm.determineCollectionName(doc))
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	query := orm.queryFilter(modelType(doc))
+	orm.Statement.record(collection, "findOne", query)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	err := collection.FindOne(ctx, query, orm.findOneOptions(modelType(doc))).Decode(doc)
+	if err == nil {
+		if orm.Error = orm.callHook(doc, hookAfterFind); orm.Error == nil {
+			orm.Error = decodeInto(doc, assigns)
+		}
+		return orm
+	}
+	if err = translateError(err); !errors.Is(err, ErrRecordNotFound) {
+		orm.Error = err
+		return orm
+	}
+
+	init := equalityFields(filter)
+	for key, value := range attrs {
+		init[key] = value
+	}
+	for key, value := range assigns {
+		init[key] = value
+	}
+	orm.Error = decodeInto(doc, init)
+	return orm
+}
+
+// FirstOrCreate loads the first document matching the chained conditions
+// and conds into doc, atomically inserting one built from the equality
+// conditions, Attrs and Assign values when none matches. Assign values are
+// also stored on a found document, stamping its update timestamps as
+// Updates does. It runs as a single findOneAndUpdate with upsert, so
+// concurrent callers never create duplicates when the conditions are
+// backed by a unique index. RowsAffected is 1 when a document was created.
+// The document that would be created is validated as Create validates;
+// when it is invalid, FirstOrCreate only loads a matching document,
+// failing with the validation error when none matches.
+func (orm *MongoORM) FirstOrCreate(doc interface{}, conds ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	if tx.Statement.Attrs == nil {
+		tx.Statement.Attrs = bson.M{}
+	}
+	return tx.execute(opCreate, doc, func(tx *MongoORM) {
+		tx.firstOrCreate(doc, conds...)
+	})
+}
+
+// firstOrCreate is the built-in step of FirstOrCreate.
+func (orm *MongoORM) firstOrCreate(doc interface{}, conds ...interface{}) *MongoORM {
+	if orm.Error != nil {
+		return orm
+	}
+	if err := orm.addFilters(conds); err != nil {
+		orm.Error = err
+		return orm
+	}
+
+	t := modelType(doc)
+	filter := orm.queryFilter(t)
+
+	insert := bson.M{}
+	fresh := reflect.New(t)
+	if err := orm.callHook(fresh.Interface(), hookBeforeCreate); err != nil {
+		orm.Error = err
+		return orm
+	}
+	_, filtered := filter["_id"]
+	if _, given := orm.Statement.Attrs["_id"]; !filtered && !given {
+		if err := orm.assignID(fresh.Interface()); err != nil {
+			orm.Error = err
+			return orm
+		}
+	}
+	orm.stampCreate(fresh.Interface())
+	orm.initVersion(fresh.Interface())
+	defaults, err := toDocument(fresh.Interface())
+	if err != nil {
+		orm.Error = err
+		return orm
+	}
+	for key, value := range defaults {
+		insert[key] = value
+	}
+	for key, value := range orm.Statement.Attrs {
+		insert[key] = value
+	}
+
+	// Assign values are also stored on a found document, whose update
+	// timestamps are stamped as Updates stamps them.
+	var set bson.M
+	if len(orm.Statement.Assigns) > 0 {
+		stamped := orm.stampUpdate(bson.M{"$set": orm.Statement.Assigns}, t, nil)
+		if set, err = toDocument(stamped["$set"]); err != nil {
+			orm.Error = err
+			return orm
+		}
+	}
+	for key := range set {
+		delete(insert, key)
+	}
+	for key := range equalityFields(filter) {
+		delete(insert, key)
+	}
+
+	// A created document is given an ID unless the conditions or Attrs
+	// choose it.
+	if filtered {
+		delete(insert, "_id")
+	} else if _, ok := insert["_id"]; !ok {
+		insert["_id"] = primitive.NewObjectID()
+	}
+
+	// The document that would be created, from the insert along with the
+	// conditions and Assign values the upsert writes too, is validated.
+	// When it is invalid, a matching document is still found, but none is
+	// created.
+	created := equalityFields(filter)
+	for key, value := range insert {
+		created[key] = value
+	}
+	for key, value := range set {
+		created[key] = value
+	}
+	candidate := reflect.New(t)
+	if err := decodeInto(candidate.Interface(), created); err != nil {
+		orm.Error = err
+		return orm
+	}
+	invalid := orm.validate(candidate.Interface(), false)
+
+	update := bson.M{}
+	if len(insert) > 0 {
+		update["$setOnInsert"] = insert
+	}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(update) == 0 {
+		update["$setOnInsert"] = bson.M{}
+	}
+
+	collection := orm.collection(orm.determineCollectionName(doc))
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	// findAndModify is run as a command, whose reply tells whether the
+	// document was created, which that of FindOneAndUpdate does not. It is
+	// given the options FindOneAndUpdate would be.
+	command := bson.D{
+		{Key: "findAndModify", Value: collection.Name()},
+		{Key: "query", Value: filter},
+		{Key: "update", Value: update},
+		{Key: "new", Value: true},
+		{Key: "upsert", Value: invalid == nil},
+	}
+	if len(orm.Statement.Sort) > 0 {
+		command = append(command, bson.E{Key: "sort", Value: orm.Statement.Sort})
+	}
+	if orm.Statement.Collation != nil {
+		command = append(command, bson.E{Key: "collation", Value: orm.Statement.Collation.ToDocument()})
+	}
+	if orm.Statement.Hint != nil {
+		command = append(command, bson.E{Key: "hint", Value: orm.Statement.Hint})
+	}
+	if wc := orm.Statement.WriteConcern; wc != nil && mongo.SessionFromContext(ctx) == nil {
+		command = append(command, bson.E{Key: "writeConcern", Value: writeConcernDocument(wc)})
+	}
+
+	orm.Statement.record(collection, "findOneAndUpdate", filter, update)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	var reply struct {
+		LastErrorObject struct {
+			UpdatedExisting bool          `bson:"updatedExisting"`
+			Upserted        bson.RawValue `bson:"upserted"`
+		} `bson:"lastErrorObject"`
+		Value bson.RawValue `bson:"value"`
+	}
+	if err := collection.Database().RunCommand(ctx, command).Decode(&reply); err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	resetValue(doc)
+	value, ok := reply.Value.DocumentOK()
+	if !ok {
+		orm.Error = ErrRecordNotFound
+		if invalid != nil {
+			orm.Error = invalid
+		}
+		return orm
+	}
+	if err := unmarshalDocument(value, doc); err != nil {
+		orm.Error = err
+		return orm
+	}
+
+	orm.RowsAffected = 0
+	if !reply.LastErrorObject.UpdatedExisting && reply.LastErrorObject.Upserted.Type != 0 {
+		orm.RowsAffected = 1
+		orm.Error = orm.callHook(doc, hookAfterCreate)
+	} else {
+		orm.Error = orm.callHook(doc, hookAfterFind)
+	}
+	return orm
+}
+
+// writeConcernDocument returns wc as the writeConcern field of a command.
+func writeConcernDocument(wc *writeconcern.WriteConcern) bson.D {
+	doc := bson.D{}
+	if wc.W != nil {
+		doc = append(doc, bson.E{Key: "w", Value: wc.W})
+	}
+	if wc.Journal != nil {
+		doc = append(doc, bson.E{Key: "j", Value: *wc.Journal})
+	}
+	if wc.WTimeout > 0 {
+		doc = append(doc, bson.E{Key: "wtimeout", Value: wc.WTimeout.Milliseconds()})
+	}
+	return doc
+}
+
+// equalityFields returns the plain field: value conditions of filter,
+// which describe a document matching it.
+func equalityFields(filter bson.M) bson.M {
+	fields := bson.M{}
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") {
+			if and, ok := value.(bson.A); ok && key == "$and" {
+				for _, cond := range and {
+					if m, ok := cond.(bson.M); ok {
+						for k, v := range equalityFields(m) {
+							fields[k] = v
+						}
+					}
+				}
+			}
+			continue
+		}
+		if m, ok := value.(bson.M); ok && hasOperator(m) {
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+func hasOperator(doc bson.M) bool {
+	for key := range doc {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeInto sets the fields of doc present in values.
+func decodeInto(doc interface{}, values bson.M) error {
+	if len(values) == 0 {
+		return nil
+	}
+	data, err := bson.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return unmarshalDocument(data, doc)
+}
+
+// resetValue sets the value doc points to back to its zero value, so that
+// decoding does not leave stale fields behind.
+func resetValue(doc interface{}) {
+	value := reflect.ValueOf(doc)
+	if value.Kind() == reflect.Ptr && !value.IsNil() {
+		value.Elem().Set(reflect.Zero(value.Elem().Type()))
+	}
+}
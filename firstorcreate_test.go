@@ -0,0 +1,106 @@
+package mongorm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type member struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty"`
+	Email string             `bson:"email" validate:"required,email"`
+	Name  string             `bson:"name" validate:"required"`
+	Role  string             `bson:"role"`
+}
+
+func TestFirstOrCreateValidatesCreatedDocument(t *testing.T) {
+	orm := mongormtest.New()
+
+	var m member
+	err := orm.Where("email = ?", "ann@example.com").FirstOrCreate(&m).Error
+	var validationErr *mongorm.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want a validation error for the missing name", err)
+	}
+	var count int64
+	if err := orm.Model(&member{}).Count(&count).Error; err != nil || count != 0 {
+		t.Fatalf("count = %d (%v), want nothing created", count, err)
+	}
+
+	m = member{}
+	err = orm.Where("email = ?", "ann@example.com").Attrs(bson.M{"name": "Ann"}).FirstOrCreate(&m).Error
+	if err != nil || m.Name != "Ann" {
+		t.Fatalf("FirstOrCreate = %+v, %v, want Ann created", m, err)
+	}
+}
+
+func TestFirstOrCreateFindsDocumentItCouldNotCreate(t *testing.T) {
+	orm := mongormtest.New()
+	if err := orm.Create(&member{Email: "ann@example.com", Name: "Ann"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var m member
+	tx := orm.Where("email = ?", "ann@example.com").Assign(bson.M{"role": "admin"}).FirstOrCreate(&m)
+	if tx.Error != nil || m.Name != "Ann" || m.Role != "admin" || tx.RowsAffected != 0 {
+		t.Fatalf("FirstOrCreate = %+v, %v, rows %d, want Ann found and assigned", m, tx.Error, tx.RowsAffected)
+	}
+}
+
+func TestFirstOrCreateReportsCreationWithIDCondition(t *testing.T) {
+	orm := mongormtest.New()
+	id := primitive.NewObjectID()
+
+	var m member
+	tx := orm.Where("_id = ?", id).Attrs(bson.M{"email": "ann@example.com", "name": "Ann"}).FirstOrCreate(&m)
+	if tx.Error != nil || tx.RowsAffected != 1 || m.ID != id {
+		t.Fatalf("FirstOrCreate = %+v, %v, rows %d, want it created", m, tx.Error, tx.RowsAffected)
+	}
+
+	m = member{}
+	tx = orm.Where("_id = ?", id).FirstOrCreate(&m)
+	if tx.Error != nil || tx.RowsAffected != 0 || m.Name != "Ann" {
+		t.Fatalf("FirstOrCreate = %+v, %v, rows %d, want it found", m, tx.Error, tx.RowsAffected)
+	}
+}
+
+func TestFirstOrCreateStampsAssignedDocument(t *testing.T) {
+	type account struct {
+		mongorm.OrmModel `bson:",inline"`
+		Email            string `bson:"email"`
+		Plan             string `bson:"plan"`
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	orm := mongormtest.New(&mongorm.Config{NowFunc: func() time.Time { return now }})
+
+	var a account
+	if err := orm.Where("email = ?", "ann@example.com").FirstOrCreate(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	created := now
+
+	now = now.Add(time.Hour)
+	a = account{}
+	err := orm.Where("email = ?", "ann@example.com").Assign(bson.M{"plan": "pro"}).FirstOrCreate(&a).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Plan != "pro" || !a.DateCreated.Equal(created) || !a.DateUpdated.Equal(now) {
+		t.Fatalf("account = %+v, want pro created at %v and updated at %v", a, created, now)
+	}
+
+	now = now.Add(time.Hour)
+	var b account
+	err = orm.Where("email = ?", "bob@example.com").Assign(bson.M{"plan": "pro"}).FirstOrCreate(&b).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Plan != "pro" || !b.DateCreated.Equal(now) || !b.DateUpdated.Equal(now) {
+		t.Fatalf("account = %+v, want pro created and updated at %v", b, now)
+	}
+}
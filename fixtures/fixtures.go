@@ -0,0 +1,323 @@
+// Package fixtures loads documents described in YAML or JSON files into a
+// mongorm database, to set up integration tests and demo environments.
+//
+// A fixture file maps collection names to the documents to insert:
+//
+//	users:
+//	  - _id: $oid:alice
+//	    name: Alice
+//	    created_at: $now-24h
+//	posts:
+//	  - _id: $oid:hello
+//	    author_id: $oid:alice
+//	    title: Hello
+//	    published_at: $time:2024-01-15T12:00:00Z
+//
+// String values starting with a placeholder are converted when loading:
+// "$oid:label" becomes the ObjectID returned by ID for label, or the
+// ObjectID itself when label is one in hex, and "$oid" a new one; "$now"
+// becomes the load time, optionally shifted by a duration such as "$now+1h"
+// or "$now-720h"; "$time:" followed by an RFC 3339 time or a date such as
+// 2024-01-15 becomes that time.
+//
+// Collections are loaded after those defining the labels their documents
+// refer to, and otherwise in the order they appear in.
+package fixtures
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+)
+
+// Options configures Load.
+type Options struct {
+	// Truncate deletes every document of the collections in the fixtures
+	// before loading them.
+	Truncate bool
+}
+
+// ID returns the ObjectID the "$oid:label" placeholder stands for. It is
+// the same for every load, so that tests can refer to fixture documents:
+//
+//	orm.First(&user, fixtures.ID("alice").Hex())
+func ID(label string) primitive.ObjectID {
+	if id, err := primitive.ObjectIDFromHex(label); err == nil {
+		return id
+	}
+	sum := sha256.Sum256([]byte(label))
+	var id primitive.ObjectID
+	copy(id[:], sum[:])
+	return id
+}
+
+// Load inserts the documents of the fixture files at paths, or of the .yml,
+// .yaml and .json files in the directories at paths, into the database of
+// orm. Documents are inserted as they are, without running hooks.
+func Load(ctx context.Context, orm *mongorm.MongoORM, opts *Options, paths ...string) error {
+	sources := make([]source, len(paths))
+	for i, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		sources[i] = source{fsys: os.DirFS(filepath.Dir(abs)), path: filepath.Base(abs), name: p}
+	}
+	return load(ctx, orm, opts, sources)
+}
+
+// LoadFS is like Load, reading the files from fsys, such as an embed.FS.
+func LoadFS(ctx context.Context, orm *mongorm.MongoORM, opts *Options, fsys fs.FS, paths ...string) error {
+	sources := make([]source, len(paths))
+	for i, p := range paths {
+		sources[i] = source{fsys: fsys, path: path.Clean(p), name: p}
+	}
+	return load(ctx, orm, opts, sources)
+}
+
+// source is a fixture file, or a directory of them, in a file system.
+type source struct {
+	fsys fs.FS
+	path string
+	// name is the path as given, for error messages.
+	name string
+}
+
+func load(ctx context.Context, orm *mongorm.MongoORM, opts *Options, sources []source) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	files, err := fixtureFiles(sources)
+	if err != nil {
+		return err
+	}
+
+	set := &fixtureSet{documents: map[string][]interface{}{}}
+	now := time.Now().UTC()
+	for _, file := range files {
+		data, err := fs.ReadFile(file.fsys, file.path)
+		if err != nil {
+			return err
+		}
+		if err := set.parse(data, now); err != nil {
+			return fmt.Errorf("fixtures %s: %w", file.name, err)
+		}
+	}
+
+	order := set.order()
+	if opts.Truncate {
+		for i := len(order) - 1; i >= 0; i-- {
+			collection, err := orm.Collection(order[i])
+			if err == nil {
+				_, err = collection.DeleteMany(ctx, bson.M{})
+			}
+			if err != nil {
+				return fmt.Errorf("fixtures: truncating %s: %w", order[i], err)
+			}
+		}
+	}
+	for _, name := range order {
+		if len(set.documents[name]) == 0 {
+			continue
+		}
+		collection, err := orm.Collection(name)
+		if err == nil {
+			_, err = collection.InsertMany(ctx, set.documents[name])
+		}
+		if err != nil {
+			return fmt.Errorf("fixtures: loading %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// fixtureFiles expands the directories among sources into the fixture
+// files they hold, in lexical order.
+func fixtureFiles(sources []source) ([]source, error) {
+	var files []source
+	for _, src := range sources {
+		info, err := fs.Stat(src.fsys, src.path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, src)
+			continue
+		}
+		entries, err := fs.ReadDir(src.fsys, src.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch path.Ext(entry.Name()) {
+			case ".yml", ".yaml", ".json":
+				if !entry.IsDir() {
+					files = append(files, source{
+						fsys: src.fsys,
+						path: path.Join(src.path, entry.Name()),
+						name: path.Join(src.name, entry.Name()),
+					})
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// fixtureSet holds the documents read from fixture files.
+type fixtureSet struct {
+	// names lists the collections in the order they appeared in.
+	names     []string
+	documents map[string][]interface{}
+	// defines maps the labels of "$oid:label" _id values to the collection
+	// defining them, and refers lists, by collection, the labels referred
+	// to by other fields.
+	defines map[string]string
+	refers  map[string][]string
+}
+
+// parse adds the documents of a fixture file, whose times are relative to
+// now. JSON files are parsed as YAML, of which JSON is a subset.
+func (set *fixtureSet) parse(data []byte, now time.Time) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of collection names to documents", mapping.Line)
+	}
+	if set.defines == nil {
+		set.defines, set.refers = map[string]string{}, map[string][]string{}
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		name := mapping.Content[i].Value
+		var docs []map[string]interface{}
+		if err := mapping.Content[i+1].Decode(&docs); err != nil {
+			return fmt.Errorf("collection %s: %w", name, err)
+		}
+		if _, ok := set.documents[name]; !ok {
+			set.names = append(set.names, name)
+			set.documents[name] = nil
+		}
+		for _, doc := range docs {
+			for key, value := range doc {
+				converted, err := set.convert(name, key == "_id", value, now)
+				if err != nil {
+					return fmt.Errorf("collection %s, field %s: %w", name, key, err)
+				}
+				doc[key] = converted
+			}
+			set.documents[name] = append(set.documents[name], doc)
+		}
+	}
+	return nil
+}
+
+// convert replaces the placeholders in value, a value of a document of the
+// collection name, recording the labels it defines, for an _id, or refers
+// to.
+func (set *fixtureSet) convert(name string, isID bool, value interface{}, now time.Time) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			converted, err := set.convert(name, false, inner, now)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case []interface{}:
+		for i, inner := range v {
+			converted, err := set.convert(name, false, inner, now)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	case string:
+		return set.placeholder(name, isID, v, now)
+	}
+	return value, nil
+}
+
+// placeholder returns the value s stands for.
+func (set *fixtureSet) placeholder(name string, isID bool, s string, now time.Time) (interface{}, error) {
+	switch {
+	case s == "$oid":
+		return primitive.NewObjectID(), nil
+	case strings.HasPrefix(s, "$oid:"):
+		label := strings.TrimPrefix(s, "$oid:")
+		if isID {
+			set.defines[label] = name
+		} else {
+			set.refers[name] = append(set.refers[name], label)
+		}
+		return ID(label), nil
+	case strings.HasPrefix(s, "$now"):
+		offset := strings.TrimPrefix(s, "$now")
+		if offset == "" {
+			return now, nil
+		}
+		d, err := time.ParseDuration(strings.TrimPrefix(offset, "+"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid placeholder %q", s)
+		}
+		return now.Add(d), nil
+	case strings.HasPrefix(s, "$time:"):
+		value := strings.TrimPrefix(s, "$time:")
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse(time.DateOnly, value); err == nil {
+			return t, nil
+		}
+		return nil, fmt.Errorf("invalid placeholder %q", s)
+	}
+	return s, nil
+}
+
+// order returns the collections in loading order: each after those
+// defining the labels it refers to, unless they refer to it in turn, and
+// otherwise in the order they appeared in.
+func (set *fixtureSet) order() []string {
+	loaded := map[string]bool{}
+	visiting := map[string]bool{}
+	var order []string
+	var visit func(name string)
+	visit = func(name string) {
+		if loaded[name] || visiting[name] {
+			return
+		}
+		visiting[name] = true
+		for _, label := range set.refers[name] {
+			if dependency, ok := set.defines[label]; ok && dependency != name {
+				visit(dependency)
+			}
+		}
+		visiting[name] = false
+		loaded[name] = true
+		order = append(order, name)
+	}
+	for _, name := range set.names {
+		visit(name)
+	}
+	return order
+}
@@ -0,0 +1,82 @@
+package mongorm
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Point is a GeoJSON point. Fields holding one are queried with Near,
+// Within and GeoIntersects once AutoMigrate created a 2dsphere index on
+// them:
+//
+//	type Shop struct {
+//		Name     string        `bson:"name"`
+//		Location mongorm.Point `bson:"location" mongorm:"2dsphere"`
+//	}
+type Point struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewPoint returns the point at longitude lng and latitude lat.
+func NewPoint(lng, lat float64) Point {
+	return Point{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// Polygon is a GeoJSON polygon: an outer ring of [longitude, latitude]
+// positions, followed by the rings of its holes.
+type Polygon struct {
+	Type        string        `bson:"type" json:"type"`
+	Coordinates [][][]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewPolygon returns the polygon bounded by positions, given as
+// [longitude, latitude] pairs. The ring is closed if its last position is
+// not its first.
+func NewPolygon(positions ...[2]float64) Polygon {
+	ring := make([][]float64, 0, len(positions)+1)
+	for _, position := range positions {
+		ring = append(ring, []float64{position[0], position[1]})
+	}
+	if n := len(positions); n > 0 && positions[0] != positions[n-1] {
+		ring = append(ring, []float64{positions[0][0], positions[0][1]})
+	}
+	return Polygon{Type: "Polygon", Coordinates: [][][]float64{ring}}
+}
+
+// Near matches the documents whose field, holding GeoJSON, lies within
+// maxMeters of the point at longitude lng and latitude lat, nearest first.
+// A maxMeters of zero does not bound the distance:
+//
+//	orm.Near("location", -73.99, 40.73, 500).Limit(10).Find(&shops)
+//
+// The field needs a 2dsphere index. MongoDB does not allow $near in Count,
+// whose documents are counted with an aggregation; use Within there.
+func (orm *MongoORM) Near(field string, lng, lat, maxMeters float64) *MongoORM {
+	near := bson.M{"$geometry": NewPoint(lng, lat)}
+	if maxMeters > 0 {
+		near["$maxDistance"] = maxMeters
+	}
+	tx := orm.getInstance()
+	tx.addCondition(bson.M{field: bson.M{"$near": near}})
+	return tx
+}
+
+// Within matches the documents whose field, holding GeoJSON, lies entirely
+// inside polygon:
+//
+//	area := mongorm.NewPolygon([2]float64{-74, 40.7}, [2]float64{-73.9, 40.7}, [2]float64{-73.9, 40.8})
+//	orm.Within("location", area).Find(&shops)
+func (orm *MongoORM) Within(field string, polygon Polygon) *MongoORM {
+	tx := orm.getInstance()
+	tx.addCondition(bson.M{field: bson.M{"$geoWithin": bson.M{"$geometry": polygon}}})
+	return tx
+}
+
+// GeoIntersects matches the documents whose field, holding GeoJSON,
+// intersects geometry, such as a Point, a Polygon or a GeoJSON document of
+// another type:
+//
+//	orm.GeoIntersects("delivery_area", mongorm.NewPoint(-73.99, 40.73)).Find(&zones)
+func (orm *MongoORM) GeoIntersects(field string, geometry interface{}) *MongoORM {
+	tx := orm.getInstance()
+	tx.addCondition(bson.M{field: bson.M{"$geoIntersects": bson.M{"$geometry": geometry}}})
+	return tx
+}
@@ -0,0 +1,154 @@
+package mongorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// aggregateSelect matches the aggregate expressions Select accepts for
+// grouped queries, such as "sum(amount) as total".
+var aggregateSelect = regexp.MustCompile(`(?i)^\s*(sum|avg|min|max|count)\(\s*([\w.]+|\*)\s*\)\s+as\s+(\w+)\s*$`)
+
+// Group groups the documents matching the chain by a comma separated list of
+// fields. Find then reads one document per group, holding the group's
+// fields, the number of documents in it as "count", and any aggregates given
+// to Select as "sum(field) as name", with sum, avg, min, max or count(*).
+// Having filters the groups, and Order, Limit and Offset apply to them:
+//
+//	type StatusTotal struct {
+//		Status string
+//		Count  int
+//		Total  float64
+//	}
+//	var totals []StatusTotal
+//	orm.Model(&Order{}).Select("sum(amount) as total").Group("status").
+//		Having("count > ?", 5).Order("total desc").Find(&totals)
+//
+// The collection is taken from a preceding call to Model.
+func (orm *MongoORM) Group(fields string) *MongoORM {
+	tx := orm.getInstance()
+	for _, field := range strings.Split(fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			tx.Statement.Groups = append(tx.Statement.Groups, field)
+		}
+	}
+	return tx
+}
+
+// Having adds a condition on the groups read by a Group query, written as
+// for Where and referring to the fields of the documents Find reads.
+// Calling Having several times ANDs the conditions together.
+func (orm *MongoORM) Having(query string, args ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	cond, err := parseCondition(query, args...)
+	if err != nil {
+		tx.AddError(err)
+		return tx
+	}
+	tx.Statement.Having = mergeConditions(tx.Statement.Having, cond)
+	return tx
+}
+
+// groupPipeline returns the aggregation reading the groups of documents of
+// type t.
+func (orm *MongoORM) groupPipeline(t reflect.Type) (mongo.Pipeline, error) {
+	joins, keys, err := orm.joinStages(t)
+	if err != nil {
+		return nil, err
+	}
+	before, after := orm.splitFilter(t, keys)
+
+	id := bson.D{}
+	project := bson.D{{Key: "_id", Value: 0}}
+	for i, name := range orm.Statement.Groups {
+		key := orm.documentKey(t, name)
+		// Field names of the _id document may not contain dots.
+		alias := fmt.Sprintf("g%d", i)
+		id = append(id, bson.E{Key: alias, Value: "$" + key})
+		project = append(project, bson.E{Key: key, Value: "$_id." + alias})
+	}
+	group := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+	}
+	project = append(project, bson.E{Key: "count", Value: 1})
+
+	exprs := make([]string, 0, len(orm.Statement.Selects))
+	for expr := range orm.Statement.Selects {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+	for _, expr := range exprs {
+		match := aggregateSelect.FindStringSubmatch(expr)
+		if match == nil {
+			if strings.Contains(expr, "(") {
+				return nil, fmt.Errorf("%w: unsupported aggregate %q", ErrInvalidCondition, expr)
+			}
+			continue
+		}
+		operator, field, name := "$"+strings.ToLower(match[1]), match[2], match[3]
+		var value interface{} = "$" + orm.documentKey(t, field)
+		if operator == "$count" {
+			if field != "*" {
+				return nil, fmt.Errorf("%w: unsupported aggregate %q, use count(*)", ErrInvalidCondition, expr)
+			}
+			operator, value = "$sum", 1
+		}
+		group = append(group, bson.E{Key: name, Value: bson.D{{Key: operator, Value: value}}})
+		project = append(project, bson.E{Key: name, Value: 1})
+	}
+
+	pipeline := mongo.Pipeline{}
+	if len(before) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: before}})
+	}
+	pipeline = append(pipeline, joins...)
+	if len(after) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: after}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: group}},
+		bson.D{{Key: "$project", Value: project}})
+	if len(orm.Statement.Having) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: orm.Statement.Having}})
+	}
+	if len(orm.Statement.Sort) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: orm.Statement.Sort}})
+	}
+	if orm.Statement.Offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: orm.Statement.Offset}})
+	}
+	if orm.Statement.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: orm.Statement.Limit}})
+	}
+	return pipeline, nil
+}
+
+// findGrouped reads the groups of a Group query into docs, a pointer to a
+// slice, recording the aggregation in the statement.
+func (orm *MongoORM) findGrouped(ctx context.Context, docs interface{}) error {
+	collection := orm.Statement.Collection
+	if collection == nil {
+		return ErrMissingModel
+	}
+	pipeline, err := orm.groupPipeline(modelType(orm.Statement.Model))
+	if err != nil {
+		return err
+	}
+	orm.Statement.record(collection, "aggregate", pipeline)
+	if orm.Statement.DryRun {
+		return nil
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline, orm.aggregateOptions())
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, docs)
+}
@@ -0,0 +1,36 @@
+package mongorm
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Hint makes the next query, count, aggregation, update or delete use the
+// given index, named or given by its key pattern, instead of the one the
+// query planner would pick:
+//
+//	orm.Hint("status_1_created_-1").Where("status = ?", "open").Find(&tickets)
+//	orm.Model(&Ticket{}).Hint(bson.D{{Key: "status", Value: 1}}).Count(&n)
+//
+// The operation fails if the index does not exist.
+func (orm *MongoORM) Hint(index interface{}) *MongoORM {
+	tx := orm.getInstance()
+	switch index := index.(type) {
+	case string:
+		if index == "" {
+			tx.AddError(fmt.Errorf("hint requires an index name"))
+			return tx
+		}
+	case bson.D:
+		if len(index) == 0 {
+			tx.AddError(fmt.Errorf("hint requires an index key pattern"))
+			return tx
+		}
+	default:
+		tx.AddError(fmt.Errorf("hint must be an index name or a bson.D key pattern, got %T", index))
+		return tx
+	}
+	tx.Statement.Hint = index
+	return tx
+}
@@ -0,0 +1,80 @@
+package mongorm
+
+import "reflect"
+
+// Hook method names looked up on documents. A hook may have any of these
+// signatures:
+//
+//	func (u *User) BeforeCreate()
+//	func (u *User) BeforeCreate() error
+//	func (u *User) BeforeCreate(tx *mongorm.MongoORM) error
+//
+// A Before hook returning an error aborts the operation and the error is
+// reported in MongoORM.Error. After hooks run once the operation succeeded;
+// the tx they receive carries its result, such as RowsAffected, and the
+// active transaction, if any. An error returned by an After hook is reported
+// in MongoORM.Error, and aborts the transaction when returned from a
+// Transaction callback.
+const (
+	hookBeforeCreate  = "BeforeCreate"
+	hookBeforeSave    = "BeforeSave"
+	hookBeforeUpdate  = "BeforeUpdate"
+	hookBeforeDelete  = "BeforeDelete"
+	hookBeforeRestore = "BeforeRestore"
+	hookAfterCreate   = "AfterCreate"
+	hookAfterSave     = "AfterSave"
+	hookAfterUpdate   = "AfterUpdate"
+	hookAfterDelete   = "AfterDelete"
+	hookAfterFind     = "AfterFind"
+	hookAfterRestore  = "AfterRestore"
+)
+
+// callHookEach invokes the hook method name on every element of the slice
+// docs, stopping at the first error.
+func (orm *MongoORM) callHookEach(docs reflect.Value, name string) error {
+	for i := 0; i < docs.Len(); i++ {
+		if err := orm.callHook(elemPointer(docs.Index(i)), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// elemPointer returns a pointer to the slice element elem, so that hooks
+// with pointer receivers are found.
+func elemPointer(elem reflect.Value) interface{} {
+	if elem.Kind() == reflect.Ptr || !elem.CanAddr() {
+		return elem.Interface()
+	}
+	return elem.Addr().Interface()
+}
+
+// callHook invokes the hook method name on doc if it has one with a
+// supported signature. Hooks are skipped in sessions with SkipHooks and by
+// UpdateColumn and UpdateColumns.
+func (orm *MongoORM) callHook(doc interface{}, name string) error {
+	if orm.skipHooks || (orm.Statement != nil && orm.Statement.UpdatingColumns) {
+		return nil
+	}
+	value := reflect.ValueOf(doc)
+	if !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+		return nil
+	}
+	if !orm.hasHook(value.Type(), name) {
+		return nil
+	}
+	method := value.MethodByName(name)
+	if !method.IsValid() {
+		return nil
+	}
+
+	switch hook := method.Interface().(type) {
+	case func(*MongoORM) error:
+		return hook(orm)
+	case func() error:
+		return hook()
+	case func():
+		hook()
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package mongorm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Documents are identified by the value of their ID field, the field
+// tagged mongorm:"primaryKey" or else named ID, stored as _id. It is
+// usually a primitive.ObjectID, left for the driver to fill in, but may be
+// of any type, such as a string or a UUID:
+//
+//	type Session struct {
+//		ID     mongorm.UUID `bson:"_id,omitempty"`
+//		UserID primitive.ObjectID
+//	}
+//
+//	type Country struct {
+//		ID   string `bson:"_id,omitempty" mongorm:"idGenerator:none"`
+//		Name string
+//	}
+//
+// Create stores a new ID in a zero ID field, made by the generator named by
+// the idGenerator tag of the field, one of Config.IDGenerators or the
+// built-in "uuid" and "objectid" generators. UUID fields default to "uuid",
+// string fields to "uuid" as well, and ObjectID fields to leaving the ID to
+// the driver. The generator "none" makes IDs client-generated: creating a
+// document with a zero ID fails with ErrMissingID.
+//
+// String IDs given to First, Delete and Restore are converted to the type
+// of the ID field. Associations still require ObjectID IDs.
+//
+// An IDGenerator returns the ID of a new document, which is converted to
+// the type of the ID field: ObjectIDs and UUIDs become strings in string
+// fields.
+type IDGenerator func() interface{}
+
+// builtinIDGenerators are the ID generators available without
+// configuration.
+var builtinIDGenerators = map[string]IDGenerator{
+	"uuid":     func() interface{} { return NewUUID() },
+	"objectid": func() interface{} { return primitive.NewObjectID() },
+}
+
+var (
+	uuidType     = reflect.TypeOf(UUID{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+// UUID is a UUID stored as binary data of subtype 4, the standard UUID
+// representation. Its zero value is the nil UUID.
+type UUID [16]byte
+
+// NewUUID returns a random, version 4, UUID.
+func NewUUID() UUID {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// ParseUUID parses s, a UUID in its canonical form, such as
+// "f47ac10b-58cc-4372-a567-0e02b2c3d479", or without hyphens.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	digits := s
+	if len(s) == 36 {
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return u, fmt.Errorf("%w: %q", ErrInvalidUUID, s)
+		}
+		digits = strings.ReplaceAll(s, "-", "")
+	}
+	if len(digits) != 32 {
+		return u, fmt.Errorf("%w: %q", ErrInvalidUUID, s)
+	}
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return u, fmt.Errorf("%w: %q", ErrInvalidUUID, s)
+	}
+	return u, nil
+}
+
+// String returns u in its canonical form.
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// IsZero reports whether u is the nil UUID, which omitempty leaves out.
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+// MarshalBSONValue stores u as binary data of subtype 4.
+func (u UUID) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.TypeBinary, bsoncore.AppendBinary(nil, bson.TypeBinaryUUID, u[:]), nil
+}
+
+// UnmarshalBSONValue reads u from binary data of subtype 4, or of the
+// legacy subtype 3, or from a string in canonical form.
+func (u *UUID) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bson.TypeNull, bson.TypeUndefined:
+		*u = UUID{}
+		return nil
+	case bson.TypeString:
+		s, _, ok := bsoncore.ReadString(data)
+		if !ok {
+			return fmt.Errorf("%w: malformed string", ErrInvalidUUID)
+		}
+		parsed, err := ParseUUID(s)
+		if err != nil {
+			return err
+		}
+		*u = parsed
+		return nil
+	case bson.TypeBinary:
+		subtype, bin, _, ok := bsoncore.ReadBinary(data)
+		if !ok || len(bin) != len(u) || (subtype != bson.TypeBinaryUUID && subtype != bson.TypeBinaryUUIDOld) {
+			return fmt.Errorf("%w: binary of subtype %d and length %d", ErrInvalidUUID, subtype, len(bin))
+		}
+		copy(u[:], bin)
+		return nil
+	}
+	return fmt.Errorf("%w: cannot decode %s into a UUID", ErrInvalidUUID, t)
+}
+
+// idFields caches the ID fields of struct types.
+var idFields sync.Map // reflect.Type -> fieldLookup
+
+// idField returns the ID field of the struct type t: the field tagged
+// primaryKey, or else the field named ID. Either way it is stored as _id.
+func idField(t reflect.Type) (reflect.StructField, bool) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	if lookup, ok := idFields.Load(t); ok {
+		return lookup.(fieldLookup).field, lookup.(fieldLookup).ok
+	}
+	var lookup fieldLookup
+	for _, field := range reflect.VisibleFields(t) {
+		if _, ok := fieldSettings(field)["primarykey"]; ok && field.IsExported() {
+			lookup = fieldLookup{field: field, ok: true}
+			break
+		}
+	}
+	if !lookup.ok {
+		lookup.field, lookup.ok = t.FieldByName("ID")
+	}
+	idFields.Store(t, lookup)
+	return lookup.field, lookup.ok
+}
+
+// idValue returns the ID field of v, a struct value.
+func idValue(v reflect.Value) reflect.Value {
+	field, ok := idField(v.Type())
+	if !ok {
+		return reflect.Value{}
+	}
+	value, err := v.FieldByIndexErr(field.Index)
+	if err != nil {
+		return reflect.Value{}
+	}
+	return value
+}
+
+// idGenerator returns the generator of the IDs of field, an ID field, or
+// nil when the driver assigns them. ok is false when IDs must be given by
+// the client.
+func (orm *MongoORM) idGenerator(field reflect.StructField) (generator IDGenerator, ok bool, err error) {
+	name, tagged := fieldSettings(field)["idgenerator"]
+	if !tagged {
+		switch t := indirectType(field.Type); {
+		case t == objectIDType, t.Kind() == reflect.Interface:
+			return nil, true, nil
+		case t == uuidType, t.Kind() == reflect.String:
+			name = "uuid"
+		default:
+			return nil, false, nil
+		}
+	}
+	if name == "none" {
+		return nil, false, nil
+	}
+	if generator, ok := orm.config.IDGenerators[name]; ok {
+		return generator, true, nil
+	}
+	if generator, ok := builtinIDGenerators[name]; ok {
+		return generator, true, nil
+	}
+	return nil, false, fmt.Errorf("unknown ID generator %q", name)
+}
+
+// assignID stores a new ID in the ID field of doc when it is zero, made by
+// the generator of the field. IDs left to the driver are not assigned.
+func (orm *MongoORM) assignID(doc interface{}) error {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	field, ok := idField(v.Type())
+	if !ok {
+		return nil
+	}
+	value, err := v.FieldByIndexErr(field.Index)
+	if err != nil || !value.CanSet() || !idIsZero(value) {
+		return nil
+	}
+	generator, ok, err := orm.idGenerator(field)
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		return fmt.Errorf("%w: %s IDs must be set before Create", ErrMissingID, v.Type())
+	case generator == nil:
+		return nil
+	}
+	return setID(value, generator())
+}
+
+// setID stores id in value, an ID field, converting it to the type of the
+// field.
+func setID(value reflect.Value, id interface{}) error {
+	target := value.Type()
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	idValue := reflect.ValueOf(id)
+	switch {
+	case !idValue.IsValid():
+		return fmt.Errorf("%w: ID generator returned nil", ErrMissingID)
+	case idValue.Type().AssignableTo(target):
+	case target.Kind() == reflect.String && idValue.Type() == objectIDType:
+		idValue = reflect.ValueOf(id.(primitive.ObjectID).Hex()).Convert(target)
+	case target.Kind() == reflect.String && idValue.Type() == uuidType:
+		idValue = reflect.ValueOf(id.(UUID).String()).Convert(target)
+	case idValue.Kind() == reflect.String && target.Kind() == reflect.String,
+		idValue.Kind() != reflect.String && target.Kind() != reflect.String && idValue.Type().ConvertibleTo(target):
+		idValue = idValue.Convert(target)
+	default:
+		return fmt.Errorf("ID generator returned %T, which cannot be stored in a %s ID", id, value.Type())
+	}
+	if value.Kind() == reflect.Ptr {
+		ptr := reflect.New(target)
+		ptr.Elem().Set(idValue)
+		idValue = ptr
+	}
+	value.Set(idValue)
+	return nil
+}
+
+// idIsZero reports whether value, an ID field, holds no ID.
+func idIsZero(value reflect.Value) bool {
+	if value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return true
+		}
+		value = value.Elem()
+	}
+	return value.IsZero()
+}
+
+// recordID returns the value of doc's ID field, of whatever type, or
+// ErrMissingID when it has none.
+func recordID(doc interface{}) (interface{}, error) {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, ErrMissingID
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, ErrMissingID
+	}
+	value := idValue(v)
+	if !value.IsValid() || idIsZero(value) {
+		return nil, ErrMissingID
+	}
+	if value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	return value.Interface(), nil
+}
+
+// parseID converts id, an ID given as a string, to the type of the ID
+// field of t: UUID fields parse it as a UUID, other string fields keep it,
+// and anything else parses it as an ObjectID.
+func parseID(t reflect.Type, id string) (interface{}, error) {
+	if field, ok := idField(t); ok {
+		switch ft := indirectType(field.Type); {
+		case ft == uuidType:
+			return ParseUUID(id)
+		case ft.Kind() == reflect.String:
+			return reflect.ValueOf(id).Convert(ft).Interface(), nil
+		}
+	}
+	return parseObjectID(id)
+}
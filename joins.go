@@ -0,0 +1,289 @@
+package mongorm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Joins joins the association name, declared as described for Preload, on
+// the server with $lookup. First and Find then read with an aggregation
+// that loads the association into each document, and conditions may refer
+// to fields of the associated documents under the association's key, its
+// bson name or else its lowercased field name:
+//
+//	// Users with at least one failed payment, with their payments.
+//	orm.Joins("Payments").Where("payments.status = ?", "failed").Find(&users)
+//
+// A pointer association is unwound into a single document, left empty when
+// there is none. Conditions that only refer to the model's own fields are
+// applied before the $lookup. Soft deleted associated documents, and those
+// outside the default scope of their model, are excluded unless the chain
+// is Unscoped, which requires MongoDB 5.0.
+func (orm *MongoORM) Joins(name string) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Joins = append(tx.Statement.Joins, name)
+	return tx
+}
+
+// joinKey returns the key $lookup stores the association field under.
+func (orm *MongoORM) joinKey(field reflect.StructField) string {
+	if name := orm.fieldName(field); name != "-" {
+		return name
+	}
+	return orm.namingStrategy().FieldName(field.Name)
+}
+
+// readPipeline returns the aggregation stages reading documents of type t
+// as chained: the filter, the associations given to Joins, order, offset
+// and limit, which Aggregate starts its pipelines with.
+func (orm *MongoORM) readPipeline(t reflect.Type, limit int64) (mongo.Pipeline, error) {
+	joins, keys, err := orm.joinStages(t)
+	if err != nil {
+		return nil, err
+	}
+	before, after := orm.splitFilter(t, keys)
+
+	// Unless they depend on the joined documents, order, offset and limit
+	// are applied before the $lookup as well, so that fewer documents are
+	// joined.
+	var window mongo.Pipeline
+	if len(orm.Statement.Sort) > 0 {
+		window = append(window, bson.D{{Key: "$sort", Value: orm.Statement.Sort}})
+	}
+	if orm.Statement.Offset > 0 {
+		window = append(window, bson.D{{Key: "$skip", Value: orm.Statement.Offset}})
+	}
+	if limit > 0 {
+		window = append(window, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	sortsJoin := false
+	for _, e := range orm.Statement.Sort {
+		sortsJoin = sortsJoin || referencesJoin(bson.M{e.Key: nil}, keys)
+	}
+
+	pipeline := mongo.Pipeline{}
+	if len(before) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: before}})
+	}
+	if len(after) == 0 && !sortsJoin {
+		pipeline = append(pipeline, window...)
+		window = nil
+	}
+	pipeline = append(pipeline, joins...)
+	if len(after) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: after}})
+	}
+	pipeline = append(pipeline, window...)
+	return pipeline, nil
+}
+
+// joinStages returns the $lookup stages loading the associations given to
+// Joins into documents of type t, and the keys they are stored under.
+func (orm *MongoORM) joinStages(t reflect.Type) (mongo.Pipeline, []string, error) {
+	var joins mongo.Pipeline
+	var keys []string
+	for _, name := range orm.Statement.Joins {
+		assoc, ok := orm.association(t, name)
+		if !ok {
+			return nil, nil, orm.missingAssociation(t, name)
+		}
+
+		key := orm.joinKey(assoc.field)
+		keys = append(keys, key)
+		lookup := bson.D{{Key: "from", Value: orm.Statement.CollectionPrefix + orm.collectionName(assoc.target)}}
+		if assoc.joinCollection != "" {
+			// Look up the join documents first, then the documents they
+			// refer to.
+			joins = append(joins, bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: orm.Statement.CollectionPrefix + assoc.joinCollection},
+				{Key: "localField", Value: "_id"},
+				{Key: "foreignField", Value: assoc.joinForeignKey},
+				{Key: "as", Value: key},
+			}}})
+			lookup = append(lookup,
+				bson.E{Key: "localField", Value: key + "." + assoc.joinReferences},
+				bson.E{Key: "foreignField", Value: "_id"})
+		} else if assoc.manyToMany {
+			lookup = append(lookup,
+				bson.E{Key: "localField", Value: orm.fieldName(assoc.foreignKey)},
+				bson.E{Key: "foreignField", Value: "_id"})
+		} else if assoc.many {
+			lookup = append(lookup,
+				bson.E{Key: "localField", Value: "_id"},
+				bson.E{Key: "foreignField", Value: orm.fieldName(assoc.foreignKey)})
+		} else {
+			lookup = append(lookup,
+				bson.E{Key: "localField", Value: orm.fieldName(assoc.foreignKey)},
+				bson.E{Key: "foreignField", Value: "_id"})
+		}
+		if scope := orm.modelScope(assoc.target); scope != nil {
+			lookup = append(lookup, bson.E{Key: "pipeline", Value: bson.A{bson.M{"$match": scope}}})
+		}
+		lookup = append(lookup, bson.E{Key: "as", Value: key})
+		joins = append(joins, bson.D{{Key: "$lookup", Value: lookup}})
+
+		if !assoc.many {
+			joins = append(joins, bson.D{{Key: "$unwind", Value: bson.D{
+				{Key: "path", Value: "$" + key},
+				{Key: "preserveNullAndEmptyArrays", Value: true},
+			}}})
+		}
+	}
+
+	return joins, keys, nil
+}
+
+// splitFilter splits the filter for documents of type t into the conditions
+// that can be matched before the $lookup stages storing associations under
+// keys, so that fewer documents are joined, and those that can only be
+// matched after them.
+func (orm *MongoORM) splitFilter(t reflect.Type, keys []string) (before, after bson.M) {
+	before, after = bson.M{}, bson.M{}
+	for key, value := range orm.queryFilter(t) {
+		if referencesJoin(bson.M{key: value}, keys) {
+			after[key] = value
+		} else {
+			before[key] = value
+		}
+	}
+	return before, after
+}
+
+// referencesJoin reports whether filter refers to a field stored under one
+// of keys.
+func referencesJoin(filter interface{}, keys []string) bool {
+	switch f := filter.(type) {
+	case bson.M:
+		for key, value := range f {
+			if strings.HasPrefix(key, "$") {
+				if referencesJoin(value, keys) {
+					return true
+				}
+				continue
+			}
+			for _, joined := range keys {
+				if key == joined || strings.HasPrefix(key, joined+".") {
+					return true
+				}
+			}
+		}
+	case bson.A:
+		for _, value := range f {
+			if referencesJoin(value, keys) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findJoined runs the aggregation reading documents of type t with the
+// associations given to Joins, recording it in the statement. It returns
+// nil without error on a dry run.
+func (orm *MongoORM) findJoined(ctx context.Context, collection *mongo.Collection, t reflect.Type, limit int64) (*mongo.Cursor, error) {
+	pipeline, err := orm.joinedPipeline(t, limit)
+	if err != nil {
+		return nil, err
+	}
+	orm.Statement.record(collection, "aggregate", pipeline)
+	if orm.Statement.DryRun {
+		return nil, nil
+	}
+	return collection.Aggregate(ctx, pipeline, orm.aggregateOptions())
+}
+
+// joinedPipeline returns the aggregation findJoined runs: readPipeline
+// followed by the projection of Select and Omit.
+func (orm *MongoORM) joinedPipeline(t reflect.Type, limit int64) (mongo.Pipeline, error) {
+	pipeline, err := orm.readPipeline(t, limit)
+	if err != nil {
+		return nil, err
+	}
+	if projection := orm.readProjection(t); len(projection) > 0 {
+		if orm.selectsFields() {
+			for _, name := range orm.Statement.Joins {
+				if assoc, ok := orm.association(t, name); ok {
+					projection[orm.joinKey(assoc.field)] = 1
+				}
+			}
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+	}
+	return pipeline, nil
+}
+
+// decodeJoined decodes raw, a document read with the associations given to
+// Joins, into doc, a pointer to a struct, including associations whose
+// fields the bson codec skips.
+func (orm *MongoORM) decodeJoined(raw bson.Raw, doc interface{}) error {
+	if err := unmarshalDocument(raw, doc); err != nil {
+		return err
+	}
+	docVal, ok := structValue(reflect.ValueOf(doc))
+	if !ok {
+		return nil
+	}
+	for _, name := range orm.Statement.Joins {
+		assoc, ok := orm.association(docVal.Type(), name)
+		if !ok {
+			continue
+		}
+		value, err := raw.LookupErr(orm.joinKey(assoc.field))
+		if err != nil {
+			continue
+		}
+		if err := value.Unmarshal(docVal.FieldByIndex(assoc.field.Index).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstJoined reads the first document of type t with the associations
+// given to Joins into doc.
+func (orm *MongoORM) firstJoined(ctx context.Context, collection *mongo.Collection, t reflect.Type, doc interface{}) error {
+	cursor, err := orm.findJoined(ctx, collection, t, 1)
+	if err != nil || cursor == nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+		return mongo.ErrNoDocuments
+	}
+	return orm.decodeJoined(cursor.Current, doc)
+}
+
+// decodeAllJoined decodes every document of cursor into docs, a pointer to
+// a slice, as decodeJoined does.
+func (orm *MongoORM) decodeAllJoined(ctx context.Context, cursor *mongo.Cursor, docs interface{}) error {
+	defer cursor.Close(ctx)
+
+	slice := reflect.ValueOf(docs).Elem()
+	elemType := slice.Type().Elem()
+	result := reflect.MakeSlice(slice.Type(), 0, 0)
+	for cursor.Next(ctx) {
+		elem := reflect.New(indirectType(elemType))
+		if err := orm.decodeJoined(cursor.Current, elem.Interface()); err != nil {
+			return err
+		}
+		if elemType.Kind() == reflect.Ptr {
+			result = reflect.Append(result, elem)
+		} else {
+			result = reflect.Append(result, elem.Elem())
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	slice.Set(result)
+	return nil
+}
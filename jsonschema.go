@@ -0,0 +1,337 @@
+package mongorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// namespaceNotFound is the server error code of collMod on a collection
+// that does not exist.
+const namespaceNotFound = 26
+
+// namespaceExists is the server error code of create on a collection that
+// already exists.
+const namespaceExists = 48
+
+// JSONSchema returns the $jsonSchema validator AutoMigrate installs for
+// model when Config.SchemaValidation is set. Field types map to BSON types,
+// with pointers, slices and maps also accepting null, and the rules of the
+// validate tags described for Validatable map to their JSON Schema
+// counterparts:
+//
+//	type User struct {
+//		ID    primitive.ObjectID `bson:"_id,omitempty"`
+//		Name  string             `validate:"required,max=50"`
+//		Role  string             `validate:"oneof=admin member"`
+//		Posts []Post             // an association
+//	}
+//
+// yields {"bsonType": "object", "required": ["name"], "properties":
+// {"_id": {"bsonType": "objectId"}, "name": {"bsonType": "string",
+// "maxLength": 50}, "role": {"bsonType": "string", "enum": ["admin",
+// "member"]}}}. Association fields and fields whose type encodes itself are
+// left unconstrained, as are fields absent from the model, so that
+// documents may carry more than it declares.
+func (orm *MongoORM) JSONSchema(model interface{}) (bson.M, error) {
+	t := modelType(model)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("JSONSchema expects a struct model, got %T", model)
+	}
+	return orm.objectSchema(t, map[reflect.Type]bool{})
+}
+
+// migrateSchema installs the $jsonSchema validator of the model type t on
+// its collection, creating the collection if needed.
+func (orm *MongoORM) migrateSchema(t reflect.Type) error {
+	schema, err := orm.objectSchema(t, map[reflect.Type]bool{})
+	if err != nil {
+		return err
+	}
+	validator := bson.M{"$jsonSchema": schema}
+	name := orm.collectionName(t)
+	db := orm.client.Database(orm.databaseName(name))
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+	begin := time.Now()
+	method := "collMod"
+	err = db.RunCommand(ctx, bson.D{{Key: "collMod", Value: name}, {Key: "validator", Value: validator}}).Err()
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == namespaceNotFound {
+		method = "createCollection"
+		err = db.CreateCollection(ctx, name, options.CreateCollection().SetValidator(validator))
+	}
+	orm.logger().Trace(orm.context(), begin, func() (string, int64) {
+		stmt := &Statement{}
+		stmt.record(db.Collection(name), method, validator)
+		return stmt.String(), 0
+	}, err)
+	return err
+}
+
+// objectSchema returns the schema of documents of the struct type t.
+// visiting holds the types whose schema is being built, whose documents
+// nested in themselves are left unconstrained.
+func (orm *MongoORM) objectSchema(t reflect.Type, visiting map[reflect.Type]bool) (bson.M, error) {
+	visiting[t] = true
+	defer delete(visiting, t)
+	properties := bson.M{}
+	var required []string
+	if err := orm.propertySchemas(t, visiting, properties, &required); err != nil {
+		return nil, err
+	}
+	schema := bson.M{"bsonType": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// propertySchemas adds the schemas of the fields of the struct type t to
+// properties, following inlined structs, and the keys of the fields
+// validated as required to required. Keys already in properties are left
+// as they are.
+func (orm *MongoORM) propertySchemas(t reflect.Type, visiting map[reflect.Type]bool, properties bson.M, required *[]string) error {
+	s := orm.schema(t)
+	if s.validationErr != nil {
+		return s.validationErr
+	}
+	rules := map[int][]validationRule{}
+	for _, validation := range s.validations {
+		rules[validation.field.Index[0]] = validation.rules
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("bson") == "-" {
+			continue
+		}
+		if isInline(field) {
+			if err := orm.propertySchemas(indirectType(field.Type), visiting, properties, required); err != nil {
+				return err
+			}
+			continue
+		}
+		if prefix, ok := embeddedPrefix(field); ok {
+			embedded := bson.M{}
+			var embeddedRequired []string
+			if err := orm.propertySchemas(indirectType(field.Type), visiting, embedded, &embeddedRequired); err != nil {
+				return err
+			}
+			for key, property := range embedded {
+				if _, ok := properties[prefix+key]; !ok {
+					properties[prefix+key] = property
+				}
+			}
+			for _, key := range embeddedRequired {
+				*required = append(*required, prefix+key)
+			}
+			continue
+		}
+		if _, ok := orm.association(t, field.Name); ok {
+			continue
+		}
+
+		key := orm.fieldName(field)
+		if _, ok := properties[key]; ok {
+			continue
+		}
+		property, err := orm.typeSchema(field.Type, visiting)
+		if err != nil {
+			return err
+		}
+		if property == nil {
+			continue
+		}
+		if applyRules(property, field.Type, rules[i]) {
+			*required = append(*required, key)
+		}
+		properties[key] = property
+	}
+	return nil
+}
+
+var (
+	valueMarshalerType = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
+	marshalerType      = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+)
+
+// typeSchema returns the schema of values of type t, or nil when they are
+// not constrained.
+func (orm *MongoORM) typeSchema(t reflect.Type, visiting map[reflect.Type]bool) (bson.M, error) {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+
+	var bsonType interface{}
+	schema := bson.M{}
+	switch {
+	case t == fileType:
+		bsonType, nullable = "objectId", true
+	case t == timeType, t == reflect.TypeOf(primitive.DateTime(0)):
+		bsonType = "date"
+	case t == reflect.TypeOf(primitive.ObjectID{}):
+		bsonType = "objectId"
+	case t == reflect.TypeOf(primitive.Decimal128{}):
+		bsonType = "decimal"
+	case t == reflect.TypeOf(primitive.Timestamp{}):
+		bsonType = "timestamp"
+	case t == reflect.TypeOf(primitive.Binary{}), t == uuidType:
+		bsonType = "binData"
+	case t == reflect.TypeOf(bson.D{}), t == reflect.TypeOf(bson.Raw{}):
+		bsonType = "object"
+	case t.Implements(valueMarshalerType), t.Implements(marshalerType),
+		reflect.PointerTo(t).Implements(valueMarshalerType), reflect.PointerTo(t).Implements(marshalerType):
+		return nil, nil
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			bsonType = "string"
+		case reflect.Bool:
+			bsonType = "bool"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			bsonType = bson.A{"int", "long"}
+		case reflect.Float32, reflect.Float64:
+			bsonType = "double"
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				bsonType = "binData"
+				break
+			}
+			bsonType, nullable = "array", nullable || t.Kind() == reflect.Slice
+			items, err := orm.typeSchema(t.Elem(), visiting)
+			if err != nil {
+				return nil, err
+			}
+			if items != nil {
+				schema["items"] = items
+			}
+		case reflect.Map:
+			bsonType, nullable = "object", true
+		case reflect.Struct:
+			if !isEmbeddedDocument(t) || visiting[t] {
+				return nil, nil
+			}
+			nested, err := orm.objectSchema(t, visiting)
+			if err != nil {
+				return nil, err
+			}
+			schema = nested
+			bsonType = "object"
+		default:
+			return nil, nil
+		}
+	}
+
+	if nullable {
+		if types, ok := bsonType.(bson.A); ok {
+			bsonType = append(append(bson.A{}, types...), "null")
+		} else {
+			bsonType = bson.A{bsonType, "null"}
+		}
+	}
+	schema["bsonType"] = bsonType
+	return schema, nil
+}
+
+// applyRules adds to schema, the schema of values of type t, the
+// constraints of the validate rules that the server can check, and reports
+// whether the field is required. Rules of fields validated with omitempty
+// only apply to non-zero values, which JSON Schema cannot tell apart, so
+// they are left out.
+func applyRules(schema bson.M, t reflect.Type, rules []validationRule) bool {
+	required, omitempty := false, false
+	for _, rule := range rules {
+		switch rule.name {
+		case "required":
+			required = true
+		case "omitempty":
+			omitempty = true
+		}
+	}
+	if omitempty {
+		return required
+	}
+
+	nullable := t.Kind() == reflect.Ptr
+	t = indirectType(t)
+	for _, rule := range rules {
+		bound := int64(rule.bound)
+		switch rule.name {
+		case "min", "max", "len":
+			var minKey, maxKey string
+			var minValue, maxValue interface{} = bound, bound
+			switch t.Kind() {
+			case reflect.String:
+				minKey, maxKey = "minLength", "maxLength"
+			case reflect.Slice, reflect.Array:
+				minKey, maxKey = "minItems", "maxItems"
+			case reflect.Map:
+				minKey, maxKey = "minProperties", "maxProperties"
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+				minKey, maxKey = "minimum", "maximum"
+				minValue, maxValue = rule.bound, rule.bound
+			default:
+				continue
+			}
+			if rule.name != "max" {
+				schema[minKey] = minValue
+			}
+			if rule.name != "min" {
+				schema[maxKey] = maxValue
+			}
+		case "email":
+			if t.Kind() == reflect.String {
+				schema["pattern"] = `^[^@\s]+@[^@\s]+$`
+			}
+		case "oneof":
+			enum := bson.A{}
+			for _, option := range strings.Fields(rule.param) {
+				value, ok := enumValue(t, option)
+				if !ok {
+					enum = nil
+					break
+				}
+				enum = append(enum, value)
+			}
+			if enum != nil {
+				if nullable {
+					enum = append(enum, nil)
+				}
+				schema["enum"] = enum
+			}
+		}
+	}
+	return required
+}
+
+// enumValue converts option, a oneof value, to the value stored for a field
+// of type t.
+func enumValue(t reflect.Type, option string) (interface{}, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return option, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(option, 10, 64)
+		return n, err == nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(option, 10, 64)
+		return int64(n), err == nil
+	}
+	return nil, false
+}
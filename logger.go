@@ -0,0 +1,149 @@
+package mongorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// LogLevel controls which messages a Logger writes.
+type LogLevel int
+
+const (
+	// LogSilent disables logging.
+	LogSilent LogLevel = iota + 1
+	// LogError logs failed operations.
+	LogError
+	// LogWarn additionally logs slow operations.
+	LogWarn
+	// LogInfo logs every operation.
+	LogInfo
+)
+
+// Logger receives a trace of every operation and other diagnostics. Set it
+// with Config.Logger; DefaultLogger is used otherwise.
+type Logger interface {
+	// LogMode returns a copy of the logger using level.
+	LogMode(level LogLevel) Logger
+	Info(ctx context.Context, msg string, data ...interface{})
+	Warn(ctx context.Context, msg string, data ...interface{})
+	Error(ctx context.Context, msg string, data ...interface{})
+	// Trace is called once an operation finished. fc renders the driver
+	// call, such as db.users.find({"age": {"$gt": 30}}), and returns the
+	// number of documents affected.
+	Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error)
+}
+
+// Writer is the output of the logger returned by NewLogger. *log.Logger
+// implements it.
+type Writer interface {
+	Printf(format string, args ...interface{})
+}
+
+// LoggerConfig configures the logger returned by NewLogger.
+type LoggerConfig struct {
+	// SlowThreshold is the duration from which operations are logged as
+	// slow at LogWarn. Zero disables slow operation logging.
+	SlowThreshold time.Duration
+	// LogLevel selects which messages are written.
+	LogLevel LogLevel
+	// IgnoreRecordNotFoundError stops ErrRecordNotFound from being logged
+	// as an error.
+	IgnoreRecordNotFoundError bool
+}
+
+// DefaultLogger writes failed and slow operations to standard output.
+var DefaultLogger = NewLogger(log.New(os.Stdout, "\r\n", log.LstdFlags), LoggerConfig{
+	SlowThreshold:             200 * time.Millisecond,
+	LogLevel:                  LogWarn,
+	IgnoreRecordNotFoundError: true,
+})
+
+type logger struct {
+	Writer
+	LoggerConfig
+}
+
+// NewLogger returns a Logger writing to w.
+func NewLogger(w Writer, config LoggerConfig) Logger {
+	return &logger{Writer: w, LoggerConfig: config}
+}
+
+func (l *logger) LogMode(level LogLevel) Logger {
+	copied := *l
+	copied.LogLevel = level
+	return &copied
+}
+
+func (l *logger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.LogLevel >= LogInfo {
+		l.Printf("[info] "+msg, data...)
+	}
+}
+
+func (l *logger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.LogLevel >= LogWarn {
+		l.Printf("[warn] "+msg, data...)
+	}
+}
+
+func (l *logger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.LogLevel >= LogError {
+		l.Printf("[error] "+msg, data...)
+	}
+}
+
+func (l *logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.LogLevel <= LogSilent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	ms := float64(elapsed.Nanoseconds()) / 1e6
+	switch {
+	case err != nil && l.LogLevel >= LogError && (!errors.Is(err, ErrRecordNotFound) || !l.IgnoreRecordNotFoundError):
+		command, rows := fc()
+		l.Printf("%s\n[%.3fms] [rows:%d] %s", err, ms, rows, command)
+	case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= LogWarn:
+		command, rows := fc()
+		slow := fmt.Sprintf("SLOW OPERATION >= %v", l.SlowThreshold)
+		l.Printf("%s\n[%.3fms] [rows:%d] %s", slow, ms, rows, command)
+	case l.LogLevel >= LogInfo:
+		command, rows := fc()
+		l.Printf("[%.3fms] [rows:%d] %s", ms, rows, command)
+	}
+}
+
+// logger returns the configured Logger.
+func (orm *MongoORM) logger() Logger {
+	if orm.sessionLogger != nil {
+		return orm.sessionLogger
+	}
+	if orm.config != nil && orm.config.Logger != nil {
+		return orm.config.Logger
+	}
+	return DefaultLogger
+}
+
+// trace reports the operation recorded in the statement to the logger.
+func (orm *MongoORM) trace(begin time.Time) {
+	stmt := orm.Statement
+	orm.logger().Trace(orm.context(), begin, func() (string, int64) {
+		return stmt.String(), int64(orm.RowsAffected)
+	}, orm.Error)
+}
+
+// context returns the context of the running operation, the one set with
+// WithContext, or the background context.
+func (orm *MongoORM) context() context.Context {
+	if orm.Statement != nil && orm.Statement.Context != nil {
+		return orm.Statement.Context
+	}
+	if orm.ctx == nil {
+		return context.Background()
+	}
+	return orm.ctx
+}
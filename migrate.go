@@ -0,0 +1,634 @@
+package mongorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexSpec describes an index declared with mongorm struct tags.
+type indexSpec struct {
+	name   string
+	keys   []indexKey
+	unique bool
+	ttl    *time.Duration
+	// weights holds the weights of the fields of a text index.
+	weights bson.M
+	// collation is the collation the index compares strings with.
+	collation *options.Collation
+}
+
+// textIndexName names the text index gathering the fields tagged "text",
+// since a collection has at most one.
+const textIndexName = "text"
+
+type indexKey struct {
+	field string
+	order int
+	// kind replaces order for special indexes, such as "2dsphere".
+	kind     string
+	priority int
+	position int
+}
+
+// AutoMigrate creates the indexes declared on each model's fields with the
+// mongorm struct tag. Settings in the tag are separated by semicolons:
+//
+//	type Member struct {
+//		Email   string    `bson:"email" mongorm:"unique"`
+//		OrgID   string    `bson:"org_id" mongorm:"index:idx_org_name"`
+//		Name    string    `bson:"name" mongorm:"index:idx_org_name,priority:2"`
+//		Created int64     `bson:"created" mongorm:"index:,sort:desc"`
+//		Expires time.Time `bson:"expires" mongorm:"ttl:24h"`
+//	}
+//
+// A bare "index" creates a single-field ascending index. Fields sharing an
+// index name form a compound index, ordered by priority (default 10) and
+// then by field order. Options after the name are "unique", "sort:desc",
+// "priority:N", "type:2dsphere" or "type:2d" for geospatial keys, and
+// "type:text" with an optional "weight:N" for text keys, and "collation:en"
+// with an optional "strength:N" for an index comparing strings as the
+// queries run with Collation do.
+// "unique" on its own creates a single-field unique index and
+// "uniqueIndex:name" is shorthand for "index:name,unique". Existing indexes
+// with the same definition are left alone.
+//
+// "2dsphere" on its own creates a 2dsphere index on a field holding GeoJSON,
+// such as a Point, as needed by Near, Within and GeoIntersects:
+//
+//	Location mongorm.Point `bson:"location" mongorm:"2dsphere"`
+//
+// "text" adds a string field to the text index of the collection, searched
+// by Search; "text:N" gives it weight N, 1 by default:
+//
+//	Title string `bson:"title" mongorm:"text:10"`
+//	Body  string `bson:"body" mongorm:"text"`
+//
+// "ttl:24h" on a time.Time field creates a TTL index removing documents once
+// the field is older than the given duration; days may be written as "30d".
+//
+// Writes violating a unique index fail with a *DuplicateKeyError naming the
+// fields involved.
+//
+// A "timeseries" tag, usually on the time field, makes AutoMigrate create
+// the collection as a time series collection, with settings such as
+// "timeseries:metaField=sensor,granularity=minutes". Existing collections
+// are left alone, as MongoDB cannot convert them. Models implementing
+// Capped get a capped collection the same way.
+//
+// The foreign keys of the associations of each model, declared as described
+// for Preload, are indexed too, in whichever collection holds them, unless
+// an index declared on the model holding them starts with them or
+// Config.DisableForeignKeyIndexes is set. Models with invalid association
+// declarations fail to migrate.
+//
+// With Config.SchemaValidation set, AutoMigrate also installs the validator
+// returned by JSONSchema on each collection, creating it if needed.
+func (orm *MongoORM) AutoMigrate(models ...interface{}) error {
+	if orm.client == nil {
+		return ErrMissingClient
+	}
+
+	for _, model := range models {
+		t := modelType(model)
+		if t == nil || t.Kind() != reflect.Struct {
+			return fmt.Errorf("AutoMigrate expects a struct model, got %T", model)
+		}
+
+		if err := orm.schema(t).associationErr; err != nil {
+			return fmt.Errorf("migrate %s: %w", t.Name(), err)
+		}
+		if err := orm.migrateCollection(t); err != nil {
+			return fmt.Errorf("migrate %s: %w", t.Name(), err)
+		}
+		if orm.config.SchemaValidation {
+			if err := orm.migrateSchema(t); err != nil {
+				return fmt.Errorf("migrate %s: %w", t.Name(), err)
+			}
+		}
+
+		specs, err := orm.parseIndexes(t)
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", t.Name(), err)
+		}
+		name := orm.collectionName(t)
+		if err := orm.createIndexes(name, specs); err != nil {
+			return fmt.Errorf("migrate %s: %w", t.Name(), err)
+		}
+		if orm.config.DisableForeignKeyIndexes {
+			continue
+		}
+		if err := orm.migrateForeignKeys(t, specs); err != nil {
+			return fmt.Errorf("migrate %s: %w", t.Name(), err)
+		}
+	}
+	return nil
+}
+
+// createIndexes creates the indexes specs on the collection name.
+func (orm *MongoORM) createIndexes(name string, specs []*indexSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	indexModels := make([]mongo.IndexModel, 0, len(specs))
+	for _, spec := range specs {
+		indexModels = append(indexModels, spec.model())
+	}
+
+	collection := orm.collection(name)
+	ctx, cancel := orm.operationContext()
+	begin := time.Now()
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	cancel()
+	orm.logger().Trace(orm.context(), begin, func() (string, int64) {
+		keys := make([]interface{}, len(indexModels))
+		for i, model := range indexModels {
+			keys[i] = model.Keys
+		}
+		stmt := &Statement{}
+		stmt.record(collection, "createIndexes", keys)
+		return stmt.String(), int64(len(indexModels))
+	}, err)
+	return err
+}
+
+// foreignKeyIndex is an index on the foreign keys of an association.
+type foreignKeyIndex struct {
+	// collection holds the foreign keys, those of documents of model, or
+	// join documents when model is nil.
+	collection string
+	model      reflect.Type
+	spec       *indexSpec
+}
+
+// foreignKeyIndexes returns the indexes that the queries loading the
+// associations of t need: on the foreign keys of its belongsTo fields in
+// its own collection, on those of its hasMany fields in the collections of
+// their targets, and on both keys of the join documents of its many2many
+// fields.
+func (orm *MongoORM) foreignKeyIndexes(t reflect.Type) []foreignKeyIndex {
+	var indexes []foreignKeyIndex
+	for _, assoc := range orm.schema(t).associations {
+		switch {
+		case assoc.manyToMany && assoc.joinCollection == "":
+			// The targets are loaded by _id.
+		case assoc.manyToMany:
+			indexes = append(indexes,
+				foreignKeyIndex{collection: assoc.joinCollection, spec: newIndexSpec(assoc.joinForeignKey, assoc.joinReferences)},
+				foreignKeyIndex{collection: assoc.joinCollection, spec: newIndexSpec(assoc.joinReferences)})
+		case assoc.many:
+			indexes = append(indexes, foreignKeyIndex{
+				collection: orm.collectionName(assoc.target),
+				model:      assoc.target,
+				spec:       newIndexSpec(orm.fieldName(assoc.foreignKey)),
+			})
+		default:
+			indexes = append(indexes, foreignKeyIndex{
+				collection: orm.collectionName(t),
+				model:      t,
+				spec:       newIndexSpec(orm.fieldName(assoc.foreignKey)),
+			})
+		}
+	}
+	return indexes
+}
+
+// migrateForeignKeys creates the foreignKeyIndexes of t that no index
+// declared on the model holding the keys starts with. specs are the
+// indexes declared on t.
+func (orm *MongoORM) migrateForeignKeys(t reflect.Type, specs []*indexSpec) error {
+	declared := map[reflect.Type][]*indexSpec{t: specs}
+	created := map[string][]*indexSpec{}
+	var collections []string
+	for _, index := range orm.foreignKeyIndexes(t) {
+		if index.model != nil {
+			if _, ok := declared[index.model]; !ok {
+				var err error
+				if declared[index.model], err = orm.parseIndexes(index.model); err != nil {
+					return fmt.Errorf("%v: %w", index.model, err)
+				}
+			}
+			if coveredBy(index.spec, declared[index.model]) {
+				continue
+			}
+		}
+		if coveredBy(index.spec, created[index.collection]) {
+			continue
+		}
+		if _, ok := created[index.collection]; !ok {
+			collections = append(collections, index.collection)
+		}
+		created[index.collection] = append(created[index.collection], index.spec)
+	}
+	// Each index is created on its own, so that one already existing under
+	// another name, which the server refuses to create again, is skipped.
+	for _, collection := range collections {
+		for _, spec := range created[collection] {
+			err := orm.createIndexes(collection, []*indexSpec{spec})
+			var cmdErr mongo.CommandError
+			if errors.As(err, &cmdErr) && (cmdErr.Code == indexOptionsConflict || cmdErr.Code == indexKeySpecsConflict) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexOptionsConflict and indexKeySpecsConflict are the server error codes
+// of createIndexes on keys that already have an index, under another name
+// or with other options.
+const (
+	indexOptionsConflict  = 85
+	indexKeySpecsConflict = 86
+)
+
+// newIndexSpec returns the spec of an ascending index on fields.
+func newIndexSpec(fields ...string) *indexSpec {
+	spec := &indexSpec{}
+	for i, field := range fields {
+		spec.keys = append(spec.keys, indexKey{field: field, order: 1, priority: 10, position: i})
+	}
+	return spec
+}
+
+// coveredBy reports whether one of specs is a plain index whose keys start
+// with those of spec, and so serves the same queries.
+func coveredBy(spec *indexSpec, specs []*indexSpec) bool {
+	want := spec.sortedKeys()
+	for _, other := range specs {
+		keys := other.sortedKeys()
+		if other.collation != nil || other.weights != nil || len(keys) < len(want) {
+			continue
+		}
+		covered := true
+		for i, key := range want {
+			if keys[i].field != key.field || keys[i].kind != "" {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateCollection creates the collection of the model type t when its
+// tags or methods ask for a special kind of collection, such as a time
+// series or a capped collection.
+func (orm *MongoORM) migrateCollection(t reflect.Type) error {
+	opts, err := orm.parseTimeSeries(t)
+	if err != nil {
+		return err
+	}
+	capped, err := parseCapped(t)
+	switch {
+	case err != nil:
+		return err
+	case capped != nil && opts != nil:
+		return errors.New("a time series collection cannot be capped")
+	case capped != nil:
+		opts = capped
+	case opts == nil:
+		return nil
+	}
+
+	collection := orm.collection(orm.collectionName(t))
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+	begin := time.Now()
+	err = collection.Database().CreateCollection(ctx, collection.Name(), opts)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == namespaceExists {
+		err = nil
+	}
+	orm.logger().Trace(orm.context(), begin, func() (string, int64) {
+		stmt := &Statement{}
+		stmt.record(collection, "createCollection", collectionOptions(opts))
+		return stmt.String(), 0
+	}, err)
+	return err
+}
+
+// collectionOptions renders the options of a created collection as the
+// create command spells them, for the log.
+func collectionOptions(opts *options.CreateCollectionOptions) bson.D {
+	doc := bson.D{}
+	if ts := opts.TimeSeriesOptions; ts != nil {
+		timeSeries := bson.D{{Key: "timeField", Value: ts.TimeField}}
+		if ts.MetaField != nil {
+			timeSeries = append(timeSeries, bson.E{Key: "metaField", Value: *ts.MetaField})
+		}
+		if ts.Granularity != nil {
+			timeSeries = append(timeSeries, bson.E{Key: "granularity", Value: *ts.Granularity})
+		}
+		doc = append(doc, bson.E{Key: "timeseries", Value: timeSeries})
+	}
+	if opts.Capped != nil && *opts.Capped {
+		doc = append(doc, bson.E{Key: "capped", Value: true})
+		if opts.SizeInBytes != nil {
+			doc = append(doc, bson.E{Key: "size", Value: *opts.SizeInBytes})
+		}
+		if opts.MaxDocuments != nil {
+			doc = append(doc, bson.E{Key: "max", Value: *opts.MaxDocuments})
+		}
+	}
+	if opts.ExpireAfterSeconds != nil {
+		doc = append(doc, bson.E{Key: "expireAfterSeconds", Value: *opts.ExpireAfterSeconds})
+	}
+	return doc
+}
+
+// parseIndexes collects the indexes declared on t's fields, including those
+// of inlined structs and of embedded documents, whose keys are prefixed with
+// the document's path.
+func (orm *MongoORM) parseIndexes(t reflect.Type) ([]*indexSpec, error) {
+	var specs []*indexSpec
+	named := map[string]*indexSpec{}
+	position := 0
+
+	var walk func(t reflect.Type, prefix string) error
+	walk = func(t reflect.Type, prefix string) error {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if isInline(field) {
+				if err := walk(indirectType(field.Type), prefix); err != nil {
+					return err
+				}
+				continue
+			}
+			if embedded, ok := embeddedPrefix(field); ok {
+				if err := walk(indirectType(field.Type), prefix+embedded); err != nil {
+					return err
+				}
+				continue
+			}
+
+			settings := fieldSettings(field)
+			value, ok := settings["index"]
+			if uniqueValue, unique := settings["uniqueindex"]; unique {
+				value, ok = uniqueValue+",unique", true
+			} else if _, unique := settings["unique"]; unique && !ok {
+				value, ok = ",unique", true
+			} else if _, geo := settings["2dsphere"]; geo && !ok {
+				value, ok = ",type:2dsphere", true
+			} else if weight, text := settings["text"]; text && !ok {
+				value, ok = textIndexName+",type:text", true
+				if weight != "" {
+					value += ",weight:" + weight
+				}
+			}
+
+			var ttl *time.Duration
+			if ttlValue, hasTTL := settings["ttl"]; hasTTL {
+				if !isTimeField(field.Type) {
+					return fmt.Errorf("field %s: ttl requires a time.Time field", field.Name)
+				}
+				expireAfter, err := parseTTL(ttlValue)
+				if err != nil {
+					return fmt.Errorf("field %s: %w", field.Name, err)
+				}
+				ttl = &expireAfter
+				if !ok {
+					value, ok = "", true
+				}
+			}
+			if !ok {
+				if isEmbeddedDocument(field.Type) {
+					if err := walk(field.Type, prefix+orm.fieldName(field)+"."); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			position++
+
+			key := indexKey{field: prefix + orm.fieldName(field), order: 1, priority: 10, position: position}
+			parts := strings.Split(value, ",")
+			name := strings.TrimSpace(parts[0])
+			unique := false
+			weight := 0
+			var collation *options.Collation
+			strength := 0
+			for _, option := range parts[1:] {
+				optKey, optValue, _ := strings.Cut(strings.TrimSpace(option), ":")
+				switch strings.ToLower(optKey) {
+				case "unique":
+					unique = true
+				case "sort":
+					switch strings.ToLower(optValue) {
+					case "asc":
+					case "desc":
+						key.order = -1
+					default:
+						return fmt.Errorf("field %s: invalid index sort %q", field.Name, optValue)
+					}
+				case "priority":
+					priority, err := strconv.Atoi(optValue)
+					if err != nil {
+						return fmt.Errorf("field %s: invalid index priority %q", field.Name, optValue)
+					}
+					key.priority = priority
+				case "type":
+					switch kind := strings.ToLower(optValue); kind {
+					case "2dsphere", "2d", "text":
+						key.kind = kind
+					default:
+						return fmt.Errorf("field %s: invalid index type %q", field.Name, optValue)
+					}
+				case "collation":
+					if optValue == "" {
+						return fmt.Errorf("field %s: index collation requires a locale", field.Name)
+					}
+					collation = &options.Collation{Locale: optValue}
+				case "strength":
+					var err error
+					if strength, err = strconv.Atoi(optValue); err != nil || strength < 1 || strength > 5 {
+						return fmt.Errorf("field %s: invalid collation strength %q", field.Name, optValue)
+					}
+				case "weight":
+					var err error
+					if weight, err = strconv.Atoi(optValue); err != nil || weight < 1 {
+						return fmt.Errorf("field %s: invalid text index weight %q", field.Name, optValue)
+					}
+				case "":
+				default:
+					return fmt.Errorf("field %s: unknown index option %q", field.Name, optKey)
+				}
+			}
+
+			if weight > 0 && key.kind != "text" {
+				return fmt.Errorf("field %s: weight requires a text index", field.Name)
+			}
+			if strength > 0 {
+				if collation == nil {
+					return fmt.Errorf("field %s: strength requires a collation", field.Name)
+				}
+				collation.Strength = strength
+			}
+			if name == "" {
+				specs = append(specs, &indexSpec{keys: []indexKey{key}, unique: unique, ttl: ttl, collation: collation})
+				continue
+			}
+			if ttl != nil {
+				return fmt.Errorf("field %s: ttl cannot be combined with compound index %q", field.Name, name)
+			}
+			spec, exists := named[name]
+			if !exists {
+				spec = &indexSpec{name: name}
+				named[name] = spec
+				specs = append(specs, spec)
+			}
+			spec.keys = append(spec.keys, key)
+			spec.unique = spec.unique || unique
+			if collation != nil {
+				if spec.collation != nil && *spec.collation != *collation {
+					return fmt.Errorf("field %s: conflicting collations for index %q", field.Name, name)
+				}
+				spec.collation = collation
+			}
+			if weight > 0 {
+				if spec.weights == nil {
+					spec.weights = bson.M{}
+				}
+				spec.weights[key.field] = weight
+			}
+		}
+		return nil
+	}
+
+	if err := walk(t, ""); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// sortedKeys returns the keys of the spec in index order.
+func (spec *indexSpec) sortedKeys() []indexKey {
+	keys := append([]indexKey(nil), spec.keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].priority != keys[j].priority {
+			return keys[i].priority < keys[j].priority
+		}
+		return keys[i].position < keys[j].position
+	})
+	return keys
+}
+
+// model converts the spec into a driver index model.
+func (spec *indexSpec) model() mongo.IndexModel {
+	doc := bson.D{}
+	for _, key := range spec.sortedKeys() {
+		if key.kind != "" {
+			doc = append(doc, bson.E{Key: key.field, Value: key.kind})
+			continue
+		}
+		doc = append(doc, bson.E{Key: key.field, Value: key.order})
+	}
+
+	opts := options.Index()
+	if spec.name != "" {
+		opts.SetName(spec.name)
+	}
+	if spec.unique {
+		opts.SetUnique(true)
+	}
+	if spec.ttl != nil {
+		opts.SetExpireAfterSeconds(int32(spec.ttl.Seconds()))
+	}
+	if spec.weights != nil {
+		opts.SetWeights(spec.weights)
+	}
+	if spec.collation != nil {
+		opts.SetCollation(spec.collation)
+	}
+	return mongo.IndexModel{Keys: doc, Options: opts}
+}
+
+// parseTTL parses a ttl tag value. In addition to time.ParseDuration units
+// it accepts whole days, such as "30d".
+func parseTTL(value string) (time.Duration, error) {
+	var ttl time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else {
+		ttl, err = time.ParseDuration(value)
+	}
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid ttl %q", value)
+	}
+	return ttl, nil
+}
+
+func isTimeField(t reflect.Type) bool {
+	return indirectType(t) == reflect.TypeOf(time.Time{})
+}
+
+// parseTagSettings splits a mongorm struct tag into its semicolon separated
+// settings. Keys are lowercased; settings without a value map to "". Use
+// fieldSettings for the cached settings of a field.
+func parseTagSettings(tag string) map[string]string {
+	settings := map[string]string{}
+	for _, setting := range strings.Split(tag, ";") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(setting, ":")
+		settings[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return settings
+}
+
+// isInline reports whether field is a struct whose fields the bson codec
+// stores in the parent document, as requested with bson:",inline".
+func isInline(field reflect.StructField) bool {
+	if indirectType(field.Type).Kind() != reflect.Struct {
+		return false
+	}
+	for _, option := range strings.Split(field.Tag.Get("bson"), ",")[1:] {
+		if option == "inline" {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmbeddedDocument reports whether values of t are stored as a nested
+// document. Pointers are not followed so self-referencing types terminate.
+func isEmbeddedDocument(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(primitive.ObjectID{}):
+		return false
+	}
+	return t.PkgPath() != "go.mongodb.org/mongo-driver/bson/primitive"
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
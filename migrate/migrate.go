@@ -0,0 +1,328 @@
+// Package migrate applies versioned migrations to a mongorm database.
+//
+//	m := migrate.New(orm, nil, []*migrate.Migration{{
+//		ID: "202401151200_users_email_index",
+//		Up: func(tx *mongorm.MongoORM) error {
+//			return tx.AutoMigrate(&User{})
+//		},
+//		Down: func(tx *mongorm.MongoORM) error {
+//			users, err := tx.Collection("users")
+//			if err != nil {
+//				return err
+//			}
+//			_, err = users.Indexes().DropOne(tx.Context(), "email_1")
+//			return err
+//		},
+//	}})
+//	if err := m.Up(ctx); err != nil {
+//		return err
+//	}
+//
+// Migrations run in the order given and are recorded, once applied, in the
+// "migrations" collection. A lock keeps concurrent runners, such as the
+// instances of a service starting together, from applying them twice: the
+// runners that do not get it fail with ErrLocked.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrLocked is returned when another runner holds the migration lock.
+	ErrLocked = errors.New("migrations are locked by another runner")
+	// ErrUnknownMigration is returned by UpTo and DownTo for an ID that is
+	// not among the migrations.
+	ErrUnknownMigration = errors.New("unknown migration")
+	// ErrIrreversible is returned when rolling back a migration without a
+	// Down function.
+	ErrIrreversible = errors.New("migration has no Down function")
+)
+
+// Migration is a versioned change to the database.
+type Migration struct {
+	// ID identifies the migration in the migrations collection. IDs are
+	// usually prefixed with a timestamp, such as "202401151200_add_index".
+	ID string
+	// Up applies the migration and Down reverts it. Down may be nil for
+	// migrations that cannot be rolled back.
+	Up   func(tx *mongorm.MongoORM) error
+	Down func(tx *mongorm.MongoORM) error
+}
+
+// Options configures a Migrator.
+type Options struct {
+	// Collection records the applied migrations. Defaults to "migrations";
+	// the lock is kept in the same name suffixed with "_lock".
+	Collection string
+	// UseTransaction runs each migration and its record in a transaction,
+	// which requires a replica set and migrations that are allowed in
+	// transactions.
+	UseTransaction bool
+	// LockTTL is how long a lock is held before another runner may take
+	// it over, in case its holder died. It must exceed the longest run and
+	// defaults to 15 minutes.
+	LockTTL time.Duration
+}
+
+// Status is the state of a migration.
+type Status struct {
+	ID        string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// record is the document of an applied migration.
+type record struct {
+	ID        string    `bson:"_id"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Migrator applies migrations.
+type Migrator struct {
+	orm        *mongorm.MongoORM
+	opts       Options
+	migrations []*Migration
+}
+
+// New returns a Migrator applying migrations, in order, with orm.
+func New(orm *mongorm.MongoORM, opts *Options, migrations []*Migration) *Migrator {
+	m := &Migrator{orm: orm, migrations: migrations}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if m.opts.Collection == "" {
+		m.opts.Collection = "migrations"
+	}
+	if m.opts.LockTTL <= 0 {
+		m.opts.LockTTL = 15 * time.Minute
+	}
+	return m
+}
+
+// Up applies the migrations that were not applied yet.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.UpTo(ctx, "")
+}
+
+// UpTo applies the migrations that were not applied yet, up to and
+// including the one identified by id, or all of them when id is empty.
+func (m *Migrator) UpTo(ctx context.Context, id string) error {
+	last, err := m.index(id, len(m.migrations)-1)
+	if err != nil {
+		return err
+	}
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations[:last+1] {
+			if _, ok := applied[migration.ID]; ok {
+				continue
+			}
+			if err := m.run(ctx, migration, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down rolls back the last applied migration, if any.
+func (m *Migrator) Down(ctx context.Context) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].ID]; ok {
+				return m.run(ctx, m.migrations[i], false)
+			}
+		}
+		return nil
+	})
+}
+
+// DownTo rolls back the applied migrations following the one identified by
+// id, latest first, or all of them when id is empty.
+func (m *Migrator) DownTo(ctx context.Context, id string) error {
+	first, err := m.index(id, -1)
+	if err != nil {
+		return err
+	}
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i > first; i-- {
+			if _, ok := applied[m.migrations[i].ID]; !ok {
+				continue
+			}
+			if err := m.run(ctx, m.migrations[i], false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns the state of every migration, in order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{ID: migration.ID}
+		if appliedAt, ok := applied[migration.ID]; ok {
+			statuses[i].Applied, statuses[i].AppliedAt = true, appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// validate checks that the migrations have unique IDs and Up functions.
+func (m *Migrator) validate() error {
+	seen := map[string]bool{}
+	for i, migration := range m.migrations {
+		switch {
+		case migration.ID == "":
+			return fmt.Errorf("migration %d has no ID", i)
+		case seen[migration.ID]:
+			return fmt.Errorf("duplicate migration ID %q", migration.ID)
+		case migration.Up == nil:
+			return fmt.Errorf("migration %s has no Up function", migration.ID)
+		}
+		seen[migration.ID] = true
+	}
+	return nil
+}
+
+// index returns the position of the migration identified by id, or
+// fallback when id is empty.
+func (m *Migrator) index(id string, fallback int) (int, error) {
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+	if id == "" {
+		return fallback, nil
+	}
+	for i, migration := range m.migrations {
+		if migration.ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownMigration, id)
+}
+
+// applied returns when each applied migration was applied, by ID.
+func (m *Migrator) applied(ctx context.Context) (map[string]time.Time, error) {
+	collection, err := m.orm.Collection(m.opts.Collection)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[string]time.Time, len(records))
+	for _, r := range records {
+		applied[r.ID] = r.AppliedAt
+	}
+	return applied, nil
+}
+
+// run applies migration, or rolls it back, and updates its record.
+func (m *Migrator) run(ctx context.Context, migration *Migration, up bool) error {
+	fn := migration.Up
+	if !up {
+		if migration.Down == nil {
+			return fmt.Errorf("%w: %s", ErrIrreversible, migration.ID)
+		}
+		fn = migration.Down
+	}
+
+	apply := func(tx *mongorm.MongoORM) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		records, err := tx.Collection(m.opts.Collection)
+		if err != nil {
+			return err
+		}
+		if up {
+			_, err := records.InsertOne(tx.Context(), record{ID: migration.ID, AppliedAt: time.Now().UTC()})
+			return err
+		}
+		_, err = records.DeleteOne(tx.Context(), bson.M{"_id": migration.ID})
+		return err
+	}
+
+	tx := m.orm.WithContext(ctx)
+	var err error
+	if m.opts.UseTransaction {
+		err = tx.Transaction(apply)
+	} else {
+		err = apply(tx)
+	}
+	if err != nil {
+		return fmt.Errorf("migration %s: %w", migration.ID, err)
+	}
+	return nil
+}
+
+// locked runs fn holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	locks, err := m.orm.Collection(m.opts.Collection + "_lock")
+	if err != nil {
+		return err
+	}
+	owner := primitive.NewObjectID().Hex()
+	now := time.Now()
+
+	// The upsert inserts the lock document when there is none, and fails
+	// with a duplicate key error when it exists and is held.
+	filter := bson.M{"_id": "lock", "$or": bson.A{
+		bson.M{"owner": nil},
+		bson.M{"expires_at": bson.M{"$lt": now}},
+	}}
+	update := bson.M{"$set": bson.M{"owner": owner, "expires_at": now.Add(m.opts.LockTTL)}}
+	_, err = locks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// The lock is released even when ctx was canceled meanwhile.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		locks.UpdateOne(ctx, bson.M{"_id": "lock", "owner": owner}, bson.M{"$set": bson.M{"owner": nil}})
+	}()
+	return fn()
+}
@@ -0,0 +1,213 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/migrate"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// journal records the migrations run, as "+id" when applied and "-id"
+// when rolled back.
+type journal []string
+
+func (j *journal) migration(id string) *migrate.Migration {
+	return &migrate.Migration{
+		ID: id,
+		Up: func(tx *mongorm.MongoORM) error {
+			*j = append(*j, "+"+id)
+			return nil
+		},
+		Down: func(tx *mongorm.MongoORM) error {
+			*j = append(*j, "-"+id)
+			return nil
+		},
+	}
+}
+
+func applied(t *testing.T, m *migrate.Migrator) []string {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, s := range statuses {
+		if s.Applied {
+			if s.AppliedAt.IsZero() {
+				t.Fatalf("migration %s applied without a time", s.ID)
+			}
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	orm := mongormtest.New()
+	var j journal
+	m := migrate.New(orm, nil, []*migrate.Migration{j.migration("1"), j.migration("2"), j.migration("3")})
+
+	if err := m.UpTo(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, m); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Fatalf("applied = %v, want 1 and 2", got)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, m); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Fatalf("applied after Down = %v, want 1 and 2", got)
+	}
+	if err := m.DownTo(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DownTo(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, m); len(got) != 0 {
+		t.Fatalf("applied after DownTo = %v, want none", got)
+	}
+
+	want := journal{"+1", "+2", "+3", "-3", "-2", "-1"}
+	if !reflect.DeepEqual(j, want) {
+		t.Fatalf("journal = %v, want %v", j, want)
+	}
+}
+
+func TestCollectionOption(t *testing.T) {
+	ctx := context.Background()
+	orm := mongormtest.New()
+	var j journal
+	m := migrate.New(orm, &migrate.Options{Collection: "schema_versions"}, []*migrate.Migration{j.migration("1")})
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := orm.Collection("schema_versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := versions.CountDocuments(ctx, bson.M{"_id": "1"}); err != nil || n != 1 {
+		t.Fatalf("records = %d (%v), want 1", n, err)
+	}
+}
+
+func TestFailedMigrationStopsRun(t *testing.T) {
+	ctx := context.Background()
+	orm := mongormtest.New()
+	var j journal
+	failure := errors.New("boom")
+	failing := &migrate.Migration{ID: "2", Up: func(tx *mongorm.MongoORM) error { return failure }}
+	m := migrate.New(orm, nil, []*migrate.Migration{j.migration("1"), failing, j.migration("3")})
+
+	if err := m.Up(ctx); !errors.Is(err, failure) {
+		t.Fatalf("error = %v, want that of the migration", err)
+	}
+	if got := applied(t, m); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("applied = %v, want 1 only", got)
+	}
+	if !reflect.DeepEqual(j, journal{"+1"}) {
+		t.Fatalf("journal = %v, want the migrations after the failure skipped", j)
+	}
+
+	// The lock was released despite the failure.
+	failing.Up = func(tx *mongorm.MongoORM) error { return nil }
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(ctx); !errors.Is(err, migrate.ErrIrreversible) {
+		t.Fatalf("Down without Down function error = %v, want ErrIrreversible", err)
+	}
+}
+
+func TestInvalidMigrations(t *testing.T) {
+	ctx := context.Background()
+	orm := mongormtest.New()
+	var j journal
+	up := func(tx *mongorm.MongoORM) error { return nil }
+	tests := []struct {
+		name       string
+		migrations []*migrate.Migration
+	}{
+		{"no ID", []*migrate.Migration{{Up: up}}},
+		{"duplicate ID", []*migrate.Migration{j.migration("1"), j.migration("1")}},
+		{"no Up", []*migrate.Migration{{ID: "1"}}},
+	}
+	for _, tt := range tests {
+		m := migrate.New(orm, nil, tt.migrations)
+		if err := m.Up(ctx); err == nil {
+			t.Errorf("%s: Up succeeded", tt.name)
+		}
+		if err := m.Down(ctx); err == nil {
+			t.Errorf("%s: Down succeeded", tt.name)
+		}
+		if _, err := m.Status(ctx); err == nil {
+			t.Errorf("%s: Status succeeded", tt.name)
+		}
+	}
+
+	m := migrate.New(orm, nil, []*migrate.Migration{j.migration("1")})
+	if err := m.UpTo(ctx, "2"); !errors.Is(err, migrate.ErrUnknownMigration) {
+		t.Fatalf("UpTo error = %v, want ErrUnknownMigration", err)
+	}
+	if err := m.DownTo(ctx, "2"); !errors.Is(err, migrate.ErrUnknownMigration) {
+		t.Fatalf("DownTo error = %v, want ErrUnknownMigration", err)
+	}
+	if len(j) != 0 {
+		t.Fatalf("journal = %v, want nothing run", j)
+	}
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	orm := mongormtest.New()
+	locks, err := orm.Collection("migrations_lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	held := bson.M{"_id": "lock", "owner": "other", "expires_at": time.Now().Add(time.Minute)}
+	if _, err := locks.InsertOne(ctx, held); err != nil {
+		t.Fatal(err)
+	}
+
+	var j journal
+	m := migrate.New(orm, nil, []*migrate.Migration{j.migration("1")})
+	if err := m.Up(ctx); !errors.Is(err, migrate.ErrLocked) {
+		t.Fatalf("error = %v, want ErrLocked", err)
+	}
+	if len(j) != 0 {
+		t.Fatalf("journal = %v, want nothing run", j)
+	}
+
+	// A lock whose holder died is taken over once expired.
+	expired := bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Minute)}}
+	if _, err := locks.UpdateOne(ctx, bson.M{"_id": "lock"}, expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(j, journal{"+1"}) {
+		t.Fatalf("journal = %v, want 1 applied", j)
+	}
+}
@@ -2,8 +2,6 @@ package mongorm
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"reflect"
 	"strings"
 	"time"
@@ -11,118 +9,118 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type OrmModel struct {
-	ID          *primitive.ObjectID `gorm:"primaryKey;autoIncrement" json:"id,omitempty" bson:"_id,omitempty"`
-	DateCreated *time.Time          `gorm:"index;not null;default:current_timestamp" json:"date_created,omitempty" bson:"date_created,omitempty"`
-	DateUpdated *time.Time          `gorm:"index;not null;default:current_timestamp" json:"date_updated,omitempty" bson:"date_updated,omitempty"`
-	DateDeleted *time.Time          `gorm:"index" json:"date_deleted,omitempty" bson:"date_deleted,omitempty"`
+	ID          *primitive.ObjectID `mongorm:"primaryKey" json:"id,omitempty" bson:"_id,omitempty"`
+	DateCreated *time.Time          `mongorm:"autoCreateTime" json:"date_created,omitempty" bson:"date_created,omitempty"`
+	DateUpdated *time.Time          `mongorm:"autoUpdateTime" json:"date_updated,omitempty" bson:"date_updated,omitempty"`
+	DateDeleted *time.Time          `json:"date_deleted,omitempty" bson:"date_deleted,omitempty"`
 }
 
-func (d *OrmModel) BeforeCreate() {
-	now := time.Now()
-	d.DateCreated = &now
-	d.DateUpdated = &now
-}
+// BeforeCreate does nothing.
+//
+// Deprecated: DateCreated and DateUpdated are stamped by the engine, which
+// calls no hook to do so. BeforeCreate is kept for the hooks of models
+// embedding OrmModel that call it, and can be removed from them.
+func (d *OrmModel) BeforeCreate() {}
 
-func (d *OrmModel) BeforeSave() {
-	now := time.Now()
-	d.DateUpdated = &now
-}
+// BeforeSave does nothing.
+//
+// Deprecated: DateUpdated is stamped by the engine, as for BeforeCreate.
+func (d *OrmModel) BeforeSave() {}
 
 func (d *OrmModel) BeforeDelete() {
 	now := time.Now()
 	d.DateDeleted = &now
 }
 
-type MongoORM struct {
-	client             *mongo.Client
-	database           string
-	filter             interface{}
-	Error              error
-	RowsAffected       uint
-	UpdateResult       *mongo.UpdateResult
-	PreloadCollections []string
-	session            mongo.Session
-	inSession          bool
-	collection         *mongo.Collection
-	ctx                context.Context
-	fields             bson.M
-}
-
-func (orm *MongoORM) Begin() *MongoORM {
-	if orm.client == nil {
-		// Handle error: client not initialized
-		return orm
-	}
-
-	var err error
-	orm.session, err = orm.client.StartSession()
-	if err != nil {
-		// Handle error
-		return orm
-	}
-	orm.inSession = true
-	orm.session.StartTransaction()
-	return orm
+// OrmModelOf is OrmModel with an ID of type ID, such as string or UUID,
+// for models not identified by ObjectIDs:
+//
+//	type Session struct {
+//		mongorm.OrmModelOf[mongorm.UUID] `bson:",inline"`
+//		UserID primitive.ObjectID
+//	}
+type OrmModelOf[ID any] struct {
+	ID          ID         `mongorm:"primaryKey" json:"id,omitempty" bson:"_id,omitempty"`
+	DateCreated *time.Time `mongorm:"autoCreateTime" json:"date_created,omitempty" bson:"date_created,omitempty"`
+	DateUpdated *time.Time `mongorm:"autoUpdateTime" json:"date_updated,omitempty" bson:"date_updated,omitempty"`
+	DateDeleted *time.Time `json:"date_deleted,omitempty" bson:"date_deleted,omitempty"`
 }
 
-// Rollback aborts the current transaction and ends the session.
-func (orm *MongoORM) Rollback() *MongoORM {
-	if orm.inSession && orm.session != nil {
-		if err := orm.session.AbortTransaction(context.Background()); err != nil {
-			orm.Error = err
-		}
-		orm.session.EndSession(context.Background())
-		orm.inSession = false
-	}
-	return orm
-}
+// BeforeCreate does nothing.
+//
+// Deprecated: DateCreated and DateUpdated are stamped by the engine, which
+// calls no hook to do so. BeforeCreate is kept for the hooks of models
+// embedding OrmModelOf that call it, and can be removed from them.
+func (d *OrmModelOf[ID]) BeforeCreate() {}
 
-// Commit commits the current transaction and ends the session.
-func (orm *MongoORM) Commit() *MongoORM {
-	if orm.inSession && orm.session != nil {
-		if err := orm.session.CommitTransaction(context.Background()); err != nil {
-			orm.Error = err
-		}
-		orm.session.EndSession(context.Background())
-		orm.inSession = false
-	}
-	return orm
-}
+// BeforeSave does nothing.
+//
+// Deprecated: DateUpdated is stamped by the engine, as for BeforeCreate.
+func (d *OrmModelOf[ID]) BeforeSave() {}
 
-func NewMongoORM(client *mongo.Client, database string) *MongoORM {
-	return &MongoORM{client: client, database: database}
+func (d *OrmModelOf[ID]) BeforeDelete() {
+	now := time.Now()
+	d.DateDeleted = &now
 }
 
-func (orm *MongoORM) Where(query string, args ...interface{}) *MongoORM {
-
-	if query == "id = ?" && len(args) > 0 {
-		// Convert the first argument to string assuming it's the ID
-		idStr, ok := args[0].(string)
-		if !ok {
-			orm.Error = fmt.Errorf("id argument must be a string")
-			return orm
-		}
-
-		// Convert string ID to primitive.ObjectID
-		id, err := primitive.ObjectIDFromHex(idStr)
-		if err != nil {
-			orm.Error = err
-			return orm
-		}
+type MongoORM struct {
+	client          *mongo.Client
+	database        string
+	Error           error
+	RowsAffected    uint
+	UpdateResult    *mongo.UpdateResult
+	BulkWriteResult *mongo.BulkWriteResult
+	Statement       *Statement
+	session         mongo.Session
+	inSession       bool
+	ctx             context.Context
+	config          *Config
+	callbacks       *Callbacks
+	schemas         *schemaCache
+
+	// clone is set on instances that chain methods must not modify, such as
+	// the one returned by NewMongoORM; they work on a copy instead.
+	clone bool
+
+	// Settings applied by Session.
+	sessionLogger   Logger
+	dryRun          bool
+	skipHooks       bool
+	createBatchSize int
+	changes         *changeTracker
+}
 
-		orm.filter = bson.M{"_id": id}
-	} else {
-		// For other queries, implement as needed
+// NewMongoORM returns a MongoORM using database on client. An optional Config
+// customizes its behaviour. The instance is safe for concurrent use: every
+// chain started from it works on its own statement.
+func NewMongoORM(client *mongo.Client, database string, config ...*Config) *MongoORM {
+	orm := &MongoORM{client: client, database: database, config: &Config{}, callbacks: newCallbacks(), schemas: newSchemaCache(), Statement: &Statement{}, clone: true}
+	if len(config) > 0 && config[0] != nil {
+		orm.config = config[0]
 	}
-
 	return orm
 }
 
+// determineCollectionName returns the collection documents like doc are
+// stored in: the one given to Table, or else that of their model.
 func (orm *MongoORM) determineCollectionName(doc interface{}) string {
+	if orm.Statement != nil && orm.Statement.Table != "" {
+		return orm.Statement.Table
+	}
+	return orm.collectionName(modelType(doc))
+}
+
+// modelType returns the struct type behind doc, unwrapping pointers and
+// slices so that *User, []User and *[]*User all yield User.
+func modelType(doc interface{}) reflect.Type {
 	t := reflect.TypeOf(doc)
+	if t == nil {
+		return nil
+	}
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
@@ -134,62 +132,188 @@ func (orm *MongoORM) determineCollectionName(doc interface{}) string {
 			t = t.Elem()
 		}
 	}
+	return t
+}
 
-	return fmt.Sprintf("%ss", strings.ToLower(t.Name()))
+// readSource returns the collection documents are read from into doc, and
+// the type of the model they belong to: those of the model given to Model,
+// so that doc may be a map or a struct holding a subset of its fields, or
+// else those of doc itself.
+func (orm *MongoORM) readSource(doc interface{}) (*mongo.Collection, reflect.Type, error) {
+	if orm.Statement.Model != nil && orm.Statement.Collection != nil {
+		return orm.Statement.Collection, modelType(orm.Statement.Model), nil
+	}
+	t := modelType(doc)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, nil, ErrMissingModel
+	}
+	return orm.collection(orm.determineCollectionName(doc)), t, nil
 }
 
+// First loads into doc the first document matching the chained conditions,
+// in the order given with Order, or the document with the ID id when given.
+// It fails with ErrRecordNotFound when none matches.
 func (orm *MongoORM) First(doc interface{}, id ...string) *MongoORM {
+	return orm.execute(opQuery, doc, func(tx *MongoORM) {
+		tx.first(doc, id...)
+	})
+}
+
+// first is the built-in step of First.
+func (orm *MongoORM) first(doc interface{}, id ...string) *MongoORM {
 
 	if len(id) > 0 && id[0] != "" {
-		objectId, err := primitive.ObjectIDFromHex(id[0])
+		objectId, err := parseID(modelType(doc), id[0])
 		if err != nil {
 			orm.Error = err
 			return orm
 		}
-		orm.filter = bson.M{"_id": objectId}
+		orm.addCondition(bson.M{"_id": objectId})
 	}
 
-	collectionName := orm.determineCollectionName(doc)
-
-	collection := orm.client.Database(orm.database).Collection(collectionName)
+	collection, t, err := orm.readSource(doc)
+	if err != nil {
+		orm.Error = err
+		return orm
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := orm.operationContext()
 	defer cancel()
 
-	err := collection.FindOne(ctx, orm.filter).Decode(doc)
-	orm.filter = nil
-	orm.Error = err
+	if len(orm.Statement.Joins) > 0 {
+		orm.Error = translateError(orm.firstJoined(ctx, collection, t, doc))
+		if orm.Statement.DryRun {
+			return orm
+		}
+	} else {
+		filter := orm.queryFilter(t)
+		orm.Statement.record(collection, "findOne", filter)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		err := collection.FindOne(ctx, filter, orm.findOneOptions(t)).Decode(doc)
+		orm.Error = translateError(err)
+	}
+	if orm.Error == nil {
+		orm.RowsAffected = 1
+	}
 	orm.processPreloads(doc)
+	if orm.Error == nil {
+		if modelType(doc) == t {
+			orm.snapshot(doc)
+		}
+		orm.Error = orm.callHook(doc, hookAfterFind)
+	}
 	return orm
 }
 
-func (orm *MongoORM) Find(docs interface{}, filters ...interface{}) *MongoORM {
+// Last loads into doc the last document matching the chained conditions
+// in the order given with Order, or else the one with the greatest _id,
+// which for ObjectIDs is the one inserted last:
+//
+//	orm.Where("status = ?", "paid").Last(&order)
+//	orm.Order("date_created").Last(&order)
+//
+// It takes an ID and fails with ErrRecordNotFound as First does.
+func (orm *MongoORM) Last(doc interface{}, id ...string) *MongoORM {
+	return orm.execute(opQuery, doc, func(tx *MongoORM) {
+		tx.Statement.Sort = reverseSort(tx.Statement.Sort)
+		tx.first(doc, id...)
+	})
+}
 
-	if len(filters) > 0 {
-		orm.filter, _ = filters[0].(bson.M)
-	} else {
-		if orm.filter != nil {
-			orm.filter = orm.filter.(bson.M)
+// Take loads into doc a document matching the chained conditions, with no
+// guarantee as to which one unless Order was given. It takes an ID and
+// fails with ErrRecordNotFound as First does.
+func (orm *MongoORM) Take(doc interface{}, id ...string) *MongoORM {
+	return orm.execute(opQuery, doc, func(tx *MongoORM) {
+		tx.first(doc, id...)
+	})
+}
+
+// reverseSort returns the sort specification listing documents in the
+// reverse order of sort, or by descending _id when sort is empty. Keys
+// sorted by metadata, such as a text score, keep their order.
+func reverseSort(sort bson.D) bson.D {
+	if len(sort) == 0 {
+		return bson.D{{Key: "_id", Value: -1}}
+	}
+	reversed := make(bson.D, len(sort))
+	for i, e := range sort {
+		switch v := e.Value.(type) {
+		case int:
+			e.Value = -v
+		case int32:
+			e.Value = -v
+		case int64:
+			e.Value = -v
+		case float64:
+			e.Value = -v
 		}
+		reversed[i] = e
 	}
+	return reversed
+}
 
-	collectionName := orm.determineCollectionName(docs)
-
-	collection := orm.client.Database(orm.database).Collection(collectionName)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Find retrieves every document matching the chained conditions into docs,
+// which must be a pointer to a slice. Additional bson.M filters may be passed
+// and are ANDed with the chain:
+//
+//	orm.Where("age > ?", 30).Order("name").Limit(20).Find(&users, bson.M{"status": "active"})
+//
+// The collection is that of the element type of docs, or that of the model
+// given to Model, which lets docs hold maps or structs with only some of
+// the model's fields, as First does for a single document:
+//
+//	var names []struct{ Name string }
+//	orm.Model(&User{}).Select("Name").Find(&names)
+func (orm *MongoORM) Find(docs interface{}, filters ...interface{}) *MongoORM {
+	return orm.execute(opQuery, docs, func(tx *MongoORM) {
+		tx.find(docs, filters...)
+	})
+}
 
-	cursor, err := collection.Find(ctx, bson.M{})
+// find is the built-in step of Find.
+func (orm *MongoORM) find(docs interface{}, filters ...interface{}) *MongoORM {
+	if err := orm.addFilters(filters); err != nil {
+		orm.Error = err
+		return orm
+	}
 
+	collection, t, err := orm.readSource(docs)
 	if err != nil {
-
 		orm.Error = err
 		return orm
 	}
 
-	if err := cursor.All(ctx, docs); err != nil {
-		orm.Error = err
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	if len(orm.Statement.Groups) > 0 {
+		if err = orm.findGrouped(ctx, docs); err == nil && orm.Statement.DryRun {
+			return orm
+		}
+	} else if len(orm.Statement.Joins) > 0 {
+		var cursor *mongo.Cursor
+		if cursor, err = orm.findJoined(ctx, collection, t, orm.Statement.Limit); err == nil {
+			if orm.Statement.DryRun {
+				return orm
+			}
+			err = orm.decodeAllJoined(ctx, cursor, docs)
+		}
+	} else {
+		filter := orm.queryFilter(t)
+		orm.Statement.record(collection, "find", filter)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		var cursor *mongo.Cursor
+		if cursor, err = collection.Find(ctx, filter, orm.findOptions(t)); err == nil {
+			err = cursor.All(ctx, docs)
+		}
+	}
+	if err != nil {
+		orm.Error = translateError(err)
 		return orm
 	}
 	resultVal := reflect.ValueOf(docs)
@@ -199,292 +323,545 @@ func (orm *MongoORM) Find(docs interface{}, filters ...interface{}) *MongoORM {
 		resultVal.Elem().Set(newSlice)
 	}
 
-	orm.filter = nil
 	orm.Error = err
 
 	docsValue := reflect.ValueOf(docs).Elem()
+	orm.RowsAffected = uint(docsValue.Len())
 
 	if docsValue.Kind() == reflect.Slice {
-		for i := 0; i < docsValue.Len(); i++ {
-			doc := docsValue.Index(i)
-			docPtr := doc.Addr().Interface()
-			orm.processPreloads(docPtr)
+		orm.processPreloads(docs)
+		if orm.Error == nil {
+			if modelType(docs) == t {
+				orm.snapshotEach(docsValue)
+			}
+			orm.Error = orm.callHookEach(docsValue, hookAfterFind)
 		}
 	}
 
 	return orm
 }
 
+// Create inserts doc. A pointer to a struct is inserted with InsertOne and
+// reloaded from the database; a slice, or pointer to one, is inserted with
+// InsertMany and the generated IDs are written back into its elements.
+//
+// Documents held by the association fields of doc, declared as described
+// for Preload, are saved along with it: those without an ID are created,
+// and the references between them and doc are stored, so that
+//
+//	orm.Create(&User{Name: "jinzhu", Orders: []Order{{Total: 10}}})
+//
+// creates the order with its foreign key set to the new user's ID.
+// Associations given to Omit are left alone:
+//
+//	orm.Omit("Orders").Create(&user)
 func (orm *MongoORM) Create(doc interface{}) *MongoORM {
+	return orm.execute(opCreate, doc, func(tx *MongoORM) {
+		tx.create(tx.Statement.Dest)
+	})
+}
+
+// create is the built-in step of Create.
+func (orm *MongoORM) create(doc interface{}) *MongoORM {
+	if sliceValue, ok := sliceOf(doc); ok {
+		batchSize := sliceValue.Len()
+		if orm.createBatchSize > 0 {
+			batchSize = orm.createBatchSize
+		}
+		return orm.createMany(sliceValue, batchSize)
+	}
+
 	collectionName := orm.determineCollectionName(doc)
-	collection := orm.client.Database(orm.database).Collection(collectionName)
+	collection := orm.collection(collectionName)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := orm.operationContext()
 	defer cancel()
 
-	if beforeCreater, ok := doc.(interface{ BeforeCreate() }); ok {
-		beforeCreater.BeforeCreate()
+	if err := orm.callHook(doc, hookBeforeCreate); err != nil {
+		orm.Error = err
+		return orm
+	}
+	if err := orm.assignID(doc); err != nil {
+		orm.Error = err
+		return orm
+	}
+	orm.stampCreate(doc)
+	if err := orm.validate(doc, false); err != nil {
+		orm.Error = err
+		return orm
+	}
+	if !orm.Statement.DryRun {
+		if err := orm.createReferenced(doc); err != nil {
+			orm.Error = translateError(err)
+			return orm
+		}
 	}
+	orm.setReferenceArrays(doc)
+	orm.initVersion(doc)
 
-	result, err := collection.InsertOne(ctx, doc)
+	insert, err := orm.writeDocument(doc)
 	if err != nil {
 		orm.Error = err
 		return orm
 	}
 
-	// Cast InsertedID to primitive.ObjectID
-	insertedID, ok := result.InsertedID.(primitive.ObjectID)
-
-	if !ok {
-		orm.Error = fmt.Errorf("failed to cast inserted ID to ObjectID")
+	orm.Statement.record(collection, "insertOne", insert)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	result, err := collection.InsertOne(ctx, insert)
+	if err != nil {
+		orm.Error = translateError(err)
 		return orm
 	}
 
-	err = collection.FindOne(ctx, bson.M{"_id": insertedID}).Decode(doc)
-	orm.filter = nil
-	orm.Error = err
+	err = collection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(doc)
+	orm.Statement.Filter = nil
+	if err == nil {
+		err = orm.createReferrers(ctx, doc)
+	}
+	orm.Error = translateError(err)
+	if orm.Error == nil {
+		orm.RowsAffected = 1
+		orm.Error = orm.callHook(doc, hookAfterCreate)
+	}
 	return orm
 }
 
-// Example modification in Save method for ID extraction and error handling
+// Save writes doc over the stored document with its ID, replacing it
+// whole, or setting only the fields given to Select or left out by Omit:
+//
+//	user.Name = "jinzhu"
+//	orm.Save(&user)
+//
+// In a session with TrackChanges, documents loaded by First or Find, or
+// saved before, only have the top-level fields that changed since $set,
+// and those that were removed $unset; Save writes nothing when none did:
+//
+//	db := orm.Session(&mongorm.Session{TrackChanges: true})
+//	db.First(&user, id)
+//	user.Name = "jinzhu"
+//	db.Save(&user) // updateOne({_id: id}, {$set: {name: "jinzhu", date_updated: ...}})
 func (orm *MongoORM) Save(doc interface{}) *MongoORM {
+	return orm.execute(opUpdate, doc, func(tx *MongoORM) {
+		tx.save(doc)
+	})
+}
+
+// save is the built-in step of Save.
+func (orm *MongoORM) save(doc interface{}) *MongoORM {
 	if orm.Error != nil {
 		return orm // Halt if there was a previous error
 	}
 
 	collectionName := orm.determineCollectionName(doc)
-	orm.collection = orm.client.Database(orm.database).Collection(collectionName)
+	orm.Statement.Collection = orm.collection(collectionName)
 
-	docVal := reflect.ValueOf(doc)
-	if docVal.Kind() == reflect.Ptr {
-		docVal = docVal.Elem()
+	oid, err := recordID(doc)
+	if err != nil {
+		orm.Error = err
+		return orm
 	}
 
-	idField := docVal.FieldByName("ID")
-	if !idField.IsValid() || idField.Elem().Interface().(primitive.ObjectID).IsZero() {
-		orm.Error = errors.New("document must have a valid ID field of type primitive.ObjectID")
+	if err := orm.callHook(doc, hookBeforeSave); err != nil {
+		orm.Error = err
 		return orm
 	}
-
-	oid := idField.Elem().Interface().(primitive.ObjectID) // Correct ID extraction
-
-	if beforeSave, ok := doc.(interface{ BeforeSave() }); ok {
-		beforeSave.BeforeSave()
+	orm.setReferenceArrays(doc)
+
+	// A document whose changes are tracked only has the fields changed
+	// since it was loaded written, and nothing at all when none did.
+	var snapshot bson.Raw
+	tracked := false
+	if !orm.Statement.Upsert && !orm.filtersFields() {
+		snapshot, tracked = orm.snapshotOf(doc)
+	}
+	if tracked {
+		changes, err := changedFields(doc, snapshot)
+		if err != nil {
+			orm.Error = err
+			return orm
+		}
+		if len(changes) == 0 {
+			return orm.saveUnchanged(doc)
+		}
 	}
 
-	_, err := orm.collection.ReplaceOne(orm.ctx, bson.M{"_id": oid}, doc)
-	if err != nil {
+	orm.stampSave(doc)
+	if err := orm.validate(doc, false); err != nil {
 		orm.Error = err
 		return orm
 	}
-	return orm
-}
 
-func (orm *MongoORM) Delete(doc interface{}, id ...string) *MongoORM {
+	opts := options.Replace()
+	if orm.Statement.Upsert {
+		opts.SetUpsert(true)
+	}
 
-	if len(id) > 0 && id[0] != "" {
-		objectId, err := primitive.ObjectIDFromHex(id[0])
-		if err != nil {
+	filter := mergeConditions(bson.M{"_id": oid}, orm.statementScope(modelType(doc)))
+	version, versionKey, versioned := orm.lockVersion(doc)
+	var current int64
+	written := false
+	if versioned {
+		// The document is written with the next version, which it keeps
+		// once the write went through.
+		current = version.Int()
+		filter = mergeConditions(filter, versionCondition(versionKey, current))
+		version.SetInt(current + 1)
+		defer func() {
+			if !written {
+				version.SetInt(current)
+			}
+		}()
+	}
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	var result *mongo.UpdateResult
+	if tracked {
+		var update bson.M
+		if update, err = changedFields(doc, snapshot); err != nil {
 			orm.Error = err
 			return orm
 		}
-		orm.filter = bson.M{"_id": objectId}
-	} else if orm.filter == nil {
-		idField := reflect.ValueOf(doc).Elem().FieldByName("ID")
-		if !idField.IsValid() || idField.Type() != reflect.TypeOf(primitive.ObjectID{}) {
-			orm.Error = errors.New("document must have an ID field of type primitive.ObjectID for deletion")
+		orm.Statement.record(orm.Statement.Collection, "updateOne", filter, update)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		result, err = orm.Statement.Collection.UpdateOne(ctx, filter, update)
+	} else if orm.filtersFields() {
+		// Replacing the document would drop the fields left out, so only
+		// the remaining ones are set.
+		var set interface{}
+		if set, err = orm.writeDocument(doc); err != nil {
+			orm.Error = err
 			return orm
 		}
-		oid := idField.Interface().(primitive.ObjectID)
-		orm.filter = bson.M{"_id": oid}
+		delete(set.(bson.M), "_id")
+		if versioned {
+			set.(bson.M)[versionKey] = current + 1
+		}
+		update := bson.M{"$set": set}
+		orm.Statement.record(orm.Statement.Collection, "updateOne", filter, update)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		result, err = orm.Statement.Collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(orm.Statement.Upsert))
+	} else {
+		orm.Statement.record(orm.Statement.Collection, "replaceOne", filter, doc)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		result, err = orm.Statement.Collection.ReplaceOne(ctx, filter, doc, opts)
 	}
-
-	collectionName := orm.determineCollectionName(doc)
-	collection := orm.client.Database(orm.database).Collection(collectionName)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if beforeDelete, ok := doc.(interface{ BeforeDelete() }); ok {
-		beforeDelete.BeforeDelete()
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
 	}
-
-	result, err := collection.DeleteOne(ctx, orm.filter)
-
-	orm.RowsAffected = uint(result.DeletedCount)
-	orm.Error = err
+	orm.UpdateResult = result
+	if versioned && result.MatchedCount == 0 && result.UpsertedCount == 0 {
+		orm.Error = ErrStaleObject
+		return orm
+	}
+	written = true
+	orm.RowsAffected = uint(result.ModifiedCount + result.UpsertedCount)
+	if orm.filtersFields() {
+		orm.forget(doc)
+	} else {
+		orm.snapshot(doc)
+	}
+	if err := orm.saveJoinDocuments(ctx, doc); err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.Error = orm.callHook(doc, hookAfterSave)
 	return orm
 }
 
-func (orm *MongoORM) Preload(name string) *MongoORM {
-	if orm.PreloadCollections == nil {
-		orm.PreloadCollections = make([]string, 0)
+// saveUnchanged completes the Save of doc, a tracked document with no
+// changes to write: its join documents are still saved.
+func (orm *MongoORM) saveUnchanged(doc interface{}) *MongoORM {
+	if orm.Statement.DryRun {
+		return orm
 	}
-	orm.PreloadCollections = append(orm.PreloadCollections, name)
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+	if err := orm.saveJoinDocuments(ctx, doc); err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.Error = orm.callHook(doc, hookAfterSave)
 	return orm
 }
 
-func (orm *MongoORM) processPreloads(doc interface{}) {
-	if len(orm.PreloadCollections) == 0 || orm.Error != nil {
-		return
+// Delete removes the document identified by id or by doc's own ID or, when
+// conditions were chained and doc has no ID, every document matching them:
+//
+//	orm.Delete(&user)
+//	orm.Where("status = ?", "expired").Delete(&Job{})
+//
+// Conditions chained before deleting a document with an ID restrict it
+// further: the document is only deleted when it matches them.
+//
+// Models with a DateDeleted field, such as those embedding OrmModel, are
+// soft deleted by setting date_deleted; use Unscoped to remove them
+// permanently. RowsAffected reports the number of documents deleted.
+func (orm *MongoORM) Delete(doc interface{}, id ...string) *MongoORM {
+	// The document selected by id or by doc's ID is set in
+	// Statement.Filter before the callbacks run, so that they see which one
+	// is deleted.
+	tx := orm.getInstance()
+	one := len(id) > 0 && id[0] != ""
+	if one {
+		objectId, err := parseID(modelType(doc), id[0])
+		if err != nil {
+			tx.AddError(err)
+		} else {
+			tx.Statement.Filter = bson.M{"_id": objectId}
+		}
+	} else if oid, err := recordID(doc); err == nil {
+		one = true
+		tx.Statement.Filter = mergeConditions(tx.Statement.Filter, bson.M{"_id": oid})
 	}
+	return tx.execute(opDelete, doc, func(tx *MongoORM) {
+		tx.delete(doc, one)
+	})
+}
 
-	docValPtr := reflect.ValueOf(doc)
-	docType := reflect.TypeOf(doc)
-
-	if docValPtr.Kind() != reflect.Ptr || docValPtr.Elem().Kind() != reflect.Struct {
-		orm.Error = errors.New("document must be a pointer to a struct")
-		return
+// delete deletes the document selected by Statement.Filter when one is
+// set, and otherwise every document matching Statement.Filter.
+func (orm *MongoORM) delete(doc interface{}, one bool) *MongoORM {
+	many := !one
+	if orm.Statement.Filter == nil {
+		orm.Error = ErrMissingID
+		return orm
 	}
 
-	for _, preload := range orm.PreloadCollections {
-		field, found := docType.Elem().FieldByName(preload)
-		if !found {
-			continue
-		}
-
-		collectionName := fmt.Sprintf("%ss", strings.ToLower(field.Type.Elem().Name()))
-
-		ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Second)
-		defer cancel()
-
-		collection := orm.client.Database(orm.database).Collection(collectionName)
-
-		if field.Type.Kind() == reflect.Slice {
-
-			// Create a slice of the element type that the field holds.
-			sliceType := reflect.SliceOf(field.Type.Elem())
-			sliceValue := reflect.MakeSlice(sliceType, 0, 0)
-
-			// newDoc should be a pointer to this newly created slice.
-			newDoc := reflect.New(sliceType)
-			newDoc.Elem().Set(sliceValue)
-
-			docVal := docValPtr.Elem()
-			fieldId := docVal.FieldByName("ID")
-			oid := fieldId.Elem().Interface().(primitive.ObjectID)
-
-			docFieldName := docType.Elem().Name()
-			refField, found := field.Type.Elem().FieldByName(docFieldName)
-			if !found {
-				return
-			}
+	collectionName := orm.determineCollectionName(doc)
+	collection := orm.collection(collectionName)
 
-			refFieldName, found := getForeignKeyFromTag(refField.Tag)
+	ctx, cancel := orm.operationContext()
+	defer cancel()
 
-			if !found {
-				return
-			}
+	if err := orm.callHook(doc, hookBeforeDelete); err != nil {
+		orm.Error = err
+		return orm
+	}
 
-			foreignRef, found := field.Type.Elem().FieldByName(refFieldName)
+	if name, ok := orm.softDeleteField(modelType(doc)); ok && !orm.Statement.Unscoped {
+		filter := orm.queryFilter(modelType(doc))
+		update := bson.M{"$set": bson.M{name: deletedAt(doc)}}
 
-			if !found {
-				return
+		var result *mongo.UpdateResult
+		var err error
+		if many {
+			orm.Statement.record(collection, "updateMany", filter, update)
+			if orm.Statement.DryRun {
+				return orm
 			}
-
-			foreignRefName := strings.Split(foreignRef.Tag.Get("bson"), ",")[0]
-			filter := bson.M{foreignRefName: oid}
-			fmt.Println(foreignRefName)
-			cursor, err := collection.Find(ctx, filter)
-			if err != nil {
-				orm.Error = err
-				return
+			result, err = collection.UpdateMany(ctx, filter, update, orm.updateOptions())
+		} else {
+			orm.Statement.record(collection, "updateOne", filter, update)
+			if orm.Statement.DryRun {
+				return orm
 			}
-
-			if err := cursor.All(ctx, newDoc.Interface()); err != nil {
-				orm.Error = err
-				return
-			}
-
-			// docVal.FieldByName(preload).Set(newDoc)
-			docVal.FieldByName(preload).Set(newDoc.Elem())
-
+			result, err = collection.UpdateOne(ctx, filter, update, orm.updateOptions())
+		}
+		if err != nil {
+			orm.Error = translateError(err)
+			return orm
 		}
 
-		if field.Type.Kind() == reflect.Ptr {
-
-			fieldIdName, found := getForeignKeyFromTag(field.Tag)
-
-			if !found {
-				return
-			}
-
-			newDoc := reflect.New(field.Type.Elem())
+		orm.RowsAffected = uint(result.ModifiedCount)
+		orm.Error = orm.callHook(doc, hookAfterDelete)
+		return orm
+	}
 
-			docVal := docValPtr.Elem()
-			fieldId := docVal.FieldByName(fieldIdName)
-			oid := fieldId.Interface().(primitive.ObjectID)
-			if err := collection.FindOne(ctx, bson.M{"_id": oid}).Decode(newDoc.Interface()); err != nil {
-				orm.Error = err
-				return
-			}
-			docVal.FieldByName(preload).Set(newDoc)
+	filter := mergeConditions(orm.Statement.Filter, orm.statementScope(modelType(doc)))
+	var result *mongo.DeleteResult
+	var err error
+	if many {
+		orm.Statement.record(collection, "deleteMany", filter)
+		if orm.Statement.DryRun {
+			return orm
 		}
-
+		result, err = collection.DeleteMany(ctx, filter, orm.deleteOptions())
+	} else {
+		orm.Statement.record(collection, "deleteOne", filter)
+		if orm.Statement.DryRun {
+			return orm
+		}
+		result, err = collection.DeleteOne(ctx, filter, orm.deleteOptions())
+	}
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
 	}
 
-	orm.PreloadCollections = nil
+	orm.RowsAffected = uint(result.DeletedCount)
+	orm.Error = orm.callHook(doc, hookAfterDelete)
+	return orm
+}
+
+// deleteOptions translates the chained state into options for deletes.
+func (orm *MongoORM) deleteOptions() *options.DeleteOptions {
+	opts := options.Delete()
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	if orm.Statement.Hint != nil {
+		opts.SetHint(orm.Statement.Hint)
+	}
+	return opts
 }
 
 func (orm *MongoORM) Model(doc interface{}) *MongoORM {
-	collectionName := orm.determineCollectionName(doc)
-	orm.collection = orm.client.Database(orm.database).Collection(collectionName)
-	return orm
+	tx := orm.getInstance()
+	collectionName := tx.determineCollectionName(doc)
+	tx.Statement.Collection = tx.collection(collectionName)
+	tx.Statement.Model = doc
+	return tx
 }
 
-// Select specifies the fields to be returned in the query results.
+// Select limits the fields read by First and Find and written by Create,
+// Save and Updates. Fields are given by struct field or document key; a
+// leading "-" excludes a field instead:
+//
+//	orm.Select("Name", "Email").Find(&users)
+//	orm.Select("-password_hash").First(&user)
+//
+// Updates skips struct fields holding zero values unless they are selected.
+// "*" selects every field, so that Updates writes zero values too:
+//
+//	orm.Select("*").Updates(&user)
 func (orm *MongoORM) Select(fields ...string) *MongoORM {
-	if orm.Error != nil {
-		return orm
+	tx := orm.getInstance()
+	if tx.Error != nil {
+		return tx
 	}
 
-	// fields = append(fields)
 	projection := bson.M{}
 	for _, field := range fields {
+		if field == "*" {
+			tx.Statement.AllFields = true
+			continue
+		}
+		if strings.HasPrefix(field, "-") {
+			projection[strings.TrimPrefix(field, "-")] = 0
+			continue
+		}
 		projection[field] = 1
 	}
-	orm.fields = projection
-	return orm
+	tx.Statement.Selects = projection
+	return tx
+}
+
+// Omit excludes fields, given by struct field or document key, from reads
+// by First and Find and from writes by Create, Save and Updates:
+//
+//	orm.Omit("DateCreated").Save(&user)
+func (orm *MongoORM) Omit(fields ...string) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Omits = append(tx.Statement.Omits, fields...)
+	return tx
 }
 
 // Updates performs an update operation on the document(s) matching the criteria.
+// updateData is a struct, whose fields holding zero values are skipped
+// unless given to Select, or a map or bson.M whose values are written as
+// they are, zero values included:
+//
+//	orm.Model(&user).Updates(map[string]interface{}{"active": false})
+//	orm.Model(&User{}).Where("plan = ?", "trial").Updates(bson.M{"plan": "free"})
+//
+// Maps may also hold update operators. Operators added with Set, Inc, Push,
+// AddToSet, Pull and Unset are applied in the same update; updateData may be
+// nil when only those are used. The document is identified by an "_id" key
+// of a map, by the ID of a struct, or by the ID of the model given to Model.
+// Without an ID, every document matching the chained conditions is updated;
+// without either, Updates fails with ErrMissingID.
 func (orm *MongoORM) Updates(updateData interface{}) *MongoORM {
+	return orm.execute(opUpdate, updateData, func(tx *MongoORM) {
+		tx.updates(updateData)
+	})
+}
+
+// updates is the built-in step of Updates.
+func (orm *MongoORM) updates(updateData interface{}) *MongoORM {
 	if orm.Error != nil {
 		return orm
 	}
 
+	updateMap, isMap := updateData.(bson.M)
+	if data, ok := updateData.(map[string]interface{}); ok {
+		updateMap, isMap = bson.M(data), true
+	}
+
+	// Hooks run on, and the document is identified by, a struct passed to
+	// Updates, or else the model given to Model.
+	target := updateData
+	if updateData == nil || isMap {
+		target = orm.Statement.Model
+	}
+	if err := orm.callHook(target, hookBeforeUpdate); err != nil {
+		orm.Error = err
+		return orm
+	}
+	if updateData != nil && !isMap {
+		if err := orm.validate(updateData, !orm.Statement.AllFields); err != nil {
+			orm.Error = err
+			return orm
+		}
+	}
+
 	// Convert updateData to a map for easier processing.
-	// Assumes updateData is a struct; adjust accordingly if it's already a map.
 	updateDataVal := reflect.ValueOf(updateData)
 	if updateDataVal.Kind() == reflect.Ptr {
 		updateDataVal = updateDataVal.Elem()
 	}
 
-	var update primitive.M
+	update := primitive.M{}
+	var id interface{}
 
-	if orm.fields != nil {
+	if isMap {
+		updateDocument := bson.M{}
+		for key, value := range updateMap {
+			if key == "_id" || key == "id" {
+				id = value
+				continue
+			}
+			updateDocument[key] = value
+		}
+		if hasOperator(updateDocument) {
+			update = updateDocument
+		} else if len(updateDocument) > 0 {
+			update = bson.M{
+				"$set": orm.filterDocument(updateDocument, modelType(target)),
+			}
+		}
+	} else if updateData != nil && updateDataVal.Kind() == reflect.Struct && orm.selectsFields() {
 		filteredUpdateData := bson.M{}
 
-		for fieldName, include := range orm.fields {
+		for fieldName, include := range orm.Statement.Selects {
 			if include != 1 {
 				continue // Skip fields not set to be included.
 			}
 
-			fieldVal := updateDataVal.FieldByName(fieldName)
-
-			if fieldVal.IsValid() && fieldVal.Kind() != reflect.Slice {
-				field, _ := reflect.TypeOf(updateData).FieldByName(fieldName)
-				bsonFieldName := strings.Split(field.Tag.Get("bson"), ",")[0]
-				filteredUpdateData[bsonFieldName] = fieldVal.Interface()
+			field, ok := orm.lookupField(updateDataVal.Type(), fieldName)
+			if !ok {
+				continue
+			}
+			if fieldVal, err := updateDataVal.FieldByIndexErr(field.Index); err == nil {
+				filteredUpdateData[orm.fieldName(field)] = fieldVal.Interface()
 			}
 		}
 
 		// Proceed with the update using filteredUpdateData.
 		update = bson.M{
-			"$set": filteredUpdateData,
+			"$set": orm.filterDocument(filteredUpdateData, updateDataVal.Type()),
 		}
-	} else {
-		bsonData, _ := bson.Marshal(updateData)
+	} else if updateData != nil {
+		bsonData, _ := marshalDocument(updateData)
 		var updateDocument bson.M
 		err := bson.Unmarshal(bsonData, &updateDocument)
 
@@ -492,41 +869,157 @@ func (orm *MongoORM) Updates(updateData interface{}) *MongoORM {
 			orm.Error = err
 			return orm
 		}
+		if !orm.Statement.AllFields {
+			updateDocument = orm.nonZeroFields(updateDocument, updateDataVal)
+		}
 		update = bson.M{
-			"$set": updateDocument,
+			"$set": orm.filterDocument(updateDocument, modelType(updateData)),
+		}
+	}
+	update = mergeUpdateOperators(update, orm.Statement.UpdateOperators)
+	if len(update) == 0 {
+		orm.Error = ErrEmptyUpdate
+		return orm
+	}
+	update = orm.stampUpdate(update, modelType(target), target)
+
+	// The document is identified by an _id in a map, by the ID of target,
+	// or by the chained conditions, in which case every matching document
+	// is updated.
+	many := false
+	if id != nil {
+		oid, err := normalizeID(modelType(target), id)
+		if err != nil {
+			orm.Error = err
+			return orm
 		}
+		orm.addCondition(bson.M{"_id": oid})
+	} else if oid, err := recordID(target); err == nil {
+		orm.addCondition(bson.M{"_id": oid})
+	} else if len(orm.Statement.Filter) > 0 || orm.allowGlobalUpdate() {
+		many = true
+	} else {
+		orm.Error = err
+		return orm
+	}
 
+	if orm.Statement.Collection == nil {
+		if target == nil {
+			orm.Error = ErrMissingModel
+			return orm
+		}
+		orm.Statement.Collection = orm.collection(orm.determineCollectionName(target))
 	}
-	idField := updateDataVal.FieldByName("ID")
-	oid := idField.Elem().Interface().(primitive.ObjectID)
-	orm.filter = bson.M{
-		"_id": oid,
+
+	// A document identified by the ID of target is only updated while it
+	// has the version of target.
+	version, versionKey, versioned := orm.lockVersion(target)
+	locked := versioned && id == nil && !many
+	var current int64
+	if locked {
+		current = version.Int()
+		orm.addCondition(versionCondition(versionKey, current))
+		update = setVersion(update, versionKey, current+1)
+	} else if versioned {
+		update = incrementVersion(update, versionKey)
+	}
+
+	opts := orm.updateOptions()
+	if orm.Statement.Upsert {
+		opts.SetUpsert(true)
 	}
 
-	result, err := orm.collection.UpdateOne(orm.ctx, orm.filter, update)
+	filter := orm.queryFilter(modelType(target))
+	method := "updateOne"
+	if many {
+		method = "updateMany"
+	}
+	orm.Statement.record(orm.Statement.Collection, method, filter, update)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	var result *mongo.UpdateResult
+	var err error
+	if many {
+		result, err = orm.Statement.Collection.UpdateMany(ctx, filter, update, opts)
+	} else {
+		result, err = orm.Statement.Collection.UpdateOne(ctx, filter, update, opts)
+	}
 	if err != nil {
-		orm.Error = err
+		orm.Error = translateError(err)
+	} else if locked && result.MatchedCount == 0 && result.UpsertedCount == 0 {
+		orm.UpdateResult = result
+		orm.Error = ErrStaleObject
 	} else {
+		if locked {
+			version.SetInt(current + 1)
+		}
 		orm.UpdateResult = result
+		orm.RowsAffected = uint(result.ModifiedCount + result.UpsertedCount)
+		orm.Error = orm.callHook(target, hookAfterUpdate)
 	}
-	orm.fields = nil
 	return orm
 }
 
-// Add a method to set the context
+// WithContext sets the context used by subsequent operations. Its
+// cancellation and deadline apply to every driver call; without a deadline,
+// operations are bounded by Config.DefaultTimeout.
 func (orm *MongoORM) WithContext(ctx context.Context) *MongoORM {
-	orm.ctx = ctx
-	return orm
+	tx := orm.getInstance()
+	tx.ctx = ctx
+	return tx
+}
+
+// Context returns the context operations run with: the one set with
+// WithContext, which within Transaction carries the transaction's session,
+// or the background context. Driver calls made on Collection with it join
+// the transaction.
+func (orm *MongoORM) Context() context.Context {
+	return orm.context()
+}
+
+// WithTimeout bounds the next operation to d, overriding the configured
+// timeouts. A deadline on the context set with WithContext still applies if
+// it is earlier.
+func (orm *MongoORM) WithTimeout(d time.Duration) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Timeout = d
+	return tx
 }
 
-func getForeignKeyFromTag(tags reflect.StructTag) (string, bool) {
+// documentID returns the ObjectID stored in doc's ID field, which may be a
+// primitive.ObjectID or a pointer to one. Associations, which reference
+// documents by ObjectID, use it; other operations take any ID with
+// recordID.
+func documentID(doc interface{}) (primitive.ObjectID, error) {
+	docVal := reflect.ValueOf(doc)
+	for docVal.Kind() == reflect.Ptr {
+		if docVal.IsNil() {
+			return primitive.NilObjectID, ErrMissingID
+		}
+		docVal = docVal.Elem()
+	}
+	if docVal.Kind() != reflect.Struct {
+		return primitive.NilObjectID, ErrMissingID
+	}
 
-	for _, option := range strings.Split(tags.Get("gorm"), ",") {
-		keyVal := strings.Split(option, ":")
-		key := keyVal[0]
-		if key == "foreignKey" {
-			return keyVal[1], true
+	idField := idValue(docVal)
+	if idField.IsValid() && idField.Kind() == reflect.Ptr {
+		if idField.IsNil() {
+			return primitive.NilObjectID, ErrMissingID
 		}
+		idField = idField.Elem()
+	}
+	if !idField.IsValid() {
+		return primitive.NilObjectID, ErrMissingID
+	}
+
+	oid, ok := idField.Interface().(primitive.ObjectID)
+	if !ok || oid.IsZero() {
+		return primitive.NilObjectID, ErrMissingID
 	}
-	return "", false
+	return oid, nil
 }
@@ -0,0 +1,1028 @@
+package mongormtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Server error codes.
+const (
+	codeBadValue                = 2
+	codeFailedToParse           = 9
+	codeTypeMismatch            = 14
+	codeNamespaceNotFound       = 26
+	codeIndexNotFound           = 27
+	codePathNotViable           = 28
+	codeCursorNotFound          = 43
+	codeNamespaceExists         = 48
+	codeCommandNotFound         = 59
+	codeImmutableField          = 66
+	codeInvalidOptions          = 72
+	codeIndexOptionsConflict    = 85
+	codeIndexKeySpecsConflict   = 86
+	codeCommandNotSupported     = 115
+	codeConversionFailure       = 241
+	codeNoSuchTransaction       = 251
+	codeDuplicateKey            = 11000
+	codeProjectionConflict      = 31254
+	codeUnrecognizedStage       = 40324
+	codeInvalidPipelineOperator = 168
+)
+
+var codeNames = map[int32]string{
+	codeBadValue:                "BadValue",
+	codeFailedToParse:           "FailedToParse",
+	codeTypeMismatch:            "TypeMismatch",
+	codeNamespaceNotFound:       "NamespaceNotFound",
+	codeIndexNotFound:           "IndexNotFound",
+	codePathNotViable:           "PathNotViable",
+	codeCursorNotFound:          "CursorNotFound",
+	codeNamespaceExists:         "NamespaceExists",
+	codeCommandNotFound:         "CommandNotFound",
+	codeImmutableField:          "ImmutableField",
+	codeInvalidOptions:          "InvalidOptions",
+	codeIndexOptionsConflict:    "IndexOptionsConflict",
+	codeIndexKeySpecsConflict:   "IndexKeySpecsConflict",
+	codeCommandNotSupported:     "CommandNotSupported",
+	codeConversionFailure:       "ConversionFailure",
+	codeNoSuchTransaction:       "NoSuchTransaction",
+	codeDuplicateKey:            "DuplicateKey",
+	codeInvalidPipelineOperator: "InvalidPipelineOperator",
+	codeProjectionConflict:      "Location31254",
+	codeUnrecognizedStage:       "Location40324",
+}
+
+// commandError is an error the server replies with.
+type commandError struct {
+	code    int32
+	message string
+	// info holds the extra fields of duplicate key errors.
+	info bson.D
+}
+
+func (e *commandError) Error() string {
+	return e.message
+}
+
+func errorf(code int32, format string, args ...interface{}) *commandError {
+	return &commandError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// database is a database of a Server.
+type database struct {
+	collections map[string]*collection
+}
+
+// collection is a collection of a database.
+type collection struct {
+	documents []bson.D
+	indexes   []index
+	// options holds the options the collection was created with.
+	options bson.D
+}
+
+// index is an index of a collection, of which the server only enforces
+// unique ones.
+type index struct {
+	name    string
+	key     bson.D
+	unique  bool
+	sparse  bool
+	partial bson.D
+	// spec is the index as listIndexes reports it.
+	spec bson.D
+}
+
+// cursor holds the documents left to return by a cursor.
+type cursor struct {
+	ns   string
+	docs []bson.D
+}
+
+// run executes command and returns the reply.
+func (s *Server) run(command bson.D) bson.D {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply, err := s.execute(command)
+	if err != nil {
+		cmdErr, ok := err.(*commandError)
+		if !ok {
+			cmdErr = errorf(codeBadValue, "%v", err)
+		}
+		return bson.D{
+			{Key: "ok", Value: 0.0},
+			{Key: "errmsg", Value: cmdErr.message},
+			{Key: "code", Value: cmdErr.code},
+			{Key: "codeName", Value: codeNames[cmdErr.code]},
+		}
+	}
+	return append(reply, bson.E{Key: "ok", Value: 1.0})
+}
+
+func (s *Server) execute(command bson.D) (bson.D, error) {
+	if len(command) == 0 {
+		return nil, errorf(codeFailedToParse, "empty command")
+	}
+	name := command[0].Key
+	dbName, _ := lookupOr(command, "$db", "test").(string)
+
+	if err := s.transaction(name, command); err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "hello", "isMaster", "ismaster":
+		return bson.D{
+			{Key: "isWritablePrimary", Value: true},
+			{Key: "ismaster", Value: true},
+			{Key: "setName", Value: "mongormtest"},
+			{Key: "hosts", Value: bson.A{string(serverAddress)}},
+			{Key: "maxBsonObjectSize", Value: int32(serverDescription.MaxDocumentSize)},
+			{Key: "maxMessageSizeBytes", Value: int32(serverDescription.MaxMessageSize)},
+			{Key: "maxWriteBatchSize", Value: int32(serverDescription.MaxBatchCount)},
+			{Key: "logicalSessionTimeoutMinutes", Value: int32(sessionTimeoutMinutes)},
+			{Key: "minWireVersion", Value: int32(0)},
+			{Key: "maxWireVersion", Value: serverDescription.WireVersion.Max},
+		}, nil
+	case "ping", "endSessions", "killAllSessions", "commitTransaction", "abortTransaction":
+		return bson.D{}, nil
+	case "buildInfo", "buildinfo":
+		return bson.D{
+			{Key: "version", Value: "7.0.0"},
+			{Key: "versionArray", Value: bson.A{int32(7), int32(0), int32(0), int32(0)}},
+		}, nil
+	case "listDatabases":
+		names := make([]string, 0, len(s.databases))
+		for name := range s.databases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		databases := bson.A{}
+		for _, name := range names {
+			databases = append(databases, bson.D{
+				{Key: "name", Value: name},
+				{Key: "sizeOnDisk", Value: int64(0)},
+				{Key: "empty", Value: len(s.databases[name].collections) == 0},
+			})
+		}
+		return bson.D{{Key: "databases", Value: databases}, {Key: "totalSize", Value: int64(0)}}, nil
+	case "dropDatabase":
+		delete(s.databases, dbName)
+		return bson.D{}, nil
+	case "listCollections":
+		return s.listCollections(dbName, command)
+	case "explain":
+		explained, _ := command[0].Value.(bson.D)
+		return bson.D{
+			{Key: "queryPlanner", Value: bson.D{
+				{Key: "namespace", Value: dbName + "." + fmt.Sprint(lookupOr(explained, commandName(explained), ""))},
+				{Key: "winningPlan", Value: bson.D{{Key: "stage", Value: "COLLSCAN"}}},
+				{Key: "rejectedPlans", Value: bson.A{}},
+			}},
+			{Key: "command", Value: explained},
+		}, nil
+	case "getMore":
+		return s.getMore(command)
+	case "killCursors":
+		ids, _ := lookupOr(command, "cursors", bson.A{}).(bson.A)
+		for _, id := range ids {
+			if n, ok := toInt(id); ok {
+				delete(s.cursors, n)
+			}
+		}
+		return bson.D{{Key: "cursorsKilled", Value: ids}}, nil
+	}
+
+	collName, ok := command[0].Value.(string)
+	if !ok {
+		return nil, errorf(codeCommandNotFound, "no such command: '%s'", name)
+	}
+	ns := dbName + "." + collName
+	switch name {
+	case "create":
+		if s.collection(dbName, collName, false) != nil {
+			return nil, errorf(codeNamespaceExists, "Collection %s already exists.", ns)
+		}
+		s.collection(dbName, collName, true).options = commandOptions(command)
+		return bson.D{}, nil
+	case "collMod":
+		c := s.collection(dbName, collName, false)
+		if c == nil {
+			return nil, errorf(codeNamespaceNotFound, "ns does not exist: %s", ns)
+		}
+		for _, option := range commandOptions(command) {
+			c.options = set(c.options, option.Key, option.Value)
+		}
+		return bson.D{}, nil
+	case "drop":
+		if s.collection(dbName, collName, false) == nil {
+			return nil, errorf(codeNamespaceNotFound, "ns not found")
+		}
+		delete(s.databases[dbName].collections, collName)
+		return bson.D{{Key: "ns", Value: ns}}, nil
+	case "createIndexes":
+		return s.createIndexes(dbName, collName, command)
+	case "listIndexes":
+		c := s.collection(dbName, collName, false)
+		if c == nil {
+			return nil, errorf(codeNamespaceNotFound, "ns does not exist: %s", ns)
+		}
+		var specs []bson.D
+		for _, idx := range c.indexes {
+			specs = append(specs, idx.spec)
+		}
+		return s.cursorReply(ns, specs, command), nil
+	case "dropIndexes":
+		return s.dropIndexes(dbName, collName, command)
+	case "insert":
+		return s.insert(dbName, collName, command)
+	case "update":
+		return s.update(dbName, collName, command)
+	case "delete":
+		return s.delete(dbName, collName, command)
+	case "findAndModify", "findandmodify":
+		return s.findAndModify(dbName, collName, command)
+	case "find":
+		docs, err := s.find(dbName, collName, command)
+		if err != nil {
+			return nil, err
+		}
+		return s.cursorReply(ns, docs, command), nil
+	case "aggregate":
+		pipeline, _ := lookupOr(command, "pipeline", bson.A{}).(bson.A)
+		docs, err := runPipeline(s.databases[dbName], s.documents(dbName, collName), pipeline, false)
+		if err != nil {
+			return nil, err
+		}
+		return s.cursorReply(ns, docs, command), nil
+	case "count":
+		query, _ := lookupOr(command, "query", bson.D{}).(bson.D)
+		docs, err := filterDocuments(s.documents(dbName, collName), query)
+		if err != nil {
+			return nil, err
+		}
+		docs = skipLimit(docs, lookupOr(command, "skip", nil), lookupOr(command, "limit", nil))
+		return bson.D{{Key: "n", Value: int32(len(docs))}}, nil
+	case "distinct":
+		key, _ := lookupOr(command, "key", "").(string)
+		query, _ := lookupOr(command, "query", bson.D{}).(bson.D)
+		docs, err := filterDocuments(s.documents(dbName, collName), query)
+		if err != nil {
+			return nil, err
+		}
+		values := bson.A{}
+		for _, doc := range docs {
+			for _, v := range resolve(doc, split(key)) {
+				elems := bson.A{v}
+				if array, ok := v.(bson.A); ok {
+					elems = array
+				}
+				for _, elem := range elems {
+					if !containsEqual(values, elem) {
+						values = append(values, elem)
+					}
+				}
+			}
+		}
+		return bson.D{{Key: "values", Value: values}}, nil
+	}
+	return nil, errorf(codeCommandNotFound, "no such command: '%s'", name)
+}
+
+// commandName returns the name of the command, its first key.
+func commandName(command bson.D) string {
+	if len(command) == 0 {
+		return ""
+	}
+	return command[0].Key
+}
+
+// genericArguments are the fields the driver adds to commands.
+var genericArguments = map[string]bool{
+	"$db": true, "lsid": true, "$clusterTime": true, "txnNumber": true, "autocommit": true,
+	"startTransaction": true, "readConcern": true, "writeConcern": true, "$readPreference": true,
+	"comment": true, "maxTimeMS": true, "apiVersion": true, "apiStrict": true, "apiDeprecationErrors": true,
+}
+
+// commandOptions returns the fields of command besides its name and the
+// generic arguments.
+func commandOptions(command bson.D) bson.D {
+	options := bson.D{}
+	for _, e := range command[1:] {
+		if !genericArguments[e.Key] {
+			options = append(options, e)
+		}
+	}
+	return options
+}
+
+// transaction snapshots the databases when command starts a transaction,
+// and restores them when it aborts one.
+func (s *Server) transaction(name string, command bson.D) error {
+	lsid, ok := lookupOr(command, "lsid", nil).(bson.D)
+	if !ok {
+		return nil
+	}
+	var key string
+	if id, ok := get(lsid, "id"); ok {
+		if binary, ok := id.(primitive.Binary); ok {
+			key = hex.EncodeToString(binary.Data)
+		}
+	}
+	switch {
+	case truthy(lookupOr(command, "startTransaction", false)):
+		s.transactions[key] = s.snapshot()
+	case name == "commitTransaction":
+		delete(s.transactions, key)
+	case name == "abortTransaction":
+		snapshot, ok := s.transactions[key]
+		if !ok {
+			return errorf(codeNoSuchTransaction, "Transaction with { txnNumber: %v } has been aborted.", lookupOr(command, "txnNumber", nil))
+		}
+		s.databases = snapshot
+		delete(s.transactions, key)
+	}
+	return nil
+}
+
+// snapshot returns a copy of the databases.
+func (s *Server) snapshot() map[string]*database {
+	databases := make(map[string]*database, len(s.databases))
+	for name, db := range s.databases {
+		copied := &database{collections: make(map[string]*collection, len(db.collections))}
+		for collName, c := range db.collections {
+			copied.collections[collName] = &collection{
+				documents: append([]bson.D(nil), c.documents...),
+				indexes:   append([]index(nil), c.indexes...),
+				options:   append(bson.D(nil), c.options...),
+			}
+		}
+		databases[name] = copied
+	}
+	return databases
+}
+
+// collection returns the collection name of the database dbName, creating
+// it when create is set, or nil.
+func (s *Server) collection(dbName, name string, create bool) *collection {
+	db, ok := s.databases[dbName]
+	if !ok {
+		if !create {
+			return nil
+		}
+		db = &database{collections: map[string]*collection{}}
+		s.databases[dbName] = db
+	}
+	c, ok := db.collections[name]
+	if !ok {
+		if !create {
+			return nil
+		}
+		idIndex := index{
+			name:   "_id_",
+			key:    bson.D{{Key: "_id", Value: int32(1)}},
+			unique: true,
+			spec:   bson.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: bson.D{{Key: "_id", Value: int32(1)}}}, {Key: "name", Value: "_id_"}},
+		}
+		c = &collection{indexes: []index{idIndex}, options: bson.D{}}
+		db.collections[name] = c
+	}
+	return c
+}
+
+// documents returns the documents of a collection, none if it is missing.
+func (s *Server) documents(dbName, name string) []bson.D {
+	c := s.collection(dbName, name, false)
+	if c == nil {
+		return nil
+	}
+	return append([]bson.D(nil), c.documents...)
+}
+
+// cursorReply returns the reply of a command returning docs through a
+// cursor, keeping those past the batch size for getMore.
+func (s *Server) cursorReply(ns string, docs []bson.D, command bson.D) bson.D {
+	batchSize := int64(-1)
+	if spec, ok := lookupOr(command, "cursor", nil).(bson.D); ok {
+		if n, ok := toInt(lookupOr(spec, "batchSize", nil)); ok {
+			batchSize = n
+		}
+	}
+	if n, ok := toInt(lookupOr(command, "batchSize", nil)); ok && n > 0 {
+		batchSize = n
+	}
+	var id int64
+	if batchSize >= 0 && batchSize < int64(len(docs)) {
+		if !truthy(lookupOr(command, "singleBatch", false)) {
+			s.lastID++
+			id = s.lastID
+			s.cursors[id] = &cursor{ns: ns, docs: docs[batchSize:]}
+		}
+		docs = docs[:batchSize]
+	}
+	batch := bson.A{}
+	for _, doc := range docs {
+		batch = append(batch, doc)
+	}
+	return bson.D{{Key: "cursor", Value: bson.D{
+		{Key: "firstBatch", Value: batch},
+		{Key: "id", Value: id},
+		{Key: "ns", Value: ns},
+	}}}
+}
+
+func (s *Server) getMore(command bson.D) (bson.D, error) {
+	id, _ := toInt(command[0].Value)
+	c, ok := s.cursors[id]
+	if !ok {
+		return nil, errorf(codeCursorNotFound, "cursor id %d not found", id)
+	}
+	docs := c.docs
+	if n, ok := toInt(lookupOr(command, "batchSize", nil)); ok && n > 0 && n < int64(len(docs)) {
+		c.docs, docs = docs[n:], docs[:n]
+	} else {
+		delete(s.cursors, id)
+		id = 0
+	}
+	batch := bson.A{}
+	for _, doc := range docs {
+		batch = append(batch, doc)
+	}
+	return bson.D{{Key: "cursor", Value: bson.D{
+		{Key: "nextBatch", Value: batch},
+		{Key: "id", Value: id},
+		{Key: "ns", Value: c.ns},
+	}}}, nil
+}
+
+func (s *Server) listCollections(dbName string, command bson.D) (bson.D, error) {
+	filter, _ := lookupOr(command, "filter", bson.D{}).(bson.D)
+	nameOnly := truthy(lookupOr(command, "nameOnly", false))
+	var names []string
+	if db, ok := s.databases[dbName]; ok {
+		for name := range db.collections {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var docs []bson.D
+	for _, name := range names {
+		doc := bson.D{{Key: "name", Value: name}, {Key: "type", Value: "collection"}}
+		if !nameOnly {
+			doc = append(doc,
+				bson.E{Key: "options", Value: s.databases[dbName].collections[name].options},
+				bson.E{Key: "info", Value: bson.D{{Key: "readOnly", Value: false}}})
+		}
+		matched, err := match(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			docs = append(docs, doc)
+		}
+	}
+	return s.cursorReply(dbName+".$cmd.listCollections", docs, command), nil
+}
+
+func (s *Server) createIndexes(dbName, collName string, command bson.D) (bson.D, error) {
+	created := s.collection(dbName, collName, false) == nil
+	c := s.collection(dbName, collName, true)
+	before := len(c.indexes)
+	specs, _ := lookupOr(command, "indexes", bson.A{}).(bson.A)
+	for _, value := range specs {
+		spec, ok := value.(bson.D)
+		if !ok {
+			return nil, errorf(codeFailedToParse, "index specification must be an object")
+		}
+		key, ok := lookupOr(spec, "key", nil).(bson.D)
+		if !ok || len(key) == 0 {
+			return nil, errorf(codeFailedToParse, "index key pattern must be a non-empty object")
+		}
+		name, _ := lookupOr(spec, "name", "").(string)
+		if name == "" {
+			name = indexName(key)
+		}
+		idx := index{
+			name:   name,
+			key:    key,
+			unique: truthy(lookupOr(spec, "unique", false)),
+			sparse: truthy(lookupOr(spec, "sparse", false)),
+		}
+		idx.partial, _ = lookupOr(spec, "partialFilterExpression", nil).(bson.D)
+		idx.spec = append(bson.D{{Key: "v", Value: int32(2)}}, set(remove(spec, "v"), "name", name)...)
+
+		existing := -1
+		for i, other := range c.indexes {
+			sameKey := compare(other.key, key) == 0
+			switch {
+			case other.name == name && sameKey:
+				existing = i
+			case other.name == name:
+				return nil, errorf(codeIndexKeySpecsConflict, "An existing index has the same name as the requested index but different key pattern: %s", name)
+			case sameKey:
+				return nil, errorf(codeIndexOptionsConflict, "Index already exists with a different name: %s", other.name)
+			}
+		}
+		if existing >= 0 {
+			continue
+		}
+		if idx.unique {
+			for i, doc := range c.documents {
+				if err := c.checkIndex(idx, doc, i, dbName+"."+collName); err != nil {
+					return nil, err
+				}
+			}
+		}
+		c.indexes = append(c.indexes, idx)
+	}
+	return bson.D{
+		{Key: "createdCollectionAutomatically", Value: created},
+		{Key: "numIndexesBefore", Value: int32(before)},
+		{Key: "numIndexesAfter", Value: int32(len(c.indexes))},
+	}, nil
+}
+
+// indexName returns the default name of an index on key, such as
+// "email_1".
+func indexName(key bson.D) string {
+	parts := make([]string, 0, 2*len(key))
+	for _, e := range key {
+		parts = append(parts, e.Key, fmt.Sprint(e.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (s *Server) dropIndexes(dbName, collName string, command bson.D) (bson.D, error) {
+	c := s.collection(dbName, collName, false)
+	if c == nil {
+		return nil, errorf(codeNamespaceNotFound, "ns not found %s.%s", dbName, collName)
+	}
+	before := len(c.indexes)
+	target := lookupOr(command, "index", nil)
+	var names []string
+	switch target := target.(type) {
+	case string:
+		if target == "*" {
+			c.indexes = c.indexes[:1]
+			return bson.D{{Key: "nIndexesWas", Value: int32(before)}}, nil
+		}
+		names = []string{target}
+	case bson.A:
+		for _, name := range target {
+			names = append(names, fmt.Sprint(name))
+		}
+	case bson.D:
+		for _, idx := range c.indexes {
+			if compare(idx.key, target) == 0 {
+				names = append(names, idx.name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, errorf(codeIndexNotFound, "can't find index with key: %v", target)
+		}
+	}
+	for _, name := range names {
+		if name == "_id_" {
+			return nil, errorf(codeInvalidOptions, "cannot drop _id index")
+		}
+		found := false
+		for i, idx := range c.indexes {
+			if idx.name == name {
+				c.indexes = append(c.indexes[:i:i], c.indexes[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errorf(codeIndexNotFound, "index not found with name [%s]", name)
+		}
+	}
+	return bson.D{{Key: "nIndexesWas", Value: int32(before)}}, nil
+}
+
+// checkUnique returns a duplicate key error if doc, about to be stored at
+// position pos, or appended when pos is -1, violates a unique index.
+func (c *collection) checkUnique(doc bson.D, pos int, ns string) error {
+	for _, idx := range c.indexes {
+		if idx.unique {
+			if err := c.checkIndex(idx, doc, pos, ns); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkIndex returns a duplicate key error if another document than the
+// one at position pos has the key doc has in the unique index idx.
+func (c *collection) checkIndex(idx index, doc bson.D, pos int, ns string) error {
+	key, ok := idx.keyOf(doc)
+	if !ok {
+		return nil
+	}
+	for i, other := range c.documents {
+		if i == pos {
+			continue
+		}
+		if otherKey, ok := idx.keyOf(other); ok && compare(key, otherKey) == 0 {
+			values := make([]string, len(key))
+			keyValue := bson.D{}
+			for j, e := range idx.key {
+				values[j] = fmt.Sprintf("%s: %s", e.Key, formatValue(key[j]))
+				keyValue = append(keyValue, bson.E{Key: e.Key, Value: key[j]})
+			}
+			err := errorf(codeDuplicateKey, "E11000 duplicate key error collection: %s index: %s dup key: { %s }", ns, idx.name, strings.Join(values, ", "))
+			err.info = bson.D{{Key: "keyPattern", Value: idx.key}, {Key: "keyValue", Value: keyValue}}
+			return err
+		}
+	}
+	return nil
+}
+
+// keyOf returns the values doc has for the fields of idx, reporting false
+// for documents left out of sparse and partial indexes.
+func (idx index) keyOf(doc bson.D) (bson.A, bool) {
+	if idx.partial != nil {
+		if matched, err := match(doc, idx.partial); err != nil || !matched {
+			return nil, false
+		}
+	}
+	key := bson.A{}
+	present := false
+	for _, e := range idx.key {
+		values := resolve(doc, split(e.Key))
+		var value interface{}
+		if len(values) > 0 {
+			value, present = values[0], true
+		}
+		key = append(key, value)
+	}
+	if idx.sparse && !present {
+		return nil, false
+	}
+	return key, true
+}
+
+// formatValue formats v for error messages, roughly as the server does.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case primitive.ObjectID:
+		return fmt.Sprintf("ObjectId('%s')", v.Hex())
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+// writeError returns the write error entry of a failed statement.
+func writeError(i int, err error) bson.D {
+	cmdErr, ok := err.(*commandError)
+	if !ok {
+		cmdErr = errorf(codeBadValue, "%v", err)
+	}
+	entry := bson.D{
+		{Key: "index", Value: int32(i)},
+		{Key: "code", Value: cmdErr.code},
+		{Key: "errmsg", Value: cmdErr.message},
+	}
+	return append(entry, cmdErr.info...)
+}
+
+// writeReply returns the reply of a write command, with its write errors.
+func writeReply(reply bson.D, writeErrors bson.A) bson.D {
+	if len(writeErrors) > 0 {
+		reply = append(reply, bson.E{Key: "writeErrors", Value: writeErrors})
+	}
+	return reply
+}
+
+// withID returns doc with an _id, first, generating one if needed.
+func withID(doc bson.D) bson.D {
+	id, ok := get(doc, "_id")
+	if !ok {
+		id = primitive.NewObjectID()
+	}
+	return append(bson.D{{Key: "_id", Value: id}}, remove(doc, "_id")...)
+}
+
+func (s *Server) insert(dbName, collName string, command bson.D) (bson.D, error) {
+	c := s.collection(dbName, collName, true)
+	docs, _ := lookupOr(command, "documents", bson.A{}).(bson.A)
+	ordered := truthy(lookupOr(command, "ordered", true))
+	n := 0
+	writeErrors := bson.A{}
+	for i, value := range docs {
+		doc, ok := value.(bson.D)
+		if !ok {
+			writeErrors = append(writeErrors, writeError(i, errorf(codeBadValue, "document must be an object")))
+		} else {
+			doc = withID(doc)
+			if err := c.checkUnique(doc, -1, dbName+"."+collName); err != nil {
+				writeErrors = append(writeErrors, writeError(i, err))
+			} else {
+				c.documents = append(c.documents, doc)
+				n++
+				continue
+			}
+		}
+		if ordered {
+			break
+		}
+	}
+	return writeReply(bson.D{{Key: "n", Value: int32(n)}}, writeErrors), nil
+}
+
+func (s *Server) update(dbName, collName string, command bson.D) (bson.D, error) {
+	c := s.collection(dbName, collName, true)
+	statements, _ := lookupOr(command, "updates", bson.A{}).(bson.A)
+	ordered := truthy(lookupOr(command, "ordered", true))
+	var n, modified int32
+	upserted := bson.A{}
+	writeErrors := bson.A{}
+	for i, value := range statements {
+		statement, _ := value.(bson.D)
+		filter, _ := lookupOr(statement, "q", bson.D{}).(bson.D)
+		arrayFilters, _ := lookupOr(statement, "arrayFilters", bson.A{}).(bson.A)
+		result, err := c.updateDocuments(filter, lookupOr(statement, "u", bson.D{}), arrayFilters,
+			truthy(lookupOr(statement, "multi", false)), truthy(lookupOr(statement, "upsert", false)),
+			dbName+"."+collName)
+		if err != nil {
+			writeErrors = append(writeErrors, writeError(i, err))
+			if ordered {
+				break
+			}
+			continue
+		}
+		n += int32(result.matched)
+		modified += int32(result.modified)
+		if result.upserted != nil {
+			n++
+			upserted = append(upserted, bson.D{{Key: "index", Value: int32(i)}, {Key: "_id", Value: result.upserted}})
+		}
+	}
+	reply := bson.D{{Key: "n", Value: n}, {Key: "nModified", Value: modified}}
+	if len(upserted) > 0 {
+		reply = append(reply, bson.E{Key: "upserted", Value: upserted})
+	}
+	return writeReply(reply, writeErrors), nil
+}
+
+// updateResult describes the documents changed by an update.
+type updateResult struct {
+	matched, modified int
+	// upserted is the _id of the document inserted by an upsert.
+	upserted interface{}
+	// before and after are the last document updated or inserted, before
+	// and after the update.
+	before, after bson.D
+}
+
+// updateDocuments applies update to the first document matching filter,
+// or every one when multi is set, inserting one when none does and upsert
+// is set. sort orders the documents considered, for findAndModify.
+func (c *collection) updateDocuments(filter bson.D, update interface{}, arrayFilters bson.A, multi, upsert bool, ns string, sortSpec ...bson.D) (updateResult, error) {
+	var result updateResult
+	positions := make([]int, len(c.documents))
+	for i := range positions {
+		positions[i] = i
+	}
+	if len(sortSpec) > 0 && len(sortSpec[0]) > 0 {
+		sort.SliceStable(positions, func(i, j int) bool {
+			return compareBy(c.documents[positions[i]], c.documents[positions[j]], sortSpec[0]) < 0
+		})
+	}
+	for _, i := range positions {
+		doc := c.documents[i]
+		matched, err := match(doc, filter)
+		if err != nil {
+			return result, err
+		}
+		if !matched {
+			continue
+		}
+		u := &updater{filter: filter, arrayFilters: arrayFilters}
+		updated, err := u.apply(doc, update)
+		if err != nil {
+			return result, err
+		}
+		result.matched++
+		result.before, result.after = doc, updated
+		if !sameDocument(doc, updated) {
+			if err := c.checkUnique(updated, i, ns); err != nil {
+				return result, err
+			}
+			c.documents[i] = updated
+			result.modified++
+		}
+		if !multi {
+			break
+		}
+	}
+	if result.matched > 0 || !upsert {
+		return result, nil
+	}
+
+	base, err := upsertDocument(filter)
+	if err != nil {
+		return result, err
+	}
+	u := &updater{filter: filter, arrayFilters: arrayFilters, inserting: true}
+	doc, err := u.apply(base, update)
+	if err != nil {
+		return result, err
+	}
+	doc = withID(doc)
+	if err := c.checkUnique(doc, -1, ns); err != nil {
+		return result, err
+	}
+	c.documents = append(c.documents, doc)
+	result.upserted, _ = get(doc, "_id")
+	result.after = doc
+	return result, nil
+}
+
+// sameDocument reports whether a and b encode to the same BSON.
+func sameDocument(a, b bson.D) bool {
+	x, err1 := bson.Marshal(a)
+	y, err2 := bson.Marshal(b)
+	return err1 == nil && err2 == nil && bytes.Equal(x, y)
+}
+
+func (s *Server) delete(dbName, collName string, command bson.D) (bson.D, error) {
+	c := s.collection(dbName, collName, false)
+	statements, _ := lookupOr(command, "deletes", bson.A{}).(bson.A)
+	ordered := truthy(lookupOr(command, "ordered", true))
+	var n int32
+	writeErrors := bson.A{}
+	for i, value := range statements {
+		if c == nil {
+			break
+		}
+		statement, _ := value.(bson.D)
+		filter, _ := lookupOr(statement, "q", bson.D{}).(bson.D)
+		limit, _ := toInt(lookupOr(statement, "limit", int32(0)))
+		deleted, err := c.deleteDocuments(filter, limit == 1, nil)
+		if err != nil {
+			writeErrors = append(writeErrors, writeError(i, err))
+			if ordered {
+				break
+			}
+			continue
+		}
+		n += int32(len(deleted))
+	}
+	return writeReply(bson.D{{Key: "n", Value: n}}, writeErrors), nil
+}
+
+// deleteDocuments removes the documents matching filter, only the first
+// one in the order of sortSpec when one is set, and returns them.
+func (c *collection) deleteDocuments(filter bson.D, one bool, sortSpec bson.D) ([]bson.D, error) {
+	candidates := append([]bson.D(nil), c.documents...)
+	if len(sortSpec) > 0 {
+		sortDocuments(candidates, sortSpec)
+	}
+	matched, err := filterDocuments(candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+	if one && len(matched) > 1 {
+		matched = matched[:1]
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	kept := make([]bson.D, 0, len(c.documents)-len(matched))
+	for _, doc := range c.documents {
+		deleted := false
+		for _, m := range matched {
+			if sameSlice(doc, m) {
+				deleted = true
+				break
+			}
+		}
+		if !deleted {
+			kept = append(kept, doc)
+		}
+	}
+	c.documents = kept
+	return matched, nil
+}
+
+// sameSlice reports whether a and b are the same stored document.
+func sameSlice(a, b bson.D) bool {
+	return len(a) > 0 && len(b) > 0 && &a[0] == &b[0]
+}
+
+func (s *Server) findAndModify(dbName, collName string, command bson.D) (bson.D, error) {
+	ns := dbName + "." + collName
+	filter, _ := lookupOr(command, "query", bson.D{}).(bson.D)
+	sortSpec, _ := lookupOr(command, "sort", bson.D{}).(bson.D)
+	fields, _ := lookupOr(command, "fields", nil).(bson.D)
+	returnNew := truthy(lookupOr(command, "new", false))
+
+	var value bson.D
+	lastError := bson.D{}
+	if truthy(lookupOr(command, "remove", false)) {
+		c := s.collection(dbName, collName, false)
+		var deleted []bson.D
+		if c != nil {
+			var err error
+			if deleted, err = c.deleteDocuments(filter, true, sortSpec); err != nil {
+				return nil, err
+			}
+		}
+		lastError = append(lastError, bson.E{Key: "n", Value: int32(len(deleted))})
+		if len(deleted) > 0 {
+			value = deleted[0]
+		}
+	} else {
+		update, ok := get(command, "update")
+		if !ok {
+			return nil, errorf(codeFailedToParse, "Either an update or remove=true must be specified")
+		}
+		arrayFilters, _ := lookupOr(command, "arrayFilters", bson.A{}).(bson.A)
+		c := s.collection(dbName, collName, true)
+		result, err := c.updateDocuments(filter, update, arrayFilters, false, truthy(lookupOr(command, "upsert", false)), ns, sortSpec)
+		if err != nil {
+			return nil, err
+		}
+		lastError = append(lastError,
+			bson.E{Key: "n", Value: int32(result.matched + countIf(result.upserted != nil))},
+			bson.E{Key: "updatedExisting", Value: result.matched > 0})
+		if result.upserted != nil {
+			lastError = append(lastError, bson.E{Key: "upserted", Value: result.upserted})
+		}
+		value = result.before
+		if returnNew {
+			value = result.after
+		}
+	}
+
+	reply := bson.D{{Key: "lastErrorObject", Value: lastError}}
+	if value == nil {
+		return append(reply, bson.E{Key: "value", Value: nil}), nil
+	}
+	if fields != nil {
+		var err error
+		if value, err = project(value, fields, false); err != nil {
+			return nil, err
+		}
+	}
+	return append(reply, bson.E{Key: "value", Value: value}), nil
+}
+
+// countIf returns 1 if b is set, and 0 otherwise.
+func countIf(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) find(dbName, collName string, command bson.D) ([]bson.D, error) {
+	filter, _ := lookupOr(command, "filter", bson.D{}).(bson.D)
+	docs, err := filterDocuments(s.documents(dbName, collName), filter)
+	if err != nil {
+		return nil, err
+	}
+	if spec, ok := lookupOr(command, "sort", nil).(bson.D); ok && len(spec) > 0 {
+		sortDocuments(docs, spec)
+	}
+	docs = skipLimit(docs, lookupOr(command, "skip", nil), lookupOr(command, "limit", nil))
+	if projection, ok := lookupOr(command, "projection", nil).(bson.D); ok && len(projection) > 0 {
+		if docs, err = mapDocuments(docs, func(doc bson.D) (bson.D, error) {
+			return project(doc, projection, false)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// skipLimit applies the skip and limit options of a command to docs. A
+// negative limit is the same as a positive one.
+func skipLimit(docs []bson.D, skip, limit interface{}) []bson.D {
+	if n, ok := toInt(skip); ok && n > 0 {
+		if n >= int64(len(docs)) {
+			return nil
+		}
+		docs = docs[n:]
+	}
+	if n, ok := toInt(limit); ok && n != 0 {
+		if n < 0 {
+			n = -n
+		}
+		if n < int64(len(docs)) {
+			docs = docs[:n]
+		}
+	}
+	return docs
+}
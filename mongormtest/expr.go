@@ -0,0 +1,663 @@
+package mongormtest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// missingValue is the result of expressions naming missing fields, which
+// stages such as $project leave out rather than set to null.
+type missingValue struct{}
+
+// removeValue is the result of $$REMOVE.
+type removeValue struct{}
+
+// evaluate returns the value of the aggregation expression expr for doc,
+// with the variables vars besides the system ones.
+func evaluate(expr interface{}, doc bson.D, vars map[string]interface{}) (interface{}, error) {
+	switch expr := expr.(type) {
+	case string:
+		switch {
+		case strings.HasPrefix(expr, "$$"):
+			name, path, _ := strings.Cut(expr[2:], ".")
+			var value interface{}
+			switch name {
+			case "ROOT", "CURRENT":
+				value = doc
+			case "NOW":
+				value = primitive.NewDateTimeFromTime(time.Now())
+			case "REMOVE":
+				return removeValue{}, nil
+			default:
+				v, ok := vars[name]
+				if !ok {
+					return nil, errorf(codeBadValue, "use of undefined variable: %s", name)
+				}
+				value = v
+			}
+			if path == "" {
+				return value, nil
+			}
+			if v, ok := lookup(value, split(path)); ok {
+				return v, nil
+			}
+			return missingValue{}, nil
+		case strings.HasPrefix(expr, "$"):
+			if v, ok := lookup(doc, split(expr[1:])); ok {
+				return v, nil
+			}
+			return missingValue{}, nil
+		}
+		return expr, nil
+	case bson.A:
+		values := make(bson.A, len(expr))
+		for i, e := range expr {
+			v, err := evaluateValue(e, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case bson.D:
+		if len(expr) == 1 && strings.HasPrefix(expr[0].Key, "$") {
+			return evaluateOperator(expr[0].Key, expr[0].Value, doc, vars)
+		}
+		result := bson.D{}
+		for _, e := range expr {
+			v, err := evaluate(e.Value, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			switch v.(type) {
+			case missingValue, removeValue:
+				continue
+			}
+			result = append(result, bson.E{Key: e.Key, Value: v})
+		}
+		return result, nil
+	}
+	return expr, nil
+}
+
+// evaluateValue is like evaluate, with missing values as null.
+func evaluateValue(expr interface{}, doc bson.D, vars map[string]interface{}) (interface{}, error) {
+	v, err := evaluate(expr, doc, vars)
+	switch v.(type) {
+	case missingValue, removeValue:
+		return nil, err
+	}
+	return v, err
+}
+
+// evaluateArgs evaluates the arguments of an operator, given as an array or
+// as a single expression.
+func evaluateArgs(arg interface{}, doc bson.D, vars map[string]interface{}) ([]interface{}, error) {
+	exprs, ok := arg.(bson.A)
+	if !ok {
+		exprs = bson.A{arg}
+	}
+	args := make([]interface{}, len(exprs))
+	for i, e := range exprs {
+		v, err := evaluateValue(e, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+func evaluateOperator(name string, arg interface{}, doc bson.D, vars map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "$literal":
+		return arg, nil
+	case "$cond":
+		var condition, then, otherwise interface{}
+		switch arg := arg.(type) {
+		case bson.A:
+			if len(arg) != 3 {
+				return nil, errorf(codeBadValue, "$cond needs 3 arguments")
+			}
+			condition, then, otherwise = arg[0], arg[1], arg[2]
+		case bson.D:
+			condition, _ = get(arg, "if")
+			then, _ = get(arg, "then")
+			otherwise, _ = get(arg, "else")
+		}
+		v, err := evaluateValue(condition, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(v) {
+			return evaluate(then, doc, vars)
+		}
+		return evaluate(otherwise, doc, vars)
+	case "$switch":
+		spec, _ := arg.(bson.D)
+		branches, _ := get(spec, "branches")
+		list, _ := branches.(bson.A)
+		for _, b := range list {
+			branch, _ := b.(bson.D)
+			caseExpr, _ := get(branch, "case")
+			v, err := evaluateValue(caseExpr, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(v) {
+				then, _ := get(branch, "then")
+				return evaluate(then, doc, vars)
+			}
+		}
+		if otherwise, ok := get(spec, "default"); ok {
+			return evaluate(otherwise, doc, vars)
+		}
+		return nil, errorf(codeBadValue, "$switch could not find a matching branch for an input, and no default was specified")
+	case "$filter", "$map":
+		spec, _ := arg.(bson.D)
+		inputExpr, _ := get(spec, "input")
+		input, err := evaluateValue(inputExpr, doc, vars)
+		if err != nil || input == nil {
+			return nil, err
+		}
+		array, ok := input.(bson.A)
+		if !ok {
+			return nil, errorf(codeTypeMismatch, "input to %s must be an array", name)
+		}
+		as := "this"
+		if v, ok := get(spec, "as"); ok {
+			as, _ = v.(string)
+		}
+		body, _ := get(spec, "cond")
+		if name == "$map" {
+			body, _ = get(spec, "in")
+		}
+		inner := map[string]interface{}{}
+		for k, v := range vars {
+			inner[k] = v
+		}
+		result := bson.A{}
+		for _, elem := range array {
+			inner[as] = elem
+			v, err := evaluateValue(body, doc, inner)
+			if err != nil {
+				return nil, err
+			}
+			if name == "$map" {
+				result = append(result, v)
+			} else if truthy(v) {
+				result = append(result, elem)
+			}
+		}
+		return result, nil
+	}
+
+	args, err := evaluateArgs(arg, doc, vars)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "$add", "$multiply":
+		var result interface{} = int32(0)
+		if name == "$multiply" {
+			result = int32(1)
+		}
+		isDate := false
+		for _, a := range args {
+			if a == nil {
+				return nil, nil
+			}
+			if d, ok := a.(primitive.DateTime); ok && name == "$add" {
+				isDate, a = true, int64(d)
+			}
+			if !isNumber(a) {
+				return nil, errorf(codeTypeMismatch, "%s only supports numeric types, not %s", name, typeName(a))
+			}
+			if name == "$add" {
+				result = arithmetic(result, a, func(x, y float64) float64 { return x + y }, func(x, y int64) int64 { return x + y })
+			} else {
+				result = arithmetic(result, a, func(x, y float64) float64 { return x * y }, func(x, y int64) int64 { return x * y })
+			}
+		}
+		if isDate {
+			n, _ := toInt(result)
+			return primitive.DateTime(n), nil
+		}
+		return result, nil
+	case "$subtract", "$divide", "$mod":
+		if len(args) != 2 {
+			return nil, errorf(codeBadValue, "%s needs 2 arguments", name)
+		}
+		a, b := args[0], args[1]
+		if a == nil || b == nil {
+			return nil, nil
+		}
+		if name == "$subtract" {
+			da, aDate := a.(primitive.DateTime)
+			db, bDate := b.(primitive.DateTime)
+			switch {
+			case aDate && bDate:
+				return int64(da) - int64(db), nil
+			case aDate && isNumber(b):
+				n, _ := toInt(b)
+				return primitive.DateTime(int64(da) - n), nil
+			}
+		}
+		if !isNumber(a) || !isNumber(b) {
+			return nil, errorf(codeTypeMismatch, "%s only supports numeric types", name)
+		}
+		switch name {
+		case "$subtract":
+			return arithmetic(a, b, func(x, y float64) float64 { return x - y }, func(x, y int64) int64 { return x - y }), nil
+		case "$divide":
+			if toFloat(b) == 0 {
+				return nil, errorf(codeBadValue, "can't $divide by zero")
+			}
+			return toFloat(a) / toFloat(b), nil
+		}
+		if toFloat(b) == 0 {
+			return nil, errorf(codeBadValue, "can't $mod by zero")
+		}
+		return arithmetic(a, b, math.Mod, func(x, y int64) int64 { return x % y }), nil
+	case "$abs", "$ceil", "$floor":
+		v := single(args)
+		if v == nil {
+			return nil, nil
+		}
+		switch n := v.(type) {
+		case int32:
+			if name == "$abs" && n < 0 {
+				return -n, nil
+			}
+			return n, nil
+		case int64:
+			if name == "$abs" && n < 0 {
+				return -n, nil
+			}
+			return n, nil
+		case float64, primitive.Decimal128:
+			f := toFloat(n)
+			switch name {
+			case "$abs":
+				return math.Abs(f), nil
+			case "$ceil":
+				return math.Ceil(f), nil
+			}
+			return math.Floor(f), nil
+		}
+		return nil, errorf(codeTypeMismatch, "%s only supports numeric types, not %s", name, typeName(v))
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$cmp":
+		if len(args) != 2 {
+			return nil, errorf(codeBadValue, "%s needs 2 arguments", name)
+		}
+		c := compare(args[0], args[1])
+		switch name {
+		case "$eq":
+			return c == 0, nil
+		case "$ne":
+			return c != 0, nil
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		case "$lte":
+			return c <= 0, nil
+		}
+		return int32(c), nil
+	case "$and":
+		for _, a := range args {
+			if !truthy(a) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$or":
+		for _, a := range args {
+			if truthy(a) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$not":
+		return len(args) == 0 || !truthy(args[0]), nil
+	case "$ifNull":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	case "$in":
+		if len(args) != 2 {
+			return nil, errorf(codeBadValue, "$in needs 2 arguments")
+		}
+		array, ok := args[1].(bson.A)
+		if !ok {
+			return nil, errorf(codeBadValue, "$in needs an array")
+		}
+		for _, elem := range array {
+			if equal(elem, args[0]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$size":
+		array, ok := single(args).(bson.A)
+		if !ok {
+			return nil, errorf(codeTypeMismatch, "the argument to $size must be an array")
+		}
+		return int32(len(array)), nil
+	case "$isArray":
+		_, ok := single(args).(bson.A)
+		return ok, nil
+	case "$arrayElemAt":
+		if len(args) != 2 {
+			return nil, errorf(codeBadValue, "$arrayElemAt needs 2 arguments")
+		}
+		array, ok := args[0].(bson.A)
+		if !ok {
+			return nil, nil
+		}
+		i, _ := toInt(args[1])
+		if i < 0 {
+			i += int64(len(array))
+		}
+		if i < 0 || i >= int64(len(array)) {
+			return missingValue{}, nil
+		}
+		return array[i], nil
+	case "$first", "$last":
+		array, ok := single(args).(bson.A)
+		if !ok || len(array) == 0 {
+			return missingValue{}, nil
+		}
+		if name == "$first" {
+			return array[0], nil
+		}
+		return array[len(array)-1], nil
+	case "$concatArrays":
+		result := bson.A{}
+		for _, a := range args {
+			if a == nil {
+				return nil, nil
+			}
+			array, ok := a.(bson.A)
+			if !ok {
+				return nil, errorf(codeTypeMismatch, "$concatArrays only supports arrays")
+			}
+			result = append(result, array...)
+		}
+		return result, nil
+	case "$sum", "$avg", "$min", "$max":
+		values := args
+		if len(args) == 1 {
+			if array, ok := args[0].(bson.A); ok {
+				values = array
+			}
+		}
+		acc := newAccumulator(name)
+		for _, v := range values {
+			acc.add(v)
+		}
+		return acc.result(), nil
+	case "$concat":
+		var b strings.Builder
+		for _, a := range args {
+			if a == nil {
+				return nil, nil
+			}
+			s, ok := a.(string)
+			if !ok {
+				return nil, errorf(codeTypeMismatch, "$concat only supports strings, not %s", typeName(a))
+			}
+			b.WriteString(s)
+		}
+		return b.String(), nil
+	case "$toLower", "$toUpper", "$toString":
+		v := single(args)
+		if v == nil {
+			if name == "$toString" {
+				return nil, nil
+			}
+			return "", nil
+		}
+		s := stringify(v)
+		switch name {
+		case "$toLower":
+			return strings.ToLower(s), nil
+		case "$toUpper":
+			return strings.ToUpper(s), nil
+		}
+		return s, nil
+	case "$strLenCP":
+		s, ok := single(args).(string)
+		if !ok {
+			return nil, errorf(codeTypeMismatch, "$strLenCP requires a string argument")
+		}
+		return int32(len([]rune(s))), nil
+	case "$split":
+		if len(args) != 2 {
+			return nil, errorf(codeBadValue, "$split needs 2 arguments")
+		}
+		s, ok1 := args[0].(string)
+		sep, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, nil
+		}
+		parts := bson.A{}
+		for _, part := range strings.Split(s, sep) {
+			parts = append(parts, part)
+		}
+		return parts, nil
+	case "$toObjectId":
+		switch v := single(args).(type) {
+		case nil, primitive.ObjectID:
+			return v, nil
+		case string:
+			id, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				return nil, errorf(codeConversionFailure, "failed to parse objectId '%s' in $convert", v)
+			}
+			return id, nil
+		}
+		return nil, errorf(codeConversionFailure, "unsupported conversion to objectId in $convert")
+	case "$type":
+		v, err := evaluate(arg, doc, vars)
+		if _, ok := v.(missingValue); ok {
+			return "missing", err
+		}
+		return typeName(single(args)), err
+	case "$mergeObjects":
+		result := bson.D{}
+		for _, a := range args {
+			if array, ok := a.(bson.A); ok && len(args) == 1 {
+				for _, elem := range array {
+					if d, ok := elem.(bson.D); ok {
+						for _, e := range d {
+							result = set(result, e.Key, e.Value)
+						}
+					}
+				}
+				continue
+			}
+			d, ok := a.(bson.D)
+			if !ok {
+				continue
+			}
+			for _, e := range d {
+				result = set(result, e.Key, e.Value)
+			}
+		}
+		return result, nil
+	case "$year", "$month", "$dayOfMonth", "$hour", "$minute", "$second", "$dayOfWeek", "$dayOfYear":
+		d, ok := single(args).(primitive.DateTime)
+		if !ok {
+			return nil, nil
+		}
+		t := d.Time().UTC()
+		switch name {
+		case "$year":
+			return int32(t.Year()), nil
+		case "$month":
+			return int32(t.Month()), nil
+		case "$dayOfMonth":
+			return int32(t.Day()), nil
+		case "$hour":
+			return int32(t.Hour()), nil
+		case "$minute":
+			return int32(t.Minute()), nil
+		case "$second":
+			return int32(t.Second()), nil
+		case "$dayOfWeek":
+			return int32(t.Weekday()) + 1, nil
+		}
+		return int32(t.YearDay()), nil
+	case "$dateToString":
+		spec, _ := arg.(bson.D)
+		dateExpr, _ := get(spec, "date")
+		date, err := evaluateValue(dateExpr, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		d, ok := date.(primitive.DateTime)
+		if !ok {
+			return nil, nil
+		}
+		format := "%Y-%m-%dT%H:%M:%S.%LZ"
+		if f, ok := get(spec, "format"); ok {
+			format, _ = f.(string)
+		}
+		t := d.Time().UTC()
+		return strings.NewReplacer(
+			"%Y", fmt.Sprintf("%04d", t.Year()), "%m", fmt.Sprintf("%02d", int(t.Month())),
+			"%d", fmt.Sprintf("%02d", t.Day()), "%H", fmt.Sprintf("%02d", t.Hour()),
+			"%M", fmt.Sprintf("%02d", t.Minute()), "%S", fmt.Sprintf("%02d", t.Second()),
+			"%L", fmt.Sprintf("%03d", t.Nanosecond()/int(time.Millisecond)), "%%", "%",
+		).Replace(format), nil
+	}
+	return nil, errorf(codeInvalidPipelineOperator, "Unrecognized expression '%s'", name)
+}
+
+// single returns the only argument of args, or nil.
+func single(args []interface{}) interface{} {
+	if len(args) != 1 {
+		return nil
+	}
+	return args[0]
+}
+
+// arithmetic applies an operation to the numbers a and b, as doubles when
+// either is one and as integers otherwise, widening int32 results that
+// overflow to int64.
+func arithmetic(a, b interface{}, floatOp func(x, y float64) float64, intOp func(x, y int64) int64) interface{} {
+	_, aFloat := a.(float64)
+	_, bFloat := b.(float64)
+	_, aDecimal := a.(primitive.Decimal128)
+	_, bDecimal := b.(primitive.Decimal128)
+	if aFloat || bFloat || aDecimal || bDecimal {
+		return floatOp(toFloat(a), toFloat(b))
+	}
+	x, _ := toInt(a)
+	y, _ := toInt(b)
+	result := intOp(x, y)
+	_, aLong := a.(int64)
+	_, bLong := b.(int64)
+	if aLong || bLong || result > math.MaxInt32 || result < math.MinInt32 {
+		return result
+	}
+	return int32(result)
+}
+
+// stringify formats v as $toString does.
+func stringify(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC().Format("2006-01-02T15:04:05.000Z")
+	case float64, int32, int64, bool:
+		return fmt.Sprint(v)
+	case primitive.Decimal128:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// accumulator computes a $group accumulator, or its expression form.
+type accumulator struct {
+	op     string
+	sum    interface{}
+	count  int64
+	value  interface{}
+	values bson.A
+	seen   bool
+}
+
+func newAccumulator(op string) *accumulator {
+	return &accumulator{op: op, sum: int32(0), values: bson.A{}}
+}
+
+func (a *accumulator) add(v interface{}) {
+	switch a.op {
+	case "$sum", "$avg":
+		if isNumber(v) {
+			a.sum = arithmetic(a.sum, v, func(x, y float64) float64 { return x + y }, func(x, y int64) int64 { return x + y })
+			a.count++
+		}
+	case "$min", "$max":
+		if v == nil {
+			return
+		}
+		if !a.seen {
+			a.value, a.seen = v, true
+			return
+		}
+		c := compare(v, a.value)
+		if (a.op == "$min" && c < 0) || (a.op == "$max" && c > 0) {
+			a.value = v
+		}
+	case "$first":
+		if !a.seen {
+			a.value, a.seen = v, true
+		}
+	case "$last":
+		a.value = v
+	case "$push":
+		a.values = append(a.values, v)
+	case "$addToSet":
+		for _, existing := range a.values {
+			if equal(existing, v) {
+				return
+			}
+		}
+		a.values = append(a.values, v)
+	case "$count":
+		a.count++
+	}
+}
+
+func (a *accumulator) result() interface{} {
+	switch a.op {
+	case "$sum":
+		return a.sum
+	case "$avg":
+		if a.count == 0 {
+			return nil
+		}
+		return toFloat(a.sum) / float64(a.count)
+	case "$push", "$addToSet":
+		return a.values
+	case "$count":
+		return int32(a.count)
+	}
+	return a.value
+}
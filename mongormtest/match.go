@@ -0,0 +1,339 @@
+package mongormtest
+
+import (
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// match reports whether doc matches the query filter.
+func match(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := matchElement(doc, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchElement reports whether doc matches a single element of a filter,
+// a logical operator or the condition of a field.
+func matchElement(doc bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "$and", "$or", "$nor":
+		filters, ok := e.Value.(bson.A)
+		if !ok || len(filters) == 0 {
+			return false, errorf(codeBadValue, "%s must be a nonempty array", e.Key)
+		}
+		for _, f := range filters {
+			filter, ok := f.(bson.D)
+			if !ok {
+				return false, errorf(codeBadValue, "%s argument's entries must be objects", e.Key)
+			}
+			matched, err := match(doc, filter)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case e.Key == "$and" && !matched:
+				return false, nil
+			case e.Key == "$or" && matched:
+				return true, nil
+			case e.Key == "$nor" && matched:
+				return false, nil
+			}
+		}
+		return e.Key != "$or", nil
+	case "$expr":
+		value, err := evaluate(e.Value, doc, nil)
+		return truthy(value), err
+	case "$comment":
+		return true, nil
+	}
+	if strings.HasPrefix(e.Key, "$") {
+		return false, errorf(codeBadValue, "unknown top level operator: %s", e.Key)
+	}
+
+	values := resolve(doc, split(e.Key))
+	if operators, ok := operatorDocument(e.Value); ok {
+		return matchOperators(values, operators)
+	}
+	return matchEqual(values, e.Value), nil
+}
+
+// operatorDocument returns v as a document of query operators, such as
+// {$gt: 1}, if it is one.
+func operatorDocument(v interface{}) (bson.D, bool) {
+	doc, ok := v.(bson.D)
+	if !ok || len(doc) == 0 || !strings.HasPrefix(doc[0].Key, "$") {
+		return nil, false
+	}
+	return doc, true
+}
+
+// matchOperators reports whether the values of a field, none when it is
+// missing, satisfy every operator of operators.
+func matchOperators(values []interface{}, operators bson.D) (bool, error) {
+	for _, op := range operators {
+		ok, err := matchOperator(values, op, operators)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(values []interface{}, op bson.E, operators bson.D) (bool, error) {
+	switch op.Key {
+	case "$eq":
+		return matchEqual(values, op.Value), nil
+	case "$ne":
+		return !matchEqual(values, op.Value), nil
+	case "$in", "$nin":
+		candidates, ok := op.Value.(bson.A)
+		if !ok {
+			return false, errorf(codeBadValue, "%s needs an array", op.Key)
+		}
+		in := false
+		for _, candidate := range candidates {
+			if matchEqual(values, candidate) {
+				in = true
+				break
+			}
+		}
+		return in == (op.Key == "$in"), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		return anyElement(values, func(v interface{}) bool {
+			if typeOrder(v) != typeOrder(op.Value) {
+				return false
+			}
+			c := compare(v, op.Value)
+			switch op.Key {
+			case "$gt":
+				return c > 0
+			case "$gte":
+				return c >= 0
+			case "$lt":
+				return c < 0
+			}
+			return c <= 0
+		}), nil
+	case "$exists":
+		return (len(values) > 0) == truthy(op.Value), nil
+	case "$type":
+		types, ok := op.Value.(bson.A)
+		if !ok {
+			types = bson.A{op.Value}
+		}
+		return anyElement(values, func(v interface{}) bool {
+			for _, t := range types {
+				if isType(v, t) {
+					return true
+				}
+			}
+			return false
+		}), nil
+	case "$regex":
+		re, err := compileRegex(op.Value, operators)
+		if err != nil {
+			return false, err
+		}
+		return anyElement(values, func(v interface{}) bool {
+			s, ok := v.(string)
+			return ok && re.MatchString(s)
+		}), nil
+	case "$options":
+		if _, ok := get(operators, "$regex"); !ok {
+			return false, errorf(codeBadValue, "$options needs a $regex")
+		}
+		return true, nil
+	case "$not":
+		if re, ok := op.Value.(primitive.Regex); ok {
+			return !matchEqual(values, re), nil
+		}
+		inner, ok := operatorDocument(op.Value)
+		if !ok {
+			return false, errorf(codeBadValue, "$not needs a regex or a document")
+		}
+		matched, err := matchOperators(values, inner)
+		return !matched, err
+	case "$size":
+		n, ok := toInt(op.Value)
+		if !ok {
+			return false, errorf(codeBadValue, "$size needs a number")
+		}
+		for _, v := range values {
+			if array, ok := v.(bson.A); ok && int64(len(array)) == n {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		candidates, ok := op.Value.(bson.A)
+		if !ok {
+			return false, errorf(codeBadValue, "$all needs an array")
+		}
+		if len(candidates) == 0 {
+			return false, nil
+		}
+		for _, candidate := range candidates {
+			if inner, ok := candidate.(bson.D); ok && len(inner) == 1 && inner[0].Key == "$elemMatch" {
+				matched, err := matchOperator(values, inner[0], inner)
+				if err != nil || !matched {
+					return false, err
+				}
+				continue
+			}
+			if !matchEqual(values, candidate) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$elemMatch":
+		condition, ok := op.Value.(bson.D)
+		if !ok {
+			return false, errorf(codeBadValue, "$elemMatch needs an object")
+		}
+		inner, isOperators := operatorDocument(condition)
+		for _, v := range values {
+			array, ok := v.(bson.A)
+			if !ok {
+				continue
+			}
+			for _, elem := range array {
+				var matched bool
+				var err error
+				if isOperators {
+					matched, err = matchOperators([]interface{}{elem}, inner)
+				} else if doc, ok := elem.(bson.D); ok {
+					matched, err = match(doc, condition)
+				}
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$mod":
+		args, ok := op.Value.(bson.A)
+		if !ok || len(args) != 2 {
+			return false, errorf(codeBadValue, "malformed mod, needs to be an array of 2 numbers")
+		}
+		divisor, _ := toInt(args[0])
+		remainder, _ := toInt(args[1])
+		if divisor == 0 {
+			return false, errorf(codeBadValue, "divisor cannot be 0")
+		}
+		return anyElement(values, func(v interface{}) bool {
+			n, _ := toInt(v)
+			return isNumber(v) && n%divisor == remainder
+		}), nil
+	case "$comment":
+		return true, nil
+	}
+	return false, errorf(codeBadValue, "unknown operator: %s", op.Key)
+}
+
+// anyElement reports whether one of values, or of the elements of those
+// that are arrays, satisfies fn.
+func anyElement(values []interface{}, fn func(interface{}) bool) bool {
+	for _, v := range values {
+		if fn(v) {
+			return true
+		}
+		if array, ok := v.(bson.A); ok {
+			for _, elem := range array {
+				if fn(elem) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matchEqual reports whether the values of a field equal x: null matches
+// missing fields, arrays match when one of their elements does and regular
+// expressions match the strings they describe.
+func matchEqual(values []interface{}, x interface{}) bool {
+	if x == nil && len(values) == 0 {
+		return true
+	}
+	if re, ok := x.(primitive.Regex); ok {
+		compiled, err := compileRegex(re, nil)
+		if err != nil {
+			return false
+		}
+		return anyElement(values, func(v interface{}) bool {
+			if s, ok := v.(string); ok {
+				return compiled.MatchString(s)
+			}
+			return equal(v, x)
+		})
+	}
+	return anyElement(values, func(v interface{}) bool {
+		return equal(v, x)
+	})
+}
+
+// compileRegex compiles the pattern of a $regex operator, with the flags of
+// the $options operator among operators.
+func compileRegex(pattern interface{}, operators bson.D) (*regexp.Regexp, error) {
+	var expr, options string
+	switch p := pattern.(type) {
+	case string:
+		expr = p
+	case primitive.Regex:
+		expr, options = p.Pattern, p.Options
+	default:
+		return nil, errorf(codeBadValue, "$regex has to be a string")
+	}
+	if value, ok := get(operators, "$options"); ok {
+		options, _ = value.(string)
+	}
+	var flags string
+	for _, o := range options {
+		switch o {
+		case 'i', 'm', 's':
+			flags += string(o)
+		case 'x', 'u':
+		default:
+			return nil, errorf(codeBadValue, "invalid flag in regex options: %c", o)
+		}
+	}
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errorf(codeBadValue, "invalid regular expression: %v", err)
+	}
+	return re, nil
+}
+
+// typeNumbers maps the numbers of BSON types to their names.
+var typeNumbers = map[int64]string{
+	1: "double", 2: "string", 3: "object", 4: "array", 5: "binData", 6: "undefined",
+	7: "objectId", 8: "bool", 9: "date", 10: "null", 11: "regex", 13: "javascript",
+	14: "symbol", 16: "int", 17: "timestamp", 18: "long", 19: "decimal", -1: "minKey",
+	127: "maxKey",
+}
+
+// isType reports whether v is of the BSON type t, given by name or number.
+func isType(v interface{}, t interface{}) bool {
+	name, ok := t.(string)
+	if !ok {
+		n, _ := toInt(t)
+		name = typeNumbers[n]
+	}
+	if name == "number" {
+		return isNumber(v)
+	}
+	return typeName(v) == name
+}
@@ -0,0 +1,518 @@
+package mongormtest
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// runPipeline runs the aggregation pipeline stages on docs. db resolves the
+// collections of $lookup stages; update pipelines, which only allow the
+// stages reshaping documents, are run with forUpdate set.
+func runPipeline(db *database, docs []bson.D, stages bson.A, forUpdate bool) ([]bson.D, error) {
+	for _, s := range stages {
+		stage, ok := s.(bson.D)
+		if !ok || len(stage) != 1 {
+			return nil, errorf(codeBadValue, "A pipeline stage specification object must contain exactly one field.")
+		}
+		name, arg := stage[0].Key, stage[0].Value
+		if forUpdate {
+			switch name {
+			case "$addFields", "$set", "$project", "$unset", "$replaceRoot", "$replaceWith":
+			default:
+				return nil, errorf(codeInvalidOptions, "%s is not allowed to be used within an update", name)
+			}
+		}
+		var err error
+		if docs, err = runStage(db, docs, name, arg); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func runStage(db *database, docs []bson.D, name string, arg interface{}) ([]bson.D, error) {
+	switch name {
+	case "$match":
+		filter, ok := arg.(bson.D)
+		if !ok {
+			return nil, errorf(codeBadValue, "the match filter must be an expression in an object")
+		}
+		return filterDocuments(docs, filter)
+	case "$sort":
+		spec, ok := arg.(bson.D)
+		if !ok || len(spec) == 0 {
+			return nil, errorf(codeBadValue, "the $sort key specification must be an object")
+		}
+		sortDocuments(docs, spec)
+		return docs, nil
+	case "$skip", "$limit":
+		n, ok := toInt(arg)
+		if !ok || n < 0 || (name == "$limit" && n == 0) {
+			return nil, errorf(codeBadValue, "invalid argument to %s stage: %v", name, arg)
+		}
+		if name == "$skip" {
+			if n >= int64(len(docs)) {
+				return nil, nil
+			}
+			return docs[n:], nil
+		}
+		if n < int64(len(docs)) {
+			docs = docs[:n]
+		}
+		return docs, nil
+	case "$project":
+		spec, ok := arg.(bson.D)
+		if !ok {
+			return nil, errorf(codeBadValue, "$project specification must be an object")
+		}
+		return mapDocuments(docs, func(doc bson.D) (bson.D, error) {
+			return project(doc, spec, true)
+		})
+	case "$addFields", "$set":
+		spec, ok := arg.(bson.D)
+		if !ok {
+			return nil, errorf(codeBadValue, "%s specification stage must be an object", name)
+		}
+		return mapDocuments(docs, func(doc bson.D) (bson.D, error) {
+			return addFields(doc, spec)
+		})
+	case "$unset":
+		var paths []string
+		switch arg := arg.(type) {
+		case string:
+			paths = []string{arg}
+		case bson.A:
+			for _, p := range arg {
+				path, ok := p.(string)
+				if !ok {
+					return nil, errorf(codeBadValue, "$unset specification must be a string or an array of strings")
+				}
+				paths = append(paths, path)
+			}
+		default:
+			return nil, errorf(codeBadValue, "$unset specification must be a string or an array of strings")
+		}
+		spec := bson.D{}
+		for _, path := range paths {
+			spec = append(spec, bson.E{Key: path, Value: int32(0)})
+		}
+		return mapDocuments(docs, func(doc bson.D) (bson.D, error) {
+			return project(doc, spec, true)
+		})
+	case "$replaceRoot", "$replaceWith":
+		expr := arg
+		if name == "$replaceRoot" {
+			spec, _ := arg.(bson.D)
+			expr, _ = get(spec, "newRoot")
+		}
+		return mapDocuments(docs, func(doc bson.D) (bson.D, error) {
+			root, err := evaluateValue(expr, doc, nil)
+			if err != nil {
+				return nil, err
+			}
+			replacement, ok := root.(bson.D)
+			if !ok {
+				return nil, errorf(codeBadValue, "'newRoot' expression must evaluate to an object, but resulting value was of type %s", typeName(root))
+			}
+			return replacement, nil
+		})
+	case "$group":
+		spec, ok := arg.(bson.D)
+		if !ok {
+			return nil, errorf(codeBadValue, "a group's fields must be specified in an object")
+		}
+		return group(docs, spec)
+	case "$count":
+		field, ok := arg.(string)
+		if !ok || field == "" || strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+			return nil, errorf(codeBadValue, "the count field must be a non-empty string without '$' or '.'")
+		}
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []bson.D{{{Key: field, Value: int32(len(docs))}}}, nil
+	case "$sortByCount":
+		grouped, err := group(docs, bson.D{{Key: "_id", Value: arg}, {Key: "count", Value: bson.D{{Key: "$sum", Value: int32(1)}}}})
+		if err != nil {
+			return nil, err
+		}
+		sortDocuments(grouped, bson.D{{Key: "count", Value: int32(-1)}})
+		return grouped, nil
+	case "$unwind":
+		return unwind(docs, arg)
+	case "$lookup":
+		spec, ok := arg.(bson.D)
+		if !ok {
+			return nil, errorf(codeBadValue, "the $lookup specification must be an object")
+		}
+		return lookupStage(db, docs, spec)
+	case "$facet":
+		spec, ok := arg.(bson.D)
+		if !ok {
+			return nil, errorf(codeBadValue, "the $facet specification must be an object")
+		}
+		result := bson.D{}
+		for _, facet := range spec {
+			stages, ok := facet.Value.(bson.A)
+			if !ok {
+				return nil, errorf(codeBadValue, "arguments to $facet must be arrays")
+			}
+			input := make([]bson.D, len(docs))
+			copy(input, docs)
+			output, err := runPipeline(db, input, stages, false)
+			if err != nil {
+				return nil, err
+			}
+			values := bson.A{}
+			for _, doc := range output {
+				values = append(values, doc)
+			}
+			result = append(result, bson.E{Key: facet.Key, Value: values})
+		}
+		return []bson.D{result}, nil
+	case "$sample":
+		spec, _ := arg.(bson.D)
+		size, _ := toInt(lookupOr(spec, "size", int32(0)))
+		shuffled := make([]bson.D, len(docs))
+		copy(shuffled, docs)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		if size < int64(len(shuffled)) {
+			shuffled = shuffled[:size]
+		}
+		return shuffled, nil
+	case "$changeStream":
+		return nil, errorf(codeCommandNotSupported, "mongormtest does not support change streams")
+	}
+	return nil, errorf(codeUnrecognizedStage, "Unrecognized pipeline stage name: '%s'", name)
+}
+
+// lookupOr returns the value of key in doc, or fallback.
+func lookupOr(doc bson.D, key string, fallback interface{}) interface{} {
+	if v, ok := get(doc, key); ok {
+		return v
+	}
+	return fallback
+}
+
+// filterDocuments returns the documents of docs matching filter.
+func filterDocuments(docs []bson.D, filter bson.D) ([]bson.D, error) {
+	var matched []bson.D
+	for _, doc := range docs {
+		ok, err := match(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, doc)
+		}
+	}
+	return matched, nil
+}
+
+// mapDocuments returns the results of fn for each document of docs.
+func mapDocuments(docs []bson.D, fn func(bson.D) (bson.D, error)) ([]bson.D, error) {
+	result := make([]bson.D, len(docs))
+	for i, doc := range docs {
+		var err error
+		if result[i], err = fn(doc); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// sortDocuments sorts docs by the sort specification spec, stably.
+func sortDocuments(docs []bson.D, spec bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return compareBy(docs[i], docs[j], spec) < 0
+	})
+}
+
+// compareBy orders a and b by the sort specification spec.
+func compareBy(a, b bson.D, spec bson.D) int {
+	for _, e := range spec {
+		direction := 1
+		if n, ok := toInt(e.Value); ok && n < 0 {
+			direction = -1
+		}
+		path := split(e.Key)
+		if c := compare(sortKey(a, path, direction), sortKey(b, path, direction)); c != 0 {
+			return c * direction
+		}
+	}
+	return 0
+}
+
+// sortKey returns the value doc is sorted by for path: the smallest of
+// the values at path, or of the elements of arrays among them, when
+// sorting in ascending order, and the largest otherwise.
+func sortKey(doc bson.D, path []string, direction int) interface{} {
+	var key interface{}
+	found := false
+	for _, v := range resolve(doc, path) {
+		candidates := []interface{}{v}
+		if array, ok := v.(bson.A); ok && len(array) > 0 {
+			candidates = array
+		}
+		for _, candidate := range candidates {
+			if !found || compare(candidate, key)*direction < 0 {
+				key, found = candidate, true
+			}
+		}
+	}
+	return key
+}
+
+// addFields returns doc with the fields of spec set to the values of their
+// expressions.
+func addFields(doc bson.D, spec bson.D) (bson.D, error) {
+	var result interface{} = deepCopy(doc)
+	for _, e := range spec {
+		value, err := evaluate(e.Value, doc, nil)
+		if err != nil {
+			return nil, err
+		}
+		if nested, ok := e.Value.(bson.D); ok && len(nested) > 0 && !strings.HasPrefix(nested[0].Key, "$") {
+			// Nested specifications add to the existing document.
+			existing, _ := get(result.(bson.D), e.Key)
+			if existingDoc, ok := existing.(bson.D); ok {
+				if value, err = addFields(existingDoc, nested); err != nil {
+					return nil, err
+				}
+			}
+		}
+		switch value.(type) {
+		case missingValue:
+			continue
+		case removeValue:
+			result, err = (&updater{}).modify(result, split(e.Key), nil, false, func(interface{}, bool) (interface{}, bool, error) {
+				return nil, true, nil
+			})
+		default:
+			result, err = (&updater{}).modify(result, split(e.Key), nil, true, func(interface{}, bool) (interface{}, bool, error) {
+				return value, false, nil
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result.(bson.D), nil
+}
+
+// group runs a $group stage.
+func group(docs []bson.D, spec bson.D) ([]bson.D, error) {
+	idExpr, ok := get(spec, "_id")
+	if !ok {
+		return nil, errorf(codeBadValue, "a group specification must include an _id")
+	}
+	type groupState struct {
+		id           interface{}
+		accumulators []*accumulator
+	}
+	var groups []*groupState
+	for _, doc := range docs {
+		id, err := evaluateValue(idExpr, doc, nil)
+		if err != nil {
+			return nil, err
+		}
+		var g *groupState
+		for _, existing := range groups {
+			if compare(existing.id, id) == 0 {
+				g = existing
+				break
+			}
+		}
+		if g == nil {
+			g = &groupState{id: id}
+			for _, field := range spec {
+				if field.Key == "_id" {
+					continue
+				}
+				operator, ok := operatorDocument(field.Value)
+				if !ok || len(operator) != 1 {
+					return nil, errorf(codeBadValue, "the group aggregate field '%s' must be defined as an expression inside an object", field.Key)
+				}
+				switch operator[0].Key {
+				case "$sum", "$avg", "$min", "$max", "$first", "$last", "$push", "$addToSet", "$count":
+				default:
+					return nil, errorf(codeBadValue, "unknown group operator '%s'", operator[0].Key)
+				}
+				g.accumulators = append(g.accumulators, newAccumulator(operator[0].Key))
+			}
+			groups = append(groups, g)
+		}
+		i := 0
+		for _, field := range spec {
+			if field.Key == "_id" {
+				continue
+			}
+			operator, _ := operatorDocument(field.Value)
+			value, err := evaluate(operator[0].Value, doc, nil)
+			if err != nil {
+				return nil, err
+			}
+			if _, missing := value.(missingValue); missing {
+				if operator[0].Key == "$push" || operator[0].Key == "$addToSet" {
+					i++
+					continue
+				}
+				value = nil
+			}
+			g.accumulators[i].add(value)
+			i++
+		}
+	}
+
+	result := make([]bson.D, len(groups))
+	for i, g := range groups {
+		doc := bson.D{{Key: "_id", Value: g.id}}
+		j := 0
+		for _, field := range spec {
+			if field.Key == "_id" {
+				continue
+			}
+			doc = append(doc, bson.E{Key: field.Key, Value: g.accumulators[j].result()})
+			j++
+		}
+		result[i] = doc
+	}
+	return result, nil
+}
+
+// unwind runs an $unwind stage.
+func unwind(docs []bson.D, arg interface{}) ([]bson.D, error) {
+	var path, indexField string
+	preserve := false
+	switch arg := arg.(type) {
+	case string:
+		path = arg
+	case bson.D:
+		path, _ = lookupOr(arg, "path", "").(string)
+		preserve = truthy(lookupOr(arg, "preserveNullAndEmptyArrays", false))
+		indexField, _ = lookupOr(arg, "includeArrayIndex", "").(string)
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, errorf(codeBadValue, "path option to $unwind stage should be prefixed with a '$': %s", path)
+	}
+	parts := split(path[1:])
+
+	var result []bson.D
+	for _, doc := range docs {
+		value, exists := lookupDocument(doc, parts)
+		array, isArray := value.(bson.A)
+		if !isArray || len(array) == 0 {
+			if isArray || !exists || value == nil {
+				if preserve {
+					unwound := deepCopy(doc).(bson.D)
+					if isArray {
+						unwound, _ = setPath(unwound, parts, nil, true)
+					}
+					if indexField != "" {
+						unwound = set(unwound, indexField, nil)
+					}
+					result = append(result, unwound)
+				}
+				continue
+			}
+			// Non-array values are treated as single element arrays.
+			array = bson.A{value}
+		}
+		for i, elem := range array {
+			unwound, err := setPath(deepCopy(doc).(bson.D), parts, elem, false)
+			if err != nil {
+				return nil, err
+			}
+			if indexField != "" {
+				unwound = set(unwound, indexField, int64(i))
+			}
+			result = append(result, unwound)
+		}
+	}
+	return result, nil
+}
+
+// setPath returns doc with the value at path set to value, or removed when
+// unset is set.
+func setPath(doc bson.D, path []string, value interface{}, unset bool) (bson.D, error) {
+	v, err := (&updater{}).modify(doc, path, nil, !unset, func(interface{}, bool) (interface{}, bool, error) {
+		return value, unset, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(bson.D), nil
+}
+
+// lookupStage runs a $lookup stage.
+func lookupStage(db *database, docs []bson.D, spec bson.D) ([]bson.D, error) {
+	from, _ := lookupOr(spec, "from", "").(string)
+	as, _ := lookupOr(spec, "as", "").(string)
+	localField, _ := lookupOr(spec, "localField", "").(string)
+	foreignField, _ := lookupOr(spec, "foreignField", "").(string)
+	pipeline, _ := lookupOr(spec, "pipeline", bson.A{}).(bson.A)
+	let, _ := lookupOr(spec, "let", bson.D{}).(bson.D)
+	if as == "" || (localField == "") != (foreignField == "") {
+		return nil, errorf(codeFailedToParse, "$lookup requires 'as', and either both or none of 'localField' and 'foreignField'")
+	}
+	if localField == "" && len(let) > 0 {
+		return nil, errorf(codeCommandNotSupported, "mongormtest does not support $lookup with let")
+	}
+
+	var foreign []bson.D
+	if db != nil {
+		if c, ok := db.collections[from]; ok {
+			foreign = c.documents
+		}
+	}
+	result := make([]bson.D, len(docs))
+	for i, doc := range docs {
+		var joined []bson.D
+		if localField == "" {
+			joined = append(joined, foreign...)
+		} else {
+			locals := resolve(doc, split(localField))
+			if len(locals) == 0 {
+				locals = []interface{}{nil}
+			}
+			for _, other := range foreign {
+				foreignValues := resolve(other, split(foreignField))
+				for _, local := range locals {
+					candidates := []interface{}{local}
+					if array, ok := local.(bson.A); ok {
+						candidates = array
+					}
+					matched := false
+					for _, candidate := range candidates {
+						if matchEqual(foreignValues, candidate) {
+							matched = true
+							break
+						}
+					}
+					if matched {
+						joined = append(joined, other)
+						break
+					}
+				}
+			}
+		}
+		if len(pipeline) > 0 {
+			var err error
+			if joined, err = runPipeline(db, joined, pipeline, false); err != nil {
+				return nil, err
+			}
+		}
+		values := bson.A{}
+		for _, doc := range joined {
+			values = append(values, deepCopy(doc))
+		}
+		var err error
+		if result[i], err = setPath(deepCopy(doc).(bson.D), split(as), values, false); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
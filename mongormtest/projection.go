@@ -0,0 +1,274 @@
+package mongormtest
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// projectionNode is a field of a projection, and of the projected document.
+type projectionNode struct {
+	// include and exclude are set for fields projected with 1 or 0.
+	include, exclude bool
+	// expr is the expression of computed fields.
+	expr     interface{}
+	computed bool
+	// slice is the argument of a $slice find projection.
+	slice    interface{}
+	children map[string]*projectionNode
+	order    []string
+}
+
+func (n *projectionNode) child(name string) *projectionNode {
+	if n.children == nil {
+		n.children = map[string]*projectionNode{}
+	}
+	child, ok := n.children[name]
+	if !ok {
+		child = &projectionNode{}
+		n.children[name] = child
+		n.order = append(n.order, name)
+	}
+	return child
+}
+
+// hasComputed reports whether n or a field below it is computed.
+func (n *projectionNode) hasComputed() bool {
+	if n.computed {
+		return true
+	}
+	for _, child := range n.children {
+		if child.hasComputed() {
+			return true
+		}
+	}
+	return false
+}
+
+// project returns doc projected by spec, a find projection or the
+// specification of a $project stage when aggregation is set. Both include
+// or exclude fields, and compute others from aggregation expressions.
+func project(doc bson.D, spec bson.D, aggregation bool) (bson.D, error) {
+	root := &projectionNode{}
+	inclusion, exclusion := false, false
+	includeID, excludeID := false, false
+	var parse func(node *projectionNode, prefix string, spec bson.D) error
+	parse = func(node *projectionNode, prefix string, spec bson.D) error {
+		for _, e := range spec {
+			path := prefix + e.Key
+			parts := split(e.Key)
+			field := node
+			for _, part := range parts {
+				field = field.child(part)
+			}
+			switch v := e.Value.(type) {
+			case bool, int32, int64, float64:
+				if truthy(v) {
+					field.include = true
+					if path == "_id" {
+						includeID = true
+					} else {
+						inclusion = true
+					}
+				} else {
+					field.exclude = true
+					if path == "_id" {
+						excludeID = true
+					} else {
+						exclusion = true
+					}
+				}
+				continue
+			case bson.D:
+				if len(v) > 0 && !strings.HasPrefix(v[0].Key, "$") {
+					if err := parse(field, path+".", v); err != nil {
+						return err
+					}
+					continue
+				}
+				if len(v) == 1 && v[0].Key == "$slice" && !aggregation {
+					field.slice = v[0].Value
+					continue
+				}
+			}
+			field.expr, field.computed = e.Value, true
+			inclusion = true
+		}
+		return nil
+	}
+	if err := parse(root, "", spec); err != nil {
+		return nil, err
+	}
+	if inclusion && exclusion {
+		return nil, errorf(codeProjectionConflict, "Cannot do exclusion on a field in inclusion projection")
+	}
+	// {_id: 1} alone includes only _id.
+	inclusion = inclusion || includeID && !exclusion
+
+	var result bson.D
+	if inclusion {
+		if !excludeID {
+			if id := root.child("_id"); !id.computed {
+				id.include = true
+			}
+		}
+		var err error
+		if result, err = includeFields(doc, root, doc); err != nil {
+			return nil, err
+		}
+	} else {
+		result = excludeFields(doc, root)
+	}
+	return applySlices(result, root), nil
+}
+
+// includeFields returns the fields of v included by node, followed by the
+// fields it computes from root.
+func includeFields(v bson.D, node *projectionNode, root bson.D) (bson.D, error) {
+	result := bson.D{}
+	for _, e := range v {
+		child, ok := node.children[e.Key]
+		if !ok || child.computed || child.exclude {
+			continue
+		}
+		switch {
+		case child.include || (child.slice != nil && child.children == nil):
+			result = append(result, bson.E{Key: e.Key, Value: deepCopy(e.Value)})
+		case child.children != nil:
+			switch value := e.Value.(type) {
+			case bson.D:
+				nested, err := includeFields(value, child, root)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, bson.E{Key: e.Key, Value: nested})
+			case bson.A:
+				array := bson.A{}
+				for _, elem := range value {
+					if doc, ok := elem.(bson.D); ok {
+						nested, err := includeFields(doc, child, root)
+						if err != nil {
+							return nil, err
+						}
+						array = append(array, nested)
+					}
+				}
+				result = append(result, bson.E{Key: e.Key, Value: array})
+			}
+		}
+	}
+	for _, name := range node.order {
+		child := node.children[name]
+		switch {
+		case child.computed:
+			value, err := evaluate(child.expr, root, nil)
+			if err != nil {
+				return nil, err
+			}
+			switch value.(type) {
+			case missingValue, removeValue:
+				continue
+			}
+			result = set(result, name, value)
+		case child.children != nil && child.hasComputed():
+			if _, ok := get(result, name); ok {
+				continue
+			}
+			nested, err := includeFields(bson.D{}, child, root)
+			if err != nil {
+				return nil, err
+			}
+			if len(nested) > 0 {
+				result = append(result, bson.E{Key: name, Value: nested})
+			}
+		}
+	}
+	return result, nil
+}
+
+// excludeFields returns v without the fields excluded by node.
+func excludeFields(v bson.D, node *projectionNode) bson.D {
+	result := bson.D{}
+	for _, e := range v {
+		child, ok := node.children[e.Key]
+		switch {
+		case !ok:
+			result = append(result, bson.E{Key: e.Key, Value: deepCopy(e.Value)})
+		case child.exclude:
+		case child.children != nil:
+			switch value := e.Value.(type) {
+			case bson.D:
+				result = append(result, bson.E{Key: e.Key, Value: excludeFields(value, child)})
+			case bson.A:
+				array := bson.A{}
+				for _, elem := range value {
+					if doc, ok := elem.(bson.D); ok {
+						elem = excludeFields(doc, child)
+					}
+					array = append(array, elem)
+				}
+				result = append(result, bson.E{Key: e.Key, Value: array})
+			default:
+				result = append(result, e)
+			}
+		default:
+			result = append(result, bson.E{Key: e.Key, Value: deepCopy(e.Value)})
+		}
+	}
+	return result
+}
+
+// applySlices applies the $slice projections of node to v.
+func applySlices(v bson.D, node *projectionNode) bson.D {
+	for i, e := range v {
+		child, ok := node.children[e.Key]
+		if !ok {
+			continue
+		}
+		if child.slice != nil {
+			if array, ok := e.Value.(bson.A); ok {
+				v[i].Value = sliceArray(array, child.slice)
+			}
+		}
+		if child.children != nil {
+			if doc, ok := e.Value.(bson.D); ok {
+				v[i].Value = applySlices(doc, child)
+			}
+		}
+	}
+	return v
+}
+
+// sliceArray returns the elements of array selected by the argument of
+// $slice: a count, negative to count from the end, or a skip and a count.
+func sliceArray(array bson.A, arg interface{}) bson.A {
+	skip, count := int64(0), int64(len(array))
+	switch arg := arg.(type) {
+	case bson.A:
+		if len(arg) == 2 {
+			skip, _ = toInt(arg[0])
+			count, _ = toInt(arg[1])
+		}
+	default:
+		n, _ := toInt(arg)
+		if n < 0 {
+			skip, count = n, -n
+		} else {
+			count = n
+		}
+	}
+	if skip < 0 {
+		skip += int64(len(array))
+		if skip < 0 {
+			skip = 0
+		}
+	}
+	if skip > int64(len(array)) {
+		skip = int64(len(array))
+	}
+	end := skip + count
+	if end > int64(len(array)) {
+		end = int64(len(array))
+	}
+	return array[skip:end]
+}
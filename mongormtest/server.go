@@ -0,0 +1,266 @@
+// Package mongormtest provides an in-memory MongoDB server, so that code
+// using mongorm can be unit tested without a live database:
+//
+//	func TestSignup(t *testing.T) {
+//		orm := mongormtest.New()
+//		svc := NewService(orm)
+//		if err := svc.Signup(ctx, "alice@example.com"); err != nil {
+//			t.Fatal(err)
+//		}
+//		var user User
+//		if err := orm.Where("email = ?", "alice@example.com").First(&user).Error; err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+//
+// The server sits behind a regular *mongo.Client, answering the commands
+// the driver sends, so the whole mongorm API works on it, as does code using
+// the driver directly. Filters, updates and aggregation pipelines are
+// evaluated in memory with the common operators, including all those mongorm
+// emits; unique indexes are enforced and transactions are rolled back when
+// aborted. Other operators fail with the errors the server returns for
+// unknown ones, and change streams, text and geospatial queries and schema
+// validation are not supported. Collations are accepted but ignored, strings
+// comparing by their bytes.
+package mongormtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/address"
+	"go.mongodb.org/mongo-driver/mongo/description"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/wiremessage"
+)
+
+// New returns a MongoORM on the "test" database of a new Server.
+func New(config ...*mongorm.Config) *mongorm.MongoORM {
+	return NewServer().ORM("test", config...)
+}
+
+// Server is an in-memory MongoDB server. It is safe for concurrent use.
+type Server struct {
+	mu        sync.Mutex
+	databases map[string]*database
+	cursors   map[int64]*cursor
+	lastID    int64
+	// transactions holds, by session, the databases as they were when the
+	// running transaction of the session started.
+	transactions map[string]map[string]*database
+}
+
+// NewServer returns an empty Server.
+func NewServer() *Server {
+	return &Server{
+		databases:    map[string]*database{},
+		cursors:      map[int64]*cursor{},
+		transactions: map[string]map[string]*database{},
+	}
+}
+
+// Client returns a connected client of s.
+func (s *Server) Client() *mongo.Client {
+	opts := options.Client()
+	opts.Deployment = &deployment{server: s}
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		// Connecting to the deployment does not do any I/O.
+		panic(fmt.Sprintf("mongormtest: %v", err))
+	}
+	return client
+}
+
+// ORM returns a MongoORM on database of s.
+func (s *Server) ORM(database string, config ...*mongorm.Config) *mongorm.MongoORM {
+	return mongorm.NewMongoORM(s.Client(), database, config...)
+}
+
+// Reset drops every database of s.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.databases = map[string]*database{}
+	s.cursors = map[int64]*cursor{}
+	s.transactions = map[string]map[string]*database{}
+}
+
+const serverAddress = address.Address("mongormtest:27017")
+
+var sessionTimeoutMinutes int64 = 30
+
+// serverDescription describes the server as the primary of a replica set
+// running MongoDB 7.0, so that the driver uses sessions and transactions.
+var serverDescription = description.Server{
+	Addr:                     serverAddress,
+	CanonicalAddr:            serverAddress,
+	Kind:                     description.RSPrimary,
+	MaxDocumentSize:          16 * 1024 * 1024,
+	MaxMessageSize:           48000000,
+	MaxBatchCount:            100000,
+	SessionTimeoutMinutes:    uint32(sessionTimeoutMinutes),
+	SessionTimeoutMinutesPtr: &sessionTimeoutMinutes,
+	WireVersion:              &description.VersionRange{Min: 0, Max: 21},
+}
+
+// deployment connects the driver to a Server.
+type deployment struct {
+	server  *Server
+	updates chan description.Topology
+}
+
+var (
+	_ driver.Deployment   = &deployment{}
+	_ driver.Server       = &deployment{}
+	_ driver.Connector    = &deployment{}
+	_ driver.Disconnector = &deployment{}
+	_ driver.Subscriber   = &deployment{}
+)
+
+func (d *deployment) SelectServer(context.Context, description.ServerSelector) (driver.Server, error) {
+	return d, nil
+}
+
+func (d *deployment) Kind() description.TopologyKind {
+	return description.ReplicaSetWithPrimary
+}
+
+func (d *deployment) Connection(context.Context) (driver.Connection, error) {
+	return &connection{server: d.server}, nil
+}
+
+func (d *deployment) RTTMonitor() driver.RTTMonitor {
+	return rttMonitor{}
+}
+
+func (d *deployment) Connect() error {
+	return nil
+}
+
+func (d *deployment) Disconnect(context.Context) error {
+	return nil
+}
+
+// Subscribe reports the topology once, which tells the driver that the
+// server supports sessions.
+func (d *deployment) Subscribe() (*driver.Subscription, error) {
+	updates := make(chan description.Topology, 1)
+	updates <- description.Topology{
+		Kind:                     description.ReplicaSetWithPrimary,
+		Servers:                  []description.Server{serverDescription},
+		SessionTimeoutMinutes:    uint32(sessionTimeoutMinutes),
+		SessionTimeoutMinutesPtr: &sessionTimeoutMinutes,
+	}
+	return &driver.Subscription{Updates: updates}, nil
+}
+
+func (d *deployment) Unsubscribe(*driver.Subscription) error {
+	return nil
+}
+
+type rttMonitor struct{}
+
+func (rttMonitor) EWMA() time.Duration { return 0 }
+func (rttMonitor) Min() time.Duration  { return 0 }
+func (rttMonitor) P90() time.Duration  { return 0 }
+func (rttMonitor) Stats() string       { return "" }
+
+// connection runs the commands written to it on its server and holds the
+// reply until it is read.
+type connection struct {
+	server *Server
+	reply  []byte
+}
+
+var _ driver.Connection = &connection{}
+
+func (c *connection) WriteWireMessage(_ context.Context, wm []byte) error {
+	_, requestID, _, opcode, rem, ok := wiremessage.ReadHeader(wm)
+	if !ok || opcode != wiremessage.OpMsg {
+		return fmt.Errorf("mongormtest: unsupported wire message")
+	}
+	flags, rem, ok := wiremessage.ReadMsgFlags(rem)
+	if !ok {
+		return fmt.Errorf("mongormtest: malformed wire message")
+	}
+	if flags&wiremessage.ChecksumPresent != 0 {
+		rem = rem[:len(rem)-4]
+	}
+
+	// The command is the body section, to which document sequences, such
+	// as the documents of an insert, are added as arrays.
+	var command bson.D
+	for len(rem) > 0 {
+		var stype wiremessage.SectionType
+		stype, rem, ok = wiremessage.ReadMsgSectionType(rem)
+		if !ok {
+			return fmt.Errorf("mongormtest: malformed wire message")
+		}
+		switch stype {
+		case wiremessage.SingleDocument:
+			var doc bsoncore.Document
+			if doc, rem, ok = wiremessage.ReadMsgSectionSingleDocument(rem); !ok {
+				return fmt.Errorf("mongormtest: malformed wire message")
+			}
+			var body bson.D
+			if err := bson.Unmarshal(doc, &body); err != nil {
+				return err
+			}
+			command = append(body, command...)
+		case wiremessage.DocumentSequence:
+			var identifier string
+			var docs []bsoncore.Document
+			if identifier, docs, rem, ok = wiremessage.ReadMsgSectionDocumentSequence(rem); !ok {
+				return fmt.Errorf("mongormtest: malformed wire message")
+			}
+			values := bson.A{}
+			for _, doc := range docs {
+				var value bson.D
+				if err := bson.Unmarshal(doc, &value); err != nil {
+					return err
+				}
+				values = append(values, value)
+			}
+			command = append(command, bson.E{Key: identifier, Value: values})
+		}
+	}
+
+	reply, err := bson.Marshal(c.server.run(command))
+	if err != nil {
+		return err
+	}
+	if flags&wiremessage.MoreToCome != 0 {
+		// Unacknowledged writes expect no reply.
+		return nil
+	}
+	idx, dst := wiremessage.AppendHeaderStart(nil, wiremessage.NextRequestID(), requestID, wiremessage.OpMsg)
+	dst = wiremessage.AppendMsgFlags(dst, 0)
+	dst = wiremessage.AppendMsgSectionType(dst, wiremessage.SingleDocument)
+	dst = append(dst, reply...)
+	c.reply = bsoncore.UpdateLength(dst, idx, int32(len(dst[idx:])))
+	return nil
+}
+
+func (c *connection) ReadWireMessage(context.Context) ([]byte, error) {
+	if c.reply == nil {
+		return nil, fmt.Errorf("mongormtest: no reply to read")
+	}
+	reply := c.reply
+	c.reply = nil
+	return reply, nil
+}
+
+func (c *connection) Description() description.Server { return serverDescription }
+func (c *connection) Close() error                    { return nil }
+func (c *connection) ID() string                      { return "mongormtest" }
+func (c *connection) ServerConnectionID() *int64      { return nil }
+func (c *connection) DriverConnectionID() uint64      { return 0 }
+func (c *connection) Address() address.Address        { return serverAddress }
+func (c *connection) Stale() bool                     { return false }
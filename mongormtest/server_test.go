@@ -0,0 +1,420 @@
+package mongormtest_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// people are the documents queried by the tests.
+var people = []interface{}{
+	bson.M{"_id": 1, "name": "ann", "age": 30, "tags": bson.A{"go", "db"}, "address": bson.M{"city": "Oslo"}},
+	bson.M{"_id": 2, "name": "bob", "age": 25, "tags": bson.A{"go"}, "address": bson.M{"city": "Rome"}},
+	bson.M{"_id": 3, "name": "cy", "age": 35, "tags": bson.A{}, "nickname": nil},
+	bson.M{"_id": 4, "name": "dee", "items": bson.A{bson.M{"sku": "a", "qty": 1}, bson.M{"sku": "b", "qty": 5}}},
+}
+
+func newCollection(t *testing.T, docs ...interface{}) *mongo.Collection {
+	t.Helper()
+	collection := mongormtest.NewServer().Client().Database("test").Collection("people")
+	if len(docs) > 0 {
+		if _, err := collection.InsertMany(context.Background(), docs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return collection
+}
+
+// ids returns the _id of the documents matching filter, in order.
+func ids(t *testing.T, collection *mongo.Collection, filter interface{}) []int32 {
+	t.Helper()
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []struct {
+		ID int32 `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		t.Fatal(err)
+	}
+	found := []int32{}
+	for _, doc := range docs {
+		found = append(found, doc.ID)
+	}
+	return found
+}
+
+func TestFindMatchesFilters(t *testing.T) {
+	collection := newCollection(t, people...)
+	tests := []struct {
+		name   string
+		filter bson.M
+		want   []int32
+	}{
+		{"empty", bson.M{}, []int32{1, 2, 3, 4}},
+		{"equality", bson.M{"name": "bob"}, []int32{2}},
+		{"comparison", bson.M{"age": bson.M{"$gt": 28}}, []int32{1, 3}},
+		{"range", bson.M{"age": bson.M{"$gte": 25, "$lt": 35}}, []int32{1, 2}},
+		{"not equal matches missing", bson.M{"age": bson.M{"$ne": 30}}, []int32{2, 3, 4}},
+		{"array element", bson.M{"tags": "go"}, []int32{1, 2}},
+		{"all", bson.M{"tags": bson.M{"$all": bson.A{"go", "db"}}}, []int32{1}},
+		{"size", bson.M{"tags": bson.M{"$size": 0}}, []int32{3}},
+		{"nested field", bson.M{"address.city": "Rome"}, []int32{2}},
+		{"in", bson.M{"name": bson.M{"$in": bson.A{"ann", "dee"}}}, []int32{1, 4}},
+		{"not in", bson.M{"name": bson.M{"$nin": bson.A{"ann", "dee"}}}, []int32{2, 3}},
+		{"missing", bson.M{"age": bson.M{"$exists": false}}, []int32{4}},
+		{"null matches missing", bson.M{"nickname": nil}, []int32{1, 2, 3, 4}},
+		{"null exists", bson.M{"nickname": bson.M{"$exists": true}}, []int32{3}},
+		{"or", bson.M{"$or": bson.A{bson.M{"name": "ann"}, bson.M{"age": bson.M{"$lt": 30}}}}, []int32{1, 2}},
+		{"nor", bson.M{"$nor": bson.A{bson.M{"name": "ann"}, bson.M{"age": bson.M{"$lt": 30}}}}, []int32{3, 4}},
+		{"not matches missing", bson.M{"age": bson.M{"$not": bson.M{"$gt": 28}}}, []int32{2, 4}},
+		{"regex", bson.M{"name": bson.M{"$regex": "^d"}}, []int32{4}},
+		{"regex options", bson.M{"name": primitive.Regex{Pattern: "^A", Options: "i"}}, []int32{1}},
+		{"elemMatch", bson.M{"items": bson.M{"$elemMatch": bson.M{"sku": "b", "qty": bson.M{"$gt": 3}}}}, []int32{4}},
+		{"array path", bson.M{"items.qty": bson.M{"$gt": 3}}, []int32{4}},
+		{"type", bson.M{"nickname": bson.M{"$type": "null"}}, []int32{3}},
+		{"mod", bson.M{"age": bson.M{"$mod": bson.A{10, 5}}}, []int32{2, 3}},
+		{"expr", bson.M{"$expr": bson.M{"$gt": bson.A{"$age", 30}}}, []int32{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(t, collection, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAppliesOptions(t *testing.T) {
+	collection := newCollection(t, people...)
+	ctx := context.Background()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "age", Value: -1}}).
+		SetSkip(1).
+		SetLimit(2).
+		SetProjection(bson.M{"name": 1, "_id": 0})
+	cursor, err := collection.Find(ctx, bson.M{"age": bson.M{"$exists": true}}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		t.Fatal(err)
+	}
+	want := []bson.M{{"name": "ann"}, {"name": "bob"}}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("found %v, want %v", docs, want)
+	}
+
+	cursor, err = collection.Find(ctx, bson.M{"name": "ann"}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []bson.M
+	if err := cursor.All(ctx, &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || len(ids[0]) != 1 || ids[0]["_id"] == nil {
+		t.Fatalf("found %v, want the _id of ann only", ids)
+	}
+}
+
+func TestUpdateAppliesOperators(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    bson.M
+		update bson.M
+		want   bson.M
+	}{
+		{
+			"set nested",
+			bson.M{"_id": 1},
+			bson.M{"$set": bson.M{"address.city": "Oslo"}},
+			bson.M{"_id": int32(1), "address": bson.M{"city": "Oslo"}},
+		},
+		{
+			"unset",
+			bson.M{"_id": 1, "a": 1, "b": 2},
+			bson.M{"$unset": bson.M{"a": ""}},
+			bson.M{"_id": int32(1), "b": int32(2)},
+		},
+		{
+			"inc and mul",
+			bson.M{"_id": 1, "n": 2, "m": 3},
+			bson.M{"$inc": bson.M{"n": 5, "missing": 1}, "$mul": bson.M{"m": 2}},
+			bson.M{"_id": int32(1), "n": int32(7), "m": int32(6), "missing": int32(1)},
+		},
+		{
+			"min and max",
+			bson.M{"_id": 1, "lo": 5, "hi": 5},
+			bson.M{"$min": bson.M{"lo": 3}, "$max": bson.M{"hi": 3}},
+			bson.M{"_id": int32(1), "lo": int32(3), "hi": int32(5)},
+		},
+		{
+			"push each and addToSet",
+			bson.M{"_id": 1, "a": bson.A{1}, "s": bson.A{"x"}},
+			bson.M{"$push": bson.M{"a": bson.M{"$each": bson.A{2, 3}}}, "$addToSet": bson.M{"s": "x"}},
+			bson.M{"_id": int32(1), "a": bson.A{int32(1), int32(2), int32(3)}, "s": bson.A{"x"}},
+		},
+		{
+			"pull condition",
+			bson.M{"_id": 1, "a": bson.A{1, 5, 8}},
+			bson.M{"$pull": bson.M{"a": bson.M{"$gte": 5}}},
+			bson.M{"_id": int32(1), "a": bson.A{int32(1)}},
+		},
+		{
+			"pop",
+			bson.M{"_id": 1, "a": bson.A{1, 2, 3}},
+			bson.M{"$pop": bson.M{"a": -1}},
+			bson.M{"_id": int32(1), "a": bson.A{int32(2), int32(3)}},
+		},
+		{
+			"rename",
+			bson.M{"_id": 1, "old": "v"},
+			bson.M{"$rename": bson.M{"old": "new"}},
+			bson.M{"_id": int32(1), "new": "v"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := newCollection(t, tt.doc)
+			ctx := context.Background()
+			if _, err := collection.UpdateOne(ctx, bson.M{"_id": 1}, tt.update); err != nil {
+				t.Fatal(err)
+			}
+			var got bson.M
+			if err := collection.FindOne(ctx, bson.M{"_id": 1}).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("updated document = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateResolvesPositionalOperators(t *testing.T) {
+	doc := bson.M{"_id": 1, "items": bson.A{
+		bson.M{"sku": "a", "qty": 1},
+		bson.M{"sku": "b", "qty": 5},
+	}}
+	collection := newCollection(t, doc)
+	ctx := context.Background()
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": 1, "items.sku": "b"}, bson.M{"$inc": bson.M{"items.$.qty": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": 1},
+		bson.M{"$set": bson.M{"items.$[low].sku": "z"}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"low.qty": bson.M{"$lt": 2}}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Items []struct {
+			SKU string `bson:"sku"`
+			Qty int    `bson:"qty"`
+		} `bson:"items"`
+	}
+	if err := collection.FindOne(ctx, bson.M{"_id": 1}).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Items) != 2 || got.Items[0].SKU != "z" || got.Items[1].Qty != 6 {
+		t.Fatalf("items = %+v, want a renamed z and b incremented to 6", got.Items)
+	}
+}
+
+func TestUpdateUpserts(t *testing.T) {
+	collection := newCollection(t)
+	ctx := context.Background()
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"name": "ann"},
+		bson.M{"$set": bson.M{"age": 30}, "$setOnInsert": bson.M{"created": true}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UpsertedCount != 1 || result.UpsertedID == nil {
+		t.Fatalf("result = %+v, want one upsert", result)
+	}
+	var got bson.M
+	if err := collection.FindOne(ctx, bson.M{"name": "ann"}).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["age"] != int32(30) || got["created"] != true {
+		t.Fatalf("upserted document = %v", got)
+	}
+
+	result, err = collection.UpdateOne(ctx,
+		bson.M{"name": "ann"},
+		bson.M{"$set": bson.M{"age": 31}, "$setOnInsert": bson.M{"created": false}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MatchedCount != 1 || result.UpsertedCount != 0 {
+		t.Fatalf("result = %+v, want one match", result)
+	}
+	if err := collection.FindOne(ctx, bson.M{"name": "ann"}).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["age"] != int32(31) || got["created"] != true {
+		t.Fatalf("updated document = %v, want $setOnInsert skipped", got)
+	}
+}
+
+func TestUpdateRejectsChangingID(t *testing.T) {
+	collection := newCollection(t, bson.M{"_id": 1})
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": 1}, bson.M{"$set": bson.M{"_id": 2}})
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("error = %v, want a server error", err)
+	}
+}
+
+func TestUniqueIndexesRejectDuplicates(t *testing.T) {
+	collection := newCollection(t)
+	ctx := context.Background()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"email": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collection.InsertOne(ctx, bson.M{"email": "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = collection.InsertOne(ctx, bson.M{"email": "a@example.com"})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Fatalf("error = %v, want a duplicate key error", err)
+	}
+}
+
+// aggregate runs pipeline on collection and returns the documents it
+// produced.
+func aggregate(t *testing.T, collection *mongo.Collection, pipeline bson.A) []bson.M {
+	t.Helper()
+	ctx := context.Background()
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		t.Fatal(err)
+	}
+	return docs
+}
+
+func TestAggregateRunsStages(t *testing.T) {
+	collection := newCollection(t, people...)
+	tests := []struct {
+		name     string
+		pipeline bson.A
+		want     []bson.M
+	}{
+		{
+			"match sort project",
+			bson.A{
+				bson.M{"$match": bson.M{"age": bson.M{"$exists": true}}},
+				bson.M{"$sort": bson.M{"age": 1}},
+				bson.M{"$project": bson.M{"_id": 0, "name": 1, "older": bson.M{"$add": bson.A{"$age", 1}}}},
+			},
+			[]bson.M{
+				{"name": "bob", "older": int32(26)},
+				{"name": "ann", "older": int32(31)},
+				{"name": "cy", "older": int32(36)},
+			},
+		},
+		{
+			"unwind group",
+			bson.A{
+				bson.M{"$unwind": "$tags"},
+				bson.M{"$group": bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}, "names": bson.M{"$push": "$name"}}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			[]bson.M{
+				{"_id": "db", "count": int32(1), "names": bson.A{"ann"}},
+				{"_id": "go", "count": int32(2), "names": bson.A{"ann", "bob"}},
+			},
+		},
+		{
+			"count",
+			bson.A{
+				bson.M{"$match": bson.M{"age": bson.M{"$gte": 30}}},
+				bson.M{"$count": "total"},
+			},
+			[]bson.M{{"total": int32(2)}},
+		},
+		{
+			"facet",
+			bson.A{
+				bson.M{"$facet": bson.M{
+					"young": bson.A{bson.M{"$match": bson.M{"age": bson.M{"$lt": 30}}}, bson.M{"$project": bson.M{"name": 1, "_id": 0}}},
+					"total": bson.A{bson.M{"$count": "n"}},
+				}},
+			},
+			[]bson.M{{"young": bson.A{bson.M{"name": "bob"}}, "total": bson.A{bson.M{"n": int32(4)}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aggregate(t, collection, tt.pipeline); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("aggregated %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateLooksUpOtherCollections(t *testing.T) {
+	collection := newCollection(t, people...)
+	ctx := context.Background()
+	orders := collection.Database().Collection("orders")
+	_, err := orders.InsertMany(ctx, []interface{}{
+		bson.M{"_id": 10, "person": 1, "total": 5},
+		bson.M{"_id": 11, "person": 1, "total": 7},
+		bson.M{"_id": 12, "person": 2, "total": 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := aggregate(t, collection, bson.A{
+		bson.M{"$match": bson.M{"_id": bson.M{"$in": bson.A{1, 3}}}},
+		bson.M{"$lookup": bson.M{"from": "orders", "localField": "_id", "foreignField": "person", "as": "orders"}},
+		bson.M{"$project": bson.M{"count": bson.M{"$size": "$orders"}}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	})
+	want := []bson.M{{"_id": int32(1), "count": int32(2)}, {"_id": int32(3), "count": int32(0)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("looked up %v, want %v", got, want)
+	}
+
+	got = aggregate(t, collection, bson.A{
+		bson.M{"$match": bson.M{"_id": 1}},
+		bson.M{"$lookup": bson.M{
+			"from":         "orders",
+			"localField":   "_id",
+			"foreignField": "person",
+			"pipeline":     bson.A{bson.M{"$match": bson.M{"total": bson.M{"$gt": 6}}}},
+			"as":           "large",
+		}},
+		bson.M{"$project": bson.M{"large._id": 1}},
+	})
+	want = []bson.M{{"_id": int32(1), "large": bson.A{bson.M{"_id": int32(11)}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("looked up with pipeline %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,561 @@
+package mongormtest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// updater applies an update to a document.
+type updater struct {
+	// filter is the query that selected the document, used to resolve the
+	// positional $ operator.
+	filter bson.D
+	// original is the document before the update.
+	original     bson.D
+	arrayFilters bson.A
+	// inserting is set when the document is being inserted by an upsert,
+	// for $setOnInsert.
+	inserting bool
+}
+
+// modifier computes the new value of a field from its current value,
+// returning unset to remove the field.
+type modifier func(old interface{}, exists bool) (value interface{}, unset bool, err error)
+
+// apply returns a copy of doc updated by update, a document of update
+// operators, a replacement document or an update pipeline.
+func (u *updater) apply(doc bson.D, update interface{}) (bson.D, error) {
+	u.original = doc
+	updated := deepCopy(doc).(bson.D)
+	var err error
+	switch update := update.(type) {
+	case bson.A:
+		docs, err := runPipeline(nil, []bson.D{updated}, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updated = docs[0]
+	case bson.D:
+		if len(update) == 0 || !strings.HasPrefix(update[0].Key, "$") {
+			updated, err = u.replace(updated, update)
+		} else {
+			updated, err = u.applyOperators(updated, update)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errorf(codeFailedToParse, "update must be a document or a pipeline")
+	}
+
+	if !u.inserting {
+		before, _ := get(doc, "_id")
+		after, ok := get(updated, "_id")
+		if !ok || !equal(before, after) {
+			return nil, errorf(codeImmutableField, "Performing an update on the path '_id' would modify the immutable field '_id'")
+		}
+	}
+	return updated, nil
+}
+
+// replace returns replacement, with the _id of doc.
+func (u *updater) replace(doc, replacement bson.D) (bson.D, error) {
+	for _, e := range replacement {
+		if strings.HasPrefix(e.Key, "$") {
+			return nil, errorf(codeFailedToParse, "the replacement document must not contain update operators")
+		}
+	}
+	result := deepCopy(replacement).(bson.D)
+	if id, ok := get(doc, "_id"); ok {
+		if replacementID, ok := get(result, "_id"); ok && !equal(id, replacementID) && !u.inserting {
+			return nil, errorf(codeImmutableField, "the (immutable) field '_id' was found to have been altered")
+		}
+		result = append(bson.D{{Key: "_id", Value: id}}, remove(result, "_id")...)
+	}
+	return result, nil
+}
+
+func (u *updater) applyOperators(doc bson.D, update bson.D) (bson.D, error) {
+	var v interface{} = doc
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, errorf(codeFailedToParse, "Modifiers operate on fields but we found type %s instead", typeName(op.Value))
+		}
+		for _, field := range fields {
+			var err error
+			if v, err = u.applyOperator(v.(bson.D), op.Key, field); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v.(bson.D), nil
+}
+
+// applyOperator returns doc with the update operator op applied to field.
+func (u *updater) applyOperator(doc bson.D, op string, field bson.E) (interface{}, error) {
+	if op == "$rename" {
+		return u.rename(doc, field)
+	}
+	fn, create, err := u.modifierFor(op, field.Key, field.Value)
+	if err != nil || fn == nil {
+		return doc, err
+	}
+	return u.modify(doc, split(field.Key), nil, create, fn)
+}
+
+// modifierFor returns the modifier of the update operator op applied with
+// arg to the field at path, and whether it creates the field when missing.
+// It returns a nil modifier for operators that do not apply.
+func (u *updater) modifierFor(op, path string, arg interface{}) (modifier, bool, error) {
+	switch op {
+	case "$set":
+		return func(interface{}, bool) (interface{}, bool, error) {
+			return deepCopy(arg), false, nil
+		}, true, nil
+	case "$setOnInsert":
+		if !u.inserting {
+			return nil, false, nil
+		}
+		return func(interface{}, bool) (interface{}, bool, error) {
+			return deepCopy(arg), false, nil
+		}, true, nil
+	case "$unset":
+		return func(interface{}, bool) (interface{}, bool, error) {
+			return nil, true, nil
+		}, false, nil
+	case "$inc", "$mul":
+		if !isNumber(arg) {
+			return nil, false, errorf(codeTypeMismatch, "Cannot %s with non-numeric argument: {%s: %v}", op[1:], path, arg)
+		}
+		return func(old interface{}, exists bool) (interface{}, bool, error) {
+			if !exists {
+				if op == "$mul" {
+					return arithmetic(int32(0), arg, func(x, y float64) float64 { return x * y }, func(x, y int64) int64 { return x * y }), false, nil
+				}
+				return arg, false, nil
+			}
+			if !isNumber(old) {
+				return nil, false, errorf(codeTypeMismatch, "Cannot apply %s to a value of non-numeric type. {_id: %v} has the field '%s' of non-numeric type %s", op, u.id(), path, typeName(old))
+			}
+			if op == "$mul" {
+				return arithmetic(old, arg, func(x, y float64) float64 { return x * y }, func(x, y int64) int64 { return x * y }), false, nil
+			}
+			return arithmetic(old, arg, func(x, y float64) float64 { return x + y }, func(x, y int64) int64 { return x + y }), false, nil
+		}, true, nil
+	case "$min", "$max":
+		return func(old interface{}, exists bool) (interface{}, bool, error) {
+			c := compare(arg, old)
+			if !exists || (op == "$min" && c < 0) || (op == "$max" && c > 0) {
+				return arg, false, nil
+			}
+			return old, false, nil
+		}, true, nil
+	case "$currentDate":
+		var now interface{} = primitive.NewDateTimeFromTime(time.Now())
+		if spec, ok := arg.(bson.D); ok {
+			if t, _ := get(spec, "$type"); t == "timestamp" {
+				now = primitive.Timestamp{T: uint32(time.Now().Unix()), I: 1}
+			}
+		}
+		return func(interface{}, bool) (interface{}, bool, error) {
+			return now, false, nil
+		}, true, nil
+	case "$push", "$addToSet":
+		values := bson.A{arg}
+		var modifiers bson.D
+		if spec, ok := arg.(bson.D); ok && len(spec) > 0 && spec[0].Key == "$each" {
+			each, ok := spec[0].Value.(bson.A)
+			if !ok {
+				return nil, false, errorf(codeBadValue, "The argument to $each in %s must be an array", op)
+			}
+			values, modifiers = each, spec[1:]
+		}
+		return func(old interface{}, exists bool) (interface{}, bool, error) {
+			array, ok := old.(bson.A)
+			if exists && !ok {
+				return nil, false, errorf(codeBadValue, "The field '%s' must be an array but is of type %s in document {_id: %v}", path, typeName(old), u.id())
+			}
+			if op == "$addToSet" {
+				for _, value := range values {
+					if !containsEqual(array, value) {
+						array = append(array, deepCopy(value))
+					}
+				}
+				if array == nil {
+					array = bson.A{}
+				}
+				return array, false, nil
+			}
+			return push(array, values, modifiers)
+		}, true, nil
+	case "$pull", "$pullAll":
+		return func(old interface{}, exists bool) (interface{}, bool, error) {
+			array, ok := old.(bson.A)
+			if !exists {
+				return nil, true, nil
+			}
+			if !ok {
+				return nil, false, errorf(codeBadValue, "Cannot apply %s to a non-array value", op)
+			}
+			kept := bson.A{}
+			for _, elem := range array {
+				pulled, err := pulls(op, arg, elem)
+				if err != nil {
+					return nil, false, err
+				}
+				if !pulled {
+					kept = append(kept, elem)
+				}
+			}
+			return kept, false, nil
+		}, false, nil
+	case "$pop":
+		return func(old interface{}, exists bool) (interface{}, bool, error) {
+			array, ok := old.(bson.A)
+			if !exists {
+				return nil, true, nil
+			}
+			if !ok {
+				return nil, false, errorf(codeTypeMismatch, "Path '%s' contains an element of non-array type '%s'", path, typeName(old))
+			}
+			if len(array) == 0 {
+				return array, false, nil
+			}
+			if n, _ := toInt(arg); n < 0 {
+				return array[1:], false, nil
+			}
+			return array[:len(array)-1], false, nil
+		}, false, nil
+	}
+	return nil, false, errorf(codeFailedToParse, "Unknown modifier: %s. Expected a valid update modifier or pipeline-style update specified as an array", op)
+}
+
+// push appends values to array, applying the $position, $slice and $sort
+// modifiers of $push.
+func push(array bson.A, values bson.A, modifiers bson.D) (interface{}, bool, error) {
+	position := int64(len(array))
+	if v, ok := get(modifiers, "$position"); ok {
+		position, _ = toInt(v)
+		if position < 0 {
+			position += int64(len(array))
+		}
+		if position < 0 {
+			position = 0
+		}
+		if position > int64(len(array)) {
+			position = int64(len(array))
+		}
+	}
+	result := make(bson.A, 0, len(array)+len(values))
+	result = append(result, array[:position]...)
+	result = append(result, deepCopy(values).(bson.A)...)
+	result = append(result, array[position:]...)
+
+	if spec, ok := get(modifiers, "$sort"); ok {
+		var less func(a, b interface{}) bool
+		switch spec := spec.(type) {
+		case bson.D:
+			less = func(a, b interface{}) bool {
+				da, _ := a.(bson.D)
+				db, _ := b.(bson.D)
+				return compareBy(da, db, spec) < 0
+			}
+		default:
+			direction, _ := toInt(spec)
+			less = func(a, b interface{}) bool {
+				return compare(a, b)*int(direction) < 0
+			}
+		}
+		sort.SliceStable(result, func(i, j int) bool { return less(result[i], result[j]) })
+	}
+	if v, ok := get(modifiers, "$slice"); ok {
+		n, _ := toInt(v)
+		switch {
+		case n >= 0 && n < int64(len(result)):
+			result = result[:n]
+		case n < 0 && -n < int64(len(result)):
+			result = result[int64(len(result))+n:]
+		}
+	}
+	return result, false, nil
+}
+
+// pulls reports whether the $pull or $pullAll argument arg removes elem.
+func pulls(op string, arg interface{}, elem interface{}) (bool, error) {
+	if op == "$pullAll" {
+		values, ok := arg.(bson.A)
+		if !ok {
+			return false, errorf(codeBadValue, "$pullAll requires an array argument")
+		}
+		return containsEqual(values, elem), nil
+	}
+	if operators, ok := operatorDocument(arg); ok {
+		return matchOperators([]interface{}{elem}, operators)
+	}
+	if condition, ok := arg.(bson.D); ok {
+		if doc, ok := elem.(bson.D); ok {
+			return match(doc, condition)
+		}
+		return false, nil
+	}
+	return matchEqual([]interface{}{elem}, arg), nil
+}
+
+// containsEqual reports whether array holds a value equal to v.
+func containsEqual(array bson.A, v interface{}) bool {
+	for _, elem := range array {
+		if equal(elem, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// rename moves the field of a $rename operator.
+func (u *updater) rename(doc bson.D, field bson.E) (interface{}, error) {
+	to, ok := field.Value.(string)
+	if !ok || to == "" {
+		return nil, errorf(codeBadValue, "The 'to' field for $rename must be a string: %s: %v", field.Key, field.Value)
+	}
+	value, exists := lookupDocument(doc, split(field.Key))
+	if !exists {
+		return doc, nil
+	}
+	v, err := u.modify(doc, split(field.Key), nil, false, func(interface{}, bool) (interface{}, bool, error) {
+		return nil, true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u.modify(v, split(to), nil, true, func(interface{}, bool) (interface{}, bool, error) {
+		return value, false, nil
+	})
+}
+
+// lookupDocument returns the value at the dotted path in v, through
+// documents only.
+func lookupDocument(v interface{}, path []string) (interface{}, bool) {
+	for _, part := range path {
+		doc, ok := v.(bson.D)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = get(doc, part); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// modify returns v with fn applied to the value at path in it, done being
+// the path to v. Missing documents on the path are created when create is
+// set, and the update is skipped otherwise. The parts $, $[] and
+// $[identifier] apply fn to the element matched by the query, to every
+// element and to the elements matching the array filters of identifier.
+func (u *updater) modify(v interface{}, path, done []string, create bool, fn modifier) (interface{}, error) {
+	part, rest := path[0], path[1:]
+	switch container := v.(type) {
+	case bson.D:
+		old, exists := get(container, part)
+		if len(rest) == 0 {
+			value, unset, err := fn(old, exists)
+			if err != nil {
+				return nil, err
+			}
+			if unset {
+				return remove(container, part), nil
+			}
+			return set(container, part, value), nil
+		}
+		if !exists {
+			if !create {
+				return container, nil
+			}
+			old = bson.D{}
+		}
+		value, err := u.modify(old, rest, append(done, part), create, fn)
+		if err != nil {
+			return nil, err
+		}
+		return set(container, part, value), nil
+
+	case bson.A:
+		var indexes []int
+		switch {
+		case part == "$[]":
+			for i := range container {
+				indexes = append(indexes, i)
+			}
+		case strings.HasPrefix(part, "$[") && strings.HasSuffix(part, "]"):
+			identifier := part[2 : len(part)-1]
+			for i, elem := range container {
+				matched, err := u.matchArrayFilters(identifier, elem)
+				if err != nil {
+					return nil, err
+				}
+				if matched {
+					indexes = append(indexes, i)
+				}
+			}
+		case part == "$":
+			i, err := u.position(done)
+			if err != nil {
+				return nil, err
+			}
+			indexes = []int{i}
+		default:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 {
+				return nil, errorf(codePathNotViable, "Cannot create field '%s' in element {%s: %v}", part, strings.Join(done, "."), container)
+			}
+			if i >= len(container) {
+				if !create {
+					return container, nil
+				}
+				for len(container) <= i {
+					container = append(container, nil)
+				}
+			}
+			indexes = []int{i}
+		}
+		for _, i := range indexes {
+			if len(rest) == 0 {
+				value, unset, err := fn(container[i], true)
+				if err != nil {
+					return nil, err
+				}
+				if unset {
+					// Unsetting an element leaves a null in its place.
+					value = nil
+				}
+				container[i] = value
+				continue
+			}
+			elem := container[i]
+			if elem == nil && create {
+				elem = bson.D{}
+			}
+			value, err := u.modify(elem, rest, append(done, strconv.Itoa(i)), create, fn)
+			if err != nil {
+				return nil, err
+			}
+			container[i] = value
+		}
+		return container, nil
+
+	case nil:
+		if !create {
+			return v, nil
+		}
+	}
+	if strings.HasPrefix(part, "$") {
+		return nil, errorf(codeBadValue, "The path '%s' must exist in the document in order to apply array updates.", strings.Join(done, "."))
+	}
+	if !create {
+		return v, nil
+	}
+	return nil, errorf(codePathNotViable, "Cannot create field '%s' in element {%s: %v}", part, strings.Join(done, "."), v)
+}
+
+// matchArrayFilters reports whether elem matches the array filters of
+// identifier.
+func (u *updater) matchArrayFilters(identifier string, elem interface{}) (bool, error) {
+	found := false
+	for _, f := range u.arrayFilters {
+		filter, ok := f.(bson.D)
+		if !ok || len(filter) == 0 {
+			return false, errorf(codeFailedToParse, "array filters must be documents")
+		}
+		if name, _, _ := strings.Cut(filter[0].Key, "."); name != identifier {
+			continue
+		}
+		found = true
+		matched, err := match(bson.D{{Key: identifier, Value: elem}}, filter)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if !found {
+		return false, errorf(codeBadValue, "No array filter found for identifier '%s'", identifier)
+	}
+	return true, nil
+}
+
+// position returns the index of the first element of the array at path in
+// the original document matched by the query, for the positional $
+// operator: the first one the query matches alone.
+func (u *updater) position(path []string) (int, error) {
+	array, _ := lookupDocument(u.original, path)
+	if elements, ok := array.(bson.A); ok {
+		for i, elem := range elements {
+			candidate, err := (&updater{}).modify(deepCopy(u.original), path, nil, false, func(interface{}, bool) (interface{}, bool, error) {
+				return bson.A{elem}, false, nil
+			})
+			if err != nil {
+				return 0, err
+			}
+			if matched, err := match(candidate.(bson.D), u.filter); err == nil && matched {
+				return i, nil
+			}
+		}
+	}
+	return 0, errorf(codeBadValue, "The positional operator did not find the match needed from the query.")
+}
+
+// id returns the _id of the updated document, for error messages.
+func (u *updater) id() interface{} {
+	id, _ := get(u.original, "_id")
+	return id
+}
+
+// upsertDocument returns the document an upsert inserts before applying
+// its update: the fields the query filter tests for equality.
+func upsertDocument(filter bson.D) (bson.D, error) {
+	var v interface{} = bson.D{}
+	for _, e := range filter {
+		var value interface{}
+		switch {
+		case e.Key == "$and":
+			conditions, _ := e.Value.(bson.A)
+			for _, c := range conditions {
+				condition, _ := c.(bson.D)
+				nested, err := upsertDocument(condition)
+				if err != nil {
+					return nil, err
+				}
+				for _, field := range nested {
+					v = set(v.(bson.D), field.Key, field.Value)
+				}
+			}
+			continue
+		case strings.HasPrefix(e.Key, "$"):
+			continue
+		default:
+			if operators, ok := operatorDocument(e.Value); ok {
+				eq, ok := get(operators, "$eq")
+				if !ok {
+					continue
+				}
+				value = eq
+			} else if _, ok := e.Value.(primitive.Regex); ok {
+				continue
+			} else {
+				value = e.Value
+			}
+		}
+		var err error
+		v, err = (&updater{}).modify(v, split(e.Key), nil, true, func(interface{}, bool) (interface{}, bool, error) {
+			return deepCopy(value), false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v.(bson.D), nil
+}
@@ -0,0 +1,373 @@
+package mongormtest
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Documents are held as bson.D, with nested documents as bson.D and arrays
+// as bson.A, as the driver decodes them. Stored documents are never
+// modified: updates replace them with modified copies.
+
+// get returns the value of key in doc.
+func get(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set returns doc with key set to value, appended if absent.
+func set(doc bson.D, key string, value interface{}) bson.D {
+	for i, e := range doc {
+		if e.Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+// remove returns doc without key.
+func remove(doc bson.D, key string) bson.D {
+	for i, e := range doc {
+		if e.Key == key {
+			return append(doc[:i:i], doc[i+1:]...)
+		}
+	}
+	return doc
+}
+
+// resolve returns the values at the dotted path in v. Arrays met before the
+// end of the path are traversed: the path applies to each of their
+// documents, and a numeric part also selects an element. A missing path
+// yields no values.
+func resolve(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	switch v := v.(type) {
+	case bson.D:
+		if value, ok := get(v, path[0]); ok {
+			return resolve(value, path[1:])
+		}
+	case bson.A:
+		var values []interface{}
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(v) {
+			values = append(values, resolve(v[i], path[1:])...)
+		}
+		for _, elem := range v {
+			if _, ok := elem.(bson.D); ok {
+				values = append(values, resolve(elem, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// lookup returns the value at the dotted path in doc, as aggregation field
+// paths see it: arrays met before the end of the path map to the arrays of
+// the values at the rest of the path in their elements.
+func lookup(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+	switch v := v.(type) {
+	case bson.D:
+		if value, ok := get(v, path[0]); ok {
+			return lookup(value, path[1:])
+		}
+	case bson.A:
+		values := bson.A{}
+		for _, elem := range v {
+			if value, ok := lookup(elem, path); ok {
+				values = append(values, value)
+			}
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// split returns the parts of a dotted path.
+func split(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// deepCopy returns a copy of v sharing no documents or arrays with it.
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.D:
+		doc := make(bson.D, len(v))
+		for i, e := range v {
+			doc[i] = bson.E{Key: e.Key, Value: deepCopy(e.Value)}
+		}
+		return doc
+	case bson.A:
+		array := make(bson.A, len(v))
+		for i, elem := range v {
+			array[i] = deepCopy(elem)
+		}
+		return array
+	}
+	return v
+}
+
+// typeOrder ranks the type of v in the order the server sorts values of
+// different types in.
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case primitive.MinKey:
+		return 0
+	case nil, primitive.Undefined:
+		return 1
+	case int32, int64, float64, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	case primitive.MaxKey:
+		return 13
+	}
+	return 12
+}
+
+// isNumber reports whether v is a number.
+func isNumber(v interface{}) bool {
+	return typeOrder(v) == 2
+}
+
+// toFloat converts the number v to a float64.
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	}
+	return 0
+}
+
+// toInt converts the number v to an int64, reporting whether it is
+// integral.
+func toInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), v == math.Trunc(v)
+	case primitive.Decimal128:
+		f := toFloat(v)
+		return int64(f), f == math.Trunc(f)
+	}
+	return 0, false
+}
+
+// compare orders a and b as the server sorts them: by type first, and then
+// by value, numbers of different types comparing by their values.
+func compare(a, b interface{}) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		return compareInts(int64(ta), int64(tb))
+	}
+	switch a := a.(type) {
+	case int32, int64, float64, primitive.Decimal128:
+		x, xInt := a.(int64)
+		y, yInt := b.(int64)
+		if xInt && yInt {
+			return compareInts(x, y)
+		}
+		// NaN sorts before every other number.
+		fa, fb := toFloat(a), toFloat(b)
+		switch {
+		case math.IsNaN(fa) || math.IsNaN(fb):
+			return compareInts(boolInt(!math.IsNaN(fa)), boolInt(!math.IsNaN(fb)))
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, stringOf(b))
+	case primitive.Symbol:
+		return strings.Compare(string(a), stringOf(b))
+	case bson.D:
+		b := b.(bson.D)
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := compareInts(int64(typeOrder(a[i].Value)), int64(typeOrder(b[i].Value))); c != 0 {
+				return c
+			}
+			if c := strings.Compare(a[i].Key, b[i].Key); c != 0 {
+				return c
+			}
+			if c := compare(a[i].Value, b[i].Value); c != 0 {
+				return c
+			}
+		}
+		return compareInts(int64(len(a)), int64(len(b)))
+	case bson.A:
+		b := b.(bson.A)
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(int64(len(a)), int64(len(b)))
+	case primitive.Binary:
+		b := b.(primitive.Binary)
+		if len(a.Data) != len(b.Data) {
+			return compareInts(int64(len(a.Data)), int64(len(b.Data)))
+		}
+		if a.Subtype != b.Subtype {
+			return compareInts(int64(a.Subtype), int64(b.Subtype))
+		}
+		return bytes.Compare(a.Data, b.Data)
+	case primitive.ObjectID:
+		b := b.(primitive.ObjectID)
+		return bytes.Compare(a[:], b[:])
+	case bool:
+		b := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case b:
+			return -1
+		}
+		return 1
+	case primitive.DateTime:
+		return compareInts(int64(a), int64(b.(primitive.DateTime)))
+	case primitive.Timestamp:
+		return primitive.CompareTimestamp(a, b.(primitive.Timestamp))
+	case primitive.Regex:
+		b := b.(primitive.Regex)
+		if c := strings.Compare(a.Pattern, b.Pattern); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Options, b.Options)
+	}
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func stringOf(v interface{}) string {
+	if s, ok := v.(primitive.Symbol); ok {
+		return string(s)
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// equal reports whether a and b are equal values.
+func equal(a, b interface{}) bool {
+	if typeOrder(a) != typeOrder(b) {
+		return false
+	}
+	return compare(a, b) == 0
+}
+
+// truthy reports whether v is true as an aggregation expression result.
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil, primitive.Undefined:
+		return false
+	case bool:
+		return v
+	case int32, int64, float64, primitive.Decimal128:
+		return toFloat(v) != 0
+	}
+	return true
+}
+
+// typeName returns the BSON type name of v, as $type reports it.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case bson.D:
+		return "object"
+	case bson.A:
+		return "array"
+	case primitive.Binary:
+		return "binData"
+	case primitive.Undefined:
+		return "undefined"
+	case primitive.ObjectID:
+		return "objectId"
+	case bool:
+		return "bool"
+	case primitive.DateTime:
+		return "date"
+	case nil:
+		return "null"
+	case primitive.Regex:
+		return "regex"
+	case primitive.JavaScript:
+		return "javascript"
+	case primitive.Symbol:
+		return "symbol"
+	case int32:
+		return "int"
+	case primitive.Timestamp:
+		return "timestamp"
+	case int64:
+		return "long"
+	case primitive.Decimal128:
+		return "decimal"
+	case primitive.MinKey:
+		return "minKey"
+	case primitive.MaxKey:
+		return "maxKey"
+	}
+	return "unknown"
+}
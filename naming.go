@@ -0,0 +1,228 @@
+package mongorm
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// CollectionNamer is implemented by models that choose their own collection
+// name, overriding the NamingStrategy:
+//
+//	func (Person) CollectionName() string { return "people" }
+type CollectionNamer interface {
+	CollectionName() string
+}
+
+// NamingStrategy derives collection names from model type names and
+// document keys from struct field names.
+type NamingStrategy interface {
+	// CollectionName returns the collection for a model type name.
+	CollectionName(typeName string) string
+	// FieldName returns the document key for a struct field without a bson
+	// tag. It must agree with how documents are encoded, which for the
+	// default bson codec means lowercasing the field name.
+	FieldName(fieldName string) string
+}
+
+// DefaultNamingStrategy snake_cases and pluralizes type names, so User is
+// stored in "users", OrderItem in "order_items" and Person in "people".
+type DefaultNamingStrategy struct {
+	// CollectionPrefix is prepended to every collection name.
+	CollectionPrefix string
+	// SingularCollections disables pluralization.
+	SingularCollections bool
+}
+
+// CollectionName implements NamingStrategy.
+func (ns DefaultNamingStrategy) CollectionName(typeName string) string {
+	name := toSnakeCase(typeName)
+	if !ns.SingularCollections {
+		if i := strings.LastIndexByte(name, '_'); i >= 0 {
+			name = name[:i+1] + pluralize(name[i+1:])
+		} else {
+			name = pluralize(name)
+		}
+	}
+	return ns.CollectionPrefix + name
+}
+
+// FieldName implements NamingStrategy.
+func (DefaultNamingStrategy) FieldName(fieldName string) string {
+	return strings.ToLower(fieldName)
+}
+
+// LegacyNamingStrategy names collections as versions before
+// DefaultNamingStrategy did, lowercasing the type name and appending "s":
+// User is stored in "users", OrderItem in "orderitems" and Person in
+// "persons". Deployments whose data was written by those versions use it to
+// keep reading and writing the same collections.
+type LegacyNamingStrategy struct {
+	// CollectionPrefix is prepended to every collection name.
+	CollectionPrefix string
+}
+
+// CollectionName implements NamingStrategy.
+func (ns LegacyNamingStrategy) CollectionName(typeName string) string {
+	return ns.CollectionPrefix + strings.ToLower(typeName) + "s"
+}
+
+// FieldName implements NamingStrategy.
+func (LegacyNamingStrategy) FieldName(fieldName string) string {
+	return strings.ToLower(fieldName)
+}
+
+// collectionName returns the collection documents of type t are stored in.
+func (orm *MongoORM) collectionName(t reflect.Type) string {
+	return orm.schema(t).collection
+}
+
+// parseCollectionName derives the collection of type t, for its schema.
+func (orm *MongoORM) parseCollectionName(t reflect.Type) string {
+	if t.Kind() != reflect.Interface {
+		if namer, ok := reflect.New(t).Interface().(CollectionNamer); ok {
+			return namer.CollectionName()
+		}
+	}
+	return orm.namingStrategy().CollectionName(t.Name())
+}
+
+// fieldName returns the document key a struct field is stored under.
+func (orm *MongoORM) fieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("bson"), ",")[0]; name != "" {
+		return name
+	}
+	return orm.namingStrategy().FieldName(field.Name)
+}
+
+// LookupField returns the field of the struct type t named name, or stored
+// under the document key name as the bson tags and the NamingStrategy
+// store it, following inlined structs. Plugins use it to find the fields
+// of models they read or set.
+func (orm *MongoORM) LookupField(t reflect.Type, name string) (reflect.StructField, bool) {
+	return orm.lookupField(t, name)
+}
+
+// lookupField finds the field of t named name, or stored under the document
+// key name, following inlined structs.
+func (orm *MongoORM) lookupField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	s := orm.schema(t)
+	if lookup, ok := s.fields.Load(name); ok {
+		return lookup.(fieldLookup).field, lookup.(fieldLookup).ok
+	}
+	field, ok := orm.findField(t, name)
+	s.fields.Store(name, fieldLookup{field: field, ok: ok})
+	return field, ok
+}
+
+// findField is the uncached lookupField.
+func (orm *MongoORM) findField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if field, ok := t.FieldByName(name); ok {
+		return field, true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isInline(field) {
+			if inner, ok := orm.lookupField(indirectType(field.Type), name); ok {
+				inner.Index = append([]int{i}, inner.Index...)
+				return inner, true
+			}
+			continue
+		}
+		if field.IsExported() && orm.fieldName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func (orm *MongoORM) namingStrategy() NamingStrategy {
+	if orm.config != nil && orm.config.NamingStrategy != nil {
+		return orm.config.NamingStrategy
+	}
+	return DefaultNamingStrategy{}
+}
+
+// toSnakeCase converts a Go identifier to snake_case, keeping acronyms
+// together: UserID becomes user_id and HTTPRequest becomes http_request.
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					b.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var irregularPlurals = map[string]string{
+	"child":  "children",
+	"person": "people",
+	"man":    "men",
+	"woman":  "women",
+	"tooth":  "teeth",
+	"foot":   "feet",
+	"mouse":  "mice",
+	"goose":  "geese",
+	"ox":     "oxen",
+	"leaf":   "leaves",
+	"life":   "lives",
+	"knife":  "knives",
+	"wife":   "wives",
+	"half":   "halves",
+	"shelf":  "shelves",
+	"wolf":   "wolves",
+	"hero":   "heroes",
+	"potato": "potatoes",
+	"tomato": "tomatoes",
+	"index":  "indexes",
+	"matrix": "matrices",
+	"vertex": "vertices",
+	"datum":  "data",
+	"medium": "media",
+}
+
+var uncountables = map[string]bool{
+	"data":        true,
+	"metadata":    true,
+	"equipment":   true,
+	"information": true,
+	"news":        true,
+	"series":      true,
+	"species":     true,
+	"sheep":       true,
+	"fish":        true,
+	"feedback":    true,
+	"media":       true,
+}
+
+// pluralize returns the English plural of a lowercase noun.
+func pluralize(word string) string {
+	if word == "" || uncountables[word] {
+		return word
+	}
+	if plural, ok := irregularPlurals[word]; ok {
+		return plural
+	}
+
+	switch {
+	case strings.HasSuffix(word, "s"), strings.HasSuffix(word, "x"), strings.HasSuffix(word, "z"),
+		strings.HasSuffix(word, "ch"), strings.HasSuffix(word, "sh"):
+		return word + "es"
+	case strings.HasSuffix(word, "y") && len(word) > 1 && !strings.ContainsRune("aeiou", rune(word[len(word)-2])):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
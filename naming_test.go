@@ -0,0 +1,91 @@
+package mongorm_test
+
+import (
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDefaultNamingStrategy(t *testing.T) {
+	tests := []struct {
+		strategy mongorm.DefaultNamingStrategy
+		typeName string
+		want     string
+	}{
+		{mongorm.DefaultNamingStrategy{}, "User", "users"},
+		{mongorm.DefaultNamingStrategy{}, "OrderItem", "order_items"},
+		{mongorm.DefaultNamingStrategy{}, "UserID", "user_ids"},
+		{mongorm.DefaultNamingStrategy{}, "HTTPRequest", "http_requests"},
+		{mongorm.DefaultNamingStrategy{}, "OAuth2Token", "o_auth2_tokens"},
+		{mongorm.DefaultNamingStrategy{}, "Person", "people"},
+		{mongorm.DefaultNamingStrategy{}, "SalesPerson", "sales_people"},
+		{mongorm.DefaultNamingStrategy{}, "Child", "children"},
+		{mongorm.DefaultNamingStrategy{}, "Address", "addresses"},
+		{mongorm.DefaultNamingStrategy{}, "Box", "boxes"},
+		{mongorm.DefaultNamingStrategy{}, "Match", "matches"},
+		{mongorm.DefaultNamingStrategy{}, "Wish", "wishes"},
+		{mongorm.DefaultNamingStrategy{}, "Category", "categories"},
+		{mongorm.DefaultNamingStrategy{}, "Key", "keys"},
+		{mongorm.DefaultNamingStrategy{}, "Leaf", "leaves"},
+		{mongorm.DefaultNamingStrategy{}, "Metadata", "metadata"},
+		{mongorm.DefaultNamingStrategy{}, "UserNews", "user_news"},
+		{mongorm.DefaultNamingStrategy{SingularCollections: true}, "OrderItem", "order_item"},
+		{mongorm.DefaultNamingStrategy{CollectionPrefix: "app_"}, "Person", "app_people"},
+	}
+	for _, tt := range tests {
+		if got := tt.strategy.CollectionName(tt.typeName); got != tt.want {
+			t.Errorf("%+v.CollectionName(%q) = %q, want %q", tt.strategy, tt.typeName, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyNamingStrategy(t *testing.T) {
+	tests := []struct {
+		strategy mongorm.LegacyNamingStrategy
+		typeName string
+		want     string
+	}{
+		{mongorm.LegacyNamingStrategy{}, "User", "users"},
+		{mongorm.LegacyNamingStrategy{}, "OrderItem", "orderitems"},
+		{mongorm.LegacyNamingStrategy{}, "Person", "persons"},
+		{mongorm.LegacyNamingStrategy{}, "Address", "addresss"},
+		{mongorm.LegacyNamingStrategy{CollectionPrefix: "app_"}, "Category", "app_categorys"},
+	}
+	for _, tt := range tests {
+		if got := tt.strategy.CollectionName(tt.typeName); got != tt.want {
+			t.Errorf("%+v.CollectionName(%q) = %q, want %q", tt.strategy, tt.typeName, got, tt.want)
+		}
+	}
+}
+
+type OrderItem struct {
+	SKU string `bson:"sku"`
+}
+
+func TestNamingStrategyNamesCollections(t *testing.T) {
+	for _, tt := range []struct {
+		config *mongorm.Config
+		want   string
+	}{
+		{&mongorm.Config{}, "order_items"},
+		{&mongorm.Config{NamingStrategy: mongorm.LegacyNamingStrategy{}}, "orderitems"},
+	} {
+		orm := mongormtest.New(tt.config)
+		if err := orm.Create(&OrderItem{SKU: "a"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		collection, err := orm.Collection(tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := collection.CountDocuments(orm.Context(), bson.M{"sku": "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("documents of %q = %d, want the created item", tt.want, n)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package mongorm
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// MongoDB tells a key holding null from a missing key, but the filter
+// {field: null}, which Where("field = ?", nil) builds, matches both. IsNull,
+// NotNull and FieldExists tell them apart:
+//
+//	                   null   missing   value
+//	IsNull               ✓
+//	NotNull                              ✓
+//	FieldExists(true)    ✓                ✓
+//	FieldExists(false)           ✓
+//
+// Documents written from a model store a nil pointer as null, unless its
+// bson tag has omitempty, which leaves the key out.
+
+// IsNull matches the documents whose field holds null, leaving out those
+// without field.
+func (orm *MongoORM) IsNull(field string) *MongoORM {
+	tx := orm.getInstance()
+	tx.addCondition(bson.M{field: nullOperator()})
+	return tx
+}
+
+// NotNull matches the documents that have field, holding anything but
+// null.
+func (orm *MongoORM) NotNull(field string) *MongoORM {
+	tx := orm.getInstance()
+	tx.addCondition(bson.M{field: bson.M{"$ne": nil}})
+	return tx
+}
+
+// FieldExists matches the documents that have field, whatever it holds,
+// null included, or that lack it when exists is false.
+func (orm *MongoORM) FieldExists(field string, exists bool) *MongoORM {
+	tx := orm.getInstance()
+	tx.addCondition(bson.M{field: bson.M{"$exists": exists}})
+	return tx
+}
+
+// IsNull matches the documents whose f holds null, leaving out those
+// without f.
+func (f Field[T]) IsNull() bson.M {
+	return bson.M{f.key: nullOperator()}
+}
+
+// NotNull matches the documents that have f, holding anything but null.
+func (f Field[T]) NotNull() bson.M {
+	return bson.M{f.key: bson.M{"$ne": nil}}
+}
+
+// nullOperator returns the operator matching null values but not missing
+// keys.
+func nullOperator() bson.M {
+	return bson.M{"$type": "null"}
+}
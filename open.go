@@ -0,0 +1,157 @@
+package mongorm
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// OpenOption configures the client created by Open.
+type OpenOption func(*openConfig)
+
+type openConfig struct {
+	client *options.ClientOptions
+	config *Config
+}
+
+// WithConfig sets the Config of the returned MongoORM.
+func WithConfig(config *Config) OpenOption {
+	return func(c *openConfig) {
+		c.config = config
+	}
+}
+
+// WithClientOptions applies driver client options not covered by the other
+// options. They are merged after the URI, so they take precedence over it.
+func WithClientOptions(opts *options.ClientOptions) OpenOption {
+	return func(c *openConfig) {
+		c.client = options.MergeClientOptions(c.client, opts)
+	}
+}
+
+// WithMaxPoolSize caps the number of connections per server.
+func WithMaxPoolSize(size uint64) OpenOption {
+	return func(c *openConfig) {
+		c.client.SetMaxPoolSize(size)
+	}
+}
+
+// WithMinPoolSize sets the number of idle connections kept per server.
+func WithMinPoolSize(size uint64) OpenOption {
+	return func(c *openConfig) {
+		c.client.SetMinPoolSize(size)
+	}
+}
+
+// WithMaxConnIdleTime closes connections idle for longer than d.
+func WithMaxConnIdleTime(d time.Duration) OpenOption {
+	return func(c *openConfig) {
+		c.client.SetMaxConnIdleTime(d)
+	}
+}
+
+// WithConnectTimeout bounds establishing a connection, and the initial ping
+// made by Open.
+func WithConnectTimeout(d time.Duration) OpenOption {
+	return func(c *openConfig) {
+		c.client.SetConnectTimeout(d)
+	}
+}
+
+// WithReadPreference sets the default read preference, for example
+// readpref.SecondaryPreferred().
+func WithReadPreference(rp *readpref.ReadPref) OpenOption {
+	return func(c *openConfig) {
+		c.client.SetReadPreference(rp)
+	}
+}
+
+// WithReadConcern sets the default read concern.
+func WithReadConcern(rc *readconcern.ReadConcern) OpenOption {
+	return func(c *openConfig) {
+		c.client.SetReadConcern(rc)
+	}
+}
+
+// WithWriteConcern sets the default write concern, for example
+// writeconcern.Majority().
+func WithWriteConcern(wc *writeconcern.WriteConcern) OpenOption {
+	return func(c *openConfig) {
+		c.client.SetWriteConcern(wc)
+	}
+}
+
+// WithAppName sets the application name reported to the server.
+func WithAppName(name string) OpenOption {
+	return func(c *openConfig) {
+		c.client.SetAppName(name)
+	}
+}
+
+// Open connects to the deployment at uri and returns a MongoORM using
+// database on it. The connection is verified with a ping; call Close to
+// disconnect:
+//
+//	orm, err := mongorm.Open("mongodb://localhost:27017", "app",
+//		mongorm.WithMaxPoolSize(50),
+//		mongorm.WithReadPreference(readpref.SecondaryPreferred()))
+//	if err != nil {
+//		return err
+//	}
+//	defer orm.Close()
+func Open(uri, database string, opts ...OpenOption) (*MongoORM, error) {
+	c := &openConfig{client: options.Client().ApplyURI(uri)}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout(c.client))
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, c.client)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return NewMongoORM(client, database, c.config), nil
+}
+
+// connectTimeout returns the time Open waits for the deployment.
+func connectTimeout(opts *options.ClientOptions) time.Duration {
+	if opts.ConnectTimeout != nil {
+		return *opts.ConnectTimeout
+	}
+	return defaultTimeout
+}
+
+// Ping verifies that the deployment is reachable.
+func (orm *MongoORM) Ping() error {
+	if orm.client == nil {
+		return ErrMissingClient
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+	return orm.client.Ping(ctx, nil)
+}
+
+// Close disconnects the client, waiting for in-use connections to be
+// returned to the pool. Instances sharing the client cannot be used
+// afterwards.
+func (orm *MongoORM) Close() error {
+	if orm.client == nil {
+		return ErrMissingClient
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+	return orm.client.Disconnect(ctx)
+}
@@ -0,0 +1,90 @@
+package mongorm
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Page is a page of documents read by Paginate, with the metadata list
+// endpoints usually return alongside it.
+type Page struct {
+	// Items is the slice of documents given to Paginate.
+	Items interface{}
+	// Page is the 1-based page number and PerPage the page size.
+	Page    int
+	PerPage int
+	// Total is the number of documents matching the chain, and TotalPages
+	// the number of pages they fill.
+	Total      int64
+	TotalPages int
+	// HasNext reports whether a page follows this one.
+	HasNext bool
+}
+
+// Paginate reads page number page, starting at 1, of perPage documents
+// matching the chain into docs, a pointer to a slice, and counts all the
+// matching documents. The count and the read run concurrently, unless the
+// chain is in a transaction, whose session does not allow it:
+//
+//	var users []User
+//	page, err := orm.Where("active = ?", true).Order("name").Paginate(2, 20, &users)
+//	// page.Items is &users; page.Total, page.TotalPages and page.HasNext
+//	// describe the whole result
+//
+// The chain's Limit and Offset are replaced. Models are taken from docs
+// unless given to Model, as for Find.
+func (orm *MongoORM) Paginate(page, perPage int, docs interface{}) (*Page, error) {
+	if perPage <= 0 {
+		return nil, errors.New("page size must be positive")
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	base := orm.Session(&Session{})
+	if base.Statement.Model == nil {
+		t := modelType(docs)
+		if t == nil || t.Kind() != reflect.Struct {
+			return nil, ErrMissingModel
+		}
+		base = base.Model(reflect.New(t).Interface())
+		base.clone = true
+	}
+
+	var total int64
+	var countErr error
+	count := func() {
+		countErr = base.Count(&total).Error
+	}
+	var wg sync.WaitGroup
+	if mongo.SessionFromContext(base.context()) != nil {
+		count()
+	} else {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count()
+		}()
+	}
+	findErr := base.Offset((page - 1) * perPage).Limit(perPage).Find(docs).Error
+	wg.Wait()
+	if findErr != nil {
+		return nil, findErr
+	}
+	if countErr != nil {
+		return nil, countErr
+	}
+
+	totalPages := int((total + int64(perPage) - 1) / int64(perPage))
+	return &Page{
+		Items:      docs,
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: totalPages,
+		HasNext:    page < totalPages,
+	}, nil
+}
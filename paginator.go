@@ -0,0 +1,230 @@
+package mongorm
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Paginator describes a page of documents read by FindPage with keyset
+// pagination: instead of skipping documents, each page starts right after
+// or before the sort key values of a document of the previous one, encoded
+// in an opaque token. Pages stay stable while documents are inserted, and
+// reading a page costs the same however deep it is.
+type Paginator struct {
+	// Order is the sort order, written as for Order. _id is added as a
+	// final tiebreaker so that the order is total; it defaults to "_id".
+	Order string
+	// Limit is the number of documents per page.
+	Limit int
+	// After and Before select the page following or preceding the one the
+	// token was returned with. The first page is read when both are empty.
+	After  string
+	Before string
+
+	// Next and Prev are set by FindPage to the tokens reading the following
+	// and preceding pages, passed back as After and Before. They are empty
+	// when there is no such page.
+	Next string
+	Prev string
+}
+
+// FindPage reads the page of documents described by p into docs, a pointer
+// to a slice, and sets p.Next and p.Prev:
+//
+//	p := &mongorm.Paginator{Order: "date_created desc", Limit: 20, After: r.URL.Query().Get("after")}
+//	orm.Where("published = ?", true).FindPage(p, &posts)
+//	// respond with posts, p.Next and p.Prev
+//
+// Conditions, Select and Omit apply as for Find; Order, Limit and Offset of
+// the chain are replaced by those of p.
+func (orm *MongoORM) FindPage(p *Paginator, docs interface{}) *MongoORM {
+	return orm.execute(opQuery, docs, func(tx *MongoORM) {
+		tx.findPage(p, docs)
+	})
+}
+
+// findPage is the built-in step of FindPage.
+func (orm *MongoORM) findPage(p *Paginator, docs interface{}) *MongoORM {
+	docsVal := reflect.ValueOf(docs)
+	if docsVal.Kind() != reflect.Ptr || docsVal.Elem().Kind() != reflect.Slice {
+		orm.Error = ErrNotSlice
+		return orm
+	}
+	if p.Limit <= 0 {
+		orm.Error = errors.New("paginator limit must be positive")
+		return orm
+	}
+	if p.After != "" && p.Before != "" {
+		orm.Error = fmt.Errorf("%w: After and Before are exclusive", ErrInvalidCursor)
+		return orm
+	}
+	collection, t, err := orm.readSource(docs)
+	if err != nil {
+		orm.Error = err
+		return orm
+	}
+
+	// The sort keys, with _id last, in the order of the page.
+	orm.Statement.Sort = nil
+	orm.Order(p.Order)
+	if orm.Error != nil {
+		return orm
+	}
+	keys := bson.D{}
+	hasID := false
+	for _, e := range orm.Statement.Sort {
+		key := orm.documentKey(t, e.Key)
+		keys = append(keys, bson.E{Key: key, Value: e.Value})
+		hasID = hasID || key == "_id"
+	}
+	if !hasID {
+		keys = append(keys, bson.E{Key: "_id", Value: 1})
+	}
+
+	// Pages before a token are read backwards from it, then reversed.
+	backward := p.Before != ""
+	sort := bson.D{}
+	for _, e := range keys {
+		direction := e.Value.(int)
+		if backward {
+			direction = -direction
+		}
+		sort = append(sort, bson.E{Key: e.Key, Value: direction})
+	}
+
+	filter := orm.queryFilter(t)
+	if token := p.After + p.Before; token != "" {
+		values, err := decodeCursor(token, len(sort))
+		if err != nil {
+			orm.Error = err
+			return orm
+		}
+		filter = mergeConditions(filter, keysetCondition(sort, values))
+	}
+
+	orm.Statement.Sort = sort
+	orm.Statement.Offset = 0
+	opts := orm.findOptions(t).SetLimit(int64(p.Limit) + 1)
+	if projection, ok := opts.Projection.(bson.M); ok && orm.selectsFields() {
+		for _, e := range sort {
+			projection[e.Key] = 1
+		}
+	}
+	orm.Statement.record(collection, "find", filter)
+	if orm.Statement.DryRun {
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	var raws []bson.Raw
+	if err := cursor.All(ctx, &raws); err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	more := len(raws) > p.Limit
+	if more {
+		raws = raws[:p.Limit]
+	}
+	if backward {
+		for i, j := 0, len(raws)-1; i < j; i, j = i+1, j-1 {
+			raws[i], raws[j] = raws[j], raws[i]
+		}
+	}
+
+	sliceVal := docsVal.Elem()
+	elemType := sliceVal.Type().Elem()
+	result := reflect.MakeSlice(sliceVal.Type(), 0, len(raws))
+	for _, raw := range raws {
+		elem := reflect.New(indirectType(elemType))
+		if err := unmarshalDocument(raw, elem.Interface()); err != nil {
+			orm.Error = err
+			return orm
+		}
+		if elemType.Kind() != reflect.Ptr {
+			elem = elem.Elem()
+		}
+		result = reflect.Append(result, elem)
+	}
+	sliceVal.Set(result)
+	orm.RowsAffected = uint(len(raws))
+
+	p.Next, p.Prev = "", ""
+	if len(raws) > 0 {
+		if more || backward {
+			p.Next = encodeCursor(raws[len(raws)-1], keys)
+		}
+		if (more && backward) || (!backward && p.After != "") {
+			p.Prev = encodeCursor(raws[0], keys)
+		}
+	}
+
+	orm.processPreloads(docs)
+	if orm.Error == nil {
+		orm.Error = orm.callHookEach(sliceVal, hookAfterFind)
+	}
+	return orm
+}
+
+// keysetCondition returns the condition matching the documents that come
+// after values, the sort key values of a document, in the order sort.
+func keysetCondition(sort bson.D, values bson.A) bson.M {
+	or := bson.A{}
+	for i, e := range sort {
+		cond := bson.M{}
+		for j := 0; j < i; j++ {
+			cond[sort[j].Key] = values[j]
+		}
+		operator := "$gt"
+		if e.Value.(int) < 0 {
+			operator = "$lt"
+		}
+		cond[e.Key] = bson.M{operator: values[i]}
+		or = append(or, cond)
+	}
+	return bson.M{"$or": or}
+}
+
+// encodeCursor returns the token holding the values of keys in doc.
+func encodeCursor(doc bson.Raw, keys bson.D) string {
+	values := bson.A{}
+	for _, e := range keys {
+		value, err := doc.LookupErr(strings.Split(e.Key, ".")...)
+		if err != nil {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, value)
+	}
+	data, _ := bson.Marshal(bson.D{{Key: "v", Value: values}})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the n sort key values held by token.
+func decodeCursor(token string, n int) (bson.A, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	var doc struct {
+		V bson.A `bson:"v"`
+	}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if len(doc.V) != n {
+		return nil, fmt.Errorf("%w: token does not match the sort order", ErrInvalidCursor)
+	}
+	return doc.V, nil
+}
@@ -0,0 +1,139 @@
+package mongorm_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type article struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty"`
+	Title string             `bson:"title"`
+	Score int                `bson:"score"`
+}
+
+// newArticles creates articles a to g, whose scores tie in pairs.
+func newArticles(t *testing.T) *mongorm.MongoORM {
+	t.Helper()
+	orm := mongormtest.New()
+	for i, title := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		if err := orm.Create(&article{Title: title, Score: i / 2}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return orm
+}
+
+func titles(articles []article) []string {
+	titles := []string{}
+	for _, a := range articles {
+		titles = append(titles, a.Title)
+	}
+	return titles
+}
+
+func TestFindPageWalksPagesBothWays(t *testing.T) {
+	orm := newArticles(t)
+	tests := []struct {
+		order string
+		pages [][]string
+	}{
+		{"", [][]string{{"a", "b", "c"}, {"d", "e", "f"}, {"g"}}},
+		{"score desc", [][]string{{"g", "e", "f"}, {"c", "d", "a"}, {"b"}}},
+		{"score asc, title desc", [][]string{{"b", "a", "d"}, {"c", "f", "e"}, {"g"}}},
+	}
+	for _, tt := range tests {
+		p := &mongorm.Paginator{Order: tt.order, Limit: 3}
+		var tokens []string
+		for i, want := range tt.pages {
+			var page []article
+			if err := orm.FindPage(p, &page).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got := titles(page); !reflect.DeepEqual(got, want) {
+				t.Fatalf("order %q: page %d = %v, want %v", tt.order, i, got, want)
+			}
+			if last := i == len(tt.pages)-1; (p.Next == "") != last || (p.Prev == "") != (i == 0) {
+				t.Fatalf("order %q: page %d tokens next %q, prev %q", tt.order, i, p.Next, p.Prev)
+			}
+			tokens = append(tokens, p.Prev)
+			p.After, p.Before = p.Next, ""
+		}
+
+		// Walk back from the last page.
+		for i := len(tt.pages) - 2; i >= 0; i-- {
+			p.After, p.Before = "", tokens[i+1]
+			var page []article
+			if err := orm.FindPage(p, &page).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got := titles(page); !reflect.DeepEqual(got, tt.pages[i]) {
+				t.Fatalf("order %q: page %d read backwards = %v, want %v", tt.order, i, got, tt.pages[i])
+			}
+			if p.Next == "" || (p.Prev == "") != (i == 0) {
+				t.Fatalf("order %q: page %d read backwards tokens next %q, prev %q", tt.order, i, p.Next, p.Prev)
+			}
+			tokens[i] = p.Prev
+		}
+	}
+}
+
+func TestFindPageBuildsKeysetCondition(t *testing.T) {
+	orm := newArticles(t)
+	p := &mongorm.Paginator{Order: "score desc", Limit: 2}
+	var page []article
+	if err := orm.FindPage(p, &page).Error; err != nil {
+		t.Fatal(err)
+	}
+	last := page[len(page)-1]
+
+	tx := orm.Session(&mongorm.Session{DryRun: true}).Where("title != ?", "z").
+		FindPage(&mongorm.Paginator{Order: "score desc", Limit: 2, After: p.Next}, &page)
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	// The token holds raw values, which are compared as they encode.
+	want := bson.M{"$and": bson.A{
+		bson.M{"title": bson.M{"$ne": "z"}},
+		bson.M{"$or": bson.A{
+			bson.M{"score": bson.M{"$lt": last.Score}},
+			bson.M{"score": last.Score, "_id": bson.M{"$gt": last.ID}},
+		}},
+	}}
+	if len(tx.Statement.Args) != 1 || !equalDocuments(t, tx.Statement.Args[0], want) {
+		t.Fatalf("filter = %v, want %v", tx.Statement.Args, want)
+	}
+}
+
+func TestFindPageRejectsInvalidPaginators(t *testing.T) {
+	orm := newArticles(t)
+	var page []article
+	p := &mongorm.Paginator{Limit: 2}
+	if err := orm.FindPage(p, &page).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := p.Next
+
+	tests := []struct {
+		name string
+		p    mongorm.Paginator
+		want error
+	}{
+		{"garbage token", mongorm.Paginator{Limit: 2, After: "not a token!"}, mongorm.ErrInvalidCursor},
+		{"not a document", mongorm.Paginator{Limit: 2, After: "AAAA"}, mongorm.ErrInvalidCursor},
+		{"other order", mongorm.Paginator{Order: "score desc", Limit: 2, After: token}, mongorm.ErrInvalidCursor},
+		{"both directions", mongorm.Paginator{Limit: 2, After: token, Before: token}, mongorm.ErrInvalidCursor},
+		{"no limit", mongorm.Paginator{}, nil},
+	}
+	for _, tt := range tests {
+		err := orm.FindPage(&tt.p, &page).Error
+		if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package mongorm
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Path returns the dot-notation path of a field nested in the embedded
+// documents of model, given by the Go names of the fields leading to it.
+// Each name is resolved to its document key as the bson tags and the
+// NamingStrategy store it, so that conditions on nested fields follow
+// renamed keys:
+//
+//	city := orm.Path(&User{}, "Address", "City") // "address.city"
+//	orm.Where(city+" = ?", "Oslo").Find(&users)
+//
+// Slices of documents are stepped through, as dot notation does for
+// arrays. Names that are not fields, such as map keys, array indexes and
+// positional operators, are kept as given:
+//
+//	orm.Path(&Order{}, "Items", "$", "Status") // "items.$.status"
+//
+// The fields of embedded structs are joined to their prefix instead, as in
+// "total_amount". Select, Omit, Pluck and Distinct resolve dotted Go
+// names, such as "Address.City", the same way.
+func (orm *MongoORM) Path(model interface{}, names ...string) string {
+	return orm.path(modelType(model), names)
+}
+
+// path resolves names, a path of field names, to document keys starting
+// from the struct type t. The keys of embedded fields are joined to their
+// prefix rather than nested.
+func (orm *MongoORM) path(t reflect.Type, names []string) string {
+	var path strings.Builder
+	prefix := ""
+	for i, name := range names {
+		key := name
+		for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			t = t.Elem()
+		}
+		switch {
+		case t == nil:
+		case t.Kind() == reflect.Map:
+			t = t.Elem()
+		case t.Kind() != reflect.Struct:
+			t = nil
+		default:
+			if field, ok := orm.lookupField(t, name); ok {
+				key = orm.fieldName(field)
+				t = field.Type
+				if embedded, ok := embeddedPrefix(field); ok && i < len(names)-1 {
+					prefix += embedded
+					continue
+				}
+			} else if !positional(name) {
+				t = nil
+			}
+		}
+		if path.Len() > 0 {
+			path.WriteByte('.')
+		}
+		path.WriteString(prefix + key)
+		prefix = ""
+	}
+	return path.String()
+}
+
+// positional reports whether name, a part of a dotted path, is an array
+// index or a positional operator such as $ or $[elem].
+func positional(name string) bool {
+	if strings.HasPrefix(name, "$") {
+		return true
+	}
+	for _, r := range name {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,530 @@
+// Package audit records the history of the documents written through
+// mongorm: every create, update and delete adds a Record to the audit
+// collection of the collection it changed, holding the fields it changed
+// before and after the operation, the actor found in its context and its
+// time.
+//
+//	if err := orm.RegisterPlugin(audit.NewPlugin(audit.Redact("password_hash"))); err != nil {
+//		return err
+//	}
+//
+//	ctx = audit.WithActor(ctx, user.ID.Hex())
+//	orm.WithContext(ctx).Save(&invoice) // recorded in invoices_audit
+//
+// The documents an update or delete affects are read before it runs, by the
+// ID of the document or model it is given, or else by its chained
+// conditions, and read again once it succeeded; only those that changed are
+// recorded. They are read as the operation sees them, in the database and
+// within the scope its callbacks chose, such as the tenant's. The documents
+// of bulk writes are read by the filters of their operations and the IDs of
+// those they insert; operations without a filter are not recorded.
+// Operations that fail, dry runs and raw commands are not recorded either.
+// Documents given as maps are recorded like structs.
+//
+// Only the first documents of an operation, 1000 unless set with WithLimit,
+// are read whole. The others are read by ID, a batch at a time, and
+// recorded without their changes, so that an update of a whole collection
+// does not load it in memory.
+//
+// Records are written in the context of the operation, so that they join
+// its transaction. A failure to write them is reported in the operation's
+// Error.
+package audit
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Redacted replaces the values of redacted fields in records.
+const Redacted = "[REDACTED]"
+
+// Record is the history document stored for each document changed by an
+// operation.
+type Record struct {
+	ID primitive.ObjectID `bson:"_id,omitempty"`
+	// DocumentID is the ID of the changed document.
+	DocumentID interface{} `bson:"document_id"`
+	// Operation is "create", "update" or "delete", after what happened to
+	// the document in bulk writes. Soft deletes are deletes whose After
+	// holds the deletion timestamp.
+	Operation string `bson:"operation"`
+	// Actor is the actor found in the context of the operation.
+	Actor string `bson:"actor,omitempty"`
+	// Time is when the operation completed.
+	Time time.Time `bson:"time"`
+	// Before and After hold the top-level fields that changed, as they
+	// were before and after the operation. Before is empty for created
+	// documents and After for deleted ones, which are recorded whole. Both
+	// are empty for documents past the limit set with WithLimit.
+	Before bson.M `bson:"before,omitempty"`
+	After  bson.M `bson:"after,omitempty"`
+}
+
+type contextKey struct{}
+
+// WithActor returns a copy of ctx carrying actor, such as the ID of the
+// user on whose behalf operations run.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, contextKey{}, actor)
+}
+
+// FromContext returns the actor carried by ctx.
+func FromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(contextKey{}).(string)
+	return actor, ok && actor != ""
+}
+
+// Option configures the plugin.
+type Option func(*Plugin)
+
+// Redact replaces the values of the fields stored under keys, top-level
+// document keys, with Redacted in records. Changes to them are still
+// recorded.
+func Redact(keys ...string) Option {
+	return func(p *Plugin) {
+		for _, key := range keys {
+			p.redacted[key] = true
+		}
+	}
+}
+
+// WithCollection sets the name of the audit collection of each collection.
+// Defaults to the name of the collection followed by "_audit".
+func WithCollection(name func(collection string) string) Option {
+	return func(p *Plugin) {
+		p.collection = name
+	}
+}
+
+// WithActorFunc sets how the actor is found in the context of an
+// operation, for applications storing it under their own key. Defaults to
+// FromContext.
+func WithActorFunc(fn func(ctx context.Context) (string, bool)) Option {
+	return func(p *Plugin) {
+		p.actorFunc = fn
+	}
+}
+
+// WithLimit sets how many of the documents an operation changes are read
+// whole and recorded with their changes. Defaults to 1000.
+func WithLimit(n int) Option {
+	return func(p *Plugin) {
+		if n > 0 {
+			p.limit = n
+		}
+	}
+}
+
+// Plugin is a mongorm.Plugin recording the history of documents.
+type Plugin struct {
+	redacted   map[string]bool
+	collection func(string) string
+	actorFunc  func(context.Context) (string, bool)
+	limit      int
+
+	// pending holds the documents read before each running operation,
+	// by statement.
+	pending sync.Map // *mongorm.Statement -> documents
+}
+
+// documents are the documents read around an operation, by ID as given by
+// idKey. Those past the limit hold their _id only and are listed in
+// partial.
+type documents struct {
+	byID    map[string]bson.M
+	partial map[string]bool
+}
+
+// NewPlugin returns the audit plugin.
+func NewPlugin(opts ...Option) *Plugin {
+	p := &Plugin{
+		redacted:   map[string]bool{},
+		collection: func(collection string) string { return collection + "_audit" },
+		actorFunc:  FromContext,
+		limit:      1000,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Name implements mongorm.Plugin.
+func (p *Plugin) Name() string {
+	return "audit"
+}
+
+// Initialize implements mongorm.Plugin.
+func (p *Plugin) Initialize(orm *mongorm.MongoORM) error {
+	callbacks := orm.Callback()
+	processors := map[string]*mongorm.Processor{
+		"create": callbacks.Create(),
+		"update": callbacks.Update(),
+		"delete": callbacks.Delete(),
+		"bulk":   callbacks.Bulk(),
+	}
+	for op, processor := range processors {
+		if op != "create" {
+			if err := processor.Before("mongorm:"+op).Register("audit:before_"+op, p.before); err != nil {
+				return err
+			}
+		}
+		if err := processor.After("mongorm:"+op).Register("audit:after_"+op, p.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// before reads the documents the operation of tx is about to change.
+func (p *Plugin) before(tx *mongorm.MongoORM) {
+	stmt := tx.Statement
+	if tx.Error != nil || stmt.DryRun {
+		return
+	}
+	var ids []interface{}
+	filter := stmt.Filter
+	if models, ok := stmt.Dest.([]mongo.WriteModel); ok {
+		filter = bulkFilter(models)
+	} else {
+		ids = documentIDs(reflect.ValueOf(stmt.Dest))
+		if len(ids) == 0 && stmt.Model != nil {
+			ids = documentIDs(reflect.ValueOf(stmt.Model))
+		}
+	}
+	if len(ids) == 0 && len(filter) == 0 {
+		return
+	}
+	docs, err := p.load(tx, ids, filter)
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+	p.pending.Store(stmt, docs)
+}
+
+// after records the changes made by the operation of tx.
+func (p *Plugin) after(tx *mongorm.MongoORM) {
+	stmt := tx.Statement
+	pending, _ := p.pending.LoadAndDelete(stmt)
+	if tx.Error != nil || stmt.DryRun || stmt.Collection == nil {
+		return
+	}
+	if stmt.Operation == "create" && tx.RowsAffected == 0 {
+		return
+	}
+	before, _ := pending.(documents)
+
+	// The documents to read again are those read before, those given to
+	// the operation, and those it upserted or selected by an ID the
+	// statement does not show otherwise.
+	ids := documentIDs(reflect.ValueOf(stmt.Dest))
+	if models, ok := stmt.Dest.([]mongo.WriteModel); ok {
+		ids = insertedIDs(models)
+	}
+	for _, doc := range before.byID {
+		ids = append(ids, doc["_id"])
+	}
+	if tx.UpdateResult != nil && tx.UpdateResult.UpsertedID != nil {
+		ids = append(ids, tx.UpdateResult.UpsertedID)
+	}
+	if tx.BulkWriteResult != nil {
+		for _, id := range tx.BulkWriteResult.UpsertedIDs {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		ids = filteredID(stmt.Args)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	after, err := p.load(tx, ids, nil)
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+
+	now := time.Now()
+	actor, _ := p.actorFunc(stmt.Context)
+	var records []interface{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		key := idKey(id)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		old, new := before.byID[key], after.byID[key]
+		record := Record{DocumentID: id, Operation: operation(stmt.Operation, old, new), Actor: actor, Time: now}
+		switch {
+		case old == nil && new == nil && record.Operation != "delete":
+			continue
+		case before.partial[key] || after.partial[key]:
+			// Documents past the limit are recorded without their changes.
+		case old == nil || new == nil:
+			record.Before, record.After = p.redact(old), p.redact(new)
+		default:
+			record.Before, record.After = p.changes(old, new)
+			if len(record.Before) == 0 && len(record.After) == 0 {
+				continue
+			}
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return
+	}
+	collection := stmt.Collection.Database().Collection(p.collection(stmt.Collection.Name()))
+	if _, err := collection.InsertMany(stmt.Context, records); err != nil {
+		tx.AddError(err)
+	}
+}
+
+// load reads the documents the operation of tx operates on matching
+// filter, with an ID among ids if any are given, routed and scoped as the
+// operation is. The first p.limit documents are read whole, and the others
+// by ID only.
+func (p *Plugin) load(tx *mongorm.MongoORM, ids []interface{}, filter bson.M) (documents, error) {
+	docs := documents{byID: map[string]bson.M{}, partial: map[string]bool{}}
+	stmt := tx.Statement
+	model := stmt.Model
+	if _, bulk := stmt.Dest.([]mongo.WriteModel); model == nil && !bulk {
+		model = stmt.Dest
+	}
+	if model == nil {
+		return docs, nil
+	}
+
+	query := func() *mongorm.MongoORM {
+		query := tx.Session(&mongorm.Session{NewDB: true, Context: stmt.Context}).Unscoped()
+		if stmt.Table != "" {
+			query = query.Table(stmt.Table)
+		}
+		query = query.Model(model)
+		if len(filter) > 0 {
+			query = query.Where(filter)
+		}
+		if len(ids) > 0 {
+			query = query.Where(bson.M{"_id": bson.M{"$in": ids}})
+		}
+		return query
+	}
+	var whole []bson.M
+	if err := query().Limit(p.limit).Find(&whole).Error; err != nil {
+		return docs, err
+	}
+	for _, doc := range whole {
+		docs.byID[idKey(doc["_id"])] = doc
+	}
+	if len(whole) < p.limit {
+		return docs, nil
+	}
+
+	var batch []bson.M
+	err := query().Select("_id").FindInBatches(&batch, p.limit, func(*mongorm.MongoORM, int) error {
+		for _, doc := range batch {
+			key := idKey(doc["_id"])
+			if _, ok := docs.byID[key]; !ok {
+				docs.byID[key] = bson.M{"_id": doc["_id"]}
+				docs.partial[key] = true
+			}
+		}
+		return nil
+	}).Error
+	return docs, err
+}
+
+// operation returns the operation recorded for a document changed by op,
+// which for bulk writes depends on whether it was created or deleted.
+func operation(op string, old, new bson.M) string {
+	if op != "bulk" {
+		return op
+	}
+	switch {
+	case old == nil:
+		return "create"
+	case new == nil:
+		return "delete"
+	}
+	return "update"
+}
+
+// bulkFilter returns the conditions matching the documents the updates,
+// replacements and deletes of a bulk write select, or nil if it has none.
+// Operations without a filter are left out rather than read as selecting
+// every document; the driver rejects them unless a callback scopes them.
+func bulkFilter(models []mongo.WriteModel) bson.M {
+	var filters bson.A
+	for _, model := range models {
+		var filter interface{}
+		switch m := model.(type) {
+		case *mongo.UpdateOneModel:
+			filter = m.Filter
+		case *mongo.UpdateManyModel:
+			filter = m.Filter
+		case *mongo.ReplaceOneModel:
+			filter = m.Filter
+		case *mongo.DeleteOneModel:
+			filter = m.Filter
+		case *mongo.DeleteManyModel:
+			filter = m.Filter
+		default:
+			continue
+		}
+		if filter == nil {
+			continue
+		}
+		filters = append(filters, filter)
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return bson.M{"$or": filters}
+}
+
+// insertedIDs returns the IDs of the documents inserted by a bulk write.
+func insertedIDs(models []mongo.WriteModel) []interface{} {
+	var ids []interface{}
+	for _, model := range models {
+		if m, ok := model.(*mongo.InsertOneModel); ok {
+			ids = append(ids, documentIDs(reflect.ValueOf(m.Document))...)
+		}
+	}
+	return ids
+}
+
+// changes returns the top-level fields that differ between old and new, as
+// they are in each.
+func (p *Plugin) changes(old, new bson.M) (before, after bson.M) {
+	before, after = bson.M{}, bson.M{}
+	for key, value := range old {
+		if other, ok := new[key]; !ok || !sameValue(value, other) {
+			before[key] = p.redactValue(key, value)
+		}
+	}
+	for key, value := range new {
+		if other, ok := old[key]; !ok || !sameValue(value, other) {
+			after[key] = p.redactValue(key, value)
+		}
+	}
+	return before, after
+}
+
+// redact returns a copy of doc with the values of redacted fields replaced.
+func (p *Plugin) redact(doc bson.M) bson.M {
+	if doc == nil {
+		return nil
+	}
+	redacted := make(bson.M, len(doc))
+	for key, value := range doc {
+		redacted[key] = p.redactValue(key, value)
+	}
+	return redacted
+}
+
+func (p *Plugin) redactValue(key string, value interface{}) interface{} {
+	if p.redacted[key] {
+		return Redacted
+	}
+	return value
+}
+
+// documentIDs returns the IDs of v, a document or slice of documents:
+// the _id of the structs, or the "_id" or "id" key of the maps, unless
+// unset.
+func documentIDs(v reflect.Value) []interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		var ids []interface{}
+		for i := 0; i < v.Len(); i++ {
+			ids = append(ids, documentIDs(v.Index(i))...)
+		}
+		return ids
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range []string{"_id", "id"} {
+			if id := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())); id.IsValid() && !isZero(id) {
+				return []interface{}{id.Interface()}
+			}
+		}
+	case reflect.Struct:
+		data, err := bson.Marshal(v.Interface())
+		if err != nil {
+			return nil
+		}
+		id, err := bson.Raw(data).LookupErr("_id")
+		if err != nil || id.Type == bson.TypeNull {
+			return nil
+		}
+		if oid, ok := id.ObjectIDOK(); ok && oid.IsZero() {
+			return nil
+		}
+		return []interface{}{id}
+	}
+	return nil
+}
+
+// filteredID returns the ID selected by the filter of the driver call
+// recorded in args, when it selects a single ID.
+func filteredID(args []interface{}) []interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	filter, ok := args[0].(bson.M)
+	if !ok {
+		return nil
+	}
+	id, ok := filter["_id"]
+	if !ok {
+		return nil
+	}
+	if doc, ok := id.(bson.M); ok {
+		for key := range doc {
+			if strings.HasPrefix(key, "$") {
+				return nil
+			}
+		}
+	}
+	return []interface{}{id}
+}
+
+// idKey returns a key identifying id by its encoded value, so that IDs read
+// from documents and taken from structs compare equal.
+func idKey(id interface{}) string {
+	t, data, err := bson.MarshalValue(id)
+	if err != nil {
+		return ""
+	}
+	return string(rune(t)) + string(data)
+}
+
+// sameValue reports whether a and b encode to the same BSON value.
+func sameValue(a, b interface{}) bool {
+	return idKey(a) != "" && idKey(a) == idKey(b)
+}
+
+func isZero(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.IsZero()
+}
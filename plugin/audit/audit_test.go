@@ -0,0 +1,194 @@
+package audit_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"github.com/imkrishnaagrawal/mongorm/plugin/audit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type item struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty"`
+	Name  string             `bson:"name"`
+	Price int                `bson:"price"`
+}
+
+func newORM(t *testing.T) *mongorm.MongoORM {
+	t.Helper()
+	orm := mongormtest.New()
+	if err := orm.RegisterPlugin(audit.NewPlugin()); err != nil {
+		t.Fatal(err)
+	}
+	return orm
+}
+
+func records(t *testing.T, orm *mongorm.MongoORM, collection string) []audit.Record {
+	t.Helper()
+	var records []audit.Record
+	if err := orm.Table(collection).Order("time").Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestUpdatesAreRecorded(t *testing.T) {
+	orm := newORM(t)
+	ctx := audit.WithActor(orm.Context(), "ann")
+	it := item{Name: "pen", Price: 2}
+	if err := orm.WithContext(ctx).Create(&it).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.WithContext(ctx).Model(&it).Updates(bson.M{"price": 3}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got := records(t, orm, "items_audit")
+	if len(got) != 2 {
+		t.Fatalf("records = %d, want 2", len(got))
+	}
+	if got[0].Operation != "create" || got[0].After["name"] != "pen" {
+		t.Fatalf("create record = %+v", got[0])
+	}
+	update := got[1]
+	if update.Operation != "update" || update.Actor != "ann" {
+		t.Fatalf("update record = %+v", update)
+	}
+	if len(update.Before) != 1 || update.Before["price"] != int32(2) || update.After["price"] != int32(3) {
+		t.Fatalf("update changes = %v -> %v, want price 2 -> 3", update.Before, update.After)
+	}
+}
+
+func TestDeleteByIDIsRecordedWithItsState(t *testing.T) {
+	orm := newORM(t)
+	it := item{Name: "pen", Price: 2}
+	if err := orm.Create(&it).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Delete(&item{}, it.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got := records(t, orm, "items_audit")
+	if len(got) != 2 {
+		t.Fatalf("records = %d, want 2", len(got))
+	}
+	deleted := got[1]
+	if deleted.Operation != "delete" || deleted.DocumentID != it.ID {
+		t.Fatalf("delete record = %+v", deleted)
+	}
+	if deleted.Before["name"] != "pen" || deleted.After != nil {
+		t.Fatalf("delete changes = %v -> %v, want the deleted document before", deleted.Before, deleted.After)
+	}
+}
+
+func TestDocumentsAreReadAsOperationRoutesThem(t *testing.T) {
+	orm := mongormtest.New()
+	err := orm.Callback().Update().Before("mongorm:update").Register("test:archive", func(tx *mongorm.MongoORM) {
+		tx.Statement.CollectionPrefix = "archive_"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.RegisterPlugin(audit.NewPlugin()); err != nil {
+		t.Fatal(err)
+	}
+	it := item{Name: "pen", Price: 2}
+	if err := orm.Table("archive_items").Create(&it).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Model(&it).Updates(bson.M{"price": 3}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got := records(t, orm, "archive_items_audit")
+	if len(got) != 2 {
+		t.Fatalf("records = %d, want 2", len(got))
+	}
+	if update := got[1]; update.Before["price"] != int32(2) || update.After["price"] != int32(3) {
+		t.Fatalf("update changes = %v -> %v, want price 2 -> 3", update.Before, update.After)
+	}
+}
+
+func TestFailedOperationsAreNotRecorded(t *testing.T) {
+	orm := newORM(t)
+	it := item{Name: "pen"}
+	if err := orm.Create(&it).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Create(&it).Error; err == nil {
+		t.Fatal("duplicate create succeeded")
+	}
+	if got := records(t, orm, "items_audit"); len(got) != 1 {
+		t.Fatalf("records = %d, want 1", len(got))
+	}
+}
+
+func TestDocumentsPastLimitAreRecordedByID(t *testing.T) {
+	orm := mongormtest.New()
+	if err := orm.RegisterPlugin(audit.NewPlugin(audit.WithLimit(2))); err != nil {
+		t.Fatal(err)
+	}
+	items := []item{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+	if err := orm.Create(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Model(&item{}).Where("price = ?", 0).UpdateMany(bson.M{"price": 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var creates, updates, whole int
+	for _, record := range records(t, orm, "items_audit") {
+		switch record.Operation {
+		case "create":
+			creates++
+		case "update":
+			updates++
+		}
+		if record.Before != nil || record.After != nil {
+			whole++
+		}
+	}
+	if creates != 5 || updates != 5 || whole != 4 {
+		t.Fatalf("records = %d creates and %d updates, %d with changes; want 5, 5 and 4", creates, updates, whole)
+	}
+}
+
+func TestMapCreatesAreRecorded(t *testing.T) {
+	orm := newORM(t)
+	if err := orm.Table("items").Create(bson.M{"name": "pen"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := records(t, orm, "items_audit")
+	if len(got) != 1 || got[0].Operation != "create" || got[0].After["name"] != "pen" {
+		t.Fatalf("records = %+v, want the create of pen", got)
+	}
+}
+
+func TestBulkWithoutFilterIsNotRead(t *testing.T) {
+	orm := newORM(t)
+	if err := orm.Create(&[]item{{Name: "pen"}, {Name: "ink"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := orm.Callback().Bulk().Before("mongorm:bulk").Register("test:scope", func(tx *mongorm.MongoORM) {
+		tx.Statement.Scope = func(reflect.Type) bson.M { return bson.M{"name": "pen"} }
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := 0
+	if err := orm.Callback().Query().Register("test:reads", func(*mongorm.MongoORM) { reads++ }); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := orm.Model(&item{}).Bulk().DeleteMany(nil).Execute()
+	if tx.Error != nil || tx.RowsAffected != 1 {
+		t.Fatalf("scoped delete = %d (%v), want pen deleted", tx.RowsAffected, tx.Error)
+	}
+	if reads != 0 {
+		t.Fatalf("audit reads = %d, want none for a bulk without filters", reads)
+	}
+}
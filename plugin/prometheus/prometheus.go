@@ -0,0 +1,139 @@
+// Package prometheus exports metrics about mongorm operations to Prometheus.
+//
+//	if err := orm.RegisterPlugin(prometheus.NewPlugin(prometheus.Config{})); err != nil {
+//		return err
+//	}
+//
+// The plugin maintains two metrics, labelled with the collection, the verb,
+// that is the driver call such as "find" or "updateOne", and, for the
+// counter, the status "ok", "not_found" or "error":
+//
+//	mongorm_operations_total{collection, verb, status}
+//	mongorm_operation_duration_seconds{collection, verb}
+//
+// It is versioned as a separate module, which keeps the Prometheus client
+// out of the dependencies of mongorm itself:
+//
+//	go get github.com/imkrishnaagrawal/mongorm/plugin/prometheus
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config configures the plugin.
+type Config struct {
+	// Namespace prefixes the metric names. Defaults to "mongorm".
+	Namespace string
+	// Registerer registers the metrics. Defaults to
+	// prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+	// Buckets are the latency histogram buckets, in seconds. Defaults to
+	// prometheus.DefBuckets.
+	Buckets []float64
+}
+
+// Plugin is a mongorm.Plugin recording operation counts and latencies.
+type Plugin struct {
+	config     Config
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+}
+
+type startKey struct{}
+
+// NewPlugin returns the metrics plugin.
+func NewPlugin(config Config) *Plugin {
+	if config.Namespace == "" {
+		config.Namespace = "mongorm"
+	}
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	if config.Buckets == nil {
+		config.Buckets = prometheus.DefBuckets
+	}
+
+	return &Plugin{
+		config: config,
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Name:      "operations_total",
+			Help:      "Number of operations by collection, verb and status.",
+		}, []string{"collection", "verb", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of operations by collection and verb.",
+			Buckets:   config.Buckets,
+		}, []string{"collection", "verb"}),
+	}
+}
+
+// Name implements mongorm.Plugin.
+func (p *Plugin) Name() string {
+	return "prometheus"
+}
+
+// Initialize implements mongorm.Plugin.
+func (p *Plugin) Initialize(orm *mongorm.MongoORM) error {
+	for _, collector := range []prometheus.Collector{p.operations, p.duration} {
+		if err := p.config.Registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	callbacks := orm.Callback()
+	processors := map[string]*mongorm.Processor{
+		"create": callbacks.Create(),
+		"query":  callbacks.Query(),
+		"update": callbacks.Update(),
+		"delete": callbacks.Delete(),
+		"bulk":   callbacks.Bulk(),
+	}
+	for op, processor := range processors {
+		if err := processor.Before("mongorm:"+op).Register("prometheus:before_"+op, p.before); err != nil {
+			return err
+		}
+		if err := processor.After("mongorm:"+op).Register("prometheus:after_"+op, p.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) before(tx *mongorm.MongoORM) {
+	tx.Statement.Context = context.WithValue(tx.Statement.Context, startKey{}, time.Now())
+}
+
+func (p *Plugin) after(tx *mongorm.MongoORM) {
+	start, ok := tx.Statement.Context.Value(startKey{}).(time.Time)
+	if !ok {
+		return
+	}
+
+	collection := ""
+	if tx.Statement.Collection != nil {
+		collection = tx.Statement.Collection.Name()
+	}
+	verb := tx.Statement.Method
+	if verb == "" {
+		verb = tx.Statement.Operation
+	}
+
+	status := "ok"
+	switch {
+	case errors.Is(tx.Error, mongorm.ErrRecordNotFound):
+		status = "not_found"
+	case tx.Error != nil:
+		status = "error"
+	}
+
+	p.operations.WithLabelValues(collection, verb, status).Inc()
+	p.duration.WithLabelValues(collection, verb).Observe(time.Since(start).Seconds())
+}
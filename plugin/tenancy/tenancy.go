@@ -0,0 +1,440 @@
+// Package tenancy scopes mongorm operations to the tenant found in their
+// context, so that the documents of one tenant cannot be read or written on
+// behalf of another.
+//
+//	if err := orm.RegisterPlugin(tenancy.NewPlugin()); err != nil {
+//		return err
+//	}
+//
+//	ctx = tenancy.WithTenant(ctx, "acme")
+//	orm.WithContext(ctx).Find(&invoices)
+//	tenancy.Tenant(orm, "acme").Create(&invoice)
+//
+// By default every tenant shares the same collections: models with a
+// string field stored under "tenant_id" have the tenant's ID added to every
+// filter, including those selecting a document by ID, and set on the
+// documents they create or save; maps given to Create are left as they
+// are, and a copy holding the field written instead. Writes giving the
+// field another tenant's ID, including updates, bulk writes and the values
+// given to Attrs and Assign, fail with ErrCrossTenant. Models without the
+// field are shared between tenants.
+//
+// WithDatabase and WithCollectionPrefix instead give each tenant its own
+// database or its own set of collections, to which every operation is
+// routed. Indexes and validators are not created by AutoMigrate in those;
+// migrate each tenant with a MongoORM opened on its database, or with a
+// NamingStrategy using its prefix.
+//
+// Aggregations join the collections of models, given to Joins or
+// Pipeline.Lookup, as they read them; joins of other collections by name
+// fail with mongorm.ErrUnscopedJoin. Raw collections returned by
+// Collection are routed as well, but refused with ErrUnscoped in shared
+// collections, whose documents they could not scope.
+//
+// Operations without a tenant fail with ErrMissingTenant unless
+// AllowMissingTenant is given, in which case they are left alone. Raw
+// collections are always returned without a tenant, for migrations and
+// fixtures.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrMissingTenant is returned by operations whose context carries no
+	// tenant.
+	ErrMissingTenant = errors.New("tenancy: no tenant in context")
+	// ErrCrossTenant is returned by writes that would store a document for
+	// another tenant than the one in their context.
+	ErrCrossTenant = errors.New("tenancy: cross-tenant write")
+	// ErrUnscoped is returned by operations of a tenant that cannot be
+	// scoped to it, such as raw access to shared collections.
+	ErrUnscoped = errors.New("tenancy: operation cannot be scoped to tenant")
+)
+
+// DefaultField is the document key holding the tenant of shared
+// collections.
+const DefaultField = "tenant_id"
+
+type contextKey struct{}
+
+// WithTenant returns a copy of ctx carrying tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant carried by ctx.
+func FromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(contextKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// Tenant returns an instance whose operations run on behalf of tenant:
+//
+//	tenancy.Tenant(orm, "acme").Where("paid = ?", false).Find(&invoices)
+func Tenant(orm *mongorm.MongoORM, tenant string) *mongorm.MongoORM {
+	return orm.WithContext(WithTenant(orm.Context(), tenant))
+}
+
+// Option configures the plugin.
+type Option func(*Plugin)
+
+// WithField sets the document key holding the tenant in shared
+// collections. Defaults to DefaultField.
+func WithField(key string) Option {
+	return func(p *Plugin) {
+		p.field = key
+	}
+}
+
+// WithDatabase gives each tenant its own database, named by name:
+//
+//	tenancy.WithDatabase(func(tenant string) string { return "app_" + tenant })
+func WithDatabase(name func(tenant string) string) Option {
+	return func(p *Plugin) {
+		p.database = name
+	}
+}
+
+// WithCollectionPrefix gives each tenant its own collections, whose names
+// start with the prefix returned by prefix.
+//
+//	tenancy.WithCollectionPrefix(func(tenant string) string { return tenant + "_" })
+func WithCollectionPrefix(prefix func(tenant string) string) Option {
+	return func(p *Plugin) {
+		p.prefix = prefix
+	}
+}
+
+// WithTenantFunc sets how the tenant is found in the context of an
+// operation, for applications storing it under their own key. Defaults to
+// FromContext.
+func WithTenantFunc(fn func(ctx context.Context) (string, bool)) Option {
+	return func(p *Plugin) {
+		p.tenantFunc = fn
+	}
+}
+
+// AllowMissingTenant lets operations without a tenant run unscoped, for
+// example for administrative jobs spanning every tenant.
+func AllowMissingTenant() Option {
+	return func(p *Plugin) {
+		p.allowMissing = true
+	}
+}
+
+// Plugin is a mongorm.Plugin scoping operations to a tenant.
+type Plugin struct {
+	field        string
+	database     func(string) string
+	prefix       func(string) string
+	tenantFunc   func(context.Context) (string, bool)
+	allowMissing bool
+}
+
+// NewPlugin returns the tenancy plugin.
+func NewPlugin(opts ...Option) *Plugin {
+	p := &Plugin{field: DefaultField, tenantFunc: FromContext}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Name implements mongorm.Plugin.
+func (p *Plugin) Name() string {
+	return "tenancy"
+}
+
+// Initialize implements mongorm.Plugin.
+func (p *Plugin) Initialize(orm *mongorm.MongoORM) error {
+	callbacks := orm.Callback()
+	processors := map[string]*mongorm.Processor{
+		"create": callbacks.Create(),
+		"query":  callbacks.Query(),
+		"update": callbacks.Update(),
+		"delete": callbacks.Delete(),
+		"bulk":   callbacks.Bulk(),
+		"raw":    callbacks.Raw(),
+	}
+	for op, processor := range processors {
+		if err := processor.Before("mongorm:"+op).Register("tenancy:"+op, p.scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shared reports whether tenants share collections, told apart by the
+// tenant field.
+func (p *Plugin) shared() bool {
+	return p.database == nil && p.prefix == nil
+}
+
+func (p *Plugin) scope(tx *mongorm.MongoORM) {
+	stmt := tx.Statement
+	tenant, ok := p.tenantFunc(stmt.Context)
+	if !ok {
+		if p.allowMissing || stmt.Operation == "raw" {
+			return
+		}
+		if t := stmt.ModelType(); p.shared() && t != nil && p.tenantField(tx, t) == nil {
+			return
+		}
+		tx.AddError(ErrMissingTenant)
+		return
+	}
+
+	switch {
+	case p.database != nil:
+		stmt.Database = p.database(tenant)
+		return
+	case p.prefix != nil:
+		stmt.CollectionPrefix = p.prefix(tenant)
+		return
+	case stmt.Operation == "raw":
+		tx.AddError(fmt.Errorf("%w: raw access to %s", ErrUnscoped, stmt.Table))
+		return
+	}
+
+	stmt.Scope = func(t reflect.Type) bson.M {
+		if p.tenantField(tx, t) == nil {
+			return nil
+		}
+		return bson.M{p.field: tenant}
+	}
+	if stmt.Operation != "query" && stmt.Operation != "delete" {
+		if err := p.checkWrite(tx, tenant); err != nil {
+			tx.AddError(err)
+		}
+	}
+}
+
+// checkWrite sets the tenant field of the documents written by stmt, and
+// fails if they, the update or the values given to Attrs and Assign give
+// it another value.
+func (p *Plugin) checkWrite(tx *mongorm.MongoORM, tenant string) error {
+	stmt := tx.Statement
+	if models, ok := stmt.Dest.([]mongo.WriteModel); ok {
+		return p.checkModels(tx, models, tenant)
+	}
+	dest, err := p.setTenant(tx, reflect.ValueOf(stmt.Dest), tenant, stmt.Operation == "create")
+	if err != nil {
+		return err
+	}
+	if dest.IsValid() {
+		stmt.Dest = dest.Interface()
+	}
+	for _, values := range []bson.M{stmt.Attrs, stmt.Assigns} {
+		if value, ok := values[p.field]; ok {
+			if err := p.checkValue(value, tenant); err != nil {
+				return err
+			}
+		}
+	}
+	return p.checkUpdate(stmt.UpdateOperators, tenant)
+}
+
+// checkModels sets the tenant field of the documents inserted and replaced
+// by the write models of a bulk write, and fails if they, or its updates,
+// give it another value. Update pipelines cannot be checked, and fail with
+// ErrUnscoped for models with the tenant field.
+func (p *Plugin) checkModels(tx *mongorm.MongoORM, models []mongo.WriteModel, tenant string) error {
+	tenanted := p.tenantField(tx, tx.Statement.ModelType()) != nil
+	for _, model := range models {
+		var update interface{}
+		switch m := model.(type) {
+		case *mongo.InsertOneModel:
+			doc, err := p.setTenant(tx, reflect.ValueOf(m.Document), tenant, true)
+			if err != nil {
+				return err
+			}
+			if doc.IsValid() {
+				m.Document = doc.Interface()
+			}
+			continue
+		case *mongo.ReplaceOneModel:
+			doc, err := p.setTenant(tx, reflect.ValueOf(m.Replacement), tenant, true)
+			if err != nil {
+				return err
+			}
+			if doc.IsValid() {
+				m.Replacement = doc.Interface()
+			}
+			continue
+		case *mongo.UpdateOneModel:
+			update = m.Update
+		case *mongo.UpdateManyModel:
+			update = m.Update
+		default:
+			continue
+		}
+
+		var doc bson.M
+		switch u := update.(type) {
+		case bson.M:
+			doc = u
+		case map[string]interface{}:
+			doc = u
+		default:
+			data, err := bson.Marshal(update)
+			if err != nil || bson.Unmarshal(data, &doc) != nil {
+				if tenanted {
+					return fmt.Errorf("%w: update pipeline", ErrUnscoped)
+				}
+				continue
+			}
+		}
+		if err := p.checkUpdate(doc, tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTenant sets the tenant field of v, a document or slice of documents,
+// where it is empty, and fails if v gives it another value. Structs are set
+// in place, but maps are left as they are: the value returned holds copies
+// of them with the field set, or is invalid when nothing was copied.
+func (p *Plugin) setTenant(tx *mongorm.MongoORM, v reflect.Value, tenant string, create bool) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Value{}, nil
+		}
+		elem, err := p.setTenant(tx, v.Elem(), tenant, create)
+		if err != nil || !elem.IsValid() {
+			return reflect.Value{}, err
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(elem)
+		return copied, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Value{}, nil
+		}
+		return p.setTenant(tx, v.Elem(), tenant, create)
+	case reflect.Slice, reflect.Array:
+		copies := map[int]reflect.Value{}
+		for i := 0; i < v.Len(); i++ {
+			elem, err := p.setTenant(tx, v.Index(i), tenant, create)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			if elem.IsValid() {
+				copies[i] = elem
+			}
+		}
+		if len(copies) == 0 {
+			return reflect.Value{}, nil
+		}
+		copied := reflect.New(v.Type()).Elem()
+		if v.Kind() == reflect.Slice {
+			copied.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		}
+		reflect.Copy(copied, v)
+		for i, elem := range copies {
+			copied.Index(i).Set(elem)
+		}
+		return copied, nil
+	case reflect.Struct:
+		index := p.tenantField(tx, v.Type())
+		if index == nil {
+			return reflect.Value{}, nil
+		}
+		field, err := v.FieldByIndexErr(index)
+		if err != nil {
+			return reflect.Value{}, nil
+		}
+		switch {
+		case field.String() == tenant:
+		case field.String() != "":
+			return reflect.Value{}, fmt.Errorf("%w: %s %q", ErrCrossTenant, p.field, field.String())
+		case field.CanSet():
+			field.SetString(tenant)
+		}
+	case reflect.Map:
+		var doc bson.M
+		switch m := v.Interface().(type) {
+		case bson.M:
+			doc = m
+		case map[string]interface{}:
+			doc = m
+		default:
+			return reflect.Value{}, nil
+		}
+		if err := p.checkUpdate(doc, tenant); err != nil {
+			return reflect.Value{}, err
+		}
+		if value, ok := doc[p.field]; ok {
+			return reflect.Value{}, p.checkValue(value, tenant)
+		}
+		if !create || doc == nil {
+			return reflect.Value{}, nil
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len()+1)
+		for iter := v.MapRange(); iter.Next(); {
+			copied.SetMapIndex(iter.Key(), iter.Value())
+		}
+		copied.SetMapIndex(reflect.ValueOf(p.field), reflect.ValueOf(tenant))
+		return copied, nil
+	}
+	return reflect.Value{}, nil
+}
+
+// checkUpdate fails if the update operators in update change the tenant
+// field to another value than tenant, or remove it.
+func (p *Plugin) checkUpdate(update bson.M, tenant string) error {
+	for operator, fields := range update {
+		if !strings.HasPrefix(operator, "$") {
+			continue
+		}
+		var value interface{}
+		var ok bool
+		switch fields := fields.(type) {
+		case bson.M:
+			value, ok = fields[p.field]
+		case map[string]interface{}:
+			value, ok = fields[p.field]
+		}
+		if !ok {
+			continue
+		}
+		switch operator {
+		case "$set", "$setOnInsert":
+			if err := p.checkValue(value, tenant); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: %s %s", ErrCrossTenant, operator, p.field)
+		}
+	}
+	return nil
+}
+
+// checkValue fails if value, written to the tenant field, is not tenant.
+func (p *Plugin) checkValue(value interface{}, tenant string) error {
+	if s, ok := value.(string); !ok || s != tenant {
+		return fmt.Errorf("%w: %s %v", ErrCrossTenant, p.field, value)
+	}
+	return nil
+}
+
+// tenantField returns the index of the string field of t stored under the
+// tenant key, or nil if t has none.
+func (p *Plugin) tenantField(tx *mongorm.MongoORM, t reflect.Type) []int {
+	field, ok := tx.LookupField(t, p.field)
+	if !ok || !field.IsExported() || field.Type.Kind() != reflect.String {
+		return nil
+	}
+	return field.Index
+}
@@ -0,0 +1,265 @@
+package tenancy_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"github.com/imkrishnaagrawal/mongorm/plugin/tenancy"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type invoice struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	Tenant string             `bson:"tenant_id"`
+	Number string             `bson:"number"`
+	Paid   bool               `bson:"paid"`
+}
+
+func newORM(t *testing.T) *mongorm.MongoORM {
+	t.Helper()
+	orm := mongormtest.New()
+	if err := orm.RegisterPlugin(tenancy.NewPlugin()); err != nil {
+		t.Fatal(err)
+	}
+	return orm
+}
+
+func TestBulkWritesAreScopedToTenant(t *testing.T) {
+	orm := newORM(t)
+	acme, globex := tenancy.Tenant(orm, "acme"), tenancy.Tenant(orm, "globex")
+	if err := acme.Create(&invoice{Number: "A-1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := globex.Create(&invoice{Number: "G-1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	inserted := invoice{Number: "A-2"}
+	err := acme.Model(&invoice{}).Bulk().
+		Insert(&inserted).
+		UpdateMany(bson.M{}, bson.M{"$set": bson.M{"paid": true}}).
+		Execute().Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted.Tenant != "acme" {
+		t.Fatalf("inserted tenant = %q, want acme", inserted.Tenant)
+	}
+
+	var paid []invoice
+	if err := globex.Where("paid = ?", true).Find(&paid).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(paid) != 0 {
+		t.Fatalf("bulk update of acme paid %d invoices of globex", len(paid))
+	}
+	if err := acme.Where("paid = ?", true).Find(&paid).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(paid) != 2 {
+		t.Fatalf("acme paid invoices = %d, want 2", len(paid))
+	}
+}
+
+func TestBulkWritesRejectOtherTenants(t *testing.T) {
+	orm := newORM(t)
+	acme := tenancy.Tenant(orm, "acme")
+
+	err := acme.Bulk().Insert(&invoice{Tenant: "globex", Number: "G-1"}).Execute().Error
+	if !errors.Is(err, tenancy.ErrCrossTenant) {
+		t.Fatalf("insert for another tenant error = %v, want ErrCrossTenant", err)
+	}
+	err = acme.Model(&invoice{}).Bulk().
+		Update(bson.M{}, bson.M{"$set": bson.M{"tenant_id": "globex"}}).
+		Execute().Error
+	if !errors.Is(err, tenancy.ErrCrossTenant) {
+		t.Fatalf("update to another tenant error = %v, want ErrCrossTenant", err)
+	}
+}
+
+type customer struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	Tenant string             `bson:"tenant_id"`
+	Name   string             `bson:"name"`
+}
+
+type order struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Tenant     string             `bson:"tenant_id"`
+	CustomerID primitive.ObjectID `bson:"customer_id"`
+}
+
+func TestCreateStampsCopyOfMaps(t *testing.T) {
+	orm := newORM(t)
+	acme := tenancy.Tenant(orm, "acme")
+
+	doc := bson.M{"number": "A-1"}
+	if err := acme.Table("invoices").Create(doc).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc["tenant_id"]; ok {
+		t.Fatalf("created map = %v, want it left without tenant_id", doc)
+	}
+	var inv invoice
+	if err := acme.Where("number = ?", "A-1").First(&inv).Error; err != nil {
+		t.Fatal(err)
+	}
+	if inv.Tenant != "acme" {
+		t.Fatalf("stored tenant = %q, want acme", inv.Tenant)
+	}
+}
+
+func TestUpdateAndGetChecksUpdate(t *testing.T) {
+	orm := newORM(t)
+	acme := tenancy.Tenant(orm, "acme")
+	inv := invoice{Number: "A-1"}
+	if err := acme.Create(&inv).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := acme.UpdateAndGet(&inv, bson.M{"tenant_id": "globex"}).Error
+	if !errors.Is(err, tenancy.ErrCrossTenant) {
+		t.Fatalf("UpdateAndGet error = %v, want ErrCrossTenant", err)
+	}
+	err = acme.UpdateAndGet(&inv, bson.M{"$unset": bson.M{"tenant_id": ""}}).Error
+	if !errors.Is(err, tenancy.ErrCrossTenant) {
+		t.Fatalf("UpdateAndGet unsetting the tenant error = %v, want ErrCrossTenant", err)
+	}
+	if err := acme.UpdateAndGet(&inv, bson.M{"paid": true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !inv.Paid || inv.Tenant != "acme" {
+		t.Fatalf("updated invoice = %+v", inv)
+	}
+}
+
+func TestFirstOrCreateChecksAttrs(t *testing.T) {
+	orm := newORM(t)
+	var inv invoice
+	err := tenancy.Tenant(orm, "acme").Attrs(bson.M{"tenant_id": "globex"}).
+		Where("number = ?", "A-1").FirstOrCreate(&inv).Error
+	if !errors.Is(err, tenancy.ErrCrossTenant) {
+		t.Fatalf("FirstOrCreate error = %v, want ErrCrossTenant", err)
+	}
+}
+
+func TestLookupJoinsDocumentsOfTenant(t *testing.T) {
+	orm := newORM(t)
+	acme, globex := tenancy.Tenant(orm, "acme"), tenancy.Tenant(orm, "globex")
+	own, other := customer{Name: "Ann"}, customer{Name: "Bob"}
+	if err := acme.Create(&own).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := globex.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []primitive.ObjectID{own.ID, other.ID} {
+		if err := acme.Create(&order{CustomerID: id}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var results []struct {
+		CustomerID primitive.ObjectID `bson:"customer_id"`
+		Customer   []customer         `bson:"customer"`
+	}
+	err := acme.Model(&order{}).Aggregate().
+		Lookup(&customer{}, "customer_id", "_id", "customer").
+		All(&results).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("orders = %d, want 2", len(results))
+	}
+	for _, result := range results {
+		want := 0
+		if result.CustomerID == own.ID {
+			want = 1
+		}
+		if len(result.Customer) != want {
+			t.Fatalf("order of customer %s joined %d customers, want %d", result.CustomerID.Hex(), len(result.Customer), want)
+		}
+	}
+
+	err = acme.Model(&order{}).Aggregate().
+		Lookup("customers", "customer_id", "_id", "customer").
+		All(&results).Error
+	if !errors.Is(err, mongorm.ErrUnscopedJoin) {
+		t.Fatalf("lookup by name error = %v, want ErrUnscopedJoin", err)
+	}
+}
+
+func TestCollectionIsRefusedToTenants(t *testing.T) {
+	orm := newORM(t)
+	if _, err := tenancy.Tenant(orm, "acme").Collection("invoices"); !errors.Is(err, tenancy.ErrUnscoped) {
+		t.Fatalf("Collection error = %v, want ErrUnscoped", err)
+	}
+	if _, err := orm.Collection("invoices"); err != nil {
+		t.Fatalf("Collection without tenant error = %v", err)
+	}
+}
+
+func TestCollectionIsRoutedToTenantDatabase(t *testing.T) {
+	orm := mongormtest.New()
+	plugin := tenancy.NewPlugin(tenancy.WithDatabase(func(tenant string) string { return "app_" + tenant }))
+	if err := orm.RegisterPlugin(plugin); err != nil {
+		t.Fatal(err)
+	}
+	collection, err := tenancy.Tenant(orm, "acme").Collection("invoices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := collection.Database().Name(); name != "app_acme" {
+		t.Fatalf("database = %q, want app_acme", name)
+	}
+}
+
+func TestReadsAreScopedToTenant(t *testing.T) {
+	orm := newORM(t)
+	acme, globex := tenancy.Tenant(orm, "acme"), tenancy.Tenant(orm, "globex")
+	own, other := invoice{Number: "A-1"}, invoice{Number: "G-1"}
+	if err := acme.Create(&own).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := globex.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var invoices []invoice
+	if err := acme.Find(&invoices).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(invoices) != 1 || invoices[0].ID != own.ID {
+		t.Fatalf("invoices of acme = %+v, want A-1 alone", invoices)
+	}
+	var found invoice
+	if err := acme.First(&found, other.ID.Hex()).Error; !errors.Is(err, mongorm.ErrRecordNotFound) {
+		t.Fatalf("First of another tenant's invoice error = %v, want ErrRecordNotFound", err)
+	}
+	if err := acme.Delete(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := globex.First(&found, other.ID.Hex()).Error; err != nil {
+		t.Fatalf("invoice deleted by another tenant: %v", err)
+	}
+}
+
+func TestOperationsRequireTenant(t *testing.T) {
+	orm := newORM(t)
+	var invoices []invoice
+	if err := orm.Find(&invoices).Error; !errors.Is(err, tenancy.ErrMissingTenant) {
+		t.Fatalf("Find without tenant error = %v, want ErrMissingTenant", err)
+	}
+
+	orm = mongormtest.New()
+	if err := orm.RegisterPlugin(tenancy.NewPlugin(tenancy.AllowMissingTenant())); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Find(&invoices).Error; err != nil {
+		t.Fatalf("Find without tenant error = %v with AllowMissingTenant", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package tracing instruments mongorm operations with OpenTelemetry spans.
+//
+//	if err := orm.RegisterPlugin(tracing.NewPlugin()); err != nil {
+//		return err
+//	}
+//
+// Each operation starts a client span, named after the operation, as a child
+// of the span in the context given to WithContext, so that database calls
+// appear inside the traces of the requests issuing them.
+//
+// The package is a module of its own, so that applications not tracing
+// their operations do not depend on OpenTelemetry:
+//
+//	go get github.com/imkrishnaagrawal/mongorm/plugin/tracing
+package tracing
+
+import (
+	"errors"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/imkrishnaagrawal/mongorm/plugin/tracing"
+
+// Option configures the plugin.
+type Option func(*Plugin)
+
+// WithTracerProvider sets the provider spans are created with. Defaults to
+// the global provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(p *Plugin) {
+		p.provider = provider
+	}
+}
+
+// WithAttributes adds attrs to every span.
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return func(p *Plugin) {
+		p.attrs = append(p.attrs, attrs...)
+	}
+}
+
+// WithoutStatement omits the db.statement attribute, which holds the
+// rendered filter and update including their values.
+func WithoutStatement() Option {
+	return func(p *Plugin) {
+		p.omitStatement = true
+	}
+}
+
+// Plugin is a mongorm.Plugin creating a span per operation.
+type Plugin struct {
+	provider      trace.TracerProvider
+	tracer        trace.Tracer
+	attrs         []attribute.KeyValue
+	omitStatement bool
+}
+
+// NewPlugin returns the tracing plugin.
+func NewPlugin(opts ...Option) *Plugin {
+	p := &Plugin{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Name implements mongorm.Plugin.
+func (p *Plugin) Name() string {
+	return "tracing"
+}
+
+// Initialize implements mongorm.Plugin.
+func (p *Plugin) Initialize(orm *mongorm.MongoORM) error {
+	provider := p.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	p.tracer = provider.Tracer(instrumentationName)
+
+	callbacks := orm.Callback()
+	processors := map[string]*mongorm.Processor{
+		"create": callbacks.Create(),
+		"query":  callbacks.Query(),
+		"update": callbacks.Update(),
+		"delete": callbacks.Delete(),
+		"bulk":   callbacks.Bulk(),
+	}
+	for op, processor := range processors {
+		if err := processor.Before("mongorm:"+op).Register("tracing:before_"+op, p.before); err != nil {
+			return err
+		}
+		if err := processor.After("mongorm:"+op).Register("tracing:after_"+op, p.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) before(tx *mongorm.MongoORM) {
+	tx.Statement.Context, _ = p.tracer.Start(tx.Statement.Context, "mongorm."+tx.Statement.Operation,
+		trace.WithSpanKind(trace.SpanKindClient))
+}
+
+func (p *Plugin) after(tx *mongorm.MongoORM) {
+	span := trace.SpanFromContext(tx.Statement.Context)
+	if !span.IsRecording() {
+		return
+	}
+	defer span.End()
+
+	attrs := append([]attribute.KeyValue{
+		semconv.DBSystemMongoDB,
+		attribute.String("mongorm.operation", tx.Statement.Operation),
+		attribute.Int64("mongorm.rows_affected", int64(tx.RowsAffected)),
+	}, p.attrs...)
+	if stmt := tx.Statement; stmt.Collection != nil {
+		attrs = append(attrs,
+			semconv.DBName(stmt.Collection.Database().Name()),
+			semconv.DBMongoDBCollection(stmt.Collection.Name()),
+		)
+	}
+	if tx.Statement.Method != "" {
+		attrs = append(attrs, semconv.DBOperation(tx.Statement.Method))
+		if !p.omitStatement {
+			attrs = append(attrs, semconv.DBStatement(tx.Statement.String()))
+		}
+	}
+	span.SetAttributes(attrs...)
+
+	if err := tx.Error; err != nil && !errors.Is(err, mongorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
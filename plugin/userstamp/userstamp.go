@@ -0,0 +1,430 @@
+// Package userstamp records who created and last updated documents,
+// alongside the timestamps stamped by mongorm: models with string fields
+// stored under "created_by" and "updated_by" have them set to the
+// principal found in the context of the operations writing them.
+//
+//	if err := orm.RegisterPlugin(userstamp.NewPlugin()); err != nil {
+//		return err
+//	}
+//
+//	ctx = userstamp.WithPrincipal(ctx, user.ID.Hex())
+//	orm.WithContext(ctx).Create(&invoice) // created_by and updated_by
+//	orm.WithContext(ctx).Save(&invoice)   // updated_by
+//
+// Create, including slice creates and FirstOrCreate, sets both fields
+// where they are empty. Save sets updated_by on the saved struct, and
+// Updates and UpdateMany $set it, unless the update writes it itself, as
+// does UpdateAndGet when given operators with Set, Inc and friends.
+// Bulk writes set both fields on the documents they insert, and updated_by
+// on those they replace and update.
+// Maps are left as they are, and copies holding the fields written
+// instead. Fields are found by their document keys, as the bson tags and
+// the NamingStrategy store them.
+// UpdateColumn and UpdateColumns set nothing, and neither do operations
+// without a principal and raw commands.
+// In sessions with TrackChanges, Save writes a document saved by another
+// principal than the last one even when nothing else changed.
+//
+// The principal of applications already carrying one in their contexts,
+// for the audit plugin for example, is read with WithPrincipalFunc:
+//
+//	userstamp.NewPlugin(userstamp.WithPrincipalFunc(audit.FromContext))
+package userstamp
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Default keys of the fields holding the principals that created and last
+// updated documents.
+const (
+	DefaultCreatedField = "created_by"
+	DefaultUpdatedField = "updated_by"
+)
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying principal, such as the ID of
+// the user on whose behalf operations run.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal carried by ctx.
+func FromContext(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(contextKey{}).(string)
+	return principal, ok && principal != ""
+}
+
+// Option configures the plugin.
+type Option func(*Plugin)
+
+// WithFields sets the document keys of the fields holding the principals
+// that created and last updated documents. Defaults to DefaultCreatedField
+// and DefaultUpdatedField; an empty key leaves the field out.
+func WithFields(created, updated string) Option {
+	return func(p *Plugin) {
+		p.createdKey, p.updatedKey = created, updated
+	}
+}
+
+// WithPrincipalFunc sets how the principal is found in the context of an
+// operation, for applications storing it under their own key. Defaults to
+// FromContext.
+func WithPrincipalFunc(fn func(ctx context.Context) (string, bool)) Option {
+	return func(p *Plugin) {
+		p.principalFunc = fn
+	}
+}
+
+// Plugin is a mongorm.Plugin stamping the principals that create and
+// update documents.
+type Plugin struct {
+	createdKey    string
+	updatedKey    string
+	principalFunc func(context.Context) (string, bool)
+}
+
+// NewPlugin returns the userstamp plugin.
+func NewPlugin(opts ...Option) *Plugin {
+	p := &Plugin{
+		createdKey:    DefaultCreatedField,
+		updatedKey:    DefaultUpdatedField,
+		principalFunc: FromContext,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Name implements mongorm.Plugin.
+func (p *Plugin) Name() string {
+	return "userstamp"
+}
+
+// Initialize implements mongorm.Plugin.
+func (p *Plugin) Initialize(orm *mongorm.MongoORM) error {
+	callbacks := orm.Callback()
+	if err := callbacks.Create().Before("mongorm:create").Register("userstamp:create", p.create); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("mongorm:update").Register("userstamp:update", p.update); err != nil {
+		return err
+	}
+	return callbacks.Bulk().Before("mongorm:bulk").Register("userstamp:bulk", p.bulk)
+}
+
+// create stamps the documents about to be created by tx.
+func (p *Plugin) create(tx *mongorm.MongoORM) {
+	stmt := tx.Statement
+	principal, ok := p.principalFunc(stmt.Context)
+	if !ok {
+		return
+	}
+	t := stmt.ModelType()
+	keys := p.stampedKeys(tx, t, p.createdKey, p.updatedKey)
+	if len(keys) == 0 {
+		return
+	}
+	if dest := p.stampCreate(tx, reflect.ValueOf(stmt.Dest), keys, principal); dest.IsValid() {
+		stmt.Dest = dest.Interface()
+	}
+
+	// FirstOrCreate builds the document it inserts from Attrs rather than
+	// from its destination.
+	if stmt.Attrs == nil {
+		return
+	}
+	attrs := bson.M{}
+	for key, value := range stmt.Attrs {
+		attrs[key] = value
+	}
+	for _, key := range keys {
+		if _, ok := stmt.Assigns[key]; ok {
+			continue
+		}
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = principal
+		}
+	}
+	stmt.Attrs = attrs
+}
+
+// stampCreate sets the empty stamped fields of v, a document or slice of
+// documents, whose model stores them under keys. Structs are set in place,
+// but maps are left as they are: the value returned holds copies of them
+// with the keys set, or is invalid when nothing was copied.
+func (p *Plugin) stampCreate(tx *mongorm.MongoORM, v reflect.Value, keys []string, principal string) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		elem := p.stampCreate(tx, v.Elem(), keys, principal)
+		if !elem.IsValid() {
+			return reflect.Value{}
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(elem)
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		return p.stampCreate(tx, v.Elem(), keys, principal)
+	case reflect.Slice, reflect.Array:
+		copies := map[int]reflect.Value{}
+		for i := 0; i < v.Len(); i++ {
+			if elem := p.stampCreate(tx, v.Index(i), keys, principal); elem.IsValid() {
+				copies[i] = elem
+			}
+		}
+		if len(copies) == 0 {
+			return reflect.Value{}
+		}
+		copied := reflect.New(v.Type()).Elem()
+		if v.Kind() == reflect.Slice {
+			copied.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		}
+		reflect.Copy(copied, v)
+		for i, elem := range copies {
+			copied.Index(i).Set(elem)
+		}
+		return copied
+	case reflect.Struct:
+		for _, key := range []string{p.createdKey, p.updatedKey} {
+			setField(v, p.stampedField(tx, v.Type(), key), principal, true)
+		}
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}
+		}
+		var missing []string
+		for _, key := range keys {
+			if !v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())).IsValid() {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) == 0 || !reflect.TypeOf(principal).AssignableTo(v.Type().Elem()) {
+			return reflect.Value{}
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len()+len(missing))
+		for iter := v.MapRange(); iter.Next(); {
+			copied.SetMapIndex(iter.Key(), iter.Value())
+		}
+		for _, key := range missing {
+			copied.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), reflect.ValueOf(principal))
+		}
+		return copied
+	}
+	return reflect.Value{}
+}
+
+// update stamps updated_by into the update about to be made by tx.
+func (p *Plugin) update(tx *mongorm.MongoORM) {
+	stmt := tx.Statement
+	if stmt.UpdatingColumns {
+		return
+	}
+	principal, ok := p.principalFunc(stmt.Context)
+	if !ok {
+		return
+	}
+	if p.stampedField(tx, stmt.ModelType(), p.updatedKey) == nil {
+		return
+	}
+
+	v := reflect.ValueOf(stmt.Dest)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct && len(stmt.UpdateOperators) == 0 {
+		setField(v, p.stampedField(tx, v.Type(), p.updatedKey), principal, false)
+		return
+	}
+
+	// The update given to Updates or UpdateMany is left as it is: updated_by
+	// is added to the operators merged into it, which are copied, unless
+	// nothing else is updated.
+	var doc bson.M
+	switch d := stmt.Dest.(type) {
+	case bson.M:
+		doc = d
+	case map[string]interface{}:
+		doc = d
+	}
+	if len(doc) == 0 && len(stmt.UpdateOperators) == 0 {
+		return
+	}
+	if writesKey(doc, p.updatedKey) || writesKey(stmt.UpdateOperators, p.updatedKey) {
+		return
+	}
+	if operators, ok := p.stampUpdate(stmt.UpdateOperators, principal).(bson.M); ok {
+		stmt.UpdateOperators = operators
+	}
+}
+
+// bulk stamps the documents inserted and replaced by the bulk write of tx,
+// and $sets updated_by in its updates. Maps are replaced with stamped
+// copies.
+func (p *Plugin) bulk(tx *mongorm.MongoORM) {
+	stmt := tx.Statement
+	principal, ok := p.principalFunc(stmt.Context)
+	if !ok {
+		return
+	}
+	keys := p.stampedKeys(tx, stmt.ModelType(), p.createdKey, p.updatedKey)
+	updated := p.stampedKeys(tx, stmt.ModelType(), p.updatedKey)
+	models, _ := stmt.Dest.([]mongo.WriteModel)
+	for _, model := range models {
+		switch m := model.(type) {
+		case *mongo.InsertOneModel:
+			if doc := p.stampCreate(tx, reflect.ValueOf(m.Document), keys, principal); doc.IsValid() {
+				m.Document = doc.Interface()
+			}
+		case *mongo.ReplaceOneModel:
+			v := reflect.ValueOf(m.Replacement)
+			for v.Kind() == reflect.Ptr && !v.IsNil() {
+				v = v.Elem()
+			}
+			if v.Kind() == reflect.Struct {
+				setField(v, p.stampedField(tx, v.Type(), p.updatedKey), principal, false)
+			} else if len(updated) > 0 {
+				var replacement bson.M
+				switch d := m.Replacement.(type) {
+				case bson.M:
+					replacement = d
+				case map[string]interface{}:
+					replacement = d
+				default:
+					continue
+				}
+				stamped := bson.M{}
+				for key, value := range replacement {
+					stamped[key] = value
+				}
+				stamped[p.updatedKey] = principal
+				m.Replacement = stamped
+			}
+		case *mongo.UpdateOneModel:
+			if len(updated) > 0 {
+				m.Update = p.stampUpdate(m.Update, principal)
+			}
+		case *mongo.UpdateManyModel:
+			if len(updated) > 0 {
+				m.Update = p.stampUpdate(m.Update, principal)
+			}
+		}
+	}
+}
+
+// stampUpdate returns a copy of update, an update document, with
+// updated_by $set, or update itself when it writes updated_by or is not a
+// document of operators.
+func (p *Plugin) stampUpdate(update interface{}, principal string) interface{} {
+	var doc bson.M
+	switch d := update.(type) {
+	case bson.M:
+		doc = d
+	case map[string]interface{}:
+		doc = d
+	default:
+		return update
+	}
+	stamped := bson.M{}
+	for operator, fields := range doc {
+		if !strings.HasPrefix(operator, "$") {
+			return update
+		}
+		stamped[operator] = fields
+	}
+	if writesKey(doc, p.updatedKey) {
+		return update
+	}
+	set := bson.M{}
+	switch existing := doc["$set"].(type) {
+	case nil:
+	case bson.M:
+		for key, value := range existing {
+			set[key] = value
+		}
+	case map[string]interface{}:
+		for key, value := range existing {
+			set[key] = value
+		}
+	default:
+		return update
+	}
+	set[p.updatedKey] = principal
+	stamped["$set"] = set
+	return stamped
+}
+
+// stampedKeys returns those of keys under which t, a model, stores a
+// stamped field.
+func (p *Plugin) stampedKeys(tx *mongorm.MongoORM, t reflect.Type, keys ...string) []string {
+	var stamped []string
+	for _, key := range keys {
+		if p.stampedField(tx, t, key) != nil {
+			stamped = append(stamped, key)
+		}
+	}
+	return stamped
+}
+
+// stampedField returns the index of the string field of t stored under
+// key, or nil if t has none.
+func (p *Plugin) stampedField(tx *mongorm.MongoORM, t reflect.Type, key string) []int {
+	if key == "" {
+		return nil
+	}
+	field, ok := tx.LookupField(t, key)
+	if !ok || !field.IsExported() || field.Type.Kind() != reflect.String {
+		return nil
+	}
+	return field.Index
+}
+
+// setField sets the field of v at index to principal, only when empty with
+// onlyEmpty.
+func setField(v reflect.Value, index []int, principal string, onlyEmpty bool) {
+	if index == nil {
+		return
+	}
+	field, err := v.FieldByIndexErr(index)
+	if err != nil || !field.CanSet() || (onlyEmpty && field.String() != "") {
+		return
+	}
+	field.SetString(principal)
+}
+
+// writesKey reports whether update, a document or update document, writes
+// key.
+func writesKey(update bson.M, key string) bool {
+	if _, ok := update[key]; ok {
+		return true
+	}
+	for operator, fields := range update {
+		if !strings.HasPrefix(operator, "$") {
+			continue
+		}
+		var ok bool
+		switch fields := fields.(type) {
+		case bson.M:
+			_, ok = fields[key]
+		case map[string]interface{}:
+			_, ok = fields[key]
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package userstamp_test
+
+import (
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"github.com/imkrishnaagrawal/mongorm/plugin/userstamp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Stamps struct {
+	CreatedBy string `bson:"created_by"`
+	UpdatedBy string `bson:"updated_by"`
+}
+
+type note struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	Title  string             `bson:"title"`
+	Stamps `bson:",inline"`
+}
+
+func newORM(t *testing.T) *mongorm.MongoORM {
+	t.Helper()
+	orm := mongormtest.New()
+	if err := orm.RegisterPlugin(userstamp.NewPlugin()); err != nil {
+		t.Fatal(err)
+	}
+	return orm
+}
+
+func as(orm *mongorm.MongoORM, principal string) *mongorm.MongoORM {
+	return orm.WithContext(userstamp.WithPrincipal(orm.Context(), principal))
+}
+
+func TestCreateStampsDocuments(t *testing.T) {
+	orm := newORM(t)
+	n := note{Title: "a"}
+	if err := as(orm, "ann").Create(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n.CreatedBy != "ann" || n.UpdatedBy != "ann" {
+		t.Fatalf("created note = %+v, want stamped by ann", n)
+	}
+
+	doc := bson.M{"title": "b"}
+	if err := as(orm, "ann").Model(&note{}).Table("notes").Create(doc).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc["created_by"]; ok {
+		t.Fatalf("created map = %v, want it left as it is", doc)
+	}
+	var stored note
+	if err := orm.Where("title = ?", "b").First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.CreatedBy != "ann" || stored.UpdatedBy != "ann" {
+		t.Fatalf("stored note = %+v, want stamped by ann", stored)
+	}
+}
+
+func TestUpdatesStampCopyOfMaps(t *testing.T) {
+	orm := newORM(t)
+	n := note{Title: "a"}
+	if err := as(orm, "ann").Create(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	set := bson.M{"title": "b"}
+	update := map[string]interface{}{"$set": set}
+	if err := as(orm, "bob").Model(&n).Updates(update).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(update) != 1 || len(set) != 1 {
+		t.Fatalf("update = %v, want it left as it is", update)
+	}
+	var stored note
+	if err := orm.First(&stored, n.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "b" || stored.CreatedBy != "ann" || stored.UpdatedBy != "bob" {
+		t.Fatalf("stored note = %+v, want title b updated by bob", stored)
+	}
+}
+
+func TestUpdateManyKeepsGivenPrincipal(t *testing.T) {
+	orm := newORM(t)
+	if err := as(orm, "ann").Create(&note{Title: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := as(orm, "bob").Model(&note{}).Where("title = ?", "a").
+		UpdateMany(bson.M{"updated_by": "system"}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored note
+	if err := orm.Where("title = ?", "a").First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.UpdatedBy != "system" {
+		t.Fatalf("updated_by = %q, want system", stored.UpdatedBy)
+	}
+}
+
+func TestFirstOrCreateStampsCreatedDocument(t *testing.T) {
+	orm := newORM(t)
+	var n note
+	if err := as(orm, "ann").Where("title = ?", "a").FirstOrCreate(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n.CreatedBy != "ann" || n.UpdatedBy != "ann" {
+		t.Fatalf("created note = %+v, want stamped by ann", n)
+	}
+}
+
+func TestCreateLeavesAttrsAlone(t *testing.T) {
+	orm := newORM(t)
+	var attrs []bson.M
+	err := orm.Callback().Create().After("userstamp:create").Register("test:attrs", func(tx *mongorm.MongoORM) {
+		attrs = append(attrs, tx.Statement.Attrs)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := as(orm, "ann").Create(&note{Title: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 1 || attrs[0] != nil {
+		t.Fatalf("Attrs of Create = %v, want none", attrs)
+	}
+}
+
+func TestBulkStampsCopyOfMaps(t *testing.T) {
+	orm := newORM(t)
+	n := note{Title: "a"}
+	if err := as(orm, "ann").Create(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	inserted := bson.M{"title": "b"}
+	update := bson.M{"$set": bson.M{"title": "c"}}
+	err := as(orm, "bob").Model(&note{}).Bulk().
+		Insert(inserted).
+		Update(bson.M{"_id": n.ID}, update).
+		Execute().Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inserted) != 1 || len(update["$set"].(bson.M)) != 1 {
+		t.Fatalf("bulk documents = %v and %v, want them left as they are", inserted, update)
+	}
+
+	var notes []note
+	if err := orm.Order("title").Find(&notes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("notes = %d, want 2", len(notes))
+	}
+	if notes[0].Title != "b" || notes[0].CreatedBy != "bob" {
+		t.Fatalf("inserted note = %+v, want created by bob", notes[0])
+	}
+	if notes[1].Title != "c" || notes[1].CreatedBy != "ann" || notes[1].UpdatedBy != "bob" {
+		t.Fatalf("updated note = %+v, want updated by bob", notes[1])
+	}
+}
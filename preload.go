@@ -0,0 +1,417 @@
+package mongorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Preload loads the association name, a struct field of the model, into the
+// documents returned by First and Find:
+//
+//	orm.Preload("Orders").Preload("Company").Find(&users)
+//
+// A slice field tagged hasMany holds the documents referring to the model
+// with the ObjectID field of theirs named by foreignKey. A pointer field
+// tagged belongsTo holds the document referred to by the ObjectID field of
+// the model named by foreignKey:
+//
+//	type Author struct {
+//		ID    primitive.ObjectID `bson:"_id,omitempty"`
+//		Books []Book             `bson:"-" mongorm:"hasMany;foreignKey:AuthorID"`
+//	}
+//
+//	type Book struct {
+//		ID       primitive.ObjectID `bson:"_id,omitempty"`
+//		AuthorID primitive.ObjectID `bson:"author_id"`
+//		Author   *Author            `bson:"-" mongorm:"belongsTo;foreignKey:AuthorID"`
+//	}
+//
+// belongsTo may be left out of a pointer field with a foreignKey, and a
+// slice field without hasMany holds the documents whose field named after
+// the model is such a pointer field. gorm tags declaring foreignKey,
+// many2many and the like are read as well when the mongorm tag does not.
+// Invalid declarations, such as a foreignKey naming no ObjectID field, make
+// writes, Preload and AutoMigrate fail with ErrInvalidAssociation.
+//
+// A slice field tagged many2many holds the documents associated with the
+// model through a join collection, which holds a document per associated
+// pair with the IDs of both, or through an array of ObjectIDs in the model:
+//
+//	type User struct {
+//		ID      primitive.ObjectID   `bson:"_id,omitempty"`
+//		Roles   []Role               `bson:"-" mongorm:"many2many:user_roles"`
+//		TeamIDs []primitive.ObjectID `bson:"team_ids"`
+//		Teams   []Team               `bson:"-" mongorm:"many2many;foreignKey:TeamIDs"`
+//	}
+//
+// The join documents refer to the model and the target under the snake
+// cased type name followed by _id, user_id and role_id above, unless set
+// with joinForeignKey and joinReferences. Create and Save store the
+// documents held by many2many fields as associated with the model; they
+// must have been created already. Associations of associations are named
+// with dots, and load the associations along the way:
+//
+//	orm.Preload("Orders.Items").First(&user)
+//
+// Each association is loaded with a single query, however many documents
+// were found. scopes add conditions, order, limits and field selection to
+// that query:
+//
+//	orm.Preload("Orders", func(tx *mongorm.MongoORM) *mongorm.MongoORM {
+//		return tx.Where("status = ?", "open").Order("created desc").Limit(10)
+//	}).Find(&users)
+//
+// Limit and Offset apply to the query as a whole rather than to the
+// associations of each document. Naming a File field loads the name, length
+// and metadata of the files it holds from GridFS.
+func (orm *MongoORM) Preload(name string, scopes ...func(*MongoORM) *MongoORM) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Preloads = append(tx.Statement.Preloads, name)
+	if len(scopes) > 0 {
+		if tx.Statement.PreloadScopes == nil {
+			tx.Statement.PreloadScopes = map[string][]func(*MongoORM) *MongoORM{}
+		}
+		tx.Statement.PreloadScopes[name] = append(tx.Statement.PreloadScopes[name], scopes...)
+	}
+	return tx
+}
+
+// processPreloads loads the associations given to Preload into docs, a
+// pointer to a struct or to a slice of structs.
+func (orm *MongoORM) processPreloads(docs interface{}) {
+	if len(orm.Statement.Preloads) == 0 || orm.Error != nil {
+		return
+	}
+
+	docsVal := reflect.ValueOf(docs)
+	if docsVal.Kind() != reflect.Ptr || docsVal.IsNil() {
+		orm.Error = errors.New("document must be a pointer to a struct or slice")
+		return
+	}
+
+	var parents []reflect.Value
+	switch docsVal = docsVal.Elem(); docsVal.Kind() {
+	case reflect.Struct:
+		parents = append(parents, docsVal)
+	case reflect.Slice:
+		for i := 0; i < docsVal.Len(); i++ {
+			if parent, ok := structValue(docsVal.Index(i)); ok {
+				parents = append(parents, parent)
+			}
+		}
+	default:
+		orm.Error = errors.New("document must be a pointer to a struct or slice")
+		return
+	}
+	if len(parents) == 0 {
+		return
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	// loaded maps each association path loaded so far to the documents it
+	// loaded, so that a path shared by several preloads is loaded once.
+	loaded := map[string][]reflect.Value{}
+	for _, preload := range orm.Statement.Preloads {
+		names := strings.Split(preload, ".")
+		docs := parents
+		for i, name := range names {
+			path := strings.Join(names[:i+1], ".")
+			children, ok := loaded[path]
+			if !ok {
+				var err error
+				if children, err = orm.preload(ctx, docs, name, orm.preloadQuery(path)); err != nil {
+					orm.Error = translateError(err)
+					return
+				}
+				loaded[path] = children
+			}
+			if docs = children; len(docs) == 0 {
+				break
+			}
+		}
+	}
+}
+
+// preloadQuery returns the instance holding the state of the query loading
+// the association path: the scopes given to Preload applied to a statement
+// inheriting Unscoped and the read options of orm's.
+func (orm *MongoORM) preloadQuery(path string) *MongoORM {
+	query := orm.newInstance()
+	query.Statement.Unscoped = orm.Statement.Unscoped
+	query.Statement.ReadPreference = orm.Statement.ReadPreference
+	query.Statement.ReadConcern = orm.Statement.ReadConcern
+	for _, scope := range orm.Statement.PreloadScopes[path] {
+		query = scope(query)
+	}
+	return query
+}
+
+// preload loads the association name into each of parents, addressable
+// struct values of the same type, and returns the documents it loaded with
+// query.
+func (orm *MongoORM) preload(ctx context.Context, parents []reflect.Value, name string, query *MongoORM) ([]reflect.Value, error) {
+	if query.Error != nil {
+		return nil, query.Error
+	}
+	if field, ok := parents[0].Type().FieldByName(name); ok && isFileField(field) {
+		return nil, query.preloadFiles(ctx, parents, field)
+	}
+	assoc, found := orm.association(parents[0].Type(), name)
+	if !found {
+		// Names that are not associations are ignored, but invalid
+		// declarations are reported.
+		_, _, err := orm.parseAssociation(parents[0].Type(), name)
+		return nil, err
+	}
+	if assoc.manyToMany {
+		return query.preloadManyToMany(ctx, parents, assoc)
+	}
+	if assoc.many {
+		return query.preloadMany(ctx, parents, assoc)
+	}
+	return query.preloadOne(ctx, parents, assoc)
+}
+
+// preloadMany loads into field of each parent the documents whose foreign
+// key holds the parent's ID and that match orm's statement.
+func (orm *MongoORM) preloadMany(ctx context.Context, parents []reflect.Value, assoc association) ([]reflect.Value, error) {
+	field, childType, foreignRef := assoc.field, assoc.target, assoc.foreignKey
+
+	var ids []primitive.ObjectID
+	for _, parent := range parents {
+		if id, err := documentID(parent.Addr().Interface()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	children := reflect.New(field.Type)
+	if len(ids) > 0 {
+		filter := mergeConditions(bson.M{orm.fieldName(foreignRef): bson.M{"$in": ids}}, orm.queryFilter(childType))
+		cursor, err := orm.collection(orm.collectionName(childType)).Find(ctx, filter, orm.findOptions(childType))
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.All(ctx, children.Interface()); err != nil {
+			return nil, err
+		}
+	}
+
+	byParent := map[primitive.ObjectID]reflect.Value{}
+	for i := 0; i < children.Elem().Len(); i++ {
+		child := children.Elem().Index(i)
+		childVal, ok := structValue(child)
+		if !ok {
+			continue
+		}
+		id, ok := objectIDValue(childVal.FieldByIndex(foreignRef.Index))
+		if !ok {
+			continue
+		}
+		group, ok := byParent[id]
+		if !ok {
+			group = reflect.MakeSlice(field.Type, 0, 0)
+		}
+		byParent[id] = reflect.Append(group, child)
+	}
+
+	for _, parent := range parents {
+		group := reflect.MakeSlice(field.Type, 0, 0)
+		if id, err := documentID(parent.Addr().Interface()); err == nil {
+			if loaded, ok := byParent[id]; ok {
+				group = loaded
+			}
+		}
+		parent.FieldByIndex(field.Index).Set(group)
+	}
+	return associatedDocs(parents, field), nil
+}
+
+// preloadManyToMany loads into field of each parent the documents it is
+// associated with through the join collection or its array of ObjectIDs,
+// in the order of the join documents or of the array, if they match orm's
+// statement.
+func (orm *MongoORM) preloadManyToMany(ctx context.Context, parents []reflect.Value, assoc association) ([]reflect.Value, error) {
+	// refs holds the IDs of the documents associated with each parent.
+	refs := make([][]primitive.ObjectID, len(parents))
+	if assoc.joinCollection != "" {
+		byParent := map[primitive.ObjectID][]int{}
+		var ids []primitive.ObjectID
+		for i, parent := range parents {
+			if id, err := documentID(parent.Addr().Interface()); err == nil {
+				if _, ok := byParent[id]; !ok {
+					ids = append(ids, id)
+				}
+				byParent[id] = append(byParent[id], i)
+			}
+		}
+		if len(ids) > 0 {
+			cursor, err := orm.collection(assoc.joinCollection).Find(ctx, bson.M{assoc.joinForeignKey: bson.M{"$in": ids}})
+			if err != nil {
+				return nil, err
+			}
+			var pairs []bson.M
+			if err := cursor.All(ctx, &pairs); err != nil {
+				return nil, err
+			}
+			for _, pair := range pairs {
+				id, _ := pair[assoc.joinForeignKey].(primitive.ObjectID)
+				ref, ok := pair[assoc.joinReferences].(primitive.ObjectID)
+				if !ok {
+					continue
+				}
+				for _, i := range byParent[id] {
+					refs[i] = append(refs[i], ref)
+				}
+			}
+		}
+	} else {
+		for i, parent := range parents {
+			array := parent.FieldByIndex(assoc.foreignKey.Index)
+			if array.Kind() != reflect.Slice {
+				continue
+			}
+			for j := 0; j < array.Len(); j++ {
+				if ref, ok := objectIDValue(array.Index(j)); ok {
+					refs[i] = append(refs[i], ref)
+				}
+			}
+		}
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	var ids []primitive.ObjectID
+	for _, parentRefs := range refs {
+		for _, ref := range parentRefs {
+			if !seen[ref] {
+				seen[ref] = true
+				ids = append(ids, ref)
+			}
+		}
+	}
+
+	targets := reflect.New(assoc.field.Type)
+	if len(ids) > 0 {
+		filter := mergeConditions(bson.M{"_id": bson.M{"$in": ids}}, orm.queryFilter(assoc.target))
+		cursor, err := orm.collection(orm.collectionName(assoc.target)).Find(ctx, filter, orm.findOptions(assoc.target))
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.All(ctx, targets.Interface()); err != nil {
+			return nil, err
+		}
+	}
+
+	byID := map[primitive.ObjectID]reflect.Value{}
+	for i := 0; i < targets.Elem().Len(); i++ {
+		target := targets.Elem().Index(i)
+		if targetVal, ok := structValue(target); ok {
+			if id, err := documentID(targetVal.Addr().Interface()); err == nil {
+				byID[id] = target
+			}
+		}
+	}
+
+	for i, parent := range parents {
+		group := reflect.MakeSlice(assoc.field.Type, 0, len(refs[i]))
+		for _, ref := range refs[i] {
+			if target, ok := byID[ref]; ok {
+				group = reflect.Append(group, target)
+			}
+		}
+		parent.FieldByIndex(assoc.field.Index).Set(group)
+	}
+	return associatedDocs(parents, assoc.field), nil
+}
+
+// associatedDocs returns the documents held by the slice field of each of
+// parents.
+func associatedDocs(parents []reflect.Value, field reflect.StructField) []reflect.Value {
+	var docs []reflect.Value
+	for _, parent := range parents {
+		group := parent.FieldByIndex(field.Index)
+		for i := 0; i < group.Len(); i++ {
+			if child, ok := structValue(group.Index(i)); ok {
+				docs = append(docs, child)
+			}
+		}
+	}
+	return docs
+}
+
+// preloadOne loads into field of each parent the document whose ID is held
+// by the parent's foreign key, if it matches orm's statement.
+func (orm *MongoORM) preloadOne(ctx context.Context, parents []reflect.Value, assoc association) ([]reflect.Value, error) {
+	field, targetType, foreignKey := assoc.field, assoc.target, assoc.foreignKey
+
+	seen := map[primitive.ObjectID]bool{}
+	var ids []primitive.ObjectID
+	for _, parent := range parents {
+		if id, ok := objectIDValue(parent.FieldByIndex(foreignKey.Index)); ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	targets := reflect.New(reflect.SliceOf(targetType))
+	filter := mergeConditions(bson.M{"_id": bson.M{"$in": ids}}, orm.queryFilter(targetType))
+	cursor, err := orm.collection(orm.collectionName(targetType)).Find(ctx, filter, orm.findOptions(targetType))
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, targets.Interface()); err != nil {
+		return nil, err
+	}
+
+	byID := map[primitive.ObjectID]reflect.Value{}
+	docs := make([]reflect.Value, 0, targets.Elem().Len())
+	for i := 0; i < targets.Elem().Len(); i++ {
+		target := targets.Elem().Index(i)
+		docs = append(docs, target)
+		if id, err := documentID(target.Addr().Interface()); err == nil {
+			byID[id] = target.Addr()
+		}
+	}
+
+	for _, parent := range parents {
+		if id, ok := objectIDValue(parent.FieldByIndex(foreignKey.Index)); ok {
+			if target, ok := byID[id]; ok {
+				parent.FieldByIndex(field.Index).Set(target)
+			}
+		}
+	}
+	return docs, nil
+}
+
+// structValue returns the struct held by v, a struct or a pointer to one.
+func structValue(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, v.Kind() == reflect.Struct
+}
+
+// objectIDValue returns the ObjectID held by v, a primitive.ObjectID or a
+// pointer to one, if it is set.
+func objectIDValue(v reflect.Value) (primitive.ObjectID, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return primitive.NilObjectID, false
+		}
+		v = v.Elem()
+	}
+	id, ok := v.Interface().(primitive.ObjectID)
+	return id, ok && !id.IsZero()
+}
@@ -0,0 +1,96 @@
+package mongorm_test
+
+import (
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type author struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty"`
+	Name  string             `bson:"name"`
+	Books []book             `bson:"-" mongorm:"hasMany;foreignKey:AuthorID"`
+}
+
+type book struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Title    string             `bson:"title"`
+	AuthorID primitive.ObjectID `bson:"author_id"`
+	Author   *author            `bson:"-" mongorm:"belongsTo;foreignKey:AuthorID"`
+}
+
+func newLibrary(t *testing.T) *mongorm.MongoORM {
+	t.Helper()
+	orm := mongormtest.New()
+	for name, titles := range map[string][]string{"ann": {"Go", "Rust"}, "bob": {"Zig"}, "cy": nil} {
+		a := author{Name: name}
+		if err := orm.Create(&a).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, title := range titles {
+			if err := orm.Create(&book{Title: title, AuthorID: a.ID}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return orm
+}
+
+func TestPreloadHasMany(t *testing.T) {
+	orm := newLibrary(t)
+	var authors []author
+	if err := orm.Preload("Books").Order("name").Find(&authors).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(authors) != 3 {
+		t.Fatalf("authors = %d, want 3", len(authors))
+	}
+	for i, want := range []int{2, 1, 0} {
+		if got := len(authors[i].Books); got != want {
+			t.Fatalf("books of %s = %d, want %d", authors[i].Name, got, want)
+		}
+		for _, b := range authors[i].Books {
+			if b.AuthorID != authors[i].ID {
+				t.Fatalf("book %q of %s has author %s", b.Title, authors[i].Name, b.AuthorID.Hex())
+			}
+		}
+	}
+}
+
+func TestPreloadBelongsTo(t *testing.T) {
+	orm := newLibrary(t)
+	var zig book
+	if err := orm.Preload("Author").Where("title = ?", "Zig").First(&zig).Error; err != nil {
+		t.Fatal(err)
+	}
+	if zig.Author == nil || zig.Author.Name != "bob" {
+		t.Fatalf("author = %+v, want bob", zig.Author)
+	}
+}
+
+func TestPreloadNested(t *testing.T) {
+	orm := newLibrary(t)
+	var rust book
+	if err := orm.Preload("Author.Books").Where("title = ?", "Rust").First(&rust).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rust.Author == nil || len(rust.Author.Books) != 2 {
+		t.Fatalf("author = %+v, want ann with her 2 books", rust.Author)
+	}
+}
+
+func TestPreloadScopes(t *testing.T) {
+	orm := newLibrary(t)
+	var ann author
+	err := orm.Preload("Books", func(tx *mongorm.MongoORM) *mongorm.MongoORM {
+		return tx.Where("title = ?", "Rust")
+	}).Where("name = ?", "ann").First(&ann).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ann.Books) != 1 || ann.Books[0].Title != "Rust" {
+		t.Fatalf("books = %+v, want only Rust", ann.Books)
+	}
+}
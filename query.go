@@ -0,0 +1,517 @@
+package mongorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Order specifies the sort order of the query results. It accepts a comma
+// separated list of fields, each optionally followed by "asc" or "desc":
+//
+//	orm.Order("age desc, name").Find(&users)
+//
+// Calling Order several times appends to the sort specification.
+func (orm *MongoORM) Order(value string) *MongoORM {
+	tx := orm.getInstance()
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+
+		direction := 1
+		if len(fields) > 1 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				direction = -1
+			default:
+				tx.AddError(fmt.Errorf("invalid sort direction %q for field %q", fields[1], fields[0]))
+				return tx
+			}
+		}
+		if len(fields) > 2 {
+			tx.AddError(fmt.Errorf("invalid order clause %q", strings.TrimSpace(part)))
+			return tx
+		}
+
+		tx.Statement.Sort = append(tx.Statement.Sort, bson.E{Key: sortField(fields[0]), Value: direction})
+	}
+	return tx
+}
+
+// OrderBy appends a raw sort specification, for cases Order cannot express.
+func (orm *MongoORM) OrderBy(sort bson.D) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Sort = append(tx.Statement.Sort, sort...)
+	return tx
+}
+
+func sortField(field string) string {
+	if field == "id" {
+		return "_id"
+	}
+	return field
+}
+
+// Limit caps the number of documents returned by Find. A negative value
+// removes a previously set limit.
+func (orm *MongoORM) Limit(limit int) *MongoORM {
+	tx := orm.getInstance()
+	if limit < 0 {
+		limit = 0
+	}
+	tx.Statement.Limit = int64(limit)
+	return tx
+}
+
+// Offset skips the given number of documents before returning results.
+// A negative value removes a previously set offset.
+func (orm *MongoORM) Offset(offset int) *MongoORM {
+	tx := orm.getInstance()
+	if offset < 0 {
+		offset = 0
+	}
+	tx.Statement.Offset = int64(offset)
+	return tx
+}
+
+// Count stores the number of documents matching the accumulated filter in
+// count. The collection is taken from a preceding call to Model:
+//
+//	orm.Model(&User{}).Where("age > ?", 30).Count(&count)
+func (orm *MongoORM) Count(count *int64) *MongoORM {
+	return orm.execute(opQuery, count, func(tx *MongoORM) {
+		tx.count(count)
+	})
+}
+
+// count is the built-in step of Count.
+func (orm *MongoORM) count(count *int64) *MongoORM {
+	if orm.Statement.Collection == nil {
+		orm.Error = ErrMissingModel
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	filter := orm.queryFilter(modelType(orm.Statement.Model))
+	orm.Statement.record(orm.Statement.Collection, "countDocuments", filter)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	n, err := orm.Statement.Collection.CountDocuments(ctx, filter, orm.countOptions())
+	orm.Error = translateError(err)
+	if err == nil {
+		*count = n
+	}
+	return orm
+}
+
+// Exists reports whether a document matches the accumulated filter. It
+// reads the _id of at most one document, which is cheaper than Count on
+// large collections. The collection is taken from a preceding call to
+// Model:
+//
+//	taken, err := orm.Model(&User{}).Where("email = ?", email).Exists()
+func (orm *MongoORM) Exists() (bool, error) {
+	exists := false
+	tx := orm.execute(opQuery, &exists, func(tx *MongoORM) {
+		tx.exists(&exists)
+	})
+	return exists, tx.Error
+}
+
+// exists is the built-in step of Exists.
+func (orm *MongoORM) exists(exists *bool) *MongoORM {
+	if orm.Statement.Collection == nil {
+		orm.Error = ErrMissingModel
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	filter := orm.queryFilter(modelType(orm.Statement.Model))
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	if orm.Statement.Hint != nil {
+		opts.SetHint(orm.Statement.Hint)
+	}
+	orm.Statement.record(orm.Statement.Collection, "findOne", filter, opts.Projection)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	err := orm.Statement.Collection.FindOne(ctx, filter, opts).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return orm
+	}
+	orm.Error = translateError(err)
+	if err == nil {
+		*exists = true
+		orm.RowsAffected = 1
+	}
+	return orm
+}
+
+// EstimatedCount stores the collection's estimated document count, read from
+// collection metadata, in count. It ignores any accumulated filter and is
+// much cheaper than Count on large collections.
+func (orm *MongoORM) EstimatedCount(count *int64) *MongoORM {
+	return orm.execute(opQuery, count, func(tx *MongoORM) {
+		tx.estimatedCount(count)
+	})
+}
+
+// estimatedCount is the built-in step of EstimatedCount.
+func (orm *MongoORM) estimatedCount(count *int64) *MongoORM {
+	if orm.Statement.Collection == nil {
+		orm.Error = ErrMissingModel
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	orm.Statement.record(orm.Statement.Collection, "estimatedDocumentCount")
+	if orm.Statement.DryRun {
+		return orm
+	}
+	n, err := orm.Statement.Collection.EstimatedDocumentCount(ctx)
+	orm.Error = translateError(err)
+	if err == nil {
+		*count = n
+	}
+	return orm
+}
+
+// Distinct stores the distinct values of field among the documents matching
+// the accumulated filter in values, a pointer to a slice. The collection is
+// taken from a preceding call to Model:
+//
+//	var countries []string
+//	orm.Model(&User{}).Where("age > ?", 30).Distinct("Country", &countries)
+func (orm *MongoORM) Distinct(field string, values interface{}) *MongoORM {
+	return orm.execute(opQuery, values, func(tx *MongoORM) {
+		tx.distinct(field, values)
+	})
+}
+
+// distinct is the built-in step of Distinct.
+func (orm *MongoORM) distinct(field string, values interface{}) *MongoORM {
+	if orm.Statement.Collection == nil {
+		orm.Error = ErrMissingModel
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	t := modelType(orm.Statement.Model)
+	key := orm.documentKey(t, field)
+	filter := orm.queryFilter(t)
+	orm.Statement.record(orm.Statement.Collection, "distinct", key, filter)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	result, err := orm.Statement.Collection.Distinct(ctx, key, filter, orm.distinctOptions())
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.Error = decodeValues(result, values)
+	if orm.Error == nil {
+		orm.RowsAffected = uint(len(result))
+	}
+	return orm
+}
+
+// Pluck stores the value of field in each document matching the
+// accumulated filter in values, a pointer to a slice, reading only that
+// field. Order, Limit and Offset apply, and documents without the field are
+// skipped. The collection is taken from a preceding call to Model:
+//
+//	var emails []string
+//	orm.Model(&User{}).Where("age > ?", 30).Order("name").Pluck("Email", &emails)
+func (orm *MongoORM) Pluck(field string, values interface{}) *MongoORM {
+	return orm.execute(opQuery, values, func(tx *MongoORM) {
+		tx.pluck(field, values)
+	})
+}
+
+// pluck is the built-in step of Pluck.
+func (orm *MongoORM) pluck(field string, values interface{}) *MongoORM {
+	if orm.Statement.Collection == nil {
+		orm.Error = ErrMissingModel
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	t := modelType(orm.Statement.Model)
+	key := orm.documentKey(t, field)
+	projection := bson.M{key: 1}
+	if key != "_id" {
+		projection["_id"] = 0
+	}
+	opts := orm.findOptions(t).SetProjection(projection)
+	filter := orm.queryFilter(t)
+	orm.Statement.record(orm.Statement.Collection, "find", filter, projection)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	cursor, err := orm.Statement.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	defer cursor.Close(ctx)
+
+	result := []interface{}{}
+	for cursor.Next(ctx) {
+		if value, err := cursor.Current.LookupErr(strings.Split(key, ".")...); err == nil {
+			result = append(result, value)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.Error = decodeValues(result, values)
+	if orm.Error == nil {
+		orm.RowsAffected = uint(len(result))
+	}
+	return orm
+}
+
+// decodeValues decodes values, as returned by the driver, into dest, a
+// pointer to a slice.
+func decodeValues(values []interface{}, dest interface{}) error {
+	data, err := bson.Marshal(bson.M{"values": values})
+	if err != nil {
+		return err
+	}
+	return bson.Raw(data).Lookup("values").Unmarshal(dest)
+}
+
+// queryFilter returns the accumulated filter for documents of type t, with
+// the soft delete and default scopes applied. It returns an empty document
+// when there are no conditions.
+func (orm *MongoORM) queryFilter(t reflect.Type) bson.M {
+	filter := mergeConditions(orm.Statement.Filter, orm.modelScope(t))
+	if filter == nil {
+		return bson.M{}
+	}
+	return filter
+}
+
+// findOptions translates the chained Select, Omit, Order, Limit and Offset state
+// into driver options. Selected struct field names are resolved to their
+// bson names using the model type t.
+func (orm *MongoORM) findOptions(t reflect.Type) *options.FindOptions {
+	opts := options.Find()
+	if projection := orm.readProjection(t); len(projection) > 0 {
+		opts.SetProjection(projection)
+	}
+	if len(orm.Statement.Sort) > 0 {
+		opts.SetSort(orm.Statement.Sort)
+	}
+	if orm.Statement.Limit > 0 {
+		opts.SetLimit(orm.Statement.Limit)
+	}
+	if orm.Statement.Offset > 0 {
+		opts.SetSkip(orm.Statement.Offset)
+	}
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	if orm.Statement.Hint != nil {
+		opts.SetHint(orm.Statement.Hint)
+	}
+	return opts
+}
+
+// findOneOptions translates the chained Select, Omit, Order and Offset state
+// into options for a single document query.
+func (orm *MongoORM) findOneOptions(t reflect.Type) *options.FindOneOptions {
+	opts := options.FindOne()
+	if projection := orm.readProjection(t); len(projection) > 0 {
+		opts.SetProjection(projection)
+	}
+	if len(orm.Statement.Sort) > 0 {
+		opts.SetSort(orm.Statement.Sort)
+	}
+	if orm.Statement.Offset > 0 {
+		opts.SetSkip(orm.Statement.Offset)
+	}
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	if orm.Statement.Hint != nil {
+		opts.SetHint(orm.Statement.Hint)
+	}
+	return opts
+}
+
+// countOptions translates the chained state into options for counting.
+func (orm *MongoORM) countOptions() *options.CountOptions {
+	opts := options.Count()
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	if orm.Statement.Hint != nil {
+		opts.SetHint(orm.Statement.Hint)
+	}
+	return opts
+}
+
+// distinctOptions translates the chained state into options for Distinct.
+func (orm *MongoORM) distinctOptions() *options.DistinctOptions {
+	opts := options.Distinct()
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	return opts
+}
+
+// resetStatement clears the chained query state once an operation ran. A
+// dry run keeps it, so that the operation can be inspected.
+func (orm *MongoORM) resetStatement() {
+	if orm.Statement.DryRun {
+		return
+	}
+	orm.Statement = &Statement{}
+}
+
+// projection converts a Select field set into a projection document, using
+// the bson name of struct fields where the name matches a field of t.
+func (orm *MongoORM) projection(fields bson.M, t reflect.Type) bson.M {
+	proj := bson.M{}
+	for name, include := range fields {
+		proj[orm.documentKey(t, name)] = include
+	}
+	return proj
+}
+
+// readProjection returns the projection for reading documents of type t,
+// combining Select with Omit. Omitted fields are dropped from an inclusion
+// projection, since MongoDB does not allow mixing both kinds.
+func (orm *MongoORM) readProjection(t reflect.Type) bson.M {
+	proj := orm.projection(orm.Statement.Selects, t)
+	inclusive := false
+	for _, include := range proj {
+		if include == 1 {
+			inclusive = true
+		}
+	}
+	for _, name := range orm.Statement.Omits {
+		key := orm.documentKey(t, name)
+		if inclusive {
+			delete(proj, key)
+		} else {
+			proj[key] = 0
+		}
+	}
+	return proj
+}
+
+// selectsFields reports whether Select named fields to include.
+func (orm *MongoORM) selectsFields() bool {
+	for _, include := range orm.Statement.Selects {
+		if include == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// filterDocument returns a copy of doc, a document of type t to be written,
+// without the fields excluded by Select and Omit. When Select named fields
+// to include, only those and _id are kept.
+func (orm *MongoORM) filterDocument(doc bson.M, t reflect.Type) bson.M {
+	include := map[string]bool{}
+	exclude := map[string]bool{}
+	for name, selected := range orm.Statement.Selects {
+		if selected == 1 {
+			include[orm.documentKey(t, name)] = true
+		} else {
+			exclude[orm.documentKey(t, name)] = true
+		}
+	}
+	for _, name := range orm.Statement.Omits {
+		exclude[orm.documentKey(t, name)] = true
+	}
+
+	filtered := bson.M{}
+	for key, value := range doc {
+		if exclude[key] || (len(include) > 0 && !include[key] && key != "_id") {
+			continue
+		}
+		filtered[key] = value
+	}
+	return filtered
+}
+
+// nonZeroFields returns a copy of doc, the document encoded from the struct
+// v, without the fields holding zero values in v. Keys that do not belong to
+// a field of v are kept.
+func (orm *MongoORM) nonZeroFields(doc bson.M, v reflect.Value) bson.M {
+	nonZero := bson.M{}
+	for key, value := range doc {
+		if field, ok := orm.lookupField(v.Type(), key); ok {
+			if fieldVal, err := v.FieldByIndexErr(field.Index); err != nil || fieldVal.IsZero() {
+				continue
+			}
+		}
+		nonZero[key] = value
+	}
+	return nonZero
+}
+
+// filtersFields reports whether Select or Omit restrict the fields written.
+func (orm *MongoORM) filtersFields() bool {
+	return len(orm.Statement.Selects) > 0 || len(orm.Statement.Omits) > 0
+}
+
+// writeDocument returns doc as it should be written: doc itself, or the
+// document it encodes to filtered by Select and Omit.
+func (orm *MongoORM) writeDocument(doc interface{}) (interface{}, error) {
+	if !orm.filtersFields() {
+		return doc, nil
+	}
+	encoded, err := toDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	return orm.filterDocument(encoded, modelType(doc)), nil
+}
+
+// documentKey resolves name, a struct field of t or a document key, to the
+// document key.
+func (orm *MongoORM) documentKey(t reflect.Type, name string) string {
+	if t == nil || t.Kind() != reflect.Struct {
+		return sortField(name)
+	}
+	s := orm.schema(t)
+	if key, ok := s.keys.Load(name); ok {
+		return key.(string)
+	}
+	key := sortField(name)
+	if field, ok := orm.lookupField(t, name); ok {
+		key = orm.fieldName(field)
+	} else if strings.Contains(name, ".") {
+		key = orm.path(t, strings.Split(name, "."))
+	}
+	s.keys.Store(name, key)
+	return key
+}
@@ -0,0 +1,85 @@
+package mongorm
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Between matches the documents whose field lies between from and to,
+// both included:
+//
+//	orm.Between("date_created", monday, sunday).Find(&orders)
+//	orm.Between("price", 10, 20).Find(&products)
+//
+// A bound that is nil, a nil pointer or the zero time.Time is left open, so
+// that the *time.Time fields of OrmModel and optional filter parameters can
+// be passed as they are; pointers are dereferenced. Between with both
+// bounds open adds no condition.
+func (orm *MongoORM) Between(field string, from, to interface{}) *MongoORM {
+	tx := orm.getInstance()
+	if operator := rangeOperator(from, to); operator != nil {
+		tx.addCondition(bson.M{field: operator})
+	}
+	return tx
+}
+
+// Since matches the documents whose field is t or later. t is a time.Time
+// or a *time.Time, and Since adds no condition when it is nil or zero.
+func (orm *MongoORM) Since(field string, t interface{}) *MongoORM {
+	return orm.Between(field, t, nil)
+}
+
+// Until matches the documents whose field is t or earlier. t is a
+// time.Time or a *time.Time, and Until adds no condition when it is nil or
+// zero.
+func (orm *MongoORM) Until(field string, t interface{}) *MongoORM {
+	return orm.Between(field, nil, t)
+}
+
+// Between matches the documents whose f lies between from and to, both
+// included, leaving open the bounds Between leaves open. It returns an
+// empty filter, matching every document, when both are.
+func (f Field[T]) Between(from, to T) bson.M {
+	operator := rangeOperator(from, to)
+	if operator == nil {
+		return bson.M{}
+	}
+	return bson.M{f.key: operator}
+}
+
+// rangeOperator returns the $gte and $lte operators bounding a range by
+// from and to, or nil when both bounds are open.
+func rangeOperator(from, to interface{}) bson.M {
+	operator := bson.M{}
+	if bound, ok := rangeBound(from); ok {
+		operator["$gte"] = bound
+	}
+	if bound, ok := rangeBound(to); ok {
+		operator["$lte"] = bound
+	}
+	if len(operator) == 0 {
+		return nil
+	}
+	return operator
+}
+
+// rangeBound returns bound with its pointers dereferenced, and false when
+// it is nil, a nil pointer or the zero time.Time, leaving the range open.
+func rangeBound(bound interface{}) (interface{}, bool) {
+	v := reflect.ValueOf(bound)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, false
+	}
+	if t, ok := v.Interface().(time.Time); ok && t.IsZero() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
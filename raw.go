@@ -0,0 +1,66 @@
+package mongorm
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection returns the named collection of the database, with the read
+// preference and concerns set on the chain, for operations the ORM does not
+// cover. It runs the callbacks of Callbacks.Raw, which may route it to
+// another database or refuse it, but operations run on it directly bypass
+// hooks, callbacks and logging. The chain is left as it is.
+func (orm *MongoORM) Collection(name string) (*mongo.Collection, error) {
+	var collection *mongo.Collection
+	tx := orm.Session(&Session{}).Table(name)
+	tx = tx.execute(opRaw, nil, func(tx *MongoORM) {
+		collection = tx.collection(name)
+	})
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return collection, nil
+}
+
+// RawFilter ANDs filter, a query document passed to the driver as it is,
+// into the conditions of the next operation. Unlike running it on
+// Collection, the operation still goes through hooks, callbacks, logging
+// and the soft delete and default scopes:
+//
+//	orm.RawFilter(bson.M{"tags": bson.M{"$all": bson.A{"go", "mongodb"}}}).Find(&posts)
+func (orm *MongoORM) RawFilter(filter bson.M) *MongoORM {
+	tx := orm.getInstance()
+	tx.addCondition(copyM(filter))
+	return tx
+}
+
+// RawUpdate adds update, an update document passed to the driver as it is,
+// to the next Updates, UpdateMany or UpdateAndGet, combined with the
+// operators added by Set, Inc and friends. Keys that are not update
+// operators are $set:
+//
+//	orm.Model(&post).RawUpdate(bson.M{"$max": bson.M{"score": 42}}).Updates(nil)
+func (orm *MongoORM) RawUpdate(update bson.M) *MongoORM {
+	tx := orm.getInstance()
+	for key, fields := range update {
+		if !strings.HasPrefix(key, "$") {
+			tx.addUpdateOperator("$set", key, fields)
+			continue
+		}
+		values, ok := fields.(bson.M)
+		if data, isMap := fields.(map[string]interface{}); isMap {
+			values, ok = bson.M(data), true
+		}
+		if !ok {
+			tx.AddError(fmt.Errorf("%w: %s expects a document, got %T", ErrInvalidUpdate, key, fields))
+			return tx
+		}
+		for field, value := range values {
+			tx.addUpdateOperator(key, field, value)
+		}
+	}
+	return tx
+}
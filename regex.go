@@ -0,0 +1,102 @@
+package mongorm
+
+import (
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Like matches the documents whose field, a string, matches pattern, an SQL
+// LIKE pattern: % stands for any run of characters, _ for any single
+// character, and a backslash makes the character after it literal:
+//
+//	orm.Like("name", "jo%").Find(&users)
+//	orm.Like("sku", "AB\\_%").Find(&products)
+//
+// The pattern is anchored at both ends and compiled to $regex. Patterns
+// without a leading % become prefix expressions, which use an index on
+// field.
+func (orm *MongoORM) Like(field, pattern string) *MongoORM {
+	return orm.Regex(field, likeExpression(pattern), "")
+}
+
+// ILike is Like, ignoring case. Case-insensitive expressions cannot use
+// an index efficiently; a case-insensitive collation index serves equality
+// matches better.
+func (orm *MongoORM) ILike(field, pattern string) *MongoORM {
+	return orm.Regex(field, likeExpression(pattern), "i")
+}
+
+// Regex matches the documents whose field, a string, matches the regular
+// expression pattern, given in the PCRE syntax of MongoDB, with the $regex
+// options in options, such as "i" to ignore case, or none when empty:
+//
+//	orm.Regex("email", `@example\.(com|org)$`, "i").Find(&users)
+//
+// Unlike Like, the pattern is not anchored.
+func (orm *MongoORM) Regex(field, pattern, options string) *MongoORM {
+	tx := orm.getInstance()
+	tx.addCondition(bson.M{field: regexOperator(pattern, options)})
+	return tx
+}
+
+// Like matches the documents whose f matches pattern, an SQL LIKE pattern,
+// as Like does.
+func (f Field[T]) Like(pattern string) bson.M {
+	return bson.M{f.key: regexOperator(likeExpression(pattern), "")}
+}
+
+// ILike is Like, ignoring case.
+func (f Field[T]) ILike(pattern string) bson.M {
+	return bson.M{f.key: regexOperator(likeExpression(pattern), "i")}
+}
+
+// Regex matches the documents whose f matches the regular expression
+// pattern, with the $regex options in options.
+func (f Field[T]) Regex(pattern, options string) bson.M {
+	return bson.M{f.key: regexOperator(pattern, options)}
+}
+
+// regexOperator returns the $regex operator matching pattern with options.
+func regexOperator(pattern, options string) bson.M {
+	operator := bson.M{"$regex": pattern}
+	if options != "" {
+		operator["$options"] = options
+	}
+	return operator
+}
+
+// likeExpression translates pattern, an SQL LIKE pattern, into an anchored
+// regular expression. A trailing % is dropped rather than translated to .*
+// so that prefix patterns stay prefix expressions.
+func likeExpression(pattern string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '%':
+			if i == len(pattern)-1 {
+				return b.String()
+			}
+			b.WriteString(".*")
+		case '_':
+			b.WriteByte('.')
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			fallthrough
+		default:
+			next := strings.IndexAny(pattern[i+1:], `%_\`)
+			if next < 0 {
+				next = len(pattern) - i - 1
+			}
+			literal := pattern[i : i+1+next]
+			b.WriteString(regexp.QuoteMeta(literal))
+			i += next
+		}
+	}
+	b.WriteByte('$')
+	return b.String()
+}
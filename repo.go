@@ -0,0 +1,91 @@
+package mongorm
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Repo is a typed facade over a MongoORM for documents of type T, a model
+// struct, for callers that prefer compile-time types to interface{}
+// destinations:
+//
+//	users := mongorm.NewRepo[User](orm)
+//	active, err := users.Find(ctx, bson.M{"active": true})
+//	user, err := users.FindByID(ctx, id)
+//
+// Every method runs through the engine, so hooks, callbacks, scopes and
+// logging apply. Repos are safe for concurrent use.
+type Repo[T any] struct {
+	orm *MongoORM
+}
+
+// NewRepo returns a Repo for documents of type T using orm, which may carry
+// settings such as a Session or conditions that every query then applies.
+func NewRepo[T any](orm *MongoORM) *Repo[T] {
+	return &Repo[T]{orm: orm.Session(&Session{})}
+}
+
+// DB returns a chain on the collection of T running with ctx, for queries
+// the Repo methods do not cover:
+//
+//	var names []string
+//	err := users.DB(ctx).Where("age > ?", 30).Pluck("Name", &names).Error
+func (r *Repo[T]) DB(ctx context.Context) *MongoORM {
+	return r.orm.WithContext(ctx).Model(new(T))
+}
+
+// Find returns the documents matching filter, or every document when filter
+// is nil.
+func (r *Repo[T]) Find(ctx context.Context, filter bson.M) ([]T, error) {
+	var docs []T
+	if err := r.DB(ctx).RawFilter(filter).Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// First returns the first document matching filter. It fails with
+// ErrRecordNotFound when there is none.
+func (r *Repo[T]) First(ctx context.Context, filter bson.M) (*T, error) {
+	doc := new(T)
+	if err := r.DB(ctx).RawFilter(filter).First(doc).Error; err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// FindByID returns the document with the ID id, a hex encoded ObjectID or
+// the string form of the ID of T as First takes it. It fails with
+// ErrRecordNotFound when there is none.
+func (r *Repo[T]) FindByID(ctx context.Context, id string) (*T, error) {
+	doc := new(T)
+	if err := r.DB(ctx).First(doc, id).Error; err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Count returns the number of documents matching filter, or of every
+// document when filter is nil.
+func (r *Repo[T]) Count(ctx context.Context, filter bson.M) (int64, error) {
+	var count int64
+	err := r.DB(ctx).RawFilter(filter).Count(&count).Error
+	return count, err
+}
+
+// Create inserts doc and reloads it, as Create does.
+func (r *Repo[T]) Create(ctx context.Context, doc *T) error {
+	return r.orm.WithContext(ctx).Create(doc).Error
+}
+
+// Update replaces the stored document with doc, identified by its ID, as
+// Save does.
+func (r *Repo[T]) Update(ctx context.Context, doc *T) error {
+	return r.orm.WithContext(ctx).Save(doc).Error
+}
+
+// Delete deletes doc, identified by its ID, as Delete does.
+func (r *Repo[T]) Delete(ctx context.Context, doc *T) error {
+	return r.orm.WithContext(ctx).Delete(doc).Error
+}
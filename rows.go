@@ -0,0 +1,95 @@
+package mongorm
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Rows iterates over the documents read by MongoORM.Rows, one at a time.
+type Rows struct {
+	orm    *MongoORM
+	ctx    context.Context
+	cursor *mongo.Cursor
+}
+
+// Rows opens a cursor over the documents matching the chain, for processing
+// them one at a time without holding them all in memory. Select, Omit,
+// Order, Limit and Offset apply, and the collection is taken from a
+// preceding call to Model. The context set with WithContext bounds the
+// iteration; the operation timeout only applies to opening the cursor:
+//
+//	rows, err := orm.Model(&User{}).Where("active = ?", true).Rows()
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		var user User
+//		if err := rows.Decode(&user); err != nil {
+//			return err
+//		}
+//	}
+//	return rows.Err()
+//
+// Rows returns nil without error on a dry run.
+func (orm *MongoORM) Rows() (*Rows, error) {
+	var rows *Rows
+	tx := orm.execute(opQuery, nil, func(tx *MongoORM) {
+		rows = tx.rows()
+	})
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return rows, nil
+}
+
+// rows is the built-in step of Rows.
+func (orm *MongoORM) rows() *Rows {
+	collection := orm.Statement.Collection
+	if collection == nil {
+		orm.Error = ErrMissingModel
+		return nil
+	}
+
+	t := modelType(orm.Statement.Model)
+	filter := orm.queryFilter(t)
+	orm.Statement.record(collection, "find", filter)
+	if orm.Statement.DryRun {
+		return nil
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, filter, orm.findOptions(t))
+	if err != nil {
+		orm.Error = translateError(err)
+		return nil
+	}
+	return &Rows{orm: orm, ctx: orm.context(), cursor: cursor}
+}
+
+// Next advances to the next document, reporting whether there is one.
+func (r *Rows) Next() bool {
+	return r.cursor.Next(r.ctx)
+}
+
+// Decode decodes the current document into doc and runs its AfterFind
+// hook.
+func (r *Rows) Decode(doc interface{}) error {
+	if err := r.cursor.Decode(doc); err != nil {
+		return err
+	}
+	return r.orm.callHook(doc, hookAfterFind)
+}
+
+// Err returns the error that stopped Next, if any.
+func (r *Rows) Err() error {
+	return translateError(r.cursor.Err())
+}
+
+// Close closes the cursor. It is safe to call several times.
+func (r *Rows) Close() error {
+	return r.cursor.Close(r.ctx)
+}
@@ -0,0 +1,173 @@
+package mongorm
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// schema holds what operations look up about a model type: its collection,
+// special fields and associations. It is parsed once per type and cached,
+// so that operations do not walk struct fields and parse tags on every
+// call. Field lookups by name, which come from chain arguments such as
+// Select or Order, are resolved on first use and cached as well.
+type schema struct {
+	collection string
+	// database is the database chosen by the type with DatabaseNamer.
+	database string
+	// embedded is set when documents of the type have embedded fields.
+	embedded bool
+
+	version   reflect.StructField
+	versioned bool
+
+	softDeleteKey string
+	softDeleted   bool
+
+	// createdAt and updatedAt hold the creation and update timestamp
+	// fields of the type.
+	createdAt []timestampField
+	updatedAt []timestampField
+
+	// defaultScoped is set when pointers to the type implement
+	// DefaultScoper.
+	defaultScoped bool
+
+	// associations holds the associations declared by the fields of the
+	// type, in field order, and associationErr the error in the first
+	// invalid declaration.
+	associations   []association
+	associationErr error
+
+	// validations holds the rules of the validate tags of the type, or
+	// validationErr the error in parsing them.
+	validations   []fieldValidation
+	validationErr error
+
+	fields sync.Map // name -> fieldLookup
+	keys   sync.Map // name -> string
+	named  sync.Map // name -> associationLookup
+}
+
+type fieldLookup struct {
+	field reflect.StructField
+	ok    bool
+}
+
+type associationLookup struct {
+	assoc association
+	ok    bool
+}
+
+type hookKey struct {
+	t    reflect.Type
+	name string
+}
+
+// schemaCache holds the schemas parsed by a root instance and everything
+// derived from it, which share its Config. Schemas depend on the naming
+// strategy, which must therefore not change once the instance is used.
+type schemaCache struct {
+	schemas   sync.Map // reflect.Type -> *schema
+	hooks     sync.Map // hookKey -> bool
+	databases sync.Map // collection -> database chosen with DatabaseNamer
+	embedded  sync.Map // collection -> true for models with embedded fields
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{}
+}
+
+var defaultScoperType = reflect.TypeOf((*DefaultScoper)(nil)).Elem()
+
+// schema returns the schema of the model type t.
+func (orm *MongoORM) schema(t reflect.Type) *schema {
+	if orm.schemas == nil {
+		return orm.parseSchema(t)
+	}
+	if s, ok := orm.schemas.schemas.Load(t); ok {
+		return s.(*schema)
+	}
+	s, _ := orm.schemas.schemas.LoadOrStore(t, orm.parseSchema(t))
+	if database := s.(*schema).database; database != "" {
+		orm.schemas.databases.Store(s.(*schema).collection, database)
+	}
+	if s.(*schema).embedded {
+		orm.schemas.embedded.Store(s.(*schema).collection, true)
+	}
+	return s.(*schema)
+}
+
+// parseSchema parses the schema of the model type t.
+func (orm *MongoORM) parseSchema(t reflect.Type) *schema {
+	s := &schema{collection: orm.parseCollectionName(t), database: parseDatabaseName(t)}
+	if t.Kind() != reflect.Struct {
+		return s
+	}
+	s.embedded = hasEmbeddedFields(t, map[reflect.Type]bool{})
+	s.version, s.versioned = orm.parseVersionField(t)
+	s.softDeleteKey, s.softDeleted = orm.parseSoftDeleteField(t)
+	s.createdAt, s.updatedAt = orm.parseTimestampFields(t)
+	s.defaultScoped = reflect.PointerTo(t).Implements(defaultScoperType)
+	s.validations, s.validationErr = orm.parseValidations(t)
+	for i := 0; i < t.NumField(); i++ {
+		assoc, ok, err := orm.parseAssociation(t, t.Field(i).Name)
+		if err != nil && s.associationErr == nil {
+			s.associationErr = err
+		}
+		if ok {
+			s.associations = append(s.associations, assoc)
+		}
+	}
+	return s
+}
+
+// hasHook reports whether values of type t have a method named name, which
+// callHook then invokes.
+func (orm *MongoORM) hasHook(t reflect.Type, name string) bool {
+	if orm.schemas == nil {
+		_, ok := t.MethodByName(name)
+		return ok
+	}
+	key := hookKey{t: t, name: name}
+	if ok, found := orm.schemas.hooks.Load(key); found {
+		return ok.(bool)
+	}
+	_, ok := t.MethodByName(name)
+	orm.schemas.hooks.Store(key, ok)
+	return ok
+}
+
+// tagSettings caches the settings of struct tags, which do not depend on
+// the Config.
+var tagSettings sync.Map // reflect.StructTag -> map[string]string
+
+// gormSettings are the settings read from gorm tags when the mongorm tag
+// does not have them, for models written for gorm: those declaring keys,
+// associations and timestamps, which mean the same to both.
+var gormSettings = []string{"primarykey", "foreignkey", "references", "many2many", "joinforeignkey", "joinreferences", "autocreatetime", "autoupdatetime"}
+
+// fieldSettings returns the settings of the mongorm tag of field, as
+// parsed by parseTagSettings, along with the gormSettings of its gorm tag.
+// The returned map is shared and must not be modified.
+func fieldSettings(field reflect.StructField) map[string]string {
+	if settings, ok := tagSettings.Load(field.Tag); ok {
+		return settings.(map[string]string)
+	}
+	settings := parseTagSettings(field.Tag.Get("mongorm"))
+	if tag, ok := field.Tag.Lookup("gorm"); ok {
+		// gorm separates settings with semicolons; commas are accepted
+		// too, as earlier versions required them.
+		gorm := parseTagSettings(strings.ReplaceAll(tag, ",", ";"))
+		for _, key := range gormSettings {
+			if _, set := settings[key]; set {
+				continue
+			}
+			if value, ok := gorm[key]; ok {
+				settings[key] = value
+			}
+		}
+	}
+	s, _ := tagSettings.LoadOrStore(field.Tag, settings)
+	return s.(map[string]string)
+}
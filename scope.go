@@ -0,0 +1,57 @@
+package mongorm
+
+import (
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultScoper is implemented by models whose queries are always narrowed
+// by the same conditions, such as excluding archived documents:
+//
+//	func (Post) DefaultScope(tx *mongorm.MongoORM) *mongorm.MongoORM {
+//		return tx.Where("archived = ?", false)
+//	}
+//
+// The conditions added to tx apply to First, Find, Count, the update and
+// delete methods, aggregations, preloads and joins of the model, alongside
+// the soft delete scope. Unscoped bypasses both.
+type DefaultScoper interface {
+	DefaultScope(tx *MongoORM) *MongoORM
+}
+
+// modelScope returns the conditions every query for documents of type t is
+// narrowed by: the statement's Scope, the soft delete scope and the model's
+// default scope. It is nil when there are none; an unscoped chain keeps the
+// statement's Scope only.
+func (orm *MongoORM) modelScope(t reflect.Type) bson.M {
+	scope := mergeConditions(orm.statementScope(t), orm.softDeleteScope(t))
+	if orm.Statement.Unscoped || t == nil {
+		return scope
+	}
+
+	if !orm.schema(t).defaultScoped {
+		return scope
+	}
+	scoper, ok := reflect.New(t).Interface().(DefaultScoper)
+	if !ok {
+		return scope
+	}
+	scoped := scoper.DefaultScope(orm.newInstance())
+	if scoped == nil {
+		return scope
+	}
+	if scoped.Error != nil {
+		orm.AddError(scoped.Error)
+	}
+	return mergeConditions(scope, scoped.Statement.Filter)
+}
+
+// statementScope returns the conditions of the statement's Scope for
+// documents of type t.
+func (orm *MongoORM) statementScope(t reflect.Type) bson.M {
+	if orm.Statement.Scope == nil {
+		return nil
+	}
+	return orm.Statement.Scope(t)
+}
@@ -0,0 +1,138 @@
+package mongorm
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Session holds settings captured by MongoORM.Session.
+type Session struct {
+	// Context is used by every operation, as with WithContext.
+	Context context.Context
+	// Logger replaces Config.Logger.
+	Logger Logger
+	// DryRun builds operations, recording them in Statement, without
+	// sending them to the database, as DryRun does.
+	DryRun bool
+	// SkipHooks disables model hooks such as BeforeCreate and AfterFind.
+	SkipHooks bool
+	// CreateBatchSize makes Create insert slices in batches of this size,
+	// as CreateInBatches does.
+	CreateBatchSize int
+	// TrackChanges snapshots the documents loaded by First and Find, and
+	// written by Save, so that Save only writes the fields that changed
+	// since. Snapshots are kept until the session is dropped.
+	TrackChanges bool
+	// NewDB starts chains from an empty statement instead of the
+	// conditions accumulated on the instance, keeping only where its
+	// operations are routed and scoped: Database, CollectionPrefix and
+	// Scope. Callbacks use it to read the documents of the running
+	// operation as it sees them.
+	NewDB bool
+}
+
+// Session returns an instance applying config to every operation. Like the
+// instance returned by NewMongoORM it is safe for concurrent use, and each
+// chain started from it also starts from any conditions accumulated on orm,
+// making it cheap to prepare instances per request or per tenant:
+//
+//	db := orm.Session(&mongorm.Session{Context: r.Context(), SkipHooks: true})
+//	db.Where("id = ?", id).First(&user)
+func (orm *MongoORM) Session(config *Session) *MongoORM {
+	var tx *MongoORM
+	if config.NewDB {
+		tx = orm.newInstance()
+		tx.session, tx.inSession = orm.session, orm.inSession
+		tx.Statement.Database = orm.Statement.Database
+		tx.Statement.CollectionPrefix = orm.Statement.CollectionPrefix
+		tx.Statement.Scope = orm.Statement.Scope
+	} else {
+		tx = orm.getInstance()
+	}
+	tx.clone = true
+	if config.Context != nil {
+		tx.ctx = config.Context
+	}
+	if config.Logger != nil {
+		tx.sessionLogger = config.Logger
+	}
+	if config.DryRun {
+		tx.dryRun = true
+	}
+	if config.SkipHooks {
+		tx.skipHooks = true
+	}
+	if config.CreateBatchSize > 0 {
+		tx.createBatchSize = config.CreateBatchSize
+	}
+	if config.TrackChanges {
+		tx.changes = newChangeTracker()
+	}
+	return tx
+}
+
+// Debug returns an instance logging every operation of the chain at
+// LogInfo, with the filter, update or pipeline sent to the driver:
+//
+//	orm.Debug().Where("age > ?", 30).Find(&users)
+//	// [1.204ms] [rows:3] db.users.find({"age":{"$gt":30}})
+func (orm *MongoORM) Debug() *MongoORM {
+	return orm.Session(&Session{Logger: orm.logger().LogMode(LogInfo)})
+}
+
+// DryRun returns an instance building operations without sending them to
+// the database. The statement of each operation is kept once it ran, so
+// that the driver call it describes can be inspected:
+//
+//	stmt := orm.DryRun().Where("age > ?", 30).Find(&users).Statement
+//	stmt.Method    // "find"
+//	stmt.String()  // db.users.find({"age":{"$gt":30}})
+func (orm *MongoORM) DryRun() *MongoORM {
+	return orm.Session(&Session{DryRun: true})
+}
+
+// clone returns a copy of stmt that shares nothing mutable with it.
+func (stmt *Statement) clone() *Statement {
+	copied := *stmt
+	copied.Filter = copyM(stmt.Filter)
+	copied.Selects = copyM(stmt.Selects)
+	copied.Attrs = copyM(stmt.Attrs)
+	copied.Assigns = copyM(stmt.Assigns)
+	if stmt.UpdateOperators != nil {
+		copied.UpdateOperators = bson.M{}
+		for operator, fields := range stmt.UpdateOperators {
+			if fields, ok := fields.(bson.M); ok {
+				copied.UpdateOperators[operator] = copyM(fields)
+				continue
+			}
+			copied.UpdateOperators[operator] = fields
+		}
+	}
+	copied.Sort = append(bson.D(nil), stmt.Sort...)
+	copied.Preloads = append([]string(nil), stmt.Preloads...)
+	if stmt.PreloadScopes != nil {
+		copied.PreloadScopes = map[string][]func(*MongoORM) *MongoORM{}
+		for name, scopes := range stmt.PreloadScopes {
+			copied.PreloadScopes[name] = append([]func(*MongoORM) *MongoORM(nil), scopes...)
+		}
+	}
+	copied.Joins = append([]string(nil), stmt.Joins...)
+	copied.Groups = append([]string(nil), stmt.Groups...)
+	copied.Having = copyM(stmt.Having)
+	copied.Omits = append([]string(nil), stmt.Omits...)
+	copied.ArrayFilters = append([]interface{}(nil), stmt.ArrayFilters...)
+	copied.Args = append([]interface{}(nil), stmt.Args...)
+	return &copied
+}
+
+func copyM(m bson.M) bson.M {
+	if m == nil {
+		return nil
+	}
+	copied := make(bson.M, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
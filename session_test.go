@@ -0,0 +1,32 @@
+package mongorm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+)
+
+func TestSessionBranchesKeepTheirArrayFilters(t *testing.T) {
+	orm := mongormtest.New()
+	base := orm.ArrayFilter("a.x = ?", 1).ArrayFilter("b.x = ?", 2).ArrayFilter("c.x = ?", 3).
+		Session(&mongorm.Session{})
+
+	first := base.ArrayFilter("d.x = ?", 4)
+	second := base.ArrayFilter("d.x = ?", 5)
+
+	for _, tc := range []struct {
+		tx   *mongorm.MongoORM
+		want int
+	}{{first, 4}, {second, 5}} {
+		want := orm.ArrayFilter("d.x = ?", tc.want).Statement.ArrayFilters[0]
+		got := tc.tx.Statement.ArrayFilters
+		if len(got) != 4 || !reflect.DeepEqual(got[3], want) {
+			t.Errorf("array filters = %v, want the last to be %v", got, want)
+		}
+	}
+	if got := base.Statement.ArrayFilters; len(got) != 3 {
+		t.Errorf("session array filters = %v, want 3", got)
+	}
+}
@@ -0,0 +1,144 @@
+package mongorm
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Unscoped disables soft delete handling and default scopes for the next
+// operation: queries include soft deleted documents and documents outside
+// the model's DefaultScope, and Delete removes documents permanently.
+func (orm *MongoORM) Unscoped() *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Unscoped = true
+	return tx
+}
+
+// softDeleteField reports the bson name of t's DateDeleted field. Models
+// that embed OrmModel, or declare their own DateDeleted *time.Time field,
+// are soft deleted.
+func (orm *MongoORM) softDeleteField(t reflect.Type) (string, bool) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return "", false
+	}
+	s := orm.schema(t)
+	return s.softDeleteKey, s.softDeleted
+}
+
+// parseSoftDeleteField is the uncached softDeleteField.
+func (orm *MongoORM) parseSoftDeleteField(t reflect.Type) (string, bool) {
+	field, ok := t.FieldByName("DateDeleted")
+	if !ok || field.Type != reflect.TypeOf(&time.Time{}) {
+		return "", false
+	}
+	return orm.fieldName(field), true
+}
+
+// softDeleteScope returns the condition excluding soft deleted documents of
+// type t, or nil when t is not soft deleted or the chain is unscoped.
+func (orm *MongoORM) softDeleteScope(t reflect.Type) bson.M {
+	if orm.Statement.Unscoped {
+		return nil
+	}
+	if name, ok := orm.softDeleteField(t); ok {
+		return bson.M{name: nil}
+	}
+	return nil
+}
+
+// deletedAt returns the deletion timestamp to store for doc, preferring one
+// already set by a BeforeDelete hook.
+func deletedAt(doc interface{}) time.Time {
+	docVal := reflect.ValueOf(doc)
+	for docVal.Kind() == reflect.Ptr && !docVal.IsNil() {
+		docVal = docVal.Elem()
+	}
+	if docVal.Kind() == reflect.Struct {
+		if field := docVal.FieldByName("DateDeleted"); field.IsValid() && !field.IsNil() {
+			if t, ok := field.Interface().(*time.Time); ok {
+				return *t
+			}
+		}
+	}
+	return time.Now()
+}
+
+// Restore undoes a soft delete by unsetting date_deleted. Like Delete, the
+// documents are selected by id, the chained conditions or doc's own ID:
+//
+//	orm.Restore(&user)
+//	orm.Where("email = ?", email).Restore(&User{})
+//
+// BeforeRestore and AfterRestore hooks on doc are called around the update,
+// and RowsAffected reports how many documents were restored.
+func (orm *MongoORM) Restore(doc interface{}, id ...string) *MongoORM {
+	return orm.execute(opUpdate, doc, func(tx *MongoORM) {
+		tx.restore(doc, id...)
+	})
+}
+
+// restore is the built-in step of Restore.
+func (orm *MongoORM) restore(doc interface{}, id ...string) *MongoORM {
+	if orm.Error != nil {
+		return orm
+	}
+
+	name, ok := orm.softDeleteField(modelType(doc))
+	if !ok {
+		orm.Error = ErrNotSoftDeletable
+		return orm
+	}
+
+	if len(id) > 0 && id[0] != "" {
+		objectId, err := parseID(modelType(doc), id[0])
+		if err != nil {
+			orm.Error = err
+			return orm
+		}
+		orm.addCondition(bson.M{"_id": objectId})
+	} else if orm.Statement.Filter == nil {
+		oid, err := recordID(doc)
+		if err != nil {
+			orm.Error = err
+			return orm
+		}
+		orm.Statement.Filter = bson.M{"_id": oid}
+	}
+
+	collectionName := orm.determineCollectionName(doc)
+	collection := orm.collection(collectionName)
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	if err := orm.callHook(doc, hookBeforeRestore); err != nil {
+		orm.Error = err
+		return orm
+	}
+
+	filter := mergeConditions(orm.Statement.Filter, bson.M{name: bson.M{"$ne": nil}})
+	filter = mergeConditions(filter, orm.statementScope(modelType(doc)))
+	update := bson.M{"$unset": bson.M{name: ""}}
+	orm.Statement.record(collection, "updateMany", filter, update)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	result, err := collection.UpdateMany(ctx, filter, update, orm.updateOptions())
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.RowsAffected = uint(result.ModifiedCount)
+
+	docVal := reflect.ValueOf(doc)
+	if docVal.Kind() == reflect.Ptr && !docVal.IsNil() && docVal.Elem().Kind() == reflect.Struct {
+		if field := docVal.Elem().FieldByName("DateDeleted"); field.CanSet() {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
+	orm.Error = orm.callHook(doc, hookAfterRestore)
+	return orm
+}
@@ -0,0 +1,178 @@
+package mongorm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// Statement holds the state accumulated by a chain of calls and the
+// operation it ends in. Callbacks registered with Callback may inspect and
+// modify it; chain methods such as Where are usually more convenient.
+type Statement struct {
+	// Operation names the running operation, such as "create" or "query".
+	Operation string
+	// Context is the context the operation runs with. It defaults to the
+	// one set with WithContext; callbacks may replace it, for example to
+	// start a tracing span around the driver call.
+	Context context.Context
+	// Dest is the document or slice of documents the operation writes or
+	// decodes into, or the write models of a bulk write. Callbacks may
+	// replace the documents of a create with copies holding other values,
+	// such as maps with added keys, so as to leave those of the caller as
+	// they are; the copies are then written and reloaded instead.
+	Dest interface{}
+	// Model is the model given to Model.
+	Model interface{}
+	// Collection is the collection the operation runs against, when known
+	// before it executes.
+	Collection *mongo.Collection
+	// Table is the collection given to Table, replacing that of the model.
+	Table string
+	// Database is the database given to Use, and CollectionPrefix a prefix
+	// for the names of the collections the operation runs against. When set,
+	// they override the database of the model. Callbacks may set them to
+	// route operations, for example to keep the documents of each tenant
+	// apart.
+	Database         string
+	CollectionPrefix string
+	// Scope, when set, returns conditions narrowing every filter sent for
+	// documents of type t, including those selecting a document by ID.
+	// Unlike the soft delete and default scopes, Unscoped keeps them.
+	Scope func(t reflect.Type) bson.M
+
+	// Filter holds the conditions added by Where, Or and Not.
+	Filter bson.M
+	// Preloads holds the associations given to Preload.
+	Preloads []string
+	// PreloadScopes holds the scopes given to Preload, by association.
+	PreloadScopes map[string][]func(*MongoORM) *MongoORM
+	// Joins holds the associations given to Joins.
+	Joins []string
+	// Groups holds the fields given to Group, and Having the conditions
+	// given to Having.
+	Groups []string
+	Having bson.M
+	// Selects holds the fields given to Select, mapped to 1, or to 0 for
+	// exclusions.
+	Selects bson.M
+	// AllFields is set by Select("*") and makes Updates write struct fields
+	// holding zero values.
+	AllFields bool
+	// Omits holds the fields given to Omit.
+	Omits  []string
+	Sort   bson.D
+	Limit  int64
+	Offset int64
+	// Unscoped disables the soft delete and default scopes.
+	Unscoped bool
+	// Upsert enables upserts for Save and the update methods.
+	Upsert bool
+	// UpdateOperators holds operators added by Set, Inc, Push and friends,
+	// and the update given to UpdateAndGet.
+	UpdateOperators bson.M
+	// UpdatingColumns is set by UpdateColumn and UpdateColumns, whose
+	// updates run no hooks and stamp no timestamps.
+	UpdatingColumns bool
+	// ArrayFilters holds the filters given to ArrayFilter and ArrayFilters.
+	ArrayFilters []interface{}
+	// Attrs and Assigns hold the values for FirstOrInit and FirstOrCreate.
+	// FirstOrCreate sets Attrs, empty when none were given, so that
+	// callbacks may add values to the document it would create.
+	Attrs   bson.M
+	Assigns bson.M
+	// Collation is the collation given to Collation.
+	Collation *options.Collation
+	// Hint is the index given to Hint, by name or key pattern.
+	Hint interface{}
+	// Ordered controls whether slice inserts stop at the first failure.
+	Ordered *bool
+	// ReadPreference, ReadConcern and WriteConcern override the client's
+	// defaults for the operation.
+	ReadPreference *readpref.ReadPref
+	ReadConcern    *readconcern.ReadConcern
+	WriteConcern   *writeconcern.WriteConcern
+	// Timeout is the timeout set with WithTimeout.
+	Timeout time.Duration
+	// DryRun skips sending the operation to the database; Method and Args
+	// still describe it, and the statement is kept once the operation ran.
+	DryRun bool
+
+	// Method and Args describe the last driver call made by the operation,
+	// such as "updateOne" with its filter and update.
+	Method string
+	Args   []interface{}
+
+	// failed is set once AddError records an error for this statement.
+	failed bool
+}
+
+// ModelType returns the type of the documents the operation reads or
+// writes: that of Model, or else that of Dest.
+func (stmt *Statement) ModelType() reflect.Type {
+	if stmt.Model != nil {
+		return modelType(stmt.Model)
+	}
+	return modelType(stmt.Dest)
+}
+
+// record notes a driver call made on collection.
+func (stmt *Statement) record(collection *mongo.Collection, method string, args ...interface{}) {
+	stmt.Collection = collection
+	stmt.Method = method
+	stmt.Args = args
+}
+
+// String renders the recorded driver call in shell syntax, for example
+// db.users.find({"age": {"$gt": 30}}).
+func (stmt *Statement) String() string {
+	if stmt.Method == "" {
+		return ""
+	}
+
+	collection := ""
+	if stmt.Collection != nil {
+		collection = stmt.Collection.Name()
+	}
+	args := make([]string, len(stmt.Args))
+	for i, arg := range stmt.Args {
+		args[i] = renderValue(arg)
+	}
+	return fmt.Sprintf("db.%s.%s(%s)", collection, stmt.Method, strings.Join(args, ", "))
+}
+
+// renderValue renders v as relaxed extended JSON, with embedded fields
+// flattened as they are stored.
+func renderValue(v interface{}) string {
+	var buf bytes.Buffer
+	err := func() error {
+		vw, err := bsonrw.NewExtJSONValueWriter(&buf, false, false)
+		if err != nil {
+			return err
+		}
+		enc, err := bson.NewEncoder(vw)
+		if err != nil {
+			return err
+		}
+		if err := enc.SetRegistry(embeddedRegistry); err != nil {
+			return err
+		}
+		return enc.Encode(bson.D{{Key: "v", Value: v}})
+	}()
+	data := bytes.TrimSpace(buf.Bytes())
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(data), `{"v":`), "}")
+}
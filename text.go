@@ -0,0 +1,19 @@
+package mongorm
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Search matches the documents whose text index, declared with the "text"
+// tag and created by AutoMigrate, matches query, most relevant first:
+//
+//	orm.Search("coffee shop").Limit(20).Find(&places)
+//	orm.Search(`"flat white" -decaf`).Where("city = ?", "Oslo").Find(&places)
+//
+// query follows MongoDB's $text syntax: words are ORed, quoted phrases must
+// appear and words prefixed with "-" must not. Results are sorted by their
+// textScore after any order given before Search.
+func (orm *MongoORM) Search(query string) *MongoORM {
+	tx := orm.getInstance()
+	tx.addCondition(bson.M{"$text": bson.M{"$search": query}})
+	tx.Statement.Sort = append(tx.Statement.Sort, bson.E{Key: "score", Value: bson.M{"$meta": "textScore"}})
+	return tx
+}
@@ -0,0 +1,106 @@
+package mongorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// parseTimeSeries parses the timeseries tag declared on a field of t:
+//
+//	type Reading struct {
+//		Time   time.Time `bson:"ts" mongorm:"timeseries:metaField=sensor,granularity=minutes"`
+//		Sensor string    `bson:"sensor"`
+//		Value  float64   `bson:"value"`
+//	}
+//
+// Its settings are timeField, defaulting to the tagged field, metaField,
+// granularity ("seconds", "minutes" or "hours") and expireAfter, a duration
+// as accepted by the ttl tag after which measurements are removed. It
+// returns nil options when t declares no time series.
+func (orm *MongoORM) parseTimeSeries(t reflect.Type) (*options.CreateCollectionOptions, error) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if isInline(field) {
+			if opts, err := orm.parseTimeSeries(indirectType(field.Type)); opts != nil || err != nil {
+				return opts, err
+			}
+			continue
+		}
+		value, ok := fieldSettings(field)["timeseries"]
+		if !ok {
+			continue
+		}
+
+		timeSeries := options.TimeSeries().SetTimeField(orm.fieldName(field))
+		opts := options.CreateCollection()
+		for _, setting := range strings.Split(value, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(setting), "=")
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "timefield":
+				timeSeries.SetTimeField(value)
+			case "metafield":
+				timeSeries.SetMetaField(value)
+			case "granularity":
+				switch value {
+				case "seconds", "minutes", "hours":
+					timeSeries.SetGranularity(value)
+				default:
+					return nil, fmt.Errorf("field %s: invalid time series granularity %q", field.Name, value)
+				}
+			case "expireafter":
+				expireAfter, err := parseTTL(value)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", field.Name, err)
+				}
+				opts.SetExpireAfterSeconds(int64(expireAfter.Seconds()))
+			case "":
+			default:
+				return nil, fmt.Errorf("field %s: unknown time series setting %q", field.Name, key)
+			}
+		}
+		return opts.SetTimeSeriesOptions(timeSeries), nil
+	}
+	return nil, nil
+}
+
+// TimeBucket appends the stages rolling documents up into buckets of
+// binSize units of their timeField, with the accumulators in fields, in
+// time order. unit is one of "millisecond", "second", "minute", "hour",
+// "day", "week", "month", "quarter" or "year":
+//
+//	var rollup []struct {
+//		Start time.Time `bson:"_id"`
+//		Avg   float64   `bson:"avg"`
+//	}
+//	orm.Model(&Reading{}).Where("sensor = ?", "s1").Aggregate().
+//		TimeBucket("ts", "minute", 5, bson.M{"avg": bson.M{"$avg": "$value"}}).
+//		All(&rollup)
+//
+// The start of each bucket is stored in _id or, when documents are also
+// grouped by the fields given in by, such as a time series' metaField, in
+// _id.time with those fields alongside. It requires MongoDB 5.0.
+func (p *Pipeline) TimeBucket(timeField, unit string, binSize int, fields bson.M, by ...string) *Pipeline {
+	start := bson.D{{Key: "$dateTrunc", Value: bson.D{
+		{Key: "date", Value: "$" + timeField},
+		{Key: "unit", Value: unit},
+		{Key: "binSize", Value: binSize},
+	}}}
+	var id interface{} = start
+	sortKey := "_id"
+	if len(by) > 0 {
+		key := bson.D{{Key: "time", Value: start}}
+		for _, field := range by {
+			key = append(key, bson.E{Key: field, Value: "$" + field})
+		}
+		id, sortKey = key, "_id.time"
+	}
+	return p.Group(id, fields).Sort(bson.D{{Key: sortKey, Value: 1}})
+}
@@ -0,0 +1,336 @@
+package mongorm
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Models keep track of when their documents were created and last updated
+// in timestamp fields, which the engine stamps: fields tagged
+// mongorm:"autoCreateTime" or "autoUpdateTime", or else named DateCreated
+// and DateUpdated, as are those of OrmModel:
+//
+//	type Article struct {
+//		ID        primitive.ObjectID `bson:"_id,omitempty"`
+//		Published time.Time          `bson:"published" mongorm:"autoCreateTime"`
+//		Edited    int64              `bson:"edited" mongorm:"autoUpdateTime:milli"`
+//	}
+//
+// Timestamp fields are time.Time or *time.Time fields, or integer fields
+// holding a Unix time in seconds, or in milliseconds or nanoseconds with
+// the "milli" and "nano" options. The option "false" turns off a field
+// found by name.
+//
+// Create, including slice creates, FirstOrCreate and bulk inserts, stamps
+// the creation and update timestamps that are zero, so that values set by
+// hand or by BeforeCreate hooks are kept. Save and bulk replacements stamp
+// the update timestamps, and the creation timestamps that are zero.
+// Updates, UpdateMany, UpdateAndGet and bulk updates of the model given to
+// Model $set the update timestamps the update does not set itself, and
+// $setOnInsert the creation timestamps when upserting; Updates stores the
+// time in the updated struct too. Timestamps given to Omit are left alone,
+// and UpdateColumn and UpdateColumns stamp nothing. The time is read from
+// Config.NowFunc and stored with the millisecond precision of BSON dates.
+
+// timestampField is a timestamp field of a model, and the unit of the
+// Unix time held by integer fields.
+type timestampField struct {
+	field reflect.StructField
+	key   string
+	unit  time.Duration
+}
+
+var timePointerType = reflect.TypeOf(&time.Time{})
+
+// now returns the time to stamp into timestamp fields.
+func (orm *MongoORM) now() time.Time {
+	now := time.Now
+	if orm.config != nil && orm.config.NowFunc != nil {
+		now = orm.config.NowFunc
+	}
+	return now().Truncate(time.Millisecond)
+}
+
+// timestampFields returns the creation and update timestamp fields of t.
+func (orm *MongoORM) timestampFields(t reflect.Type) (created, updated []timestampField) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	s := orm.schema(t)
+	return s.createdAt, s.updatedAt
+}
+
+// parseTimestampFields is the uncached timestampFields. Fields of inlined
+// structs are included.
+func (orm *MongoORM) parseTimestampFields(t reflect.Type) (created, updated []timestampField) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if isInline(field) {
+			innerCreated, innerUpdated := orm.parseTimestampFields(indirectType(field.Type))
+			for _, ts := range innerCreated {
+				ts.field.Index = append([]int{i}, ts.field.Index...)
+				created = append(created, ts)
+			}
+			for _, ts := range innerUpdated {
+				ts.field.Index = append([]int{i}, ts.field.Index...)
+				updated = append(updated, ts)
+			}
+			continue
+		}
+		if ts, ok := orm.parseTimestampField(field, "autocreatetime", "DateCreated"); ok {
+			created = append(created, ts)
+		}
+		if ts, ok := orm.parseTimestampField(field, "autoupdatetime", "DateUpdated"); ok {
+			updated = append(updated, ts)
+		}
+	}
+	return created, updated
+}
+
+// parseTimestampField returns field as a timestamp field when it is tagged
+// with setting, or named name and of a time type.
+func (orm *MongoORM) parseTimestampField(field reflect.StructField, setting, name string) (timestampField, bool) {
+	option, tagged := fieldSettings(field)[setting]
+	if (!tagged && field.Name != name) || option == "false" {
+		return timestampField{}, false
+	}
+	ts := timestampField{field: field, key: orm.fieldName(field), unit: time.Second}
+	switch option {
+	case "milli":
+		ts.unit = time.Millisecond
+	case "nano":
+		ts.unit = time.Nanosecond
+	}
+	switch field.Type.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return ts, tagged
+	}
+	return ts, field.Type == timeType || field.Type == timePointerType
+}
+
+// value returns now as stored in ts.
+func (ts timestampField) value(now time.Time) interface{} {
+	if ts.field.Type == timeType || ts.field.Type == timePointerType {
+		return now
+	}
+	return now.UnixNano() / int64(ts.unit)
+}
+
+// set stores now in ts of v, a struct value, when it can be set and, with
+// onlyZero, holds no time yet.
+func (ts timestampField) set(v reflect.Value, now time.Time, onlyZero bool) {
+	value, err := v.FieldByIndexErr(ts.field.Index)
+	if err != nil || !value.CanSet() {
+		return
+	}
+	if onlyZero && !value.IsZero() && (value.Kind() != reflect.Ptr || !value.Elem().IsZero()) {
+		return
+	}
+	switch value.Type() {
+	case timeType:
+		value.Set(reflect.ValueOf(now))
+	case timePointerType:
+		value.Set(reflect.ValueOf(&now))
+	default:
+		value.Set(reflect.ValueOf(ts.value(now)).Convert(value.Type()))
+	}
+}
+
+// stampCreate stamps the timestamp fields of doc, a document about to be
+// created, that are zero.
+func (orm *MongoORM) stampCreate(doc interface{}) {
+	orm.stampDocument(doc, true)
+}
+
+// stampSave stamps the update timestamp fields of doc, a document about to
+// be replaced, and its creation timestamp fields that are zero.
+func (orm *MongoORM) stampSave(doc interface{}) {
+	orm.stampDocument(doc, false)
+}
+
+// stampDocument stamps the timestamp fields of doc, the update ones only
+// when zero with onlyZero.
+func (orm *MongoORM) stampDocument(doc interface{}, onlyZero bool) {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	created, updated := orm.timestampFields(v.Type())
+	if len(created) == 0 && len(updated) == 0 {
+		return
+	}
+	now := orm.now()
+	for _, ts := range created {
+		ts.set(v, now, true)
+	}
+	for _, ts := range updated {
+		ts.set(v, now, onlyZero)
+	}
+}
+
+// stampUpdate returns update, an update of documents of type t, with a
+// $set of the update timestamp fields it does not write, and a
+// $setOnInsert of the creation ones when upserting. The update timestamps
+// are also stored in target, the updated struct, when given. Updates
+// issued by UpdateColumn and UpdateColumns are returned as they are.
+func (orm *MongoORM) stampUpdate(update bson.M, t reflect.Type, target interface{}) bson.M {
+	if orm.Statement.UpdatingColumns {
+		return update
+	}
+	created, updated := orm.timestampFields(t)
+	if len(updated) == 0 && (len(created) == 0 || !orm.Statement.Upsert) {
+		return update
+	}
+
+	// Timestamps given to Omit are left alone, like those the update
+	// writes itself.
+	skip := map[string]bool{}
+	for _, name := range orm.Statement.Omits {
+		skip[orm.documentKey(t, name)] = true
+	}
+	now := orm.now()
+	set, setOnInsert := bson.M{}, bson.M{}
+	for _, ts := range updated {
+		if !skip[ts.key] && !updatesKey(update, ts.key) {
+			set[ts.key] = ts.value(now)
+		}
+	}
+	if orm.Statement.Upsert {
+		for _, ts := range created {
+			if _, ok := set[ts.key]; !ok && !skip[ts.key] && !updatesKey(update, ts.key) {
+				setOnInsert[ts.key] = ts.value(now)
+			}
+		}
+	}
+	stamped := withFields(update, "$set", set)
+	stamped = withFields(stamped, "$setOnInsert", setOnInsert)
+
+	v := reflect.ValueOf(target)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct && v.Elem().Type() == t {
+		for _, ts := range updated {
+			if _, ok := set[ts.key]; ok {
+				ts.set(v.Elem(), now, false)
+			}
+		}
+	}
+	return stamped
+}
+
+// withFields returns a copy of update whose operator also writes fields.
+// update is returned as it is when the operator holds no document.
+func withFields(update bson.M, operator string, fields bson.M) bson.M {
+	if len(fields) == 0 {
+		return update
+	}
+	combined := bson.M{}
+	if existing, ok := update[operator]; ok {
+		doc, err := toDocument(existing)
+		if err != nil {
+			return update
+		}
+		for key, value := range doc {
+			combined[key] = value
+		}
+	}
+	for key, value := range fields {
+		combined[key] = value
+	}
+	copied := bson.M{operator: combined}
+	for key, value := range update {
+		if key != operator {
+			copied[key] = value
+		}
+	}
+	return copied
+}
+
+// updatesKey reports whether an operator of update writes key.
+func updatesKey(update bson.M, key string) bool {
+	for _, fields := range update {
+		if doc, err := toDocument(fields); err == nil {
+			if _, ok := doc[key]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Touch sets the update timestamps of doc, such as DateUpdated, to the
+// current time, in the database and in doc, leaving the rest of the
+// document alone. It issues a single $set, making it suited to "last
+// seen" timestamps:
+//
+//	orm.Touch(&session)
+//
+// The document is selected by doc's ID, within the chained conditions.
+// Hooks do not run, and the version of versioned documents is neither
+// checked nor bumped. Touch fails with ErrNotTouchable for models without
+// update timestamp fields, and with ErrRecordNotFound when no document
+// matches.
+func (orm *MongoORM) Touch(doc interface{}) *MongoORM {
+	return orm.execute(opUpdate, doc, func(tx *MongoORM) {
+		tx.touch(doc)
+	})
+}
+
+// touch is the built-in step of Touch.
+func (orm *MongoORM) touch(doc interface{}) *MongoORM {
+	if orm.Error != nil {
+		return orm
+	}
+
+	t := modelType(doc)
+	_, updated := orm.timestampFields(t)
+	if len(updated) == 0 {
+		orm.Error = ErrNotTouchable
+		return orm
+	}
+	id, err := recordID(doc)
+	if err != nil {
+		orm.Error = err
+		return orm
+	}
+	orm.addCondition(bson.M{"_id": id})
+
+	collection := orm.collection(orm.determineCollectionName(doc))
+	now := orm.now()
+	set := bson.M{}
+	for _, ts := range updated {
+		set[ts.key] = ts.value(now)
+	}
+	filter := orm.queryFilter(t)
+	update := bson.M{"$set": set}
+	orm.Statement.record(collection, "updateOne", filter, update)
+	if orm.Statement.DryRun {
+		return orm
+	}
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+	result, err := collection.UpdateOne(ctx, filter, update, orm.updateOptions())
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.UpdateResult = result
+	if result.MatchedCount == 0 {
+		orm.Error = ErrRecordNotFound
+		return orm
+	}
+	orm.RowsAffected = uint(result.ModifiedCount)
+	if v := reflect.ValueOf(doc); v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		for _, ts := range updated {
+			ts.set(v.Elem(), now, false)
+		}
+	}
+	return orm
+}
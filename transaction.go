@@ -0,0 +1,180 @@
+package mongorm
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Begin starts a transaction and returns a new instance bound to it. Every
+// operation issued through the returned instance runs inside the
+// transaction until Commit or Rollback is called on it:
+//
+//	tx := orm.Begin()
+//	if err := tx.Create(&order).Error; err != nil {
+//		tx.Rollback()
+//		return err
+//	}
+//	return tx.Commit().Error
+//
+// Failures to start the transaction are reported in the returned instance's
+// Error.
+func (orm *MongoORM) Begin(opts ...*options.TransactionOptions) *MongoORM {
+	tx := orm.newInstance()
+	if orm.client == nil {
+		tx.AddError(ErrMissingClient)
+		return tx
+	}
+
+	session, err := orm.client.StartSession()
+	if err != nil {
+		tx.AddError(err)
+		return tx
+	}
+	if err := session.StartTransaction(opts...); err != nil {
+		session.EndSession(context.Background())
+		tx.AddError(err)
+		return tx
+	}
+
+	tx.session = session
+	tx.inSession = true
+	tx.ctx = mongo.NewSessionContext(orm.context(), session)
+	return tx
+}
+
+// Rollback aborts the current transaction and ends the session.
+func (orm *MongoORM) Rollback() *MongoORM {
+	if orm.inSession && orm.session != nil {
+		if err := orm.session.AbortTransaction(orm.context()); err != nil {
+			orm.Error = err
+		}
+		orm.session.EndSession(orm.context())
+		orm.inSession = false
+	}
+	return orm
+}
+
+// Commit commits the current transaction and ends the session.
+func (orm *MongoORM) Commit() *MongoORM {
+	if orm.inSession && orm.session != nil {
+		if err := orm.session.CommitTransaction(orm.context()); err != nil {
+			orm.Error = err
+		}
+		orm.session.EndSession(orm.context())
+		orm.inSession = false
+	}
+	return orm
+}
+
+// Transaction runs fn inside a MongoDB transaction. Every operation issued
+// through tx is part of the transaction, which is committed when fn returns
+// nil and aborted when it returns an error:
+//
+//	err := orm.Transaction(func(tx *mongorm.MongoORM) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return tx.Save(&account).Error
+//	})
+//
+// Transient transaction errors and unknown commit results are retried by the
+// driver, so fn may run more than once and should not have side effects
+// outside the database. Calling Transaction on an instance that is already
+// in a transaction runs fn within that transaction.
+func (orm *MongoORM) Transaction(fn func(tx *MongoORM) error, opts ...*options.TransactionOptions) error {
+	if orm.client == nil {
+		return ErrMissingClient
+	}
+
+	parent := orm.context()
+	if mongo.SessionFromContext(parent) != nil {
+		return fn(orm.newInstance())
+	}
+
+	session, err := orm.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(parent, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		tx := orm.newInstance()
+		tx.ctx = sessCtx
+		return nil, fn(tx)
+	}, opts...)
+	return err
+}
+
+// newInstance returns a MongoORM sharing orm's client, database and context
+// but none of its chained query state. Like the instance returned by
+// NewMongoORM, every chain started from it gets its own statement.
+func (orm *MongoORM) newInstance() *MongoORM {
+	return &MongoORM{
+		client:          orm.client,
+		database:        orm.database,
+		ctx:             orm.ctx,
+		config:          orm.config,
+		callbacks:       orm.callbacks,
+		schemas:         orm.schemas,
+		sessionLogger:   orm.sessionLogger,
+		dryRun:          orm.dryRun,
+		skipHooks:       orm.skipHooks,
+		createBatchSize: orm.createBatchSize,
+		changes:         orm.changes,
+		Statement:       &Statement{},
+		clone:           true,
+	}
+}
+
+// getInstance returns the instance a chain method should modify: orm itself
+// within a chain, or a copy with its own statement when orm is shared, so
+// that concurrent chains do not interfere. An error recorded on a shared
+// instance, such as a failed Begin, carries over.
+func (orm *MongoORM) getInstance() *MongoORM {
+	if !orm.clone {
+		return orm
+	}
+
+	tx := &MongoORM{
+		client:          orm.client,
+		database:        orm.database,
+		session:         orm.session,
+		inSession:       orm.inSession,
+		ctx:             orm.ctx,
+		config:          orm.config,
+		callbacks:       orm.callbacks,
+		schemas:         orm.schemas,
+		sessionLogger:   orm.sessionLogger,
+		dryRun:          orm.dryRun,
+		skipHooks:       orm.skipHooks,
+		createBatchSize: orm.createBatchSize,
+		changes:         orm.changes,
+		Error:           orm.Error,
+		Statement:       orm.Statement.clone(),
+	}
+	tx.Statement.failed = orm.Error != nil
+	return tx
+}
+
+// operationContext returns the context for a single operation, derived from
+// the one set with WithContext so that cancellation, deadlines and any active
+// session carry over to the driver call. A timeout set with WithTimeout
+// always applies; otherwise contexts without a deadline are bounded by the
+// configured timeout for the operation.
+func (orm *MongoORM) operationContext() (context.Context, context.CancelFunc) {
+	ctx := orm.context()
+	if orm.Statement.Timeout > 0 {
+		return context.WithTimeout(ctx, orm.Statement.Timeout)
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+
+	timeout := orm.config.timeout(orm.Statement.Operation)
+	if timeout < 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
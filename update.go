@@ -0,0 +1,346 @@
+package mongorm
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Upsert makes the next Save, Updates or UpdateMany insert a document when
+// none matches. Save and Updates insert the document with its preset ID:
+//
+//	orm.Upsert().Save(&setting)
+func (orm *MongoORM) Upsert() *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.Upsert = true
+	return tx
+}
+
+// updateOptions translates the chained state into options for updates
+// matching documents by the chained conditions.
+func (orm *MongoORM) updateOptions() *options.UpdateOptions {
+	opts := options.Update()
+	if orm.Statement.Collation != nil {
+		opts.SetCollation(orm.Statement.Collation)
+	}
+	if orm.Statement.Hint != nil {
+		opts.SetHint(orm.Statement.Hint)
+	}
+	if len(orm.Statement.ArrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: orm.Statement.ArrayFilters})
+	}
+	return opts
+}
+
+// UpdateMany applies update to every document matching the chained
+// conditions in the collection selected with Model:
+//
+//	orm.Model(&Job{}).Where("status = ?", "queued").UpdateMany(bson.M{"status": "cancelled"})
+//
+// update may be an update document using operators such as $set or $inc,
+// or a map or struct whose fields are $set. It is combined with operators
+// added by Set, Inc, Push, AddToSet, Pull and Unset, and may be nil when
+// those are used. RowsAffected reports the number
+// of modified or upserted documents and UpdateResult the matched and
+// modified counts.
+// Without conditions UpdateMany fails with ErrMissingWhereClause unless
+// Config.AllowGlobalUpdate is set.
+func (orm *MongoORM) UpdateMany(update interface{}) *MongoORM {
+	return orm.execute(opUpdate, update, func(tx *MongoORM) {
+		tx.updateMany(update)
+	})
+}
+
+// UpdateColumn sets column, a struct field or document key, to value in
+// the documents Updates would update, without running hooks such as
+// BeforeUpdate and AfterUpdate or stamping DateUpdated. It is meant for
+// maintenance writes, such as backfills and counters, that must not look
+// like changes made by users:
+//
+//	orm.Model(&user).UpdateColumn("login_count", user.LoginCount+1)
+//
+// Callbacks and plugins still run, and versioned documents are still
+// locked.
+func (orm *MongoORM) UpdateColumn(column string, value interface{}) *MongoORM {
+	key := orm.documentKey(modelType(orm.Statement.Model), column)
+	return orm.UpdateColumns(bson.M{key: value})
+}
+
+// UpdateColumns is Updates without hooks and timestamps, as for
+// UpdateColumn. values is a struct, whose fields holding zero values are
+// skipped unless given to Select, or a map:
+//
+//	orm.Model(&Order{}).Where("currency = ?", nil).
+//		UpdateColumns(map[string]interface{}{"currency": "EUR"})
+func (orm *MongoORM) UpdateColumns(values interface{}) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.UpdatingColumns = true
+	return tx.Updates(values)
+}
+
+// updateMany is the built-in step of UpdateMany.
+func (orm *MongoORM) updateMany(update interface{}) *MongoORM {
+	if orm.Error != nil {
+		return orm
+	}
+	if orm.Statement.Collection == nil {
+		orm.Error = ErrMissingModel
+		return orm
+	}
+	if len(orm.Statement.Filter) == 0 && !orm.allowGlobalUpdate() {
+		orm.Error = ErrMissingWhereClause
+		return orm
+	}
+
+	updateDoc, err := orm.buildUpdate(update)
+	if err != nil {
+		orm.Error = err
+		return orm
+	}
+	updateDoc = orm.stampUpdate(updateDoc, modelType(orm.Statement.Model), nil)
+
+	ctx, cancel := orm.operationContext()
+	defer cancel()
+
+	opts := orm.updateOptions()
+	if orm.Statement.Upsert {
+		opts.SetUpsert(true)
+	}
+
+	filter := orm.queryFilter(modelType(orm.Statement.Model))
+	orm.Statement.record(orm.Statement.Collection, "updateMany", filter, updateDoc)
+	if orm.Statement.DryRun {
+		return orm
+	}
+	result, err := orm.Statement.Collection.UpdateMany(ctx, filter, updateDoc, opts)
+	if err != nil {
+		orm.Error = translateError(err)
+		return orm
+	}
+	orm.UpdateResult = result
+	orm.RowsAffected = uint(result.ModifiedCount + result.UpsertedCount)
+	return orm
+}
+
+// Set adds a $set of field to value to the next update.
+func (orm *MongoORM) Set(field string, value interface{}) *MongoORM {
+	return orm.addUpdateOperator("$set", field, value)
+}
+
+// Inc adds an $inc of field by amount to the next update:
+//
+//	orm.Model(&post).Inc("views", 1).Push("tags", "go").Updates(nil)
+func (orm *MongoORM) Inc(field string, amount interface{}) *MongoORM {
+	return orm.addUpdateOperator("$inc", field, amount)
+}
+
+// Push adds a $push of values onto the array field to the next update. It
+// fails with ErrInvalidUpdate without values.
+func (orm *MongoORM) Push(field string, values ...interface{}) *MongoORM {
+	return orm.addEach("$push", field, values)
+}
+
+// AddToSet adds an $addToSet of values to the array field to the next
+// update, skipping values already present. It fails with ErrInvalidUpdate
+// without values.
+func (orm *MongoORM) AddToSet(field string, values ...interface{}) *MongoORM {
+	return orm.addEach("$addToSet", field, values)
+}
+
+// Pull adds a $pull removing elements equal to value, or matching it when
+// value is a condition document, from the array field to the next update.
+func (orm *MongoORM) Pull(field string, value interface{}) *MongoORM {
+	return orm.addUpdateOperator("$pull", field, value)
+}
+
+// Unset adds an $unset of fields to the next update.
+func (orm *MongoORM) Unset(fields ...string) *MongoORM {
+	tx := orm.getInstance()
+	for _, field := range fields {
+		tx.addUpdateOperator("$unset", field, "")
+	}
+	return tx
+}
+
+// ArrayFilter adds a filter selecting the array elements updated through
+// the identifier it names, written as a Where condition on that
+// identifier. Paths built with FilteredPositional refer to the elements it
+// selects:
+//
+//	orm.Model(&Order{}).Where("id = ?", id).
+//		ArrayFilter("item.sku = ? AND item.qty > ?", "X1", 0).
+//		Set(mongorm.FilteredPositional("items", "item", "status"), "shipped").
+//		UpdateMany(nil)
+//
+// Each identifier used in the update needs exactly one filter.
+func (orm *MongoORM) ArrayFilter(query string, args ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	cond, err := parseCondition(query, args...)
+	if err != nil {
+		tx.AddError(err)
+		return tx
+	}
+	tx.Statement.ArrayFilters = append(tx.Statement.ArrayFilters, cond)
+	return tx
+}
+
+// ArrayFilters adds raw array filter documents, for filters ArrayFilter
+// cannot express:
+//
+//	orm.ArrayFilters(bson.M{"item.tags": bson.M{"$all": []string{"fragile", "cold"}}})
+func (orm *MongoORM) ArrayFilters(filters ...interface{}) *MongoORM {
+	tx := orm.getInstance()
+	tx.Statement.ArrayFilters = append(tx.Statement.ArrayFilters, filters...)
+	return tx
+}
+
+// Positional returns the path of field in the first element of array
+// matched by the query, as in "items.$.status". The query must have a
+// condition on array.
+func Positional(array, field string) string {
+	return positionalPath(array, "$", field)
+}
+
+// AllPositional returns the path of field in every element of array, as in
+// "items.$[].status".
+func AllPositional(array, field string) string {
+	return positionalPath(array, "$[]", field)
+}
+
+// FilteredPositional returns the path of field in the elements of array
+// selected by the array filter on identifier, as in
+// "items.$[item].status".
+func FilteredPositional(array, identifier, field string) string {
+	return positionalPath(array, "$["+identifier+"]", field)
+}
+
+// positionalPath joins array, a positional operator and field, which may
+// be empty to designate the elements themselves.
+func positionalPath(array, operator, field string) string {
+	if field == "" {
+		return array + "." + operator
+	}
+	return array + "." + operator + "." + field
+}
+
+// addUpdateOperator records operator: {field: value} for the next update
+// issued by Updates, UpdateMany or UpdateAndGet.
+func (orm *MongoORM) addUpdateOperator(operator, field string, value interface{}) *MongoORM {
+	tx := orm.getInstance()
+	if tx.Statement.UpdateOperators == nil {
+		tx.Statement.UpdateOperators = bson.M{}
+	}
+	fields, ok := tx.Statement.UpdateOperators[operator].(bson.M)
+	if !ok {
+		fields = bson.M{}
+		tx.Statement.UpdateOperators[operator] = fields
+	}
+	fields[field] = value
+	return tx
+}
+
+// addEach records operator: {field: values} for the next update, where
+// operator is $push or $addToSet, which need at least one value.
+func (orm *MongoORM) addEach(operator, field string, values []interface{}) *MongoORM {
+	if len(values) == 0 {
+		tx := orm.getInstance()
+		tx.AddError(fmt.Errorf("%w: %s of %q expects values", ErrInvalidUpdate, operator, field))
+		return tx
+	}
+	return orm.addUpdateOperator(operator, field, each(values))
+}
+
+// each wraps several values in $each so that $push and $addToSet add them
+// individually.
+func each(values []interface{}) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return bson.M{"$each": values}
+}
+
+// buildUpdate combines update, which may be nil, with the operators added
+// by Set, Inc, Push and friends.
+func (orm *MongoORM) buildUpdate(update interface{}) (bson.M, error) {
+	doc := bson.M{}
+	if update != nil {
+		var err error
+		if doc, err = toUpdateDocument(update); err != nil {
+			return nil, err
+		}
+	}
+	doc = mergeUpdateOperators(doc, orm.Statement.UpdateOperators)
+	if len(doc) == 0 {
+		return nil, ErrEmptyUpdate
+	}
+	return doc, nil
+}
+
+// mergeUpdateOperators merges the fields of each operator in ops into
+// update, returning a new document.
+func mergeUpdateOperators(update, ops bson.M) bson.M {
+	merged := bson.M{}
+	for operator, fields := range update {
+		merged[operator] = fields
+	}
+	for operator, fields := range ops {
+		existing, err := toDocument(merged[operator])
+		if _, ok := merged[operator]; !ok || err != nil {
+			merged[operator] = fields
+			continue
+		}
+		combined := bson.M{}
+		for key, value := range existing {
+			combined[key] = value
+		}
+		for key, value := range fields.(bson.M) {
+			combined[key] = value
+		}
+		merged[operator] = combined
+	}
+	return merged
+}
+
+// toUpdateDocument turns update into an update document. Documents whose
+// keys are update operators are used as they are; anything else is
+// converted to a document and wrapped in $set.
+func toUpdateDocument(update interface{}) (bson.M, error) {
+	doc, err := toDocument(update)
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range doc {
+		if strings.HasPrefix(key, "$") {
+			return doc, nil
+		}
+	}
+	return bson.M{"$set": doc}, nil
+}
+
+func (orm *MongoORM) allowGlobalUpdate() bool {
+	return orm.config != nil && orm.config.AllowGlobalUpdate
+}
+
+// toDocument converts a map or struct into a bson.M. Struct fields are
+// encoded as the bson codec would store them.
+func toDocument(v interface{}) (bson.M, error) {
+	switch d := v.(type) {
+	case bson.M:
+		return d, nil
+	case map[string]interface{}:
+		return bson.M(d), nil
+	}
+
+	data, err := marshalDocument(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
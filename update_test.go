@@ -0,0 +1,59 @@
+package mongorm_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type post struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty"`
+	Views int                `bson:"views"`
+	Tags  []string           `bson:"tags"`
+}
+
+func TestUpdateOperators(t *testing.T) {
+	orm := mongormtest.New()
+	p := post{Tags: []string{"go"}}
+	if err := orm.Create(&p).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := orm.Model(&p).Inc("views", 2).Push("tags", "db", "orm").AddToSet("tags", "go").Updates(nil).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored post
+	if err := orm.First(&stored, p.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Views != 2 || !reflect.DeepEqual(stored.Tags, []string{"go", "db", "orm"}) {
+		t.Fatalf("stored post = %+v, want 2 views and tags go, db and orm", stored)
+	}
+
+	tx := orm.Push("tags", "a").AddToSet("labels", "b", "c")
+	want := bson.M{
+		"$push":     bson.M{"tags": "a"},
+		"$addToSet": bson.M{"labels": bson.M{"$each": []interface{}{"b", "c"}}},
+	}
+	if got := tx.Statement.UpdateOperators; !reflect.DeepEqual(got, want) {
+		t.Fatalf("update operators = %v, want %v", got, want)
+	}
+}
+
+func TestPushAndAddToSetRequireValues(t *testing.T) {
+	orm := mongormtest.New()
+	p := post{Tags: []string{"go"}}
+	if err := orm.Create(&p).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range []*mongorm.MongoORM{orm.Model(&p).Push("tags"), orm.Model(&p).AddToSet("tags")} {
+		if err := tx.Updates(nil).Error; !errors.Is(err, mongorm.ErrInvalidUpdate) {
+			t.Errorf("update without values error = %v, want ErrInvalidUpdate", err)
+		}
+	}
+}
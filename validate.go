@@ -0,0 +1,287 @@
+package mongorm
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validatable is implemented by models with rules beyond those of their
+// validate tags, which Create, Save and Updates check documents against,
+// after their Before hooks ran and before writing them:
+//
+//	type User struct {
+//		Name    string  `validate:"required,min=3,max=50"`
+//		Email   string  `validate:"required,email"`
+//		Role    string  `validate:"oneof=admin member"`
+//		Age     int     `validate:"omitempty,min=13"`
+//		Address Address // validated with the tags of Address
+//	}
+//
+// min, max and len bound numbers by value and strings, slices and maps by
+// length. omitempty skips the other rules for zero values. Fields holding
+// embedded documents are validated in turn; pointers to structs are not
+// followed, since they usually hold associated documents, which are
+// validated when they are written themselves. Updates given a struct only
+// validates the fields it writes. Failures are reported together in a
+// *ValidationError.
+//
+// Validate runs once the tags are satisfied; an error it returns aborts the
+// write and is reported in MongoORM.Error as it is, so it may be a
+// *ValidationError built by the model.
+type Validatable interface {
+	Validate() error
+}
+
+// FieldError is a validation rule a field does not satisfy.
+type FieldError struct {
+	// Field is the path of the struct field, such as "Address.City".
+	Field string
+	// Key is the document key the field is stored under.
+	Key string
+	// Rule is the failed rule, such as "required" or "min", and Param its
+	// argument, if any.
+	Rule  string
+	Param string
+}
+
+func (e FieldError) Error() string {
+	switch e.Rule {
+	case "required":
+		return e.Field + " is required"
+	case "min":
+		return e.Field + " must be at least " + e.Param
+	case "max":
+		return e.Field + " must be at most " + e.Param
+	case "len":
+		return e.Field + " must have length " + e.Param
+	case "email":
+		return e.Field + " must be a valid email address"
+	case "oneof":
+		return e.Field + " must be one of " + strings.Join(strings.Fields(e.Param), ", ")
+	}
+	return fmt.Sprintf("%s fails %s", e.Field, e.Rule)
+}
+
+// ValidationError reports the fields of a document failing their validate
+// tags. It matches ErrValidation with errors.Is.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Error()
+	}
+	return ErrValidation.Error() + ": " + strings.Join(messages, "; ")
+}
+
+// Is reports whether target is ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// fieldValidation holds the rules of a struct field, parsed from its
+// validate tag.
+type fieldValidation struct {
+	field reflect.StructField
+	key   string
+	rules []validationRule
+	// nested is set for fields holding embedded documents, whose own
+	// fields are validated in turn.
+	nested bool
+}
+
+type validationRule struct {
+	name  string
+	param string
+	// bound is the parsed param of min, max and len.
+	bound float64
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// parseValidations parses the validate tags of the fields of t, as
+// described for Validatable.
+func (orm *MongoORM) parseValidations(t reflect.Type) ([]fieldValidation, error) {
+	var validations []fieldValidation
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		v := fieldValidation{field: field, key: orm.fieldName(field)}
+		if field.Type.Kind() == reflect.Struct && field.Type != timeType && !isFileField(field) {
+			v.nested = true
+		}
+		tag := field.Tag.Get("validate")
+		if tag != "" && tag != "-" {
+			for _, option := range strings.Split(tag, ",") {
+				name, param, _ := strings.Cut(strings.TrimSpace(option), "=")
+				rule := validationRule{name: name, param: param}
+				switch name {
+				case "required", "omitempty", "email":
+				case "min", "max", "len":
+					bound, err := strconv.ParseFloat(param, 64)
+					if err != nil {
+						return nil, fmt.Errorf("invalid validate tag on %s.%s: %s needs a number", t.Name(), field.Name, name)
+					}
+					rule.bound = bound
+				case "oneof":
+					if param == "" {
+						return nil, fmt.Errorf("invalid validate tag on %s.%s: oneof needs values", t.Name(), field.Name)
+					}
+				default:
+					return nil, fmt.Errorf("invalid validate tag on %s.%s: unknown rule %q", t.Name(), field.Name, name)
+				}
+				v.rules = append(v.rules, rule)
+			}
+		}
+		if len(v.rules) > 0 || v.nested {
+			validations = append(validations, v)
+		}
+	}
+	return validations, nil
+}
+
+// validate checks doc, a document about to be written, against the
+// validate tags of its fields and its Validate method. A partial check,
+// for the fields written by Updates, skips fields holding zero values.
+// Models with invalid association declarations fail before any check.
+func (orm *MongoORM) validate(doc interface{}, partial bool) error {
+	docVal, ok := structValue(reflect.ValueOf(doc))
+	if !ok {
+		return nil
+	}
+	if err := orm.schema(docVal.Type()).associationErr; err != nil {
+		return err
+	}
+	var fieldErrs []FieldError
+	if err := orm.validateStruct(docVal, "", partial, &fieldErrs); err != nil {
+		return err
+	}
+	if len(fieldErrs) > 0 {
+		return &ValidationError{Errors: fieldErrs}
+	}
+	if validatable, ok := doc.(Validatable); ok {
+		return validatable.Validate()
+	}
+	return nil
+}
+
+// validateStruct appends to errs the failures of the fields of v, a struct,
+// whose paths are prefixed with prefix.
+func (orm *MongoORM) validateStruct(v reflect.Value, prefix string, partial bool, errs *[]FieldError) error {
+	s := orm.schema(v.Type())
+	if s.validationErr != nil {
+		return s.validationErr
+	}
+	for _, validation := range s.validations {
+		value := v.FieldByIndex(validation.field.Index)
+		if partial && value.IsZero() {
+			continue
+		}
+		path := prefix + validation.field.Name
+		if failed, ok := checkRules(value, validation.rules); !ok {
+			*errs = append(*errs, FieldError{Field: path, Key: validation.key, Rule: failed.name, Param: failed.param})
+			continue
+		}
+		if validation.nested {
+			nestedPrefix := path + "."
+			if isInline(validation.field) {
+				nestedPrefix = prefix
+			}
+			if err := orm.validateStruct(value, nestedPrefix, partial, errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkRules returns the first of rules value fails, if any.
+func checkRules(value reflect.Value, rules []validationRule) (validationRule, bool) {
+	for _, rule := range rules {
+		if rule.name == "omitempty" && value.IsZero() {
+			return validationRule{}, true
+		}
+	}
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	for _, rule := range rules {
+		ok := true
+		switch rule.name {
+		case "required":
+			ok = !value.IsZero() && !(isCollection(value) && value.Len() == 0)
+		case "min":
+			size, sized := sizeOf(value)
+			ok = !sized || size >= rule.bound
+		case "max":
+			size, sized := sizeOf(value)
+			ok = !sized || size <= rule.bound
+		case "len":
+			size, sized := sizeOf(value)
+			ok = !sized || size == rule.bound
+		case "email":
+			ok = value.Kind() != reflect.String || isEmail(value.String())
+		case "oneof":
+			// Nil pointers are left to required.
+			ok = value.Kind() == reflect.Ptr || isOneOf(value, rule.param)
+		}
+		if !ok {
+			return rule, false
+		}
+	}
+	return validationRule{}, true
+}
+
+// isOneOf reports whether value, formatted, is one of the space separated
+// options.
+func isOneOf(value reflect.Value, options string) bool {
+	for _, option := range strings.Fields(options) {
+		if fmt.Sprint(value.Interface()) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// isCollection reports whether value has a length.
+func isCollection(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return true
+	}
+	return false
+}
+
+// sizeOf returns what min, max and len bound for value: its length for
+// strings, in characters, and collections, and its value for numbers.
+func sizeOf(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+// isEmail reports whether s is a bare email address, without a display
+// name.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
@@ -0,0 +1,156 @@
+package mongorm_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type venue struct {
+	City string `bson:"city" validate:"required"`
+	Zip  string `bson:"zip" validate:"omitempty,len=5"`
+}
+
+type event struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Name     string             `bson:"name" validate:"required,min=3,max=10"`
+	Contact  string             `bson:"contact" validate:"omitempty,email"`
+	Kind     string             `bson:"kind" validate:"oneof=talk workshop"`
+	Seats    int                `bson:"seats" validate:"min=1,max=100"`
+	Tags     []string           `bson:"tags" validate:"max=2"`
+	Venue    venue              `bson:"venue"`
+	Canceled bool               `bson:"canceled"`
+}
+
+// Validate rejects canceled events with seats left.
+func (e *event) Validate() error {
+	if e.Canceled && e.Seats > 0 {
+		return errors.New("canceled events have no seats")
+	}
+	return nil
+}
+
+func validEvent() event {
+	return event{Name: "GoConf", Kind: "talk", Seats: 10, Venue: venue{City: "Pune"}}
+}
+
+func TestCreateValidatesTags(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(e *event)
+		want   []mongorm.FieldError
+	}{
+		{"valid", func(e *event) {}, nil},
+		{"valid optional fields", func(e *event) { e.Contact, e.Venue.Zip = "ann@example.com", "41100" }, nil},
+		{"required", func(e *event) { e.Name = "" }, []mongorm.FieldError{{Field: "Name", Key: "name", Rule: "required"}}},
+		{"min length", func(e *event) { e.Name = "Go" }, []mongorm.FieldError{{Field: "Name", Key: "name", Rule: "min", Param: "3"}}},
+		{"max length in characters", func(e *event) { e.Name = "ÉÉÉÉÉÉÉÉÉÉÉ" }, []mongorm.FieldError{{Field: "Name", Key: "name", Rule: "max", Param: "10"}}},
+		{"email", func(e *event) { e.Contact = "Ann <ann@example.com>" }, []mongorm.FieldError{{Field: "Contact", Key: "contact", Rule: "email"}}},
+		{"oneof", func(e *event) { e.Kind = "party" }, []mongorm.FieldError{{Field: "Kind", Key: "kind", Rule: "oneof", Param: "talk workshop"}}},
+		{"number bounds", func(e *event) { e.Seats = 101 }, []mongorm.FieldError{{Field: "Seats", Key: "seats", Rule: "max", Param: "100"}}},
+		{"slice length", func(e *event) { e.Tags = []string{"a", "b", "c"} }, []mongorm.FieldError{{Field: "Tags", Key: "tags", Rule: "max", Param: "2"}}},
+		{
+			"nested",
+			func(e *event) { e.Venue = venue{Zip: "123"} },
+			[]mongorm.FieldError{{Field: "Venue.City", Key: "city", Rule: "required"}, {Field: "Venue.Zip", Key: "zip", Rule: "len", Param: "5"}},
+		},
+		{
+			"several fields",
+			func(e *event) { e.Name, e.Seats = "", 0 },
+			[]mongorm.FieldError{{Field: "Name", Key: "name", Rule: "required"}, {Field: "Seats", Key: "seats", Rule: "min", Param: "1"}},
+		},
+	}
+	orm := mongormtest.New()
+	for _, tt := range tests {
+		e := validEvent()
+		tt.change(&e)
+		err := orm.Create(&e).Error
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: error = %v", tt.name, err)
+			}
+			continue
+		}
+		var validationErr *mongorm.ValidationError
+		if !errors.As(err, &validationErr) || !errors.Is(err, mongorm.ErrValidation) {
+			t.Errorf("%s: error = %v, want a ValidationError", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(validationErr.Errors, tt.want) {
+			t.Errorf("%s: field errors = %+v, want %+v", tt.name, validationErr.Errors, tt.want)
+		}
+	}
+
+	var n int64
+	if err := orm.Model(&event{}).Count(&n).Error; err != nil || n != 2 {
+		t.Fatalf("events = %d (%v), want the 2 valid ones", n, err)
+	}
+}
+
+func TestValidateRunsAfterTags(t *testing.T) {
+	orm := mongormtest.New()
+	e := validEvent()
+	e.Canceled = true
+	if err := orm.Create(&e).Error; err == nil || errors.Is(err, mongorm.ErrValidation) {
+		t.Fatalf("error = %v, want that of Validate", err)
+	}
+
+	e = validEvent()
+	e.Name, e.Canceled = "", true
+	var validationErr *mongorm.ValidationError
+	if err := orm.Create(&e).Error; !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want the tags checked first", err)
+	}
+}
+
+func TestSaveAndUpdatesValidate(t *testing.T) {
+	orm := mongormtest.New()
+	e := validEvent()
+	if err := orm.Create(&e).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	e.Seats = 0
+	if err := orm.Save(&e).Error; !errors.Is(err, mongorm.ErrValidation) {
+		t.Fatalf("Save error = %v, want ErrValidation", err)
+	}
+	// Updates given a struct only checks the fields it writes.
+	if err := orm.Model(&e).Updates(&event{ID: e.ID, Kind: "workshop"}).Error; err != nil {
+		t.Fatalf("Updates of a valid field error = %v", err)
+	}
+	if err := orm.Model(&e).Updates(&event{ID: e.ID, Kind: "party"}).Error; !errors.Is(err, mongorm.ErrValidation) {
+		t.Fatalf("Updates of an invalid field error = %v, want ErrValidation", err)
+	}
+
+	var stored event
+	if err := orm.First(&stored, e.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Kind != "workshop" || stored.Seats != 10 {
+		t.Fatalf("stored event = %+v, want a workshop with 10 seats", stored)
+	}
+}
+
+func TestInvalidValidateTags(t *testing.T) {
+	type unknownRule struct {
+		Name string `validate:"uppercase"`
+	}
+	type badBound struct {
+		Name string `validate:"min=three"`
+	}
+	orm := mongormtest.New()
+	for _, doc := range []interface{}{&unknownRule{Name: "a"}, &badBound{Name: "a"}} {
+		err := orm.Table("docs").Create(doc).Error
+		if err == nil || errors.Is(err, mongorm.ErrValidation) {
+			t.Errorf("Create(%T) error = %v, want an invalid tag", doc, err)
+		}
+	}
+	if err := orm.Table("docs").Create(bson.M{"name": ""}).Error; err != nil {
+		t.Fatalf("Create of a map error = %v, want maps left unchecked", err)
+	}
+}
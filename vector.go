@@ -0,0 +1,117 @@
+package mongorm
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultVectorIndex is the Atlas Vector Search index used unless another
+// is given to VectorSearch.Index.
+const DefaultVectorIndex = "vector_index"
+
+// VectorSearch builds the $vectorSearch stage of Atlas Vector Search,
+// finding the documents whose embedding is nearest to a query vector, as
+// used for semantic search and retrieval augmented generation.
+type VectorSearch struct {
+	index      string
+	path       string
+	vector     []float64
+	limit      int
+	candidates int
+	filter     bson.M
+	exact      bool
+	scoreField string
+}
+
+// NewVectorSearch returns a search for the k documents whose field, covered
+// by a vector index, is nearest to queryVector among those matching filter,
+// which may be nil and may only refer to fields indexed as filters. Their
+// similarity score is stored in "score"; see Scored.
+func NewVectorSearch(field string, queryVector []float64, k int, filter bson.M) *VectorSearch {
+	return &VectorSearch{index: DefaultVectorIndex, path: field, vector: queryVector, limit: k, filter: filter, scoreField: "score"}
+}
+
+// Index sets the vector index searched.
+func (v *VectorSearch) Index(name string) *VectorSearch {
+	v.index = name
+	return v
+}
+
+// NumCandidates sets how many nearest neighbours the approximate search
+// considers, trading speed for recall. Defaults to ten times k.
+func (v *VectorSearch) NumCandidates(n int) *VectorSearch {
+	v.candidates = n
+	return v
+}
+
+// Exact compares the query vector with every document instead of running
+// an approximate search.
+func (v *VectorSearch) Exact() *VectorSearch {
+	v.exact = true
+	return v
+}
+
+// Score stores the similarity score of each document in the field as
+// instead of "score".
+func (v *VectorSearch) Score(as string) *VectorSearch {
+	v.scoreField = as
+	return v
+}
+
+// Stages returns the $vectorSearch stage, followed by the $addFields stage
+// storing the score.
+func (v *VectorSearch) Stages() mongo.Pipeline {
+	search := bson.D{
+		{Key: "index", Value: v.index},
+		{Key: "path", Value: v.path},
+		{Key: "queryVector", Value: v.vector},
+		{Key: "limit", Value: v.limit},
+	}
+	if v.exact {
+		search = append(search, bson.E{Key: "exact", Value: true})
+	} else {
+		candidates := v.candidates
+		if candidates <= 0 {
+			candidates = 10 * v.limit
+		}
+		search = append(search, bson.E{Key: "numCandidates", Value: candidates})
+	}
+	if len(v.filter) > 0 {
+		search = append(search, bson.E{Key: "filter", Value: v.filter})
+	}
+	stages := mongo.Pipeline{{{Key: "$vectorSearch", Value: search}}}
+	if v.scoreField != "" {
+		stages = append(stages, bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: v.scoreField, Value: bson.D{{Key: "$meta", Value: "vectorSearchScore"}}},
+		}}})
+	}
+	return stages
+}
+
+// VectorSearch runs search ahead of the other stages, as Atlas requires of
+// $vectorSearch; the conditions of the chain are matched after it.
+func (p *Pipeline) VectorSearch(search *VectorSearch) *Pipeline {
+	p.stages = append(search.Stages(), p.stages...)
+	return p
+}
+
+// VectorSearch starts an aggregation pipeline on the collection selected
+// with Model, returning the k documents whose field is nearest to
+// queryVector among those matching filter, with their score:
+//
+//	var results []mongorm.Scored[Article]
+//	orm.Model(&Article{}).VectorSearch("embedding", embedding, 5, bson.M{"lang": "en"}).All(&results)
+//
+// The search uses DefaultVectorIndex; build it with NewVectorSearch and add
+// it with Pipeline.VectorSearch to choose another. Conditions of the chain
+// are matched after the search and may leave fewer than k documents.
+func (orm *MongoORM) VectorSearch(field string, queryVector []float64, k int, filter bson.M) *Pipeline {
+	return orm.Aggregate().VectorSearch(NewVectorSearch(field, queryVector, k, filter))
+}
+
+// Scored holds a document found by VectorSearch, or by an AtlasSearch
+// storing its score in "score", with that score.
+type Scored[T any] struct {
+	Document T       `bson:",inline"`
+	Score    float64 `bson:"score" json:"score"`
+}
@@ -0,0 +1,148 @@
+package mongorm
+
+import (
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Versioned adds optimistic locking to the models embedding it inline:
+//
+//	type Account struct {
+//		ID                primitive.ObjectID `bson:"_id,omitempty"`
+//		Balance           int64
+//		mongorm.Versioned `bson:",inline"`
+//	}
+//
+// A model may instead tag an integer field of its own with
+// mongorm:"version". Create stores documents with version 1. Save, and
+// Updates of a document identified by its ID, only write the document while
+// its version is still the one read, and increment it; they fail with
+// ErrStaleObject once another writer changed the document in between:
+//
+//	orm.First(&account, id)
+//	account.Balance -= 100
+//	if err := orm.Save(&account).Error; errors.Is(err, mongorm.ErrStaleObject) {
+//		// reload and retry
+//	}
+//
+// Updates of every document matching conditions increment the version
+// without checking it.
+type Versioned struct {
+	Version int64 `bson:"version" mongorm:"version"`
+}
+
+// versionField returns the integer field of t tagged mongorm:"version",
+// following inlined structs.
+func (orm *MongoORM) versionField(t reflect.Type) (reflect.StructField, bool) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	s := orm.schema(t)
+	return s.version, s.versioned
+}
+
+// parseVersionField is the uncached versionField.
+func (orm *MongoORM) parseVersionField(t reflect.Type) (reflect.StructField, bool) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isInline(field) {
+			if inner, ok := orm.parseVersionField(indirectType(field.Type)); ok {
+				inner.Index = append([]int{i}, inner.Index...)
+				return inner, true
+			}
+			continue
+		}
+		if _, ok := fieldSettings(field)["version"]; !ok || !field.IsExported() {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// lockVersion returns the version field of doc, a pointer to a struct whose
+// model uses optimistic locking, and its document key.
+func (orm *MongoORM) lockVersion(doc interface{}) (reflect.Value, string, bool) {
+	docVal := reflect.ValueOf(doc)
+	if docVal.Kind() != reflect.Ptr || docVal.IsNil() || docVal.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, "", false
+	}
+	field, ok := orm.versionField(docVal.Elem().Type())
+	if !ok {
+		return reflect.Value{}, "", false
+	}
+	value, err := docVal.Elem().FieldByIndexErr(field.Index)
+	if err != nil || !value.CanSet() {
+		return reflect.Value{}, "", false
+	}
+	return value, orm.fieldName(field), true
+}
+
+// initVersion sets the version of doc, a document about to be created, to
+// 1 unless it has one.
+func (orm *MongoORM) initVersion(doc interface{}) {
+	if version, _, ok := orm.lockVersion(doc); ok && version.Int() == 0 {
+		version.SetInt(1)
+	}
+}
+
+// versionCondition returns the condition matching the documents whose
+// version under key is current. Documents written before the model used
+// optimistic locking have no version, which matches 0.
+func versionCondition(key string, current int64) bson.M {
+	if current == 0 {
+		return bson.M{key: bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{key: current}
+}
+
+// setVersion returns update with the version under key set to version,
+// replacing any other change to it.
+func setVersion(update bson.M, key string, version interface{}) bson.M {
+	update = withoutVersion(update, key)
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+	set[key] = version
+	update["$set"] = set
+	return update
+}
+
+// incrementVersion returns update with the version under key incremented,
+// replacing any other change to it.
+func incrementVersion(update bson.M, key string) bson.M {
+	update = withoutVersion(update, key)
+	inc, _ := update["$inc"].(bson.M)
+	if inc == nil {
+		inc = bson.M{}
+	}
+	inc[key] = 1
+	update["$inc"] = inc
+	return update
+}
+
+// withoutVersion returns a copy of update whose operators leave key alone.
+func withoutVersion(update bson.M, key string) bson.M {
+	copied := bson.M{}
+	for operator, fields := range update {
+		if fields, ok := fields.(bson.M); ok {
+			fields = copyM(fields)
+			delete(fields, key)
+			if len(fields) == 0 {
+				continue
+			}
+			copied[operator] = fields
+			continue
+		}
+		copied[operator] = fields
+	}
+	return copied
+}
@@ -0,0 +1,191 @@
+package mongorm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/imkrishnaagrawal/mongorm"
+	"github.com/imkrishnaagrawal/mongorm/mongormtest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type account struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Owner             string             `bson:"owner"`
+	Balance           int64              `bson:"balance"`
+	mongorm.Versioned `bson:",inline"`
+}
+
+func TestSaveChecksVersion(t *testing.T) {
+	orm := mongormtest.New()
+	acc := account{Owner: "ann", Balance: 10}
+	if err := orm.Create(&acc).Error; err != nil {
+		t.Fatal(err)
+	}
+	if acc.Version != 1 {
+		t.Fatalf("created version = %d, want 1", acc.Version)
+	}
+
+	var stale account
+	if err := orm.First(&stale, acc.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	acc.Balance = 20
+	if err := orm.Save(&acc).Error; err != nil {
+		t.Fatal(err)
+	}
+	if acc.Version != 2 {
+		t.Fatalf("saved version = %d, want 2", acc.Version)
+	}
+	stale.Balance = 30
+	if err := orm.Save(&stale).Error; !errors.Is(err, mongorm.ErrStaleObject) {
+		t.Fatalf("stale save error = %v, want ErrStaleObject", err)
+	}
+	if stale.Version != 1 {
+		t.Fatalf("stale version = %d, want it restored to 1", stale.Version)
+	}
+}
+
+func TestFirstOrCreateInitializesVersion(t *testing.T) {
+	orm := mongormtest.New()
+	var acc account
+	if err := orm.Where("owner = ?", "ann").FirstOrCreate(&acc).Error; err != nil {
+		t.Fatal(err)
+	}
+	if acc.Version != 1 {
+		t.Fatalf("version = %d, want 1", acc.Version)
+	}
+}
+
+func TestBulkInsertInitializesVersion(t *testing.T) {
+	orm := mongormtest.New()
+	acc := account{Owner: "ann"}
+	if err := orm.Bulk().Insert(&acc).Execute().Error; err != nil {
+		t.Fatal(err)
+	}
+	var stored account
+	if err := orm.First(&stored, acc.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if acc.Version != 1 || stored.Version != 1 {
+		t.Fatalf("versions = %d and %d stored, want 1", acc.Version, stored.Version)
+	}
+}
+
+func TestBulkReplaceChecksVersion(t *testing.T) {
+	orm := mongormtest.New()
+	acc := account{Owner: "ann", Balance: 10}
+	if err := orm.Create(&acc).Error; err != nil {
+		t.Fatal(err)
+	}
+	stale := acc
+
+	acc.Balance = 20
+	if err := orm.Bulk().Replace(&acc).Execute().Error; err != nil {
+		t.Fatal(err)
+	}
+	if acc.Version != 2 {
+		t.Fatalf("replaced version = %d, want 2", acc.Version)
+	}
+
+	stale.Balance = 30
+	err := orm.Bulk().Replace(&stale).Execute().Error
+	var bulkErr *mongorm.BulkWriteError
+	if !errors.Is(err, mongorm.ErrStaleObject) || !errors.As(err, &bulkErr) || bulkErr.Items[0].Index != 0 {
+		t.Fatalf("stale replace error = %v, want ErrStaleObject for operation 0", err)
+	}
+	if stale.Version != 1 {
+		t.Fatalf("stale version = %d, want it restored to 1", stale.Version)
+	}
+	var stored account
+	if err := orm.First(&stored, acc.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Balance != 20 || stored.Version != 2 {
+		t.Fatalf("stored = %+v, want the first replacement", stored)
+	}
+}
+
+func TestBulkUpdateIncrementsVersion(t *testing.T) {
+	orm := mongormtest.New()
+	acc := account{Owner: "ann"}
+	if err := orm.Create(&acc).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := orm.Model(&account{}).Bulk().
+		Update(bson.M{"_id": acc.ID}, bson.M{"$inc": bson.M{"balance": 5}}).
+		Execute().Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored account
+	if err := orm.First(&stored, acc.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Balance != 5 || stored.Version != 2 {
+		t.Fatalf("stored = %+v, want balance 5 at version 2", stored)
+	}
+}
+
+func TestBulkStaleReplaceKeepsOrder(t *testing.T) {
+	orm := mongormtest.New()
+	acc := account{Owner: "ann", Balance: 10}
+	if err := orm.Create(&acc).Error; err != nil {
+		t.Fatal(err)
+	}
+	stale := acc
+	stale.Version = 0
+
+	for _, ordered := range []bool{true, false} {
+		before := account{Owner: "bob"}
+		after := account{Owner: "cid"}
+		stale.Balance = 30
+		err := orm.Bulk().Insert(&before).Replace(&stale).Insert(&after).Ordered(ordered).Execute().Error
+		var bulkErr *mongorm.BulkWriteError
+		if !errors.As(err, &bulkErr) || len(bulkErr.Items) != 1 || bulkErr.Items[0].Index != 1 ||
+			!errors.Is(bulkErr.Items[0], mongorm.ErrStaleObject) {
+			t.Fatalf("ordered %v: error = %v, want ErrStaleObject for operation 1", ordered, err)
+		}
+		if stale.Version != 0 {
+			t.Fatalf("ordered %v: stale version = %d, want it restored to 0", ordered, stale.Version)
+		}
+		var n int64
+		if err := orm.Model(&account{}).Where("owner = ?", "cid").Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]int64{true: 0, false: 1}[ordered]; n != want {
+			t.Fatalf("ordered %v: inserts after the stale replacement = %d, want %d", ordered, n, want)
+		}
+	}
+
+	var stored account
+	if err := orm.First(&stored, acc.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Balance != 10 || stored.Version != 1 {
+		t.Fatalf("stored = %+v, want it untouched", stored)
+	}
+}
+
+func TestBulkReplaceFollowsInsert(t *testing.T) {
+	orm := mongormtest.New()
+	acc := account{Owner: "ann"}
+	bulk := orm.Bulk().Insert(&acc)
+	replaced := acc
+	replaced.Balance = 5
+	tx := bulk.Replace(&replaced).Delete(bson.M{"owner": "bob"}).Execute()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if tx.RowsAffected != 2 || tx.BulkWriteResult.InsertedCount != 1 || tx.BulkWriteResult.MatchedCount != 1 {
+		t.Fatalf("result = %+v, want the insert and the replacement counted", tx.BulkWriteResult)
+	}
+	var stored account
+	if err := orm.First(&stored, acc.ID.Hex()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if replaced.Version != 2 || stored.Balance != 5 || stored.Version != 2 {
+		t.Fatalf("stored = %+v, want the replacement at version 2", stored)
+	}
+}
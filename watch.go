@@ -0,0 +1,182 @@
+package mongorm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChangeEvent is a change to a document of a watched collection.
+type ChangeEvent struct {
+	// OperationType is the kind of change, such as "insert", "update",
+	// "replace" or "delete".
+	OperationType string `bson:"operationType"`
+	// DocumentKey holds the _id of the changed document.
+	DocumentKey bson.M `bson:"documentKey"`
+	// FullDocument is the document as inserted or replaced, or, for
+	// updates watched with WatchOptions.FullDocument, as it is now.
+	FullDocument bson.Raw `bson:"fullDocument,omitempty"`
+	// UpdateDescription describes the fields changed by an update.
+	UpdateDescription *UpdateDescription `bson:"updateDescription,omitempty"`
+	// ClusterTime is the time of the change in the oplog.
+	ClusterTime primitive.Timestamp `bson:"clusterTime"`
+	// ResumeToken identifies the event, for resuming the stream after it.
+	ResumeToken bson.Raw `bson:"_id"`
+}
+
+// UpdateDescription lists the fields changed by an update.
+type UpdateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// Decode decodes the full document of the event into doc. It fails for
+// events without one, such as deletes.
+func (e *ChangeEvent) Decode(doc interface{}) error {
+	if len(e.FullDocument) == 0 {
+		return errors.New("change event has no full document")
+	}
+	return unmarshalDocument(e.FullDocument, doc)
+}
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Pipeline filters or reshapes the events, such as
+	// {"$match": {"operationType": "insert"}}.
+	Pipeline mongo.Pipeline
+	// FullDocument set to options.UpdateLookup includes the current
+	// document in update events.
+	FullDocument options.FullDocument
+	// ResumeToken resumes the stream after the event it identifies.
+	ResumeToken bson.Raw
+	// LoadResumeToken, when ResumeToken is nil, returns the token to resume
+	// after, such as one stored by SaveResumeToken, or nil to start with
+	// the next change.
+	LoadResumeToken func(ctx context.Context) (bson.Raw, error)
+	// SaveResumeToken is called with the token of every event the handler
+	// accepted, so that the stream may be resumed after it.
+	SaveResumeToken func(ctx context.Context, token bson.Raw) error
+	// RetryDelay is the wait before reopening a stream that failed; it
+	// defaults to one second.
+	RetryDelay time.Duration
+}
+
+// Watch subscribes to the changes of the collection of model and calls
+// handler with each of them, until the context set with WithContext is
+// done or handler returns an error, which Watch returns:
+//
+//	err := orm.WithContext(ctx).Watch(&Order{}, &mongorm.WatchOptions{
+//		Pipeline: mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": "insert"}}}},
+//	}, func(event mongorm.ChangeEvent) error {
+//		var order Order
+//		if err := event.Decode(&order); err != nil {
+//			return err
+//		}
+//		return notify(order)
+//	})
+//
+// A stream that fails is reopened after the last event handled, so that
+// no change is missed while the resume token remains in the oplog. Change
+// streams require a replica set or a sharded cluster.
+func (orm *MongoORM) Watch(model interface{}, opts *WatchOptions, handler func(event ChangeEvent) error) error {
+	if orm.client == nil {
+		return ErrMissingClient
+	}
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	ctx := orm.context()
+	collection := orm.collection(orm.determineCollectionName(model))
+
+	token := opts.ResumeToken
+	if token == nil && opts.LoadResumeToken != nil {
+		var err error
+		if token, err = opts.LoadResumeToken(ctx); err != nil {
+			return err
+		}
+	}
+	delay := opts.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	pipeline := opts.Pipeline
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+	for {
+		streamOpts := options.ChangeStream()
+		if opts.FullDocument != "" {
+			streamOpts.SetFullDocument(opts.FullDocument)
+		}
+		if token != nil {
+			streamOpts.SetResumeAfter(token)
+		}
+
+		err := orm.watch(ctx, collection, pipeline, streamOpts, func(event ChangeEvent) error {
+			if err := handler(event); err != nil {
+				return &handlerError{err}
+			}
+			token = event.ResumeToken
+			if opts.SaveResumeToken != nil {
+				if err := opts.SaveResumeToken(ctx, token); err != nil {
+					return &handlerError{err}
+				}
+			}
+			return nil
+		})
+		var handlerErr *handlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		orm.logger().Warn(ctx, "change stream on %s failed, reopening in %v: %v", collection.Name(), delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// handlerError marks an error returned by the Watch handler, which stops
+// the subscription instead of reopening the stream.
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+// watch opens one change stream on collection and calls fn with each of its
+// events, until the stream fails.
+func (orm *MongoORM) watch(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline, opts *options.ChangeStreamOptions, fn func(ChangeEvent) error) error {
+	stream, err := collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event ChangeEvent
+		if err := stream.Decode(&event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return err
+	}
+	return errors.New("change stream closed")
+}